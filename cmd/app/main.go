@@ -2,8 +2,30 @@ package main
 
 import (
 	"avito_internship/internal/app"
+	"avito_internship/internal/config"
+	"errors"
+	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := app.Migrate(config.Get(), os.Args[2:], os.Stdout); err != nil {
+				log.Fatalf("Ошибка миграции: %v", err)
+			}
+			return
+		case "reconcile":
+			err := app.Reconcile(config.Get(), os.Args[2:], os.Stdout)
+			if errors.Is(err, app.ErrBalanceMismatch) {
+				os.Exit(2)
+			}
+			if err != nil {
+				log.Fatalf("Ошибка сверки балансов: %v", err)
+			}
+			return
+		}
+	}
 	app.Run()
 }
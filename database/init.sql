@@ -1,4 +0,0 @@
-\i /migrations/000-create_tables.sql
-\i /migrations/001-create_indexes.sql
-\i /migrations/002-create_functions.sql
-\i /migrations/003-insert_items.sql
@@ -0,0 +1,9 @@
+// Package database содержит SQL-миграции схемы, встроенные в бинарник сервиса.
+package database
+
+import "embed"
+
+// Migrations - файлы миграций вида NNN-name.sql и парные им NNN-name.down.sql
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_items;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_user_item_inventory;
+
+DROP INDEX IF EXISTS idx_item_id;
+DROP INDEX IF EXISTS idx_buyer_id;
+
+DROP INDEX IF EXISTS idx_receiver_id;
+DROP INDEX IF EXISTS idx_sender_id;
+
+DROP INDEX IF EXISTS idx_username;
@@ -0,0 +1,8 @@
+DROP FUNCTION IF EXISTS get_user_send_history(INT);
+DROP FUNCTION IF EXISTS get_user_receive_history(INT);
+DROP FUNCTION IF EXISTS get_user_inventory(INT);
+DROP FUNCTION IF EXISTS get_user_balance(INT);
+DROP FUNCTION IF EXISTS register_user(VARCHAR, CHAR);
+DROP FUNCTION IF EXISTS get_user_id_password_hash(VARCHAR);
+DROP FUNCTION IF EXISTS buy_item(INT, VARCHAR, INT);
+DROP FUNCTION IF EXISTS transfer_coins(INT, VARCHAR, INT);
@@ -0,0 +1,3 @@
+DELETE FROM items WHERE name IN (
+    't-shirt', 'cup', 'book', 'pen', 'powerbank', 'hoody', 'umbrella', 'socks', 'wallet', 'pink-hoody'
+);
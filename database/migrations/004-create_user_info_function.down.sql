@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS get_user_info(INT);
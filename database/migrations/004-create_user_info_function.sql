@@ -0,0 +1,31 @@
+--Полная информация о пользователе для /api/info одним запросом в формате InfoResponse
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_build_object('user', senders.username, 'amount', transactions.amount)
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users senders ON senders.id = transactions.sender_id
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_build_object('user', receivers.username, 'amount', transactions.amount)
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users receivers ON receivers.id = transactions.receiver_id
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+DROP INDEX IF EXISTS idx_transactions_receiver_id_id;
+DROP INDEX IF EXISTS idx_transactions_sender_id_id;
@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS get_user_purchases(INT, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT);
+
+DROP INDEX IF EXISTS idx_purchases_buyer_id_id;
@@ -0,0 +1,23 @@
+--Индекс для постраничного чтения истории покупок от новых к старым
+CREATE INDEX idx_purchases_buyer_id_id ON purchases (buyer_id, id);
+
+--История покупок пользователя с фильтрами и курсором: записи с id < before_id_param, от новых к старым.
+--NULL в любом фильтре означает отсутствие фильтра.
+CREATE OR REPLACE FUNCTION get_user_purchases(user_id_param INT,
+                                              item_name_param VARCHAR(32),
+                                              from_param TIMESTAMP,
+                                              to_param TIMESTAMP,
+                                              before_id_param INT,
+                                              limit_param INT)
+    RETURNS TABLE(id INT, item_name VARCHAR(32), amount INT, unit_price INT, purchase_date TIMESTAMP) AS $$
+    SELECT purchases.id, items.name, purchases.amount, items.price, purchases.purchase_date
+    FROM purchases
+             JOIN items ON items.id = purchases.item_id
+    WHERE purchases.buyer_id = user_id_param
+      AND (item_name_param IS NULL OR items.name = item_name_param)
+      AND (from_param IS NULL OR purchases.purchase_date >= from_param)
+      AND (to_param IS NULL OR purchases.purchase_date < to_param)
+      AND (before_id_param IS NULL OR purchases.id < before_id_param)
+    ORDER BY purchases.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,67 @@
+DROP FUNCTION get_user_purchases(INT, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT);
+
+--История покупок пользователя с фильтрами и курсором: записи с id < before_id_param, от новых к старым.
+--NULL в любом фильтре означает отсутствие фильтра.
+CREATE FUNCTION get_user_purchases(user_id_param INT,
+                                   item_name_param VARCHAR(32),
+                                   from_param TIMESTAMP,
+                                   to_param TIMESTAMP,
+                                   before_id_param INT,
+                                   limit_param INT)
+    RETURNS TABLE(id INT, item_name VARCHAR(32), amount INT, unit_price INT, purchase_date TIMESTAMP) AS $$
+    SELECT purchases.id, items.name, purchases.amount, items.price, purchases.purchase_date
+    FROM purchases
+             JOIN items ON items.id = purchases.item_id
+    WHERE purchases.buyer_id = user_id_param
+      AND (item_name_param IS NULL OR items.name = item_name_param)
+      AND (from_param IS NULL OR purchases.purchase_date >= from_param)
+      AND (to_param IS NULL OR purchases.purchase_date < to_param)
+      AND (before_id_param IS NULL OR purchases.id < before_id_param)
+    ORDER BY purchases.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF user_balance < item_amount_param * item_price THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    UPDATE users
+    SET balance = balance - item_amount_param * item_price
+    WHERE id = user_id_param;
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param);
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE purchases DROP COLUMN price_estimated;
+ALTER TABLE purchases DROP COLUMN total_cost;
+ALTER TABLE purchases DROP COLUMN unit_price;
@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS place_order(INT, VARCHAR[], INT[]);
+
+DROP INDEX IF EXISTS idx_purchases_order_id;
+ALTER TABLE purchases DROP COLUMN order_id;
+
+DROP INDEX IF EXISTS idx_orders_buyer_id;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,78 @@
+--Таблица заказов: одна оплата за несколько позиций
+CREATE TABLE orders (
+    id SERIAL PRIMARY KEY,
+    order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    buyer_id INT NOT NULL REFERENCES users(id),
+    total_cost INT NOT NULL CHECK (total_cost >= 0)
+);
+
+CREATE INDEX idx_orders_buyer_id ON orders (buyer_id);
+
+--Покупки, сделанные в рамках заказа, ссылаются на него
+ALTER TABLE purchases ADD COLUMN order_id INT REFERENCES orders(id);
+
+CREATE INDEX idx_purchases_order_id ON purchases (order_id);
+
+--Оформляет заказ из нескольких позиций: все позиции оплачиваются в одной транзакции или не оплачиваются вовсе.
+--item_names_param и quantities_param - параллельные массивы названий предметов и их количества.
+CREATE OR REPLACE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[])
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    UPDATE users
+    SET balance = balance - order_total
+    WHERE id = user_id_param;
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,13 @@
+--Ключи идемпотентности мутирующих запросов. Строка сохраняется в той же транзакции, что и изменение,
+--поэтому повтор запроса с тем же ключом получает сохраненный ответ вместо повторного выполнения.
+CREATE TABLE idempotency_keys (
+    user_id INT NOT NULL REFERENCES users(id),
+    key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    response_status INT,
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
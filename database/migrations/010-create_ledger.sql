@@ -0,0 +1,355 @@
+--Журнал двойной записи. Каждое движение монет - проводка (ledger_entries) из записей по счетам
+--(ledger_postings), сумма которых равна нулю. Журнал только дополняется, а users.balance - производный кеш
+--суммы записей по счету пользователя, который обновляется триггером при каждой новой записи.
+CREATE TABLE ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('user', 'issuance', 'shop_revenue')),
+    user_id INT UNIQUE REFERENCES users(id),
+    CHECK ((kind = 'user') = (user_id IS NOT NULL))
+);
+
+--Системные счета существуют в единственном экземпляре: выпуск монет и выручка магазина
+CREATE UNIQUE INDEX idx_ledger_accounts_system ON ledger_accounts (kind) WHERE user_id IS NULL;
+
+INSERT INTO ledger_accounts (kind) VALUES ('issuance'), ('shop_revenue');
+INSERT INTO ledger_accounts (kind, user_id) SELECT 'user', id FROM users ORDER BY id;
+
+CREATE TABLE ledger_entries (
+    id SERIAL PRIMARY KEY,
+    entry_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    kind VARCHAR(32) NOT NULL,
+    transaction_id INT REFERENCES transactions(id),
+    purchase_id INT REFERENCES purchases(id)
+);
+
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries (transaction_id);
+CREATE INDEX idx_ledger_entries_purchase_id ON ledger_entries (purchase_id);
+
+--Положительная сумма увеличивает баланс счета, отрицательная уменьшает
+CREATE TABLE ledger_postings (
+    id SERIAL PRIMARY KEY,
+    entry_id INT NOT NULL REFERENCES ledger_entries(id),
+    account_id INT NOT NULL REFERENCES ledger_accounts(id),
+    amount INT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX idx_ledger_postings_entry_id ON ledger_postings (entry_id);
+CREATE INDEX idx_ledger_postings_account_id ON ledger_postings (account_id);
+
+CREATE FUNCTION ledger_user_account(user_id_param INT)
+    RETURNS INT AS $$
+    SELECT ledger_accounts.id FROM ledger_accounts WHERE ledger_accounts.user_id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION ledger_system_account(kind_param VARCHAR(16))
+    RETURNS INT AS $$
+    SELECT ledger_accounts.id FROM ledger_accounts
+    WHERE ledger_accounts.kind = kind_param AND ledger_accounts.user_id IS NULL;
+$$ LANGUAGE sql STABLE;
+
+--Записывает проводку, по которой amount_param переходит со счета from_account_param на счет to_account_param.
+--Нулевая сумма не меняет балансы, и проводка для нее не создается.
+CREATE FUNCTION post_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                  amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    new_entry_id INT;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO ledger_entries (kind, transaction_id, purchase_id)
+    VALUES (kind_param, transaction_id_param, purchase_id_param)
+    RETURNING id INTO new_entry_id;
+
+    INSERT INTO ledger_postings (entry_id, account_id, amount)
+    VALUES (new_entry_id, from_account_param, -amount_param),
+           (new_entry_id, to_account_param, amount_param);
+
+    RETURN new_entry_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Перенос существующих данных: стартовый выпуск каждому пользователю, переводы и покупки.
+--Если накопленный баланс расходится с журналом, расхождение фиксируется явной проводкой adjustment.
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN SELECT id FROM users ORDER BY id LOOP
+        PERFORM post_ledger_entry('issuance', ledger_system_account('issuance'), ledger_user_account(r.id),
+                                  1000, NULL, NULL);
+    END LOOP;
+
+    FOR r IN SELECT * FROM transactions WHERE sender_id IS NOT NULL AND receiver_id IS NOT NULL ORDER BY id LOOP
+        PERFORM post_ledger_entry('transfer', ledger_user_account(r.sender_id), ledger_user_account(r.receiver_id),
+                                  r.amount, r.id, NULL);
+    END LOOP;
+
+    FOR r IN SELECT * FROM purchases WHERE buyer_id IS NOT NULL ORDER BY id LOOP
+        PERFORM post_ledger_entry('purchase', ledger_user_account(r.buyer_id), ledger_system_account('shop_revenue'),
+                                  r.total_cost, NULL, r.id);
+    END LOOP;
+
+    FOR r IN SELECT users.id, users.balance - COALESCE(SUM(ledger_postings.amount), 0) AS difference
+             FROM users
+                      JOIN ledger_accounts ON ledger_accounts.user_id = users.id
+                      LEFT JOIN ledger_postings ON ledger_postings.account_id = ledger_accounts.id
+             GROUP BY users.id, users.balance
+             HAVING users.balance <> COALESCE(SUM(ledger_postings.amount), 0) LOOP
+        PERFORM post_ledger_entry('adjustment', ledger_system_account('issuance'), ledger_user_account(r.id),
+                                  r.difference, NULL, NULL);
+    END LOOP;
+END;
+$$;
+
+UPDATE ledger_entries SET entry_date = transactions.transaction_date
+FROM transactions
+WHERE transactions.id = ledger_entries.transaction_id AND transactions.transaction_date IS NOT NULL;
+
+UPDATE ledger_entries SET entry_date = purchases.purchase_date
+FROM purchases
+WHERE purchases.id = ledger_entries.purchase_id AND purchases.purchase_date IS NOT NULL;
+
+--Проверка баланса проводки откладывается до конца транзакции, когда записаны все ее записи
+CREATE FUNCTION check_ledger_entry_balanced()
+    RETURNS TRIGGER AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_postings WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'Проводка % не сбалансирована', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+    AFTER INSERT ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_ledger_entry_balanced();
+
+CREATE FUNCTION reject_ledger_change()
+    RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'Журнал проводок только дополняется';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_change();
+
+CREATE TRIGGER ledger_postings_append_only
+    BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_change();
+
+--Кеш баланса пользователя обновляется каждой записью по его счету
+CREATE FUNCTION apply_ledger_posting()
+    RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users
+    SET balance = users.balance + NEW.amount
+    FROM ledger_accounts
+    WHERE ledger_accounts.id = NEW.account_id AND users.id = ledger_accounts.user_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_postings_apply
+    AFTER INSERT ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION apply_ledger_posting();
+
+--Баланс нового пользователя появляется только из проводки выпуска
+ALTER TABLE users ALTER COLUMN balance SET DEFAULT 0;
+
+--Пересчитывает кеш users.balance по журналу.
+--Возвращает пользователей, у которых кеш расходился с журналом, с прежним и пересчитанным балансом.
+CREATE FUNCTION recompute_user_balances()
+    RETURNS TABLE(user_id INT, cached_balance INT, ledger_balance INT) AS $$
+    WITH ledger AS (
+        SELECT ledger_accounts.user_id, COALESCE(SUM(ledger_postings.amount), 0)::INT AS balance
+        FROM ledger_accounts
+                 LEFT JOIN ledger_postings ON ledger_postings.account_id = ledger_accounts.id
+        WHERE ledger_accounts.user_id IS NOT NULL
+        GROUP BY ledger_accounts.user_id
+    ), drifted AS (
+        SELECT users.id, users.balance AS cached, ledger.balance AS actual
+        FROM users
+                 JOIN ledger ON ledger.user_id = users.id
+        WHERE users.balance IS DISTINCT FROM ledger.balance
+        FOR UPDATE OF users
+    ), fixed AS (
+        UPDATE users SET balance = drifted.actual
+        FROM drifted
+        WHERE users.id = drifted.id
+    )
+    SELECT drifted.id, drifted.cached, drifted.actual FROM drifted ORDER BY drifted.id;
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION register_user(username_param VARCHAR(32), password_hash_param CHAR(60))
+    RETURNS INT AS $$
+DECLARE
+    user_id_param INT;
+    account_id_param INT;
+BEGIN
+    INSERT INTO users (username, password_hash, balance)
+    VALUES (username_param, password_hash_param, 0)
+    RETURNING id INTO user_id_param;
+
+    INSERT INTO ledger_accounts (kind, user_id)
+    VALUES ('user', user_id_param)
+    RETURNING id INTO account_id_param;
+
+    PERFORM post_ledger_entry('issuance', ledger_system_account('issuance'), account_id_param, 1000, NULL, NULL);
+    RETURN user_id_param;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION transfer_coins(sender_id_param INT, receiver_param VARCHAR(32), transfer_amount_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    sender_balance INT;
+    receiver_balance INT;
+    receiver_id_param INT;
+    new_transaction_id INT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM users WHERE username = receiver_param) THEN
+        RAISE EXCEPTION 'Получатель не существует: %', receiver_param;
+    END IF;
+
+    IF transfer_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма перевода должна быть > 0';
+    END IF;
+
+    SELECT id INTO receiver_id_param FROM users WHERE username = receiver_param;
+
+    IF receiver_id_param = sender_id_param THEN
+        RAISE EXCEPTION 'Нельзя переводить средства самому себе';
+    END IF;
+
+    IF sender_id_param < receiver_id_param THEN
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+    ELSE
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+    END IF;
+
+    IF sender_balance < transfer_amount_param THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    INSERT INTO transactions (sender_id, receiver_id, amount)
+    VALUES (sender_id_param, receiver_id_param, transfer_amount_param)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('transfer', ledger_user_account(sender_id_param), ledger_user_account(receiver_id_param),
+                              transfer_amount_param, new_transaction_id, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF user_balance < item_amount_param * item_price THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, item_amount_param * item_price)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              item_amount_param * item_price, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[])
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,87 @@
+DROP FUNCTION get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+--История переводов пользователя с фильтрами и курсором: записи с id < before_id_param, от новых к старым.
+--NULL в любом фильтре означает отсутствие фильтра, direction_param принимает 'sent' или 'received'.
+CREATE FUNCTION get_user_history(user_id_param INT,
+                                 direction_param VARCHAR(8),
+                                 counterparty_param VARCHAR(32),
+                                 from_param TIMESTAMP,
+                                 to_param TIMESTAMP,
+                                 min_amount_param INT,
+                                 max_amount_param INT,
+                                 before_id_param INT,
+                                 limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date
+         FROM transactions
+                  JOIN users ON users.id = transactions.receiver_id
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date
+         FROM transactions
+                  JOIN users ON users.id = transactions.sender_id
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Полная информация о пользователе для /api/info одним запросом в формате InfoResponse
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_build_object('user', senders.username, 'amount', transactions.amount)
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users senders ON senders.id = transactions.sender_id
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_build_object('user', receivers.username, 'amount', transactions.amount)
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users receivers ON receivers.id = transactions.receiver_id
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION IF EXISTS get_user(INT);
+DROP FUNCTION IF EXISTS adjust_balances(INT, VARCHAR, VARCHAR[], INT, VARCHAR);
+
+ALTER TABLE transactions DROP COLUMN admin_id;
+ALTER TABLE transactions DROP COLUMN reason;
+ALTER TABLE transactions DROP COLUMN kind;
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,170 @@
+--Роль пользователя: администраторы могут начислять и списывать монеты
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+--Вид операции в журнале переводов. Начисление (mint) не имеет отправителя, списание (clawback) - получателя;
+--для обоих сохраняются причина и администратор, выполнивший операцию.
+ALTER TABLE transactions ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'transfer'
+    CHECK (kind IN ('transfer', 'mint', 'clawback'));
+ALTER TABLE transactions ADD COLUMN reason VARCHAR(255);
+ALTER TABLE transactions ADD COLUMN admin_id INT REFERENCES users(id);
+
+--Начисление (mint) или списание (clawback) amount_param монет каждому из пользователей usernames_param
+--от имени администратора admin_id_param. Выполняется атомарно: если хотя бы один пользователь не найден
+--или при списании у него недостаточно монет, не меняется ни один баланс.
+CREATE FUNCTION adjust_balances(admin_id_param INT,
+                                kind_param VARCHAR(16),
+                                usernames_param VARCHAR(32)[],
+                                amount_param INT,
+                                reason_param VARCHAR(255))
+    RETURNS VOID AS $$
+DECLARE
+    target RECORD;
+    new_transaction_id INT;
+BEGIN
+    IF kind_param NOT IN ('mint', 'clawback') THEN
+        RAISE EXCEPTION 'Неизвестный вид операции: %', kind_param;
+    END IF;
+
+    IF amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма операции должна быть > 0';
+    END IF;
+
+    IF reason_param IS NULL OR btrim(reason_param) = '' THEN
+        RAISE EXCEPTION 'Причина операции обязательна';
+    END IF;
+
+    IF COALESCE(array_length(usernames_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Операция должна затрагивать хотя бы одного пользователя';
+    END IF;
+
+    IF (SELECT COUNT(DISTINCT username) FROM unnest(usernames_param) AS username) <> array_length(usernames_param, 1) THEN
+        RAISE EXCEPTION 'Пользователь указан в операции несколько раз';
+    END IF;
+
+    IF (SELECT COUNT(*) FROM users WHERE username = ANY (usernames_param)) <> array_length(usernames_param, 1) THEN
+        RAISE EXCEPTION 'Пользователь не существует';
+    END IF;
+
+    --Блокировки берутся в порядке id, как в transfer_coins
+    FOR target IN SELECT id, balance FROM users WHERE username = ANY (usernames_param) ORDER BY id FOR UPDATE LOOP
+        IF kind_param = 'mint' THEN
+            INSERT INTO transactions (receiver_id, amount, kind, reason, admin_id)
+            VALUES (target.id, amount_param, kind_param, reason_param, admin_id_param)
+            RETURNING id INTO new_transaction_id;
+
+            PERFORM post_ledger_entry('mint', ledger_system_account('issuance'), ledger_user_account(target.id),
+                                      amount_param, new_transaction_id, NULL);
+        ELSE
+            IF target.balance < amount_param THEN
+                RAISE EXCEPTION 'Недостаточно средств на балансе пользователя %', target.id;
+            END IF;
+
+            INSERT INTO transactions (sender_id, amount, kind, reason, admin_id)
+            VALUES (target.id, amount_param, kind_param, reason_param, admin_id_param)
+            RETURNING id INTO new_transaction_id;
+
+            PERFORM post_ledger_entry('clawback', ledger_user_account(target.id), ledger_system_account('issuance'),
+                                      amount_param, new_transaction_id, NULL);
+        END IF;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+--Имя и роль пользователя
+CREATE FUNCTION get_user(user_id_param INT)
+    RETURNS TABLE(username VARCHAR(32), role VARCHAR(16)) AS $$
+    SELECT users.username, users.role FROM users WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+--В истории переводов начисления и списания показываются с именем администратора, видом операции и причиной.
+--Для обычных переводов вид не указывается.
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', senders.username,
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', receivers.username,
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+--История переводов пользователя с фильтрами и курсором: записи с id < before_id_param, от новых к старым.
+--NULL в любом фильтре означает отсутствие фильтра, direction_param принимает 'sent' или 'received'.
+--Для начислений и списаний контрагентом считается администратор, kind равен 'mint' или 'clawback'.
+--У обычных переводов причина пустая.
+CREATE FUNCTION get_user_history(user_id_param INT,
+                                 direction_param VARCHAR(8),
+                                 counterparty_param VARCHAR(32),
+                                 from_param TIMESTAMP,
+                                 to_param TIMESTAMP,
+                                 min_amount_param INT,
+                                 max_amount_param INT,
+                                 before_id_param INT,
+                                 limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255)) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
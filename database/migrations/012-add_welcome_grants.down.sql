@@ -0,0 +1,126 @@
+CREATE OR REPLACE FUNCTION get_user_history(user_id_param INT,
+                                            direction_param VARCHAR(8),
+                                            counterparty_param VARCHAR(32),
+                                            from_param TIMESTAMP,
+                                            to_param TIMESTAMP,
+                                            min_amount_param INT,
+                                            max_amount_param INT,
+                                            before_id_param INT,
+                                            limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255)) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), users.username, transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', senders.username,
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', receivers.username,
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION IF EXISTS get_grant_campaigns();
+DROP FUNCTION IF EXISTS create_grant_campaign(INT, VARCHAR, INT, TIMESTAMP, TIMESTAMP);
+DROP FUNCTION IF EXISTS register_user(VARCHAR, CHAR, INT);
+
+CREATE FUNCTION register_user(username_param VARCHAR(32), password_hash_param CHAR(60))
+    RETURNS INT AS $$
+DECLARE
+    user_id_param INT;
+    account_id_param INT;
+BEGIN
+    INSERT INTO users (username, password_hash, balance)
+    VALUES (username_param, password_hash_param, 0)
+    RETURNING id INTO user_id_param;
+
+    INSERT INTO ledger_accounts (kind, user_id)
+    VALUES ('user', user_id_param)
+    RETURNING id INTO account_id_param;
+
+    PERFORM post_ledger_entry('issuance', ledger_system_account('issuance'), account_id_param, 1000, NULL, NULL);
+    RETURN user_id_param;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS grant_coins(INT, INT, VARCHAR, INT, VARCHAR);
+
+--Начисления снова становятся проводками без записи в истории переводов
+ALTER TABLE ledger_entries DISABLE TRIGGER ledger_entries_append_only;
+UPDATE ledger_entries SET transaction_id = NULL
+FROM transactions
+WHERE transactions.id = ledger_entries.transaction_id AND transactions.kind = 'grant';
+ALTER TABLE ledger_entries ENABLE TRIGGER ledger_entries_append_only;
+DELETE FROM transactions WHERE kind = 'grant';
+
+DROP INDEX IF EXISTS idx_transactions_campaign_receiver;
+ALTER TABLE transactions DROP COLUMN campaign_id;
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check CHECK (kind IN ('transfer', 'mint', 'clawback'));
+
+DROP TABLE IF EXISTS grant_campaigns;
+
+ALTER TABLE users DROP COLUMN registered_at;
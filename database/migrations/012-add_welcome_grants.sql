@@ -0,0 +1,262 @@
+--Дата регистрации пользователя: по ней определяется участие в кампаниях начислений
+ALTER TABLE users ADD COLUMN registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+--Для существующих пользователей датой регистрации считается их самая ранняя операция
+UPDATE users SET registered_at = first_activity.activity_date
+FROM (
+    SELECT activity.user_id, MIN(activity.activity_date) AS activity_date
+    FROM (
+        SELECT sender_id AS user_id, transaction_date AS activity_date FROM transactions
+        UNION ALL
+        SELECT receiver_id, transaction_date FROM transactions
+        UNION ALL
+        SELECT buyer_id, purchase_date FROM purchases
+        UNION ALL
+        SELECT ledger_accounts.user_id, ledger_entries.entry_date
+        FROM ledger_entries
+                 JOIN ledger_postings ON ledger_postings.entry_id = ledger_entries.id
+                 JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+    ) activity
+    WHERE activity.user_id IS NOT NULL AND activity.activity_date IS NOT NULL
+    GROUP BY activity.user_id
+) first_activity
+WHERE users.id = first_activity.user_id AND first_activity.activity_date < users.registered_at;
+
+--Кампании начислений: каждый пользователь, зарегистрированный в [starts_at, ends_at), получает amount монет
+CREATE TABLE grant_campaigns (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    amount INT NOT NULL CHECK (amount > 0),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    admin_id INT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (starts_at < ends_at)
+);
+
+--Начисление (grant) не имеет отправителя: это приветственное начисление при регистрации
+--или начисление по кампании campaign_id. По каждой кампании пользователь получает монеты один раз.
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant'));
+ALTER TABLE transactions ADD COLUMN campaign_id INT REFERENCES grant_campaigns(id);
+CREATE UNIQUE INDEX idx_transactions_campaign_receiver ON transactions (campaign_id, receiver_id)
+    WHERE campaign_id IS NOT NULL;
+
+--Стартовый баланс существующих пользователей становится явным приветственным начислением в истории.
+--Проводки issuance без ссылки на перевод связываются с новыми записями, для этого на время переноса
+--запрет изменения журнала снимается.
+ALTER TABLE ledger_entries DISABLE TRIGGER ledger_entries_append_only;
+
+DO $$
+DECLARE
+    r RECORD;
+    new_transaction_id INT;
+BEGIN
+    FOR r IN SELECT ledger_entries.id AS entry_id, users.id AS user_id, users.registered_at, ledger_postings.amount
+             FROM ledger_entries
+                      JOIN ledger_postings ON ledger_postings.entry_id = ledger_entries.id
+                      JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+                      JOIN users ON users.id = ledger_accounts.user_id
+             WHERE ledger_entries.kind = 'issuance' AND ledger_entries.transaction_id IS NULL
+             ORDER BY ledger_entries.id LOOP
+        INSERT INTO transactions (transaction_date, receiver_id, amount, kind, reason)
+        VALUES (r.registered_at, r.user_id, r.amount, 'grant', 'welcome grant')
+        RETURNING id INTO new_transaction_id;
+
+        UPDATE ledger_entries SET transaction_id = new_transaction_id WHERE id = r.entry_id;
+    END LOOP;
+END;
+$$;
+
+ALTER TABLE ledger_entries ENABLE TRIGGER ledger_entries_append_only;
+
+--Начисляет пользователю user_id_param amount_param монет из выпуска с причиной reason_param.
+--Нулевая сумма ничего не записывает.
+CREATE FUNCTION grant_coins(user_id_param INT, amount_param INT, reason_param VARCHAR(255),
+                            campaign_id_param INT, entry_kind_param VARCHAR(32))
+    RETURNS VOID AS $$
+DECLARE
+    new_transaction_id INT;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO transactions (receiver_id, amount, kind, reason, campaign_id)
+    VALUES (user_id_param, amount_param, 'grant', reason_param, campaign_id_param)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry(entry_kind_param, ledger_system_account('issuance'), ledger_user_account(user_id_param),
+                              amount_param, new_transaction_id, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION register_user(VARCHAR, CHAR);
+
+--Регистрирует пользователя со стартовым балансом starting_balance_param, который записывается в историю
+--приветственным начислением, и начисляет монеты по кампаниям, действующим в момент регистрации.
+--Блокировка grant_campaigns в режиме SHARE не мешает параллельным регистрациям, но не дает создать
+--кампанию, пока регистрация не завершена, поэтому ни один пользователь не пропускается.
+CREATE FUNCTION register_user(username_param VARCHAR(32), password_hash_param CHAR(60), starting_balance_param INT)
+    RETURNS INT AS $$
+DECLARE
+    user_id_param INT;
+    campaign RECORD;
+BEGIN
+    IF starting_balance_param < 0 THEN
+        RAISE EXCEPTION 'Стартовый баланс не может быть отрицательным';
+    END IF;
+
+    LOCK TABLE grant_campaigns IN SHARE MODE;
+
+    INSERT INTO users (username, password_hash, balance)
+    VALUES (username_param, password_hash_param, 0)
+    RETURNING id INTO user_id_param;
+
+    INSERT INTO ledger_accounts (kind, user_id) VALUES ('user', user_id_param);
+
+    PERFORM grant_coins(user_id_param, starting_balance_param, 'welcome grant', NULL, 'issuance');
+
+    FOR campaign IN SELECT * FROM grant_campaigns
+                    WHERE grant_campaigns.starts_at <= CURRENT_TIMESTAMP AND CURRENT_TIMESTAMP < grant_campaigns.ends_at
+                    ORDER BY grant_campaigns.id LOOP
+        PERFORM grant_coins(user_id_param, campaign.amount, campaign.name, campaign.id, 'grant');
+    END LOOP;
+    RETURN user_id_param;
+END;
+$$ LANGUAGE plpgsql;
+
+--Создает кампанию начислений и сразу начисляет монеты уже зарегистрированным в ее период пользователям.
+--Тем, кто зарегистрируется позже, но до окончания кампании, монеты начислит register_user.
+CREATE FUNCTION create_grant_campaign(admin_id_param INT,
+                                      name_param VARCHAR(64),
+                                      amount_param INT,
+                                      starts_at_param TIMESTAMP,
+                                      ends_at_param TIMESTAMP)
+    RETURNS TABLE(id INT, granted INT) AS $$
+DECLARE
+    new_campaign_id INT;
+    granted_count INT := 0;
+    target RECORD;
+BEGIN
+    IF amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма должна быть положительной';
+    END IF;
+    IF starts_at_param >= ends_at_param THEN
+        RAISE EXCEPTION 'Начало кампании должно быть раньше окончания';
+    END IF;
+
+    LOCK TABLE grant_campaigns IN SHARE ROW EXCLUSIVE MODE;
+
+    INSERT INTO grant_campaigns (name, amount, starts_at, ends_at, admin_id)
+    VALUES (name_param, amount_param, starts_at_param, ends_at_param, admin_id_param)
+    RETURNING grant_campaigns.id INTO new_campaign_id;
+
+    FOR target IN SELECT users.id FROM users
+                  WHERE users.registered_at >= starts_at_param AND users.registered_at < ends_at_param
+                  ORDER BY users.id LOOP
+        PERFORM grant_coins(target.id, amount_param, name_param, new_campaign_id, 'grant');
+        granted_count := granted_count + 1;
+    END LOOP;
+
+    RETURN QUERY SELECT new_campaign_id, granted_count;
+END;
+$$ LANGUAGE plpgsql;
+
+--Кампании начислений с числом пользователей, получивших по ним монеты, от новых к старым
+CREATE FUNCTION get_grant_campaigns()
+    RETURNS TABLE(id INT, name VARCHAR(64), amount INT, starts_at TIMESTAMP, ends_at TIMESTAMP, granted INT) AS $$
+    SELECT grant_campaigns.id, grant_campaigns.name, grant_campaigns.amount,
+           grant_campaigns.starts_at, grant_campaigns.ends_at,
+           (SELECT COUNT(*) FROM transactions WHERE transactions.campaign_id = grant_campaigns.id)::INT
+    FROM grant_campaigns
+    ORDER BY grant_campaigns.id DESC;
+$$ LANGUAGE sql STABLE;
+
+--Начисления (grant) показываются в истории без контрагента, с видом операции и причиной
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+--Для начислений (grant) контрагент пустой
+CREATE OR REPLACE FUNCTION get_user_history(user_id_param INT,
+                                            direction_param VARCHAR(8),
+                                            counterparty_param VARCHAR(32),
+                                            from_param TIMESTAMP,
+                                            to_param TIMESTAMP,
+                                            min_amount_param INT,
+                                            max_amount_param INT,
+                                            before_id_param INT,
+                                            limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255)) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,23 @@
+DROP FUNCTION IF EXISTS count_users_with_role(VARCHAR);
+DROP FUNCTION IF EXISTS get_allowance_runs(INT, INT);
+DROP FUNCTION IF EXISTS delete_allowance_rule(INT);
+DROP FUNCTION IF EXISTS update_allowance_rule(INT, VARCHAR, INT, VARCHAR, VARCHAR, BOOLEAN);
+DROP FUNCTION IF EXISTS create_allowance_rule(INT, VARCHAR, INT, VARCHAR, VARCHAR, BOOLEAN);
+DROP FUNCTION IF EXISTS get_allowance_rules();
+DROP FUNCTION IF EXISTS run_allowance(INT, TIMESTAMP);
+
+--Начисления по правилам остаются в журнале проводок, но пропадают из истории переводов
+ALTER TABLE ledger_entries DISABLE TRIGGER ledger_entries_append_only;
+UPDATE ledger_entries SET transaction_id = NULL
+FROM transactions
+WHERE transactions.id = ledger_entries.transaction_id AND transactions.kind = 'allowance';
+ALTER TABLE ledger_entries ENABLE TRIGGER ledger_entries_append_only;
+DELETE FROM transactions WHERE kind = 'allowance';
+
+ALTER TABLE transactions DROP COLUMN allowance_run_id;
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant'));
+
+DROP TABLE IF EXISTS allowance_runs;
+DROP TABLE IF EXISTS allowance_rules;
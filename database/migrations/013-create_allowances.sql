@@ -0,0 +1,144 @@
+--Правила регулярных начислений: amount монет по расписанию schedule (cron из пяти полей, UTC)
+--всем пользователям или только пользователям с ролью target_role
+CREATE TABLE allowance_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    amount INT NOT NULL CHECK (amount > 0),
+    schedule VARCHAR(64) NOT NULL,
+    target_role VARCHAR(16) CHECK (target_role IN ('user', 'admin')),
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    admin_id INT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--Запуски правил. Уникальность (rule_id, period) гарантирует, что за период правило выполняется один раз,
+--даже если несколько реплик запускают его одновременно. После удаления правила запуски сохраняются.
+CREATE TABLE allowance_runs (
+    id SERIAL PRIMARY KEY,
+    rule_id INT REFERENCES allowance_rules(id) ON DELETE SET NULL,
+    rule_name VARCHAR(64) NOT NULL,
+    period TIMESTAMP NOT NULL,
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    users_granted INT NOT NULL,
+    total_amount INT NOT NULL,
+    UNIQUE (rule_id, period)
+);
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant', 'allowance'));
+ALTER TABLE transactions ADD COLUMN allowance_run_id INT REFERENCES allowance_runs(id);
+
+--Выполняет правило rule_id_param за период period_param: занимает запись запуска и начисляет монеты
+--всем подходящим пользователям в одной транзакции. Если запуск за период уже занят другой репликой,
+--ждет ее завершения и ничего не возвращает.
+CREATE FUNCTION run_allowance(rule_id_param INT, period_param TIMESTAMP)
+    RETURNS TABLE(run_id INT, run_at TIMESTAMP, users_granted INT, total_amount INT) AS $$
+DECLARE
+    rule_row allowance_rules%ROWTYPE;
+    new_run_id INT;
+    new_transaction_id INT;
+    users_count INT := 0;
+    target RECORD;
+BEGIN
+    SELECT * INTO rule_row FROM allowance_rules WHERE allowance_rules.id = rule_id_param;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Правило начислений % не найдено', rule_id_param;
+    END IF;
+
+    INSERT INTO allowance_runs (rule_id, rule_name, period, users_granted, total_amount)
+    VALUES (rule_row.id, rule_row.name, period_param, 0, 0)
+    ON CONFLICT ON CONSTRAINT allowance_runs_rule_id_period_key DO NOTHING
+    RETURNING allowance_runs.id INTO new_run_id;
+    IF new_run_id IS NULL THEN
+        RETURN;
+    END IF;
+
+    FOR target IN SELECT users.id FROM users
+                  WHERE rule_row.target_role IS NULL OR users.role = rule_row.target_role
+                  ORDER BY users.id LOOP
+        INSERT INTO transactions (receiver_id, amount, kind, reason, allowance_run_id)
+        VALUES (target.id, rule_row.amount, 'allowance', rule_row.name, new_run_id)
+        RETURNING transactions.id INTO new_transaction_id;
+
+        PERFORM post_ledger_entry('allowance', ledger_system_account('issuance'), ledger_user_account(target.id),
+                                  rule_row.amount, new_transaction_id, NULL);
+        users_count := users_count + 1;
+    END LOOP;
+
+    UPDATE allowance_runs SET users_granted = users_count, total_amount = users_count * rule_row.amount
+    WHERE allowance_runs.id = new_run_id;
+
+    RETURN QUERY SELECT allowance_runs.id, allowance_runs.run_at, allowance_runs.users_granted,
+                        allowance_runs.total_amount
+                 FROM allowance_runs WHERE allowance_runs.id = new_run_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Правила начислений с периодом последнего запуска, от новых к старым
+CREATE FUNCTION get_allowance_rules()
+    RETURNS TABLE(id INT, name VARCHAR(64), amount INT, schedule VARCHAR(64), target_role VARCHAR(16),
+                  paused BOOLEAN, created_at TIMESTAMP, last_period TIMESTAMP) AS $$
+    SELECT allowance_rules.id, allowance_rules.name, allowance_rules.amount, allowance_rules.schedule,
+           COALESCE(allowance_rules.target_role, ''), allowance_rules.paused, allowance_rules.created_at,
+           (SELECT MAX(allowance_runs.period) FROM allowance_runs WHERE allowance_runs.rule_id = allowance_rules.id)
+    FROM allowance_rules
+    ORDER BY allowance_rules.id DESC;
+$$ LANGUAGE sql STABLE;
+
+--Создает правило начислений и возвращает его идентификатор и дату создания
+CREATE FUNCTION create_allowance_rule(admin_id_param INT,
+                                      name_param VARCHAR(64),
+                                      amount_param INT,
+                                      schedule_param VARCHAR(64),
+                                      target_role_param VARCHAR(16),
+                                      paused_param BOOLEAN)
+    RETURNS TABLE(id INT, created_at TIMESTAMP) AS $$
+    INSERT INTO allowance_rules (name, amount, schedule, target_role, paused, admin_id)
+    VALUES (name_param, amount_param, schedule_param, NULLIF(target_role_param, ''), paused_param, admin_id_param)
+    RETURNING allowance_rules.id, allowance_rules.created_at;
+$$ LANGUAGE sql;
+
+--Изменяет правило начислений и возвращает его дату создания и период последнего запуска.
+--Если правила нет, не возвращает строк.
+CREATE FUNCTION update_allowance_rule(rule_id_param INT,
+                                      name_param VARCHAR(64),
+                                      amount_param INT,
+                                      schedule_param VARCHAR(64),
+                                      target_role_param VARCHAR(16),
+                                      paused_param BOOLEAN)
+    RETURNS TABLE(created_at TIMESTAMP, last_period TIMESTAMP) AS $$
+    UPDATE allowance_rules
+    SET name = name_param, amount = amount_param, schedule = schedule_param,
+        target_role = NULLIF(target_role_param, ''), paused = paused_param
+    WHERE allowance_rules.id = rule_id_param
+    RETURNING allowance_rules.created_at,
+              (SELECT MAX(allowance_runs.period) FROM allowance_runs WHERE allowance_runs.rule_id = rule_id_param);
+$$ LANGUAGE sql;
+
+--Удаляет правило начислений, история его запусков сохраняется. Возвращает FALSE, если правила нет.
+CREATE FUNCTION delete_allowance_rule(rule_id_param INT)
+    RETURNS BOOLEAN AS $$
+    WITH deleted AS (
+        DELETE FROM allowance_rules WHERE allowance_rules.id = rule_id_param RETURNING allowance_rules.id
+    )
+    SELECT EXISTS (SELECT 1 FROM deleted);
+$$ LANGUAGE sql;
+
+--Запуски правила от новых к старым, не больше limit_param
+CREATE FUNCTION get_allowance_runs(rule_id_param INT, limit_param INT)
+    RETURNS TABLE(id INT, rule_name VARCHAR(64), period TIMESTAMP, run_at TIMESTAMP, users_granted INT,
+                  total_amount INT) AS $$
+    SELECT allowance_runs.id, allowance_runs.rule_name, allowance_runs.period, allowance_runs.run_at,
+           allowance_runs.users_granted, allowance_runs.total_amount
+    FROM allowance_runs
+    WHERE allowance_runs.rule_id = rule_id_param
+    ORDER BY allowance_runs.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Число пользователей с ролью role_param, пустая роль означает всех пользователей
+CREATE FUNCTION count_users_with_role(role_param VARCHAR(16))
+    RETURNS INT AS $$
+    SELECT COUNT(*)::INT FROM users WHERE role_param = '' OR users.role = role_param;
+$$ LANGUAGE sql STABLE;
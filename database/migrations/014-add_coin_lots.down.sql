@@ -0,0 +1,82 @@
+DROP FUNCTION IF EXISTS get_user_info(INT, INTERVAL, INTERVAL);
+--Начисления (grant) показываются в истории без контрагента, с видом операции и причиной
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION IF EXISTS expire_coins(TIMESTAMP);
+
+--Записывает проводку, по которой amount_param переходит со счета from_account_param на счет to_account_param.
+--Нулевая сумма не меняет балансы, и проводка для нее не создается.
+CREATE OR REPLACE FUNCTION post_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                             amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    new_entry_id INT;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO ledger_entries (kind, transaction_id, purchase_id)
+    VALUES (kind_param, transaction_id_param, purchase_id_param)
+    RETURNING id INTO new_entry_id;
+
+    INSERT INTO ledger_postings (entry_id, account_id, amount)
+    VALUES (new_entry_id, from_account_param, -amount_param),
+           (new_entry_id, to_account_param, amount_param);
+
+    RETURN new_entry_id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS take_coin_lots(INT, INT);
+
+--Сгоревшие монеты остаются в журнале проводок, но пропадают из истории переводов
+ALTER TABLE ledger_entries DISABLE TRIGGER ledger_entries_append_only;
+UPDATE ledger_entries SET transaction_id = NULL
+FROM transactions
+WHERE transactions.id = ledger_entries.transaction_id AND transactions.kind = 'expiry';
+ALTER TABLE ledger_entries ENABLE TRIGGER ledger_entries_append_only;
+DELETE FROM transactions WHERE kind = 'expiry';
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant', 'allowance'));
+
+DROP TABLE IF EXISTS coin_lots;
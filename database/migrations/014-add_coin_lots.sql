@@ -0,0 +1,189 @@
+--Партии монет: сколько монет пользователя выпущено в момент issued_at. Сумма партий пользователя равна
+--его положительному балансу. При переводе партии переходят получателю с прежней датой выпуска, поэтому
+--срок действия монет не продлевается переводом. Тратятся партии начиная со старейших.
+CREATE TABLE coin_lots (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    issued_at TIMESTAMP NOT NULL,
+    amount INT NOT NULL CHECK (amount > 0)
+);
+
+CREATE INDEX idx_coin_lots_user_id ON coin_lots (user_id, issued_at, id);
+CREATE INDEX idx_coin_lots_issued_at ON coin_lots (issued_at);
+
+--Монеты, накопленные до появления партий, считаются выпущенными в момент миграции
+INSERT INTO coin_lots (user_id, issued_at, amount)
+SELECT users.id, CURRENT_TIMESTAMP, users.balance FROM users WHERE users.balance > 0 ORDER BY users.id;
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant', 'allowance', 'expiry'));
+
+--Забирает до amount_param монет из партий пользователя, начиная со старейших, и возвращает забранные части.
+--Если партий не хватает (баланс ушел в минус), забирает все, что есть.
+CREATE FUNCTION take_coin_lots(user_id_param INT, amount_param INT)
+    RETURNS TABLE(lot_issued_at TIMESTAMP, lot_amount INT) AS $$
+DECLARE
+    lot RECORD;
+    remaining INT := amount_param;
+BEGIN
+    FOR lot IN SELECT coin_lots.id, coin_lots.issued_at, coin_lots.amount
+               FROM coin_lots
+               WHERE coin_lots.user_id = user_id_param
+               ORDER BY coin_lots.issued_at, coin_lots.id
+               FOR UPDATE LOOP
+        EXIT WHEN remaining = 0;
+        lot_issued_at := lot.issued_at;
+        lot_amount := LEAST(lot.amount, remaining);
+        IF lot_amount = lot.amount THEN
+            DELETE FROM coin_lots WHERE coin_lots.id = lot.id;
+        ELSE
+            UPDATE coin_lots SET amount = coin_lots.amount - lot_amount WHERE coin_lots.id = lot.id;
+        END IF;
+        remaining := remaining - lot_amount;
+        RETURN NEXT;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+--Проводка теперь ведет и партии монет: списание со счета пользователя забирает его старейшие партии,
+--зачисление пользователю сначала гасит его долг (отрицательный баланс), а остаток добавляет партиями.
+--Монеты от другого пользователя сохраняют дату выпуска, монеты из выпуска и магазина выпускаются сейчас.
+CREATE OR REPLACE FUNCTION post_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                             amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    new_entry_id INT;
+    from_user_id INT;
+    to_user_id INT;
+    to_debt INT := 0;
+    repaid INT;
+    remaining INT := amount_param;
+    part RECORD;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT ledger_accounts.user_id INTO from_user_id FROM ledger_accounts WHERE ledger_accounts.id = from_account_param;
+    SELECT ledger_accounts.user_id INTO to_user_id FROM ledger_accounts WHERE ledger_accounts.id = to_account_param;
+    IF to_user_id IS NOT NULL THEN
+        SELECT GREATEST(-users.balance, 0) INTO to_debt FROM users WHERE users.id = to_user_id FOR UPDATE;
+    END IF;
+    IF from_user_id IS NOT NULL THEN
+        FOR part IN SELECT * FROM take_coin_lots(from_user_id, amount_param) LOOP
+            remaining := remaining - part.lot_amount;
+            IF to_user_id IS NOT NULL THEN
+                repaid := LEAST(to_debt, part.lot_amount);
+                to_debt := to_debt - repaid;
+                IF part.lot_amount > repaid THEN
+                    INSERT INTO coin_lots (user_id, issued_at, amount)
+                    VALUES (to_user_id, part.lot_issued_at, part.lot_amount - repaid);
+                END IF;
+            END IF;
+        END LOOP;
+    END IF;
+    IF to_user_id IS NOT NULL AND remaining > to_debt THEN
+        INSERT INTO coin_lots (user_id, issued_at, amount) VALUES (to_user_id, CURRENT_TIMESTAMP, remaining - to_debt);
+    END IF;
+
+    INSERT INTO ledger_entries (kind, transaction_id, purchase_id)
+    VALUES (kind_param, transaction_id_param, purchase_id_param)
+    RETURNING id INTO new_entry_id;
+
+    INSERT INTO ledger_postings (entry_id, account_id, amount)
+    VALUES (new_entry_id, from_account_param, -amount_param),
+           (new_entry_id, to_account_param, amount_param);
+
+    RETURN new_entry_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Сжигает партии монет, выпущенные раньше cutoff_param. Каждому затронутому пользователю записывается
+--одна операция expiry в истории, монеты возвращаются на счет выпуска. Пользователи блокируются по возрастанию
+--идентификатора, поэтому одновременный запуск на нескольких репликах сжигает монеты один раз.
+CREATE FUNCTION expire_coins(cutoff_param TIMESTAMP)
+    RETURNS TABLE(users_expired INT, total_expired INT) AS $$
+DECLARE
+    target RECORD;
+    expired INT;
+    new_transaction_id INT;
+BEGIN
+    users_expired := 0;
+    total_expired := 0;
+    FOR target IN SELECT DISTINCT coin_lots.user_id FROM coin_lots
+                  WHERE coin_lots.issued_at < cutoff_param
+                  ORDER BY coin_lots.user_id LOOP
+        PERFORM 1 FROM users WHERE users.id = target.user_id FOR UPDATE;
+        SELECT COALESCE(SUM(coin_lots.amount), 0) INTO expired
+        FROM coin_lots
+        WHERE coin_lots.user_id = target.user_id AND coin_lots.issued_at < cutoff_param;
+        CONTINUE WHEN expired = 0;
+
+        INSERT INTO transactions (sender_id, receiver_id, amount, kind)
+        VALUES (target.user_id, NULL, expired, 'expiry')
+        RETURNING id INTO new_transaction_id;
+        PERFORM post_ledger_entry('expiry', ledger_user_account(target.user_id), ledger_system_account('issuance'),
+                                  expired, new_transaction_id, NULL);
+        users_expired := users_expired + 1;
+        total_expired := total_expired + expired;
+    END LOOP;
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+--В ответ /api/info добавляются монеты, которые сгорят в ближайшие expiring_window_param.
+--Нулевой expiry_period_param означает, что монеты не сгорают.
+DROP FUNCTION get_user_info(INT);
+
+CREATE FUNCTION get_user_info(user_id_param INT, expiry_period_param INTERVAL, expiring_window_param INTERVAL)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        ),
+        'expiringSoon', (
+            SELECT json_agg(json_build_object('amount', lots.amount, 'expiresAt', lots.expires_at)
+                            ORDER BY lots.expires_at)
+            FROM (
+                SELECT SUM(coin_lots.amount)::INT AS amount,
+                       (coin_lots.issued_at + expiry_period_param) AT TIME ZONE 'UTC' AS expires_at
+                FROM coin_lots
+                WHERE coin_lots.user_id = users.id
+                  AND expiry_period_param > INTERVAL '0'
+                  AND coin_lots.issued_at + expiry_period_param < CURRENT_TIMESTAMP + expiring_window_param
+                GROUP BY coin_lots.issued_at
+            ) lots
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
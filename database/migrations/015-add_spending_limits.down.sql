@@ -0,0 +1,160 @@
+DROP FUNCTION IF EXISTS delete_user_limits(VARCHAR);
+DROP FUNCTION IF EXISTS set_user_limits(INT, VARCHAR, INT, INT, INT, INT);
+DROP FUNCTION IF EXISTS get_user_limits(VARCHAR);
+DROP FUNCTION IF EXISTS place_order(INT, VARCHAR[], INT[], INT, INT, INT, INT);
+DROP FUNCTION IF EXISTS buy_item(INT, VARCHAR, INT, INT, INT, INT, INT);
+DROP FUNCTION IF EXISTS transfer_coins(INT, VARCHAR, INT, INT, INT, INT, INT);
+
+CREATE OR REPLACE FUNCTION transfer_coins(sender_id_param INT, receiver_param VARCHAR(32), transfer_amount_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    sender_balance INT;
+    receiver_balance INT;
+    receiver_id_param INT;
+    new_transaction_id INT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM users WHERE username = receiver_param) THEN
+        RAISE EXCEPTION 'Получатель не существует: %', receiver_param;
+    END IF;
+
+    IF transfer_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма перевода должна быть > 0';
+    END IF;
+
+    SELECT id INTO receiver_id_param FROM users WHERE username = receiver_param;
+
+    IF receiver_id_param = sender_id_param THEN
+        RAISE EXCEPTION 'Нельзя переводить средства самому себе';
+    END IF;
+
+    IF sender_id_param < receiver_id_param THEN
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+    ELSE
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+    END IF;
+
+    IF sender_balance < transfer_amount_param THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    INSERT INTO transactions (sender_id, receiver_id, amount)
+    VALUES (sender_id_param, receiver_id_param, transfer_amount_param)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('transfer', ledger_user_account(sender_id_param), ledger_user_account(receiver_id_param),
+                              transfer_amount_param, new_transaction_id, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF user_balance < item_amount_param * item_price THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, item_amount_param * item_price)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              item_amount_param * item_price, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[])
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS check_spending_limits(INT, INT, INT, INT, INT, INT, INT);
+DROP INDEX IF EXISTS idx_purchases_buyer_id_date;
+DROP INDEX IF EXISTS idx_transactions_sender_id_date;
+DROP TABLE IF EXISTS user_limits;
@@ -0,0 +1,303 @@
+--Лимиты трат пользователя, заданные администратором вместо лимитов из конфигурации.
+--Ноль означает отсутствие лимита.
+CREATE TABLE user_limits (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    per_transfer INT NOT NULL CHECK (per_transfer >= 0),
+    daily INT NOT NULL CHECK (daily >= 0),
+    monthly INT NOT NULL CHECK (monthly >= 0),
+    per_recipient INT NOT NULL CHECK (per_recipient >= 0),
+    admin_id INT NOT NULL REFERENCES users(id),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--Суммы трат за день и месяц считаются по дате операции
+CREATE INDEX idx_transactions_sender_id_date ON transactions (sender_id, transaction_date);
+CREATE INDEX idx_purchases_buyer_id_date ON purchases (buyer_id, purchase_date);
+
+--Проверяет, что списание amount_param не превышает лимиты пользователя: на один перевод, на сумму переводов
+--и покупок за текущие сутки и месяц (UTC) и на сумму переводов одному получателю за сутки. Для покупок
+--recipient_id_param пустой, и лимиты переводов не проверяются. Лимиты администратора для пользователя
+--заменяют переданные. Вызывается после блокировки пользователя, поэтому параллельные списания не превышают
+--лимит. При превышении выбрасывает ошибку LIM01: CONSTRAINT - название лимита с наименьшим остатком,
+--DETAIL - остаток, который еще можно потратить.
+CREATE FUNCTION check_spending_limits(user_id_param INT, recipient_id_param INT, amount_param INT,
+                                      per_transfer_limit_param INT, daily_limit_param INT,
+                                      monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    override user_limits%ROWTYPE;
+    spent INT;
+    exceeded_limit VARCHAR(16);
+    remaining INT;
+BEGIN
+    SELECT * INTO override FROM user_limits WHERE user_limits.user_id = user_id_param;
+    IF FOUND THEN
+        per_transfer_limit_param := override.per_transfer;
+        daily_limit_param := override.daily;
+        monthly_limit_param := override.monthly;
+        per_recipient_limit_param := override.per_recipient;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_transfer_limit_param > 0 THEN
+        exceeded_limit := 'per_transfer';
+        remaining := per_transfer_limit_param;
+    END IF;
+
+    IF daily_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR daily_limit_param - spent < remaining THEN
+            exceeded_limit := 'daily';
+            remaining := daily_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF monthly_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('month', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR monthly_limit_param - spent < remaining THEN
+            exceeded_limit := 'monthly';
+            remaining := monthly_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_recipient_limit_param > 0 THEN
+        SELECT COALESCE(SUM(transactions.amount), 0) INTO spent FROM transactions
+        WHERE transactions.sender_id = user_id_param AND transactions.receiver_id = recipient_id_param
+          AND transactions.kind = 'transfer'
+          AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now()));
+        IF remaining IS NULL OR per_recipient_limit_param - spent < remaining THEN
+            exceeded_limit := 'per_recipient';
+            remaining := per_recipient_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF remaining IS NOT NULL AND amount_param > remaining THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'LIM01',
+            MESSAGE = 'Превышен лимит трат: ' || exceeded_limit,
+            CONSTRAINT = exceeded_limit,
+            DETAIL = GREATEST(remaining, 0)::TEXT;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+--Перевод и покупки принимают лимиты из конфигурации
+DROP FUNCTION transfer_coins(INT, VARCHAR, INT);
+DROP FUNCTION buy_item(INT, VARCHAR, INT);
+DROP FUNCTION place_order(INT, VARCHAR[], INT[]);
+
+CREATE FUNCTION transfer_coins(sender_id_param INT, receiver_param VARCHAR(32), transfer_amount_param INT,
+                               per_transfer_limit_param INT, daily_limit_param INT,
+                               monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    sender_balance INT;
+    receiver_balance INT;
+    receiver_id_param INT;
+    new_transaction_id INT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM users WHERE username = receiver_param) THEN
+        RAISE EXCEPTION 'Получатель не существует: %', receiver_param;
+    END IF;
+
+    IF transfer_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма перевода должна быть > 0';
+    END IF;
+
+    SELECT id INTO receiver_id_param FROM users WHERE username = receiver_param;
+
+    IF receiver_id_param = sender_id_param THEN
+        RAISE EXCEPTION 'Нельзя переводить средства самому себе';
+    END IF;
+
+    IF sender_id_param < receiver_id_param THEN
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+    ELSE
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+    END IF;
+
+    IF sender_balance < transfer_amount_param THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    PERFORM check_spending_limits(sender_id_param, receiver_id_param, transfer_amount_param, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO transactions (sender_id, receiver_id, amount)
+    VALUES (sender_id_param, receiver_id_param, transfer_amount_param)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('transfer', ledger_user_account(sender_id_param), ledger_user_account(receiver_id_param),
+                              transfer_amount_param, new_transaction_id, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT,
+                         per_transfer_limit_param INT, daily_limit_param INT,
+                         monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF user_balance < item_amount_param * item_price THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, item_amount_param * item_price, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, item_amount_param * item_price)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              item_amount_param * item_price, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[],
+                            per_transfer_limit_param INT, daily_limit_param INT,
+                            monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, order_total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION get_user_limits(username_param VARCHAR(32))
+    RETURNS TABLE(user_id INT, per_transfer INT, daily INT, monthly INT, per_recipient INT) AS $$
+    SELECT users.id, user_limits.per_transfer, user_limits.daily, user_limits.monthly, user_limits.per_recipient
+    FROM users
+             LEFT JOIN user_limits ON user_limits.user_id = users.id
+    WHERE users.username = username_param;
+$$ LANGUAGE sql STABLE;
+
+--Задает лимиты пользователя от имени администратора. Возвращает FALSE, если пользователя нет.
+CREATE FUNCTION set_user_limits(admin_id_param INT, username_param VARCHAR(32), per_transfer_param INT,
+                                daily_param INT, monthly_param INT, per_recipient_param INT)
+    RETURNS BOOLEAN AS $$
+    WITH target AS (
+        SELECT users.id FROM users WHERE users.username = username_param
+    ), upserted AS (
+        INSERT INTO user_limits (user_id, per_transfer, daily, monthly, per_recipient, admin_id)
+        SELECT target.id, per_transfer_param, daily_param, monthly_param, per_recipient_param, admin_id_param
+        FROM target
+        ON CONFLICT (user_id) DO UPDATE
+            SET per_transfer = EXCLUDED.per_transfer,
+                daily = EXCLUDED.daily,
+                monthly = EXCLUDED.monthly,
+                per_recipient = EXCLUDED.per_recipient,
+                admin_id = EXCLUDED.admin_id,
+                updated_at = CURRENT_TIMESTAMP
+        RETURNING 1
+    )
+    SELECT EXISTS (SELECT 1 FROM upserted);
+$$ LANGUAGE sql;
+
+--Возвращает пользователю лимиты из конфигурации. Возвращает FALSE, если пользователя нет.
+CREATE FUNCTION delete_user_limits(username_param VARCHAR(32))
+    RETURNS BOOLEAN AS $$
+    WITH target AS (
+        SELECT users.id FROM users WHERE users.username = username_param
+    ), deleted AS (
+        DELETE FROM user_limits USING target WHERE user_limits.user_id = target.id
+    )
+    SELECT EXISTS (SELECT 1 FROM target);
+$$ LANGUAGE sql;
@@ -0,0 +1,154 @@
+DROP FUNCTION IF EXISTS get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+CREATE FUNCTION get_user_history(user_id_param INT,
+                                            direction_param VARCHAR(8),
+                                            counterparty_param VARCHAR(32),
+                                            from_param TIMESTAMP,
+                                            to_param TIMESTAMP,
+                                            min_amount_param INT,
+                                            max_amount_param INT,
+                                            before_id_param INT,
+                                            limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255)) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION IF EXISTS get_user_info(INT, INTERVAL, INTERVAL);
+
+CREATE FUNCTION get_user_info(user_id_param INT, expiry_period_param INTERVAL, expiring_window_param INTERVAL)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        ),
+        'expiringSoon', (
+            SELECT json_agg(json_build_object('amount', lots.amount, 'expiresAt', lots.expires_at)
+                            ORDER BY lots.expires_at)
+            FROM (
+                SELECT SUM(coin_lots.amount)::INT AS amount,
+                       (coin_lots.issued_at + expiry_period_param) AT TIME ZONE 'UTC' AS expires_at
+                FROM coin_lots
+                WHERE coin_lots.user_id = users.id
+                  AND expiry_period_param > INTERVAL '0'
+                  AND coin_lots.issued_at + expiry_period_param < CURRENT_TIMESTAMP + expiring_window_param
+                GROUP BY coin_lots.issued_at
+            ) lots
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION IF EXISTS transfer_coins(INT, VARCHAR, INT, INT, INT, INT, INT, VARCHAR, VARCHAR);
+
+CREATE FUNCTION transfer_coins(sender_id_param INT, receiver_param VARCHAR(32), transfer_amount_param INT,
+                               per_transfer_limit_param INT, daily_limit_param INT,
+                               monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    sender_balance INT;
+    receiver_balance INT;
+    receiver_id_param INT;
+    new_transaction_id INT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM users WHERE username = receiver_param) THEN
+        RAISE EXCEPTION 'Получатель не существует: %', receiver_param;
+    END IF;
+
+    IF transfer_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма перевода должна быть > 0';
+    END IF;
+
+    SELECT id INTO receiver_id_param FROM users WHERE username = receiver_param;
+
+    IF receiver_id_param = sender_id_param THEN
+        RAISE EXCEPTION 'Нельзя переводить средства самому себе';
+    END IF;
+
+    IF sender_id_param < receiver_id_param THEN
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+    ELSE
+        SELECT balance INTO receiver_balance FROM users WHERE id = receiver_id_param FOR UPDATE;
+        SELECT balance INTO sender_balance FROM users WHERE id = sender_id_param FOR UPDATE;
+    END IF;
+
+    IF sender_balance < transfer_amount_param THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    PERFORM check_spending_limits(sender_id_param, receiver_id_param, transfer_amount_param, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO transactions (sender_id, receiver_id, amount)
+    VALUES (sender_id_param, receiver_id_param, transfer_amount_param)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('transfer', ledger_user_account(sender_id_param), ledger_user_account(receiver_id_param),
+                              transfer_amount_param, new_transaction_id, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS category;
+ALTER TABLE transactions DROP COLUMN IF EXISTS message;
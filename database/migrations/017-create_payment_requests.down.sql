@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS close_payment_request(INT, INT, VARCHAR);
+DROP FUNCTION IF EXISTS approve_payment_request(INT, INT, INT, INT, INT, INT);
+DROP FUNCTION IF EXISTS check_payment_request_pending(payment_requests);
+DROP FUNCTION IF EXISTS get_payment_requests(INT, VARCHAR, VARCHAR, INT);
+DROP FUNCTION IF EXISTS create_payment_request(INT, VARCHAR, INT, VARCHAR, TIMESTAMP);
+DROP VIEW IF EXISTS payment_requests_view;
+DROP TABLE IF EXISTS payment_requests;
@@ -0,0 +1,176 @@
+--Запросы монет: requester_id просит payer_id перевести amount. Запрос в статусе pending
+--после expires_at считается просроченным. Одобренный запрос ссылается на выполненный перевод.
+CREATE TABLE payment_requests (
+    id SERIAL PRIMARY KEY,
+    requester_id INT NOT NULL REFERENCES users(id),
+    payer_id INT NOT NULL REFERENCES users(id),
+    amount INT NOT NULL CHECK (amount > 0),
+    note VARCHAR(200),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'declined', 'cancelled')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    transaction_id INT REFERENCES transactions(id),
+    CHECK (requester_id <> payer_id)
+);
+
+CREATE INDEX idx_payment_requests_requester_id ON payment_requests (requester_id, id);
+CREATE INDEX idx_payment_requests_payer_id ON payment_requests (payer_id, id);
+
+--Запросы монет в том виде, в котором их видят пользователи: имена участников и статус с учетом срока
+CREATE VIEW payment_requests_view AS
+SELECT payment_requests.id,
+       payment_requests.requester_id,
+       requesters.username AS requester,
+       payment_requests.payer_id,
+       payers.username AS payer,
+       payment_requests.amount,
+       COALESCE(payment_requests.note, '')::VARCHAR(200) AS note,
+       (CASE
+            WHEN payment_requests.status = 'pending' AND payment_requests.expires_at <= LOCALTIMESTAMP
+                THEN 'expired'
+            ELSE payment_requests.status
+        END)::VARCHAR(16) AS status,
+       payment_requests.created_at,
+       payment_requests.expires_at,
+       payment_requests.resolved_at
+FROM payment_requests
+         JOIN users requesters ON requesters.id = payment_requests.requester_id
+         JOIN users payers ON payers.id = payment_requests.payer_id;
+
+--Создает запрос монет у пользователя payer_param. Если плательщика нет, ничего не возвращает.
+CREATE FUNCTION create_payment_request(requester_id_param INT, payer_param VARCHAR(32), amount_param INT,
+                                       note_param VARCHAR(200), expires_at_param TIMESTAMP)
+    RETURNS SETOF payment_requests_view AS $$
+DECLARE
+    payer_id_param INT;
+    new_request_id INT;
+BEGIN
+    SELECT users.id INTO payer_id_param FROM users WHERE users.username = payer_param;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF payer_id_param = requester_id_param THEN
+        RAISE EXCEPTION 'Нельзя запросить монеты у самого себя';
+    END IF;
+
+    INSERT INTO payment_requests (requester_id, payer_id, amount, note, expires_at)
+    VALUES (requester_id_param, payer_id_param, amount_param, note_param, expires_at_param)
+    RETURNING id INTO new_request_id;
+
+    RETURN QUERY SELECT * FROM payment_requests_view WHERE payment_requests_view.id = new_request_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Возвращает входящие (incoming) или исходящие (outgoing) запросы пользователя от новых к старым.
+--Пустой status_param означает все статусы.
+CREATE FUNCTION get_payment_requests(user_id_param INT, direction_param VARCHAR(8), status_param VARCHAR(16),
+                                     limit_param INT)
+    RETURNS SETOF payment_requests_view AS $$
+    SELECT * FROM payment_requests_view
+    WHERE CASE direction_param
+              WHEN 'incoming' THEN payment_requests_view.payer_id = user_id_param
+              ELSE payment_requests_view.requester_id = user_id_param
+          END
+      AND (status_param IS NULL OR payment_requests_view.status = status_param)
+    ORDER BY payment_requests_view.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Проверяет, что запрос можно закрыть: он в статусе pending (иначе ошибка PRQ01) и не просрочен (PRQ02)
+CREATE FUNCTION check_payment_request_pending(request payment_requests)
+    RETURNS VOID AS $$
+BEGIN
+    IF request.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'PRQ01',
+            MESSAGE = 'Запрос монет уже закрыт: ' || request.status;
+    END IF;
+
+    IF request.expires_at <= LOCALTIMESTAMP THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'PRQ02',
+            MESSAGE = 'Срок запроса монет истек';
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+--Одобряет запрос плательщиком payer_id_param: в одной транзакции переводит монеты запросившему
+--с примечанием запроса в качестве сообщения и закрывает запрос. Пользователи блокируются в порядке
+--идентификаторов, как в transfer_coins. Если средств не хватает, выбрасывает ошибку PRQ03, и запрос
+--остается открытым. Если запроса нет или пользователь не плательщик, ничего не возвращает.
+CREATE FUNCTION approve_payment_request(payer_id_param INT, request_id_param INT,
+                                        per_transfer_limit_param INT, daily_limit_param INT,
+                                        monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS SETOF payment_requests_view AS $$
+DECLARE
+    request payment_requests%ROWTYPE;
+    payer_balance INT;
+    new_transaction_id INT;
+BEGIN
+    SELECT * INTO request FROM payment_requests
+    WHERE payment_requests.id = request_id_param AND payment_requests.payer_id = payer_id_param
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    PERFORM check_payment_request_pending(request);
+
+    PERFORM 1 FROM users WHERE users.id IN (request.requester_id, request.payer_id) ORDER BY users.id FOR UPDATE;
+    SELECT users.balance INTO payer_balance FROM users WHERE users.id = request.payer_id;
+
+    IF payer_balance < request.amount THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'PRQ03',
+            MESSAGE = 'Недостаточно средств на балансе плательщика';
+    END IF;
+
+    PERFORM check_spending_limits(request.payer_id, request.requester_id, request.amount, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO transactions (sender_id, receiver_id, amount, message)
+    VALUES (request.payer_id, request.requester_id, request.amount, request.note)
+    RETURNING id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('transfer', ledger_user_account(request.payer_id),
+                              ledger_user_account(request.requester_id), request.amount, new_transaction_id, NULL);
+
+    UPDATE payment_requests
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, transaction_id = new_transaction_id
+    WHERE payment_requests.id = request.id;
+
+    RETURN QUERY SELECT * FROM payment_requests_view WHERE payment_requests_view.id = request.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Закрывает запрос без перевода: отклоняет его плательщик (declined) или отменяет запросивший (cancelled).
+--Если запроса нет или пользователь не та сторона запроса, ничего не возвращает.
+CREATE FUNCTION close_payment_request(user_id_param INT, request_id_param INT, status_param VARCHAR(16))
+    RETURNS SETOF payment_requests_view AS $$
+DECLARE
+    request payment_requests%ROWTYPE;
+BEGIN
+    SELECT * INTO request FROM payment_requests
+    WHERE payment_requests.id = request_id_param
+      AND CASE status_param
+              WHEN 'declined' THEN payment_requests.payer_id = user_id_param
+              WHEN 'cancelled' THEN payment_requests.requester_id = user_id_param
+              ELSE FALSE
+          END
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    PERFORM check_payment_request_pending(request);
+
+    UPDATE payment_requests
+    SET status = status_param, resolved_at = CURRENT_TIMESTAMP
+    WHERE payment_requests.id = request.id;
+
+    RETURN QUERY SELECT * FROM payment_requests_view WHERE payment_requests_view.id = request.id;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,133 @@
+DROP FUNCTION IF EXISTS settle_pending_transfers();
+DROP FUNCTION IF EXISTS cancel_pending_transfer(INT, INT);
+DROP FUNCTION IF EXISTS get_pending_transfers(INT, INT);
+DROP FUNCTION IF EXISTS release_pending_transfer(INT, INT, INT, VARCHAR, INT);
+DROP FUNCTION IF EXISTS hold_transfer(INT, VARCHAR, INT, INT, INT, INT, INT, VARCHAR, VARCHAR, INTERVAL);
+DROP VIEW IF EXISTS pending_transfers_view;
+DROP TABLE IF EXISTS pending_transfer_lots;
+DROP TABLE IF EXISTS pending_transfers;
+
+CREATE OR REPLACE FUNCTION check_spending_limits(user_id_param INT, recipient_id_param INT, amount_param INT,
+                                                 per_transfer_limit_param INT, daily_limit_param INT,
+                                                 monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    override user_limits%ROWTYPE;
+    spent INT;
+    exceeded_limit VARCHAR(16);
+    remaining INT;
+BEGIN
+    SELECT * INTO override FROM user_limits WHERE user_limits.user_id = user_id_param;
+    IF FOUND THEN
+        per_transfer_limit_param := override.per_transfer;
+        daily_limit_param := override.daily;
+        monthly_limit_param := override.monthly;
+        per_recipient_limit_param := override.per_recipient;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_transfer_limit_param > 0 THEN
+        exceeded_limit := 'per_transfer';
+        remaining := per_transfer_limit_param;
+    END IF;
+
+    IF daily_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR daily_limit_param - spent < remaining THEN
+            exceeded_limit := 'daily';
+            remaining := daily_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF monthly_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('month', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR monthly_limit_param - spent < remaining THEN
+            exceeded_limit := 'monthly';
+            remaining := monthly_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_recipient_limit_param > 0 THEN
+        SELECT COALESCE(SUM(transactions.amount), 0) INTO spent FROM transactions
+        WHERE transactions.sender_id = user_id_param AND transactions.receiver_id = recipient_id_param
+          AND transactions.kind = 'transfer'
+          AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now()));
+        IF remaining IS NULL OR per_recipient_limit_param - spent < remaining THEN
+            exceeded_limit := 'per_recipient';
+            remaining := per_recipient_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF remaining IS NOT NULL AND amount_param > remaining THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'LIM01',
+            MESSAGE = 'Превышен лимит трат: ' || exceeded_limit,
+            CONSTRAINT = exceeded_limit,
+            DETAIL = GREATEST(remaining, 0)::TEXT;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION post_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                             amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    new_entry_id INT;
+    from_user_id INT;
+    to_user_id INT;
+    to_debt INT := 0;
+    repaid INT;
+    remaining INT := amount_param;
+    part RECORD;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT ledger_accounts.user_id INTO from_user_id FROM ledger_accounts WHERE ledger_accounts.id = from_account_param;
+    SELECT ledger_accounts.user_id INTO to_user_id FROM ledger_accounts WHERE ledger_accounts.id = to_account_param;
+    IF to_user_id IS NOT NULL THEN
+        SELECT GREATEST(-users.balance, 0) INTO to_debt FROM users WHERE users.id = to_user_id FOR UPDATE;
+    END IF;
+    IF from_user_id IS NOT NULL THEN
+        FOR part IN SELECT * FROM take_coin_lots(from_user_id, amount_param) LOOP
+            remaining := remaining - part.lot_amount;
+            IF to_user_id IS NOT NULL THEN
+                repaid := LEAST(to_debt, part.lot_amount);
+                to_debt := to_debt - repaid;
+                IF part.lot_amount > repaid THEN
+                    INSERT INTO coin_lots (user_id, issued_at, amount)
+                    VALUES (to_user_id, part.lot_issued_at, part.lot_amount - repaid);
+                END IF;
+            END IF;
+        END LOOP;
+    END IF;
+    IF to_user_id IS NOT NULL AND remaining > to_debt THEN
+        INSERT INTO coin_lots (user_id, issued_at, amount) VALUES (to_user_id, CURRENT_TIMESTAMP, remaining - to_debt);
+    END IF;
+
+    INSERT INTO ledger_entries (kind, transaction_id, purchase_id)
+    VALUES (kind_param, transaction_id_param, purchase_id_param)
+    RETURNING id INTO new_entry_id;
+
+    INSERT INTO ledger_postings (entry_id, account_id, amount)
+    VALUES (new_entry_id, from_account_param, -amount_param),
+           (new_entry_id, to_account_param, amount_param);
+
+    RETURN new_entry_id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS record_ledger_entry(VARCHAR, INT, INT, INT, INT, INT);
+--Счет escrow и его вид остаются: журнал проводок только дописывается, и на счет могут ссылаться проводки
@@ -0,0 +1,355 @@
+--Отложенные переводы резервируются на системном счете escrow до зачисления получателю или отмены
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_kind_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_kind_check
+    CHECK (kind IN ('user', 'issuance', 'shop_revenue', 'escrow'));
+INSERT INTO ledger_accounts (kind) VALUES ('escrow');
+
+--Отложенные переводы: монеты списаны у sender_id в резерв и поступят receiver_id в settle_at,
+--если отправитель не отменит перевод раньше. Зачисленный перевод ссылается на запись в transactions.
+CREATE TABLE pending_transfers (
+    id SERIAL PRIMARY KEY,
+    sender_id INT NOT NULL REFERENCES users(id),
+    receiver_id INT NOT NULL REFERENCES users(id),
+    amount INT NOT NULL CHECK (amount > 0),
+    message VARCHAR(200),
+    category VARCHAR(16) CHECK (category IN ('thanks', 'reimbursement', 'gift')),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'settled', 'cancelled')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    settle_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    transaction_id INT REFERENCES transactions(id),
+    CHECK (sender_id <> receiver_id)
+);
+
+CREATE INDEX idx_pending_transfers_sender_id ON pending_transfers (sender_id, id);
+CREATE INDEX idx_pending_transfers_settle_at ON pending_transfers (settle_at) WHERE status = 'pending';
+
+--Партии монет в резерве отложенного перевода. При зачислении или отмене они возвращаются в coin_lots
+--с прежней датой выпуска, поэтому резерв не продлевает срок действия монет.
+CREATE TABLE pending_transfer_lots (
+    pending_transfer_id INT NOT NULL REFERENCES pending_transfers(id),
+    issued_at TIMESTAMP NOT NULL,
+    amount INT NOT NULL CHECK (amount > 0)
+);
+
+CREATE INDEX idx_pending_transfer_lots_pending_transfer_id ON pending_transfer_lots (pending_transfer_id, issued_at);
+
+--Отложенные переводы в том виде, в котором их видит отправитель
+CREATE VIEW pending_transfers_view AS
+SELECT pending_transfers.id,
+       pending_transfers.sender_id,
+       receivers.username AS to_user,
+       pending_transfers.amount,
+       COALESCE(pending_transfers.message, '')::VARCHAR(200) AS message,
+       COALESCE(pending_transfers.category, '')::VARCHAR(16) AS category,
+       pending_transfers.status,
+       pending_transfers.created_at,
+       pending_transfers.settle_at,
+       pending_transfers.resolved_at
+FROM pending_transfers
+         JOIN users receivers ON receivers.id = pending_transfers.receiver_id;
+
+--Записывает проводку без движения партий монет. Нулевая сумма проводку не создает.
+CREATE FUNCTION record_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                    amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    new_entry_id INT;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO ledger_entries (kind, transaction_id, purchase_id)
+    VALUES (kind_param, transaction_id_param, purchase_id_param)
+    RETURNING id INTO new_entry_id;
+
+    INSERT INTO ledger_postings (entry_id, account_id, amount)
+    VALUES (new_entry_id, from_account_param, -amount_param),
+           (new_entry_id, to_account_param, amount_param);
+
+    RETURN new_entry_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Проводка переносит партии монет как раньше, а саму проводку записывает record_ledger_entry
+CREATE OR REPLACE FUNCTION post_ledger_entry(kind_param VARCHAR(32), from_account_param INT, to_account_param INT,
+                                             amount_param INT, transaction_id_param INT, purchase_id_param INT)
+    RETURNS INT AS $$
+DECLARE
+    from_user_id INT;
+    to_user_id INT;
+    to_debt INT := 0;
+    repaid INT;
+    remaining INT := amount_param;
+    part RECORD;
+BEGIN
+    IF amount_param = 0 THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT ledger_accounts.user_id INTO from_user_id FROM ledger_accounts WHERE ledger_accounts.id = from_account_param;
+    SELECT ledger_accounts.user_id INTO to_user_id FROM ledger_accounts WHERE ledger_accounts.id = to_account_param;
+    IF to_user_id IS NOT NULL THEN
+        SELECT GREATEST(-users.balance, 0) INTO to_debt FROM users WHERE users.id = to_user_id FOR UPDATE;
+    END IF;
+    IF from_user_id IS NOT NULL THEN
+        FOR part IN SELECT * FROM take_coin_lots(from_user_id, amount_param) LOOP
+            remaining := remaining - part.lot_amount;
+            IF to_user_id IS NOT NULL THEN
+                repaid := LEAST(to_debt, part.lot_amount);
+                to_debt := to_debt - repaid;
+                IF part.lot_amount > repaid THEN
+                    INSERT INTO coin_lots (user_id, issued_at, amount)
+                    VALUES (to_user_id, part.lot_issued_at, part.lot_amount - repaid);
+                END IF;
+            END IF;
+        END LOOP;
+    END IF;
+    IF to_user_id IS NOT NULL AND remaining > to_debt THEN
+        INSERT INTO coin_lots (user_id, issued_at, amount) VALUES (to_user_id, CURRENT_TIMESTAMP, remaining - to_debt);
+    END IF;
+
+    RETURN record_ledger_entry(kind_param, from_account_param, to_account_param, amount_param,
+                               transaction_id_param, purchase_id_param);
+END;
+$$ LANGUAGE plpgsql;
+
+--Резерв отложенных переводов в статусе pending считается потраченным в момент создания перевода
+CREATE OR REPLACE FUNCTION check_spending_limits(user_id_param INT, recipient_id_param INT, amount_param INT,
+                                                 per_transfer_limit_param INT, daily_limit_param INT,
+                                                 monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    override user_limits%ROWTYPE;
+    spent INT;
+    exceeded_limit VARCHAR(16);
+    remaining INT;
+BEGIN
+    SELECT * INTO override FROM user_limits WHERE user_limits.user_id = user_id_param;
+    IF FOUND THEN
+        per_transfer_limit_param := override.per_transfer;
+        daily_limit_param := override.daily;
+        monthly_limit_param := override.monthly;
+        per_recipient_limit_param := override.per_recipient;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_transfer_limit_param > 0 THEN
+        exceeded_limit := 'per_transfer';
+        remaining := per_transfer_limit_param;
+    END IF;
+
+    IF daily_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR daily_limit_param - spent < remaining THEN
+            exceeded_limit := 'daily';
+            remaining := daily_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF monthly_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('month', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR monthly_limit_param - spent < remaining THEN
+            exceeded_limit := 'monthly';
+            remaining := monthly_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_recipient_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.receiver_id = recipient_id_param
+                  AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param
+                  AND pending_transfers.receiver_id = recipient_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR per_recipient_limit_param - spent < remaining THEN
+            exceeded_limit := 'per_recipient';
+            remaining := per_recipient_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF remaining IS NOT NULL AND amount_param > remaining THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'LIM01',
+            MESSAGE = 'Превышен лимит трат: ' || exceeded_limit,
+            CONSTRAINT = exceeded_limit,
+            DETAIL = GREATEST(remaining, 0)::TEXT;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+--Создает отложенный перевод: проверки те же, что в transfer_coins, но монеты списываются у отправителя
+--в резерв escrow вместе с партиями, а получатель их пока не видит. Блокируется только отправитель,
+--поэтому одновременные траты видят уменьшенный баланс. Если получателя нет, выбрасывает ошибку.
+CREATE FUNCTION hold_transfer(sender_id_param INT, receiver_param VARCHAR(32), transfer_amount_param INT,
+                              per_transfer_limit_param INT, daily_limit_param INT,
+                              monthly_limit_param INT, per_recipient_limit_param INT,
+                              message_param VARCHAR(200), category_param VARCHAR(16), delay_param INTERVAL)
+    RETURNS SETOF pending_transfers_view AS $$
+DECLARE
+    sender_balance INT;
+    receiver_id_param INT;
+    new_pending_transfer_id INT;
+BEGIN
+    SELECT users.id INTO receiver_id_param FROM users WHERE users.username = receiver_param;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Получатель не существует: %', receiver_param;
+    END IF;
+
+    IF transfer_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Сумма перевода должна быть > 0';
+    END IF;
+
+    IF receiver_id_param = sender_id_param THEN
+        RAISE EXCEPTION 'Нельзя переводить средства самому себе';
+    END IF;
+
+    SELECT users.balance INTO sender_balance FROM users WHERE users.id = sender_id_param FOR UPDATE;
+
+    IF sender_balance < transfer_amount_param THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    PERFORM check_spending_limits(sender_id_param, receiver_id_param, transfer_amount_param, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO pending_transfers (sender_id, receiver_id, amount, message, category, settle_at)
+    VALUES (sender_id_param, receiver_id_param, transfer_amount_param, message_param, category_param,
+            LOCALTIMESTAMP + delay_param)
+    RETURNING id INTO new_pending_transfer_id;
+
+    INSERT INTO pending_transfer_lots (pending_transfer_id, issued_at, amount)
+    SELECT new_pending_transfer_id, lots.lot_issued_at, lots.lot_amount
+    FROM take_coin_lots(sender_id_param, transfer_amount_param) lots;
+
+    PERFORM record_ledger_entry('transfer_hold', ledger_user_account(sender_id_param), ledger_system_account('escrow'),
+                                transfer_amount_param, NULL, NULL);
+
+    RETURN QUERY SELECT * FROM pending_transfers_view WHERE pending_transfers_view.id = new_pending_transfer_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Возвращает резерв отложенного перевода со счета escrow пользователю user_id_param проводкой kind_param.
+--Как и в post_ledger_entry, зачисление сначала гасит долг пользователя, а остаток партий возвращается
+--в coin_lots с прежней датой выпуска.
+CREATE FUNCTION release_pending_transfer(pending_transfer_id_param INT, user_id_param INT, amount_param INT,
+                                         kind_param VARCHAR(32), transaction_id_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    debt INT;
+    repaid INT;
+    remaining INT := amount_param;
+    lot RECORD;
+BEGIN
+    SELECT GREATEST(-users.balance, 0) INTO debt FROM users WHERE users.id = user_id_param FOR UPDATE;
+    FOR lot IN SELECT pending_transfer_lots.issued_at, pending_transfer_lots.amount
+               FROM pending_transfer_lots
+               WHERE pending_transfer_lots.pending_transfer_id = pending_transfer_id_param
+               ORDER BY pending_transfer_lots.issued_at LOOP
+        remaining := remaining - lot.amount;
+        repaid := LEAST(debt, lot.amount);
+        debt := debt - repaid;
+        IF lot.amount > repaid THEN
+            INSERT INTO coin_lots (user_id, issued_at, amount) VALUES (user_id_param, lot.issued_at, lot.amount - repaid);
+        END IF;
+    END LOOP;
+    IF remaining > debt THEN
+        INSERT INTO coin_lots (user_id, issued_at, amount) VALUES (user_id_param, CURRENT_TIMESTAMP, remaining - debt);
+    END IF;
+    DELETE FROM pending_transfer_lots WHERE pending_transfer_lots.pending_transfer_id = pending_transfer_id_param;
+
+    PERFORM record_ledger_entry(kind_param, ledger_system_account('escrow'), ledger_user_account(user_id_param),
+                                amount_param, transaction_id_param, NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+--Возвращает не более limit_param отложенных переводов отправителя в статусе pending от новых к старым
+CREATE FUNCTION get_pending_transfers(sender_id_param INT, limit_param INT)
+    RETURNS SETOF pending_transfers_view AS $$
+    SELECT * FROM pending_transfers_view
+    WHERE pending_transfers_view.sender_id = sender_id_param AND pending_transfers_view.status = 'pending'
+    ORDER BY pending_transfers_view.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Отменяет отложенный перевод отправителем и возвращает ему резерв. Если перевод уже зачислен, отменен
+--или его срок наступил, выбрасывает ошибку PTR01. Если перевода нет или пользователь не отправитель,
+--ничего не возвращает.
+CREATE FUNCTION cancel_pending_transfer(sender_id_param INT, pending_transfer_id_param INT)
+    RETURNS SETOF pending_transfers_view AS $$
+DECLARE
+    pending pending_transfers%ROWTYPE;
+BEGIN
+    SELECT * INTO pending FROM pending_transfers
+    WHERE pending_transfers.id = pending_transfer_id_param AND pending_transfers.sender_id = sender_id_param
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF pending.status <> 'pending' OR pending.settle_at <= LOCALTIMESTAMP THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'PTR01',
+            MESSAGE = 'Отложенный перевод уже нельзя отменить: ' || pending.status;
+    END IF;
+
+    PERFORM release_pending_transfer(pending.id, pending.sender_id, pending.amount, 'transfer_refund', NULL);
+
+    UPDATE pending_transfers
+    SET status = 'cancelled', resolved_at = CURRENT_TIMESTAMP
+    WHERE pending_transfers.id = pending.id;
+
+    RETURN QUERY SELECT * FROM pending_transfers_view WHERE pending_transfers_view.id = pending.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Зачисляет получателям отложенные переводы, срок которых наступил, и возвращает их число. Каждый перевод
+--записывается в transactions с сообщением и категорией. Строки, заблокированные отменой или другой
+--репликой, пропускаются, поэтому перевод зачисляется не более одного раза.
+CREATE FUNCTION settle_pending_transfers()
+    RETURNS INT AS $$
+DECLARE
+    pending pending_transfers%ROWTYPE;
+    new_transaction_id INT;
+    settled INT := 0;
+BEGIN
+    FOR pending IN SELECT * FROM pending_transfers
+                   WHERE pending_transfers.status = 'pending' AND pending_transfers.settle_at <= LOCALTIMESTAMP
+                   ORDER BY pending_transfers.id
+                   FOR UPDATE SKIP LOCKED LOOP
+        INSERT INTO transactions (sender_id, receiver_id, amount, message, category)
+        VALUES (pending.sender_id, pending.receiver_id, pending.amount, pending.message, pending.category)
+        RETURNING id INTO new_transaction_id;
+
+        PERFORM release_pending_transfer(pending.id, pending.receiver_id, pending.amount, 'transfer',
+                                         new_transaction_id);
+
+        UPDATE pending_transfers
+        SET status = 'settled', resolved_at = CURRENT_TIMESTAMP, transaction_id = new_transaction_id
+        WHERE pending_transfers.id = pending.id;
+        settled := settled + 1;
+    END LOOP;
+    RETURN settled;
+END;
+$$ LANGUAGE plpgsql;
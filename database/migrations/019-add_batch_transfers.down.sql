@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS send_coins_batch(INT, VARCHAR(32)[], INT[], VARCHAR(200)[], VARCHAR(16)[], INT, INT, INT, INT);
@@ -0,0 +1,82 @@
+--Пакетный перевод: строка i переводит amounts_param[i] монет пользователю receivers_param[i] с сообщением
+--messages_param[i] и категорией categories_param[i] (пустая строка - без них). Сначала проверяются все строки:
+--если хотя бы одна некорректна, ничего не выполняется, а для каждой строки возвращается код ошибки
+--(user_not_found, self_transfer, invalid_amount, duplicate_recipient) или NULL. Иначе отправитель
+--и все получатели блокируются в порядке id, как в transfer_coins, проверяются баланс на всю сумму
+--(ошибка BAT01) и лимиты трат, и все переводы выполняются в одной транзакции. Возвращаются строки
+--с идентификаторами переводов.
+CREATE FUNCTION send_coins_batch(sender_id_param INT, receivers_param VARCHAR(32)[], amounts_param INT[],
+                                 messages_param VARCHAR(200)[], categories_param VARCHAR(16)[],
+                                 per_transfer_limit_param INT, daily_limit_param INT,
+                                 monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(line_number INT, line_transaction_id INT, line_error VARCHAR(32)) AS $$
+DECLARE
+    line_count INT := COALESCE(array_length(receivers_param, 1), 0);
+    receiver_ids INT[];
+    line_errors VARCHAR(32)[];
+    total INT;
+    sender_balance INT;
+BEGIN
+    IF line_count = 0 THEN
+        RAISE EXCEPTION 'Пакет переводов пуст';
+    END IF;
+
+    IF array_length(amounts_param, 1) IS DISTINCT FROM line_count
+        OR array_length(messages_param, 1) IS DISTINCT FROM line_count
+        OR array_length(categories_param, 1) IS DISTINCT FROM line_count THEN
+        RAISE EXCEPTION 'Массивы пакета переводов разной длины';
+    END IF;
+
+    SELECT array_agg(users.id ORDER BY lines.ord) INTO receiver_ids
+    FROM unnest(receivers_param) WITH ORDINALITY AS lines(username, ord)
+             LEFT JOIN users ON users.username = lines.username;
+
+    FOR i IN 1..line_count LOOP
+        line_errors[i] := CASE
+                              WHEN receiver_ids[i] IS NULL THEN 'user_not_found'
+                              WHEN receiver_ids[i] = sender_id_param THEN 'self_transfer'
+                              WHEN amounts_param[i] IS NULL OR amounts_param[i] <= 0 THEN 'invalid_amount'
+                              WHEN receiver_ids[i] = ANY (receiver_ids[1:i - 1]) THEN 'duplicate_recipient'
+                          END;
+    END LOOP;
+
+    IF EXISTS (SELECT 1 FROM unnest(line_errors) AS line_error_code WHERE line_error_code IS NOT NULL) THEN
+        RETURN QUERY SELECT i, NULL::INT, line_errors[i] FROM generate_series(1, line_count) AS i;
+        RETURN;
+    END IF;
+
+    PERFORM 1 FROM users
+    WHERE users.id = sender_id_param OR users.id = ANY (receiver_ids)
+    ORDER BY users.id
+    FOR UPDATE;
+    SELECT users.balance INTO sender_balance FROM users WHERE users.id = sender_id_param;
+    SELECT SUM(amount)::INT INTO total FROM unnest(amounts_param) AS amount;
+
+    IF sender_balance < total THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'BAT01',
+            MESSAGE = 'Недостаточно средств на балансе отправителя';
+    END IF;
+
+    --Лимиты за день и месяц проверяются на всю сумму, лимиты на перевод и получателя - по строкам
+    PERFORM check_spending_limits(sender_id_param, NULL, total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    FOR i IN 1..line_count LOOP
+        PERFORM check_spending_limits(sender_id_param, receiver_ids[i], amounts_param[i], per_transfer_limit_param,
+                                      daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+        INSERT INTO transactions (sender_id, receiver_id, amount, message, category)
+        VALUES (sender_id_param, receiver_ids[i], amounts_param[i], NULLIF(messages_param[i], ''),
+                NULLIF(categories_param[i], ''))
+        RETURNING id INTO line_transaction_id;
+
+        PERFORM post_ledger_entry('transfer', ledger_user_account(sender_id_param),
+                                  ledger_user_account(receiver_ids[i]), amounts_param[i], line_transaction_id, NULL);
+
+        line_number := i;
+        line_error := NULL;
+        RETURN NEXT;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
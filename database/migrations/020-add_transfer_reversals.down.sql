@@ -0,0 +1,72 @@
+DROP FUNCTION IF EXISTS reverse_transfer(INT, INT, VARCHAR, BOOLEAN);
+
+DROP FUNCTION IF EXISTS get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+CREATE FUNCTION get_user_history(user_id_param INT,
+                                            direction_param VARCHAR(8),
+                                            counterparty_param VARCHAR(32),
+                                            from_param TIMESTAMP,
+                                            to_param TIMESTAMP,
+                                            min_amount_param INT,
+                                            max_amount_param INT,
+                                            before_id_param INT,
+                                            limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255), message VARCHAR(200), category VARCHAR(16)) AS $$
+    SELECT * FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, ''),
+                COALESCE(transactions.message, ''), COALESCE(transactions.category, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, ''),
+                COALESCE(transactions.message, ''), COALESCE(transactions.category, '')
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+DROP TRIGGER IF EXISTS users_settle_reversal_debt ON users;
+DROP FUNCTION IF EXISTS settle_reversal_debt();
+
+--Исходное ограничение баланса возвращается только когда непогашенных долгов по отменам не осталось,
+--иначе откат прерывается и баланс остается защищен ослабленным ограничением
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM users WHERE users.balance < 0) THEN
+        RAISE EXCEPTION 'Нельзя откатить отмены переводов: есть пользователи с долгом';
+    END IF;
+END;
+$$;
+ALTER TABLE users DROP CONSTRAINT users_balance_check,
+    ADD CONSTRAINT users_balance_check CHECK (balance >= 0);
+ALTER TABLE users DROP COLUMN IF EXISTS reversal_debt;
+
+--Операции reversal остаются в журнале проводок, который только дополняется, поэтому вид reversal
+--остается допустимым, а ссылка на отмененный перевод удаляется
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_reversal_of_check;
+ALTER TABLE transactions DROP COLUMN IF EXISTS reversal_of;
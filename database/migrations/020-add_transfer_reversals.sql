@@ -0,0 +1,155 @@
+--Отмена перевода администратором: компенсирующая операция reversal возвращает монеты от получателя
+--отправителю и ссылается на исходный перевод через reversal_of. Перевод отменяется не более одного раза.
+ALTER TABLE transactions ADD COLUMN reversal_of INT UNIQUE REFERENCES transactions(id);
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+    CHECK (kind IN ('transfer', 'mint', 'clawback', 'grant', 'allowance', 'expiry', 'reversal'));
+ALTER TABLE transactions ADD CONSTRAINT transactions_reversal_of_check
+    CHECK ((kind = 'reversal') = (reversal_of IS NOT NULL));
+
+--При отмене с долгом баланс получателя уходит в минус. Ограничение баланса заменяется ослабленным в той же
+--миграции: минус допустим только в пределах учтенного долга по отменам reversal_debt, любая другая запись,
+--уводящая баланс в минус, по-прежнему отклоняется базой.
+ALTER TABLE users ADD COLUMN reversal_debt INT NOT NULL DEFAULT 0 CHECK (reversal_debt >= 0);
+ALTER TABLE users DROP CONSTRAINT users_balance_check,
+    ADD CONSTRAINT users_balance_check CHECK (balance >= -reversal_debt);
+
+--Зачисления гасят долг: учтенный долг не превышает текущего минуса на балансе. Списание не увеличивает
+--долг, поэтому после погашения баланс снова не может уйти в минус.
+CREATE FUNCTION settle_reversal_debt()
+    RETURNS TRIGGER AS $$
+BEGIN
+    NEW.reversal_debt := LEAST(NEW.reversal_debt, GREATEST(-NEW.balance, 0));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_settle_reversal_debt
+    BEFORE UPDATE OF balance ON users
+    FOR EACH ROW EXECUTE FUNCTION settle_reversal_debt();
+
+--Отменяет перевод transaction_id_param от имени администратора admin_id_param. Если у получателя не хватает
+--монет, при allow_debt_param возвращается вся сумма и баланс получателя уходит в минус, иначе - только то,
+--что у него есть. Если возвращать нечего, ошибка REV02, если перевод уже отменен - REV01.
+--Пустой результат - перевода с таким идентификатором нет.
+CREATE FUNCTION reverse_transfer(admin_id_param INT, transaction_id_param INT, reason_param VARCHAR(255),
+                                 allow_debt_param BOOLEAN)
+    RETURNS TABLE(reversal_id INT, original_id INT, original_sender VARCHAR(32), original_receiver VARCHAR(32),
+                  original_amount INT, returned_amount INT, receiver_debt INT, reversal_reason VARCHAR(255),
+                  reversal_date TIMESTAMP) AS $$
+DECLARE
+    original transactions%ROWTYPE;
+    receiver_balance INT;
+    amount_to_return INT;
+    new_transaction_id INT;
+BEGIN
+    IF reason_param IS NULL OR btrim(reason_param) = '' THEN
+        RAISE EXCEPTION 'Причина отмены обязательна';
+    END IF;
+
+    SELECT * INTO original FROM transactions
+    WHERE transactions.id = transaction_id_param AND transactions.kind = 'transfer'
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM transactions WHERE transactions.reversal_of = original.id) THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'REV01',
+            MESSAGE = 'Перевод уже отменен';
+    END IF;
+
+    PERFORM 1 FROM users
+    WHERE users.id IN (original.sender_id, original.receiver_id)
+    ORDER BY users.id
+    FOR UPDATE;
+    SELECT users.balance INTO receiver_balance FROM users WHERE users.id = original.receiver_id;
+
+    amount_to_return := original.amount;
+    IF NOT allow_debt_param THEN
+        amount_to_return := LEAST(original.amount, GREATEST(receiver_balance, 0));
+    END IF;
+    IF amount_to_return = 0 THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'REV02',
+            MESSAGE = 'У получателя нет монет для отмены перевода';
+    END IF;
+
+    --Долг учитывается до списания, иначе users_balance_check не пропустит минус на балансе получателя
+    UPDATE users
+    SET reversal_debt = users.reversal_debt + GREATEST(amount_to_return - GREATEST(receiver_balance, 0), 0)
+    WHERE users.id = original.receiver_id;
+
+    INSERT INTO transactions (sender_id, receiver_id, amount, kind, reason, admin_id, reversal_of)
+    VALUES (original.receiver_id, original.sender_id, amount_to_return, 'reversal', reason_param, admin_id_param,
+            original.id)
+    RETURNING transactions.id INTO new_transaction_id;
+
+    PERFORM post_ledger_entry('reversal', ledger_user_account(original.receiver_id),
+                              ledger_user_account(original.sender_id), amount_to_return, new_transaction_id, NULL);
+
+    RETURN QUERY
+        SELECT transactions.id, original.id, senders.username, receivers.username, original.amount,
+               transactions.amount, GREATEST(-receivers.balance, 0), transactions.reason,
+               transactions.transaction_date
+        FROM transactions
+                 JOIN users senders ON senders.id = original.sender_id
+                 JOIN users receivers ON receivers.id = original.receiver_id
+        WHERE transactions.id = new_transaction_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--История показывает, какой перевод отменяет операция reversal и какой операцией отменен перевод
+DROP FUNCTION get_user_history(INT, VARCHAR, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT, INT, INT);
+
+CREATE FUNCTION get_user_history(user_id_param INT,
+                                 direction_param VARCHAR(8),
+                                 counterparty_param VARCHAR(32),
+                                 from_param TIMESTAMP,
+                                 to_param TIMESTAMP,
+                                 min_amount_param INT,
+                                 max_amount_param INT,
+                                 before_id_param INT,
+                                 limit_param INT)
+    RETURNS TABLE(id INT, direction VARCHAR(8), counterparty VARCHAR(32), amount INT, transaction_date TIMESTAMP,
+                  kind VARCHAR(16), reason VARCHAR(255), message VARCHAR(200), category VARCHAR(16),
+                  reversal_of INT, reversed_by INT) AS $$
+    SELECT history.*, reversals.id FROM (
+        (SELECT transactions.id, 'sent'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, ''),
+                COALESCE(transactions.message, ''), COALESCE(transactions.category, ''), transactions.reversal_of
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+         WHERE transactions.sender_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'sent')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+        UNION ALL
+        (SELECT transactions.id, 'received'::VARCHAR(8), COALESCE(users.username, ''), transactions.amount, transactions.transaction_date,
+                transactions.kind, COALESCE(transactions.reason, ''),
+                COALESCE(transactions.message, ''), COALESCE(transactions.category, ''), transactions.reversal_of
+         FROM transactions
+                  LEFT JOIN users ON users.id = COALESCE(transactions.sender_id, transactions.admin_id)
+         WHERE transactions.receiver_id = user_id_param
+           AND (direction_param IS NULL OR direction_param = 'received')
+           AND (counterparty_param IS NULL OR users.username = counterparty_param)
+           AND (from_param IS NULL OR transactions.transaction_date >= from_param)
+           AND (to_param IS NULL OR transactions.transaction_date < to_param)
+           AND (min_amount_param IS NULL OR transactions.amount >= min_amount_param)
+           AND (max_amount_param IS NULL OR transactions.amount <= max_amount_param)
+           AND (before_id_param IS NULL OR transactions.id < before_id_param)
+         ORDER BY transactions.id DESC
+         LIMIT limit_param)
+    ) history
+             LEFT JOIN transactions reversals ON reversals.reversal_of = history.id
+    ORDER BY history.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,114 @@
+DROP FUNCTION IF EXISTS get_user_purchases(INT, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT);
+
+CREATE FUNCTION get_user_purchases(user_id_param INT,
+                                   item_name_param VARCHAR(32),
+                                   from_param TIMESTAMP,
+                                   to_param TIMESTAMP,
+                                   before_id_param INT,
+                                   limit_param INT)
+    RETURNS TABLE(id INT, item_name VARCHAR(32), amount INT, unit_price INT, total_cost INT,
+                  price_estimated BOOLEAN, purchase_date TIMESTAMP) AS $$
+    SELECT purchases.id, items.name, purchases.amount, purchases.unit_price, purchases.total_cost,
+           purchases.price_estimated, purchases.purchase_date
+    FROM purchases
+             JOIN items ON items.id = purchases.item_id
+    WHERE purchases.buyer_id = user_id_param
+      AND (item_name_param IS NULL OR items.name = item_name_param)
+      AND (from_param IS NULL OR purchases.purchase_date >= from_param)
+      AND (to_param IS NULL OR purchases.purchase_date < to_param)
+      AND (before_id_param IS NULL OR purchases.id < before_id_param)
+    ORDER BY purchases.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Лимиты трат снова учитывают покупки без вычета возвратов
+CREATE OR REPLACE FUNCTION check_spending_limits(user_id_param INT, recipient_id_param INT, amount_param INT,
+                                                 per_transfer_limit_param INT, daily_limit_param INT,
+                                                 monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    override user_limits%ROWTYPE;
+    spent INT;
+    exceeded_limit VARCHAR(16);
+    remaining INT;
+BEGIN
+    SELECT * INTO override FROM user_limits WHERE user_limits.user_id = user_id_param;
+    IF FOUND THEN
+        per_transfer_limit_param := override.per_transfer;
+        daily_limit_param := override.daily;
+        monthly_limit_param := override.monthly;
+        per_recipient_limit_param := override.per_recipient;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_transfer_limit_param > 0 THEN
+        exceeded_limit := 'per_transfer';
+        remaining := per_transfer_limit_param;
+    END IF;
+
+    IF daily_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR daily_limit_param - spent < remaining THEN
+            exceeded_limit := 'daily';
+            remaining := daily_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF monthly_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(purchases.total_cost), 0) FROM purchases
+                WHERE purchases.buyer_id = user_id_param
+                  AND purchases.purchase_date >= date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('month', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR monthly_limit_param - spent < remaining THEN
+            exceeded_limit := 'monthly';
+            remaining := monthly_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_recipient_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.receiver_id = recipient_id_param
+                  AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param
+                  AND pending_transfers.receiver_id = recipient_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR per_recipient_limit_param - spent < remaining THEN
+            exceeded_limit := 'per_recipient';
+            remaining := per_recipient_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF remaining IS NOT NULL AND amount_param > remaining THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'LIM01',
+            MESSAGE = 'Превышен лимит трат: ' || exceeded_limit,
+            CONSTRAINT = exceeded_limit,
+            DETAIL = GREATEST(remaining, 0)::TEXT;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS purchases_spent_since(INT, TIMESTAMP);
+DROP FUNCTION IF EXISTS reject_purchase_return(INT, INT);
+DROP FUNCTION IF EXISTS approve_purchase_return(INT, INT);
+DROP FUNCTION IF EXISTS get_purchase_returns(INT, VARCHAR, INT);
+DROP FUNCTION IF EXISTS request_purchase_return(INT, INT, INT, VARCHAR, INTERVAL);
+DROP VIEW IF EXISTS purchase_returns_view;
+DROP TABLE IF EXISTS purchase_returns;
@@ -0,0 +1,287 @@
+--Возвраты покупок: покупатель просит вернуть quantity предметов из покупки purchase_id, администратор
+--одобряет или отклоняет запрос. При одобрении предметы списываются из инвентаря, а покупателю возвращается
+--цена, уплаченная в момент покупки.
+CREATE TABLE purchase_returns (
+    id SERIAL PRIMARY KEY,
+    purchase_id INT NOT NULL REFERENCES purchases(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    reason VARCHAR(255),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    admin_id INT REFERENCES users(id)
+);
+
+CREATE INDEX idx_purchase_returns_purchase_id ON purchase_returns (purchase_id);
+CREATE INDEX idx_purchase_returns_pending ON purchase_returns (id) WHERE status = 'pending';
+
+--Возвраты с покупателем, предметом и суммой к возврату по цене покупки
+CREATE VIEW purchase_returns_view AS
+SELECT purchase_returns.id,
+       purchase_returns.purchase_id,
+       purchases.buyer_id,
+       users.username AS buyer,
+       items.name AS item,
+       purchase_returns.quantity,
+       purchases.unit_price,
+       purchase_returns.quantity * purchases.unit_price AS refund,
+       COALESCE(purchase_returns.reason, '')::VARCHAR(255) AS reason,
+       purchase_returns.status,
+       purchase_returns.requested_at,
+       purchase_returns.resolved_at
+FROM purchase_returns
+         JOIN purchases ON purchases.id = purchase_returns.purchase_id
+         JOIN users ON users.id = purchases.buyer_id
+         JOIN items ON items.id = purchases.item_id;
+
+--Создает запрос на возврат quantity_param предметов из покупки пользователя. Если покупки нет или она
+--не его, ничего не возвращает. Если покупка старше window_param - ошибка RET01, если вместе с уже
+--запрошенными и одобренными возвратами предметов больше, чем куплено - RET02. Строка покупки блокируется,
+--поэтому одновременные запросы не превышают купленного количества.
+CREATE FUNCTION request_purchase_return(user_id_param INT, purchase_id_param INT, quantity_param INT,
+                                        reason_param VARCHAR(255), window_param INTERVAL)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase purchases%ROWTYPE;
+    claimed INT;
+    new_return_id INT;
+BEGIN
+    SELECT * INTO purchase FROM purchases
+    WHERE purchases.id = purchase_id_param AND purchases.buyer_id = user_id_param
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF quantity_param <= 0 THEN
+        RAISE EXCEPTION 'Количество возвращаемых предметов должно быть > 0';
+    END IF;
+
+    IF purchase.purchase_date < LOCALTIMESTAMP - window_param THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET01',
+            MESSAGE = 'Срок возврата покупки истек';
+    END IF;
+
+    SELECT COALESCE(SUM(purchase_returns.quantity), 0) INTO claimed
+    FROM purchase_returns
+    WHERE purchase_returns.purchase_id = purchase.id AND purchase_returns.status IN ('pending', 'approved');
+    IF claimed + quantity_param > purchase.amount THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET02',
+            MESSAGE = 'Нельзя вернуть больше предметов, чем куплено',
+            DETAIL = purchase.amount - claimed;
+    END IF;
+
+    INSERT INTO purchase_returns (purchase_id, quantity, reason)
+    VALUES (purchase.id, quantity_param, reason_param)
+    RETURNING id INTO new_return_id;
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = new_return_id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Возвращает возвраты покупателя user_id_param (NULL - всех покупателей) от новых к старым.
+--NULL в status_param означает все статусы.
+CREATE FUNCTION get_purchase_returns(user_id_param INT, status_param VARCHAR(16), limit_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+    SELECT * FROM purchase_returns_view
+    WHERE (user_id_param IS NULL OR purchase_returns_view.buyer_id = user_id_param)
+      AND (status_param IS NULL OR purchase_returns_view.status = status_param)
+    ORDER BY purchase_returns_view.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Одобряет возврат от имени администратора: списывает предметы из инвентаря покупателя и возвращает ему
+--уплаченную цену проводкой refund из выручки магазина. Если возврата нет, ничего не возвращает.
+--Если возврат уже одобрен или отклонен - ошибка RET03, если у покупателя меньше предметов, чем
+--возвращается - RET04.
+CREATE FUNCTION approve_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+    purchase purchases%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    SELECT * INTO purchase FROM purchases WHERE purchases.id = purchase_return.purchase_id;
+    PERFORM 1 FROM users WHERE users.id = purchase.buyer_id FOR UPDATE;
+
+    UPDATE user_items
+    SET amount = user_items.amount - purchase_return.quantity
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount >= purchase_return.quantity;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET04',
+            MESSAGE = 'У покупателя нет возвращаемых предметов';
+    END IF;
+    DELETE FROM user_items
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount = 0;
+
+    UPDATE purchase_returns
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    PERFORM post_ledger_entry('refund', ledger_system_account('shop_revenue'), ledger_user_account(purchase.buyer_id),
+                              purchase_return.quantity * purchase.unit_price, NULL, purchase.id);
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Отклоняет возврат от имени администратора. Если возврата нет, ничего не возвращает,
+--если он уже одобрен или отклонен - ошибка RET03.
+CREATE FUNCTION reject_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    UPDATE purchase_returns
+    SET status = 'rejected', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--История покупок показывает, сколько предметов покупки возвращено и сколько монет за них получено
+DROP FUNCTION get_user_purchases(INT, VARCHAR, TIMESTAMP, TIMESTAMP, INT, INT);
+
+CREATE FUNCTION get_user_purchases(user_id_param INT,
+                                   item_name_param VARCHAR(32),
+                                   from_param TIMESTAMP,
+                                   to_param TIMESTAMP,
+                                   before_id_param INT,
+                                   limit_param INT)
+    RETURNS TABLE(id INT, item_name VARCHAR(32), amount INT, unit_price INT, total_cost INT,
+                  price_estimated BOOLEAN, purchase_date TIMESTAMP, returned_quantity INT, refunded INT) AS $$
+    SELECT purchases.id, items.name, purchases.amount, purchases.unit_price, purchases.total_cost,
+           purchases.price_estimated, purchases.purchase_date,
+           COALESCE(returned.quantity, 0), COALESCE(returned.quantity, 0) * purchases.unit_price
+    FROM purchases
+             JOIN items ON items.id = purchases.item_id
+             LEFT JOIN (SELECT purchase_returns.purchase_id, SUM(purchase_returns.quantity)::INT AS quantity
+                        FROM purchase_returns
+                        WHERE purchase_returns.status = 'approved'
+                        GROUP BY purchase_returns.purchase_id) returned ON returned.purchase_id = purchases.id
+    WHERE purchases.buyer_id = user_id_param
+      AND (item_name_param IS NULL OR items.name = item_name_param)
+      AND (from_param IS NULL OR purchases.purchase_date >= from_param)
+      AND (to_param IS NULL OR purchases.purchase_date < to_param)
+      AND (before_id_param IS NULL OR purchases.id < before_id_param)
+    ORDER BY purchases.id DESC
+    LIMIT limit_param;
+$$ LANGUAGE sql STABLE;
+
+--Сколько пользователь потратил на покупки начиная с since_param за вычетом одобренных возвратов этих покупок
+CREATE FUNCTION purchases_spent_since(user_id_param INT, since_param TIMESTAMP)
+    RETURNS INT AS $$
+    SELECT (COALESCE((SELECT SUM(purchases.total_cost) FROM purchases
+                      WHERE purchases.buyer_id = user_id_param AND purchases.purchase_date >= since_param), 0)
+        - COALESCE((SELECT SUM(purchase_returns.quantity * purchases.unit_price) FROM purchase_returns
+                    JOIN purchases ON purchases.id = purchase_returns.purchase_id
+                    WHERE purchases.buyer_id = user_id_param AND purchases.purchase_date >= since_param
+                      AND purchase_returns.status = 'approved'), 0))::INT;
+$$ LANGUAGE sql STABLE;
+
+--Возвращенные покупки не расходуют дневной и месячный лимиты трат
+CREATE OR REPLACE FUNCTION check_spending_limits(user_id_param INT, recipient_id_param INT, amount_param INT,
+                                                 per_transfer_limit_param INT, daily_limit_param INT,
+                                                 monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    override user_limits%ROWTYPE;
+    spent INT;
+    exceeded_limit VARCHAR(16);
+    remaining INT;
+BEGIN
+    SELECT * INTO override FROM user_limits WHERE user_limits.user_id = user_id_param;
+    IF FOUND THEN
+        per_transfer_limit_param := override.per_transfer;
+        daily_limit_param := override.daily;
+        monthly_limit_param := override.monthly;
+        per_recipient_limit_param := override.per_recipient;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_transfer_limit_param > 0 THEN
+        exceeded_limit := 'per_transfer';
+        remaining := per_transfer_limit_param;
+    END IF;
+
+    IF daily_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + purchases_spent_since(user_id_param, date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR daily_limit_param - spent < remaining THEN
+            exceeded_limit := 'daily';
+            remaining := daily_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF monthly_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('month', timezone('UTC', now())))
+             + purchases_spent_since(user_id_param, date_trunc('month', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('month', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR monthly_limit_param - spent < remaining THEN
+            exceeded_limit := 'monthly';
+            remaining := monthly_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF recipient_id_param IS NOT NULL AND per_recipient_limit_param > 0 THEN
+        SELECT (SELECT COALESCE(SUM(transactions.amount), 0) FROM transactions
+                WHERE transactions.sender_id = user_id_param AND transactions.receiver_id = recipient_id_param
+                  AND transactions.kind = 'transfer'
+                  AND transactions.transaction_date >= date_trunc('day', timezone('UTC', now())))
+             + (SELECT COALESCE(SUM(pending_transfers.amount), 0) FROM pending_transfers
+                WHERE pending_transfers.sender_id = user_id_param
+                  AND pending_transfers.receiver_id = recipient_id_param AND pending_transfers.status = 'pending'
+                  AND pending_transfers.created_at >= date_trunc('day', timezone('UTC', now())))
+        INTO spent;
+        IF remaining IS NULL OR per_recipient_limit_param - spent < remaining THEN
+            exceeded_limit := 'per_recipient';
+            remaining := per_recipient_limit_param - spent;
+        END IF;
+    END IF;
+
+    IF remaining IS NOT NULL AND amount_param > remaining THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'LIM01',
+            MESSAGE = 'Превышен лимит трат: ' || exceeded_limit,
+            CONSTRAINT = exceeded_limit,
+            DETAIL = GREATEST(remaining, 0)::TEXT;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
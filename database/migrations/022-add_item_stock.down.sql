@@ -0,0 +1,168 @@
+--Покупки, заказы и возвраты возвращаются к версиям без остатков товаров
+CREATE OR REPLACE FUNCTION approve_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+    purchase purchases%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    SELECT * INTO purchase FROM purchases WHERE purchases.id = purchase_return.purchase_id;
+    PERFORM 1 FROM users WHERE users.id = purchase.buyer_id FOR UPDATE;
+
+    UPDATE user_items
+    SET amount = user_items.amount - purchase_return.quantity
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount >= purchase_return.quantity;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET04',
+            MESSAGE = 'У покупателя нет возвращаемых предметов';
+    END IF;
+    DELETE FROM user_items
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount = 0;
+
+    UPDATE purchase_returns
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    PERFORM post_ledger_entry('refund', ledger_system_account('shop_revenue'), ledger_user_account(purchase.buyer_id),
+                              purchase_return.quantity * purchase.unit_price, NULL, purchase.id);
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[],
+                                       per_transfer_limit_param INT, daily_limit_param INT,
+                                       monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, order_total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT,
+                                    per_transfer_limit_param INT, daily_limit_param INT,
+                                    monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF user_balance < item_amount_param * item_price THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, item_amount_param * item_price, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, item_amount_param * item_price)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              item_amount_param * item_price, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS set_item_stock(INT, VARCHAR, INT, INT);
+DROP FUNCTION IF EXISTS restock_item(INT, VARCHAR, INT);
+DROP FUNCTION IF EXISTS get_catalog(INT);
+DROP FUNCTION IF EXISTS take_item_stock(INT, INT, INT);
+DROP FUNCTION IF EXISTS item_purchased_quantity(INT, INT);
+DROP TABLE IF EXISTS item_stock_changes;
+ALTER TABLE items DROP COLUMN IF EXISTS per_user_limit, DROP COLUMN IF EXISTS stock;
@@ -0,0 +1,318 @@
+--Остатки товаров: stock - сколько единиц осталось (NULL - без ограничений), per_user_limit - сколько единиц
+--товара может купить один пользователь (NULL - без ограничений)
+ALTER TABLE items
+    ADD COLUMN stock INT CHECK (stock >= 0),
+    ADD COLUMN per_user_limit INT CHECK (per_user_limit > 0);
+
+--Изменения остатков администраторами
+CREATE TABLE item_stock_changes (
+    id SERIAL PRIMARY KEY,
+    item_id INT NOT NULL REFERENCES items(id),
+    admin_id INT NOT NULL REFERENCES users(id),
+    previous_stock INT,
+    new_stock INT,
+    per_user_limit INT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_item_stock_changes_item_id ON item_stock_changes (item_id);
+
+--Сколько единиц товара пользователь купил за вычетом одобренных возвратов
+CREATE FUNCTION item_purchased_quantity(user_id_param INT, item_id_param INT)
+    RETURNS INT AS $$
+    SELECT (COALESCE((SELECT SUM(purchases.amount) FROM purchases
+                      WHERE purchases.buyer_id = user_id_param AND purchases.item_id = item_id_param), 0)
+        - COALESCE((SELECT SUM(purchase_returns.quantity) FROM purchase_returns
+                    JOIN purchases ON purchases.id = purchase_returns.purchase_id
+                    WHERE purchases.buyer_id = user_id_param AND purchases.item_id = item_id_param
+                      AND purchase_returns.status = 'approved'), 0))::INT;
+$$ LANGUAGE sql STABLE;
+
+--Списывает quantity_param единиц товара из остатка для покупки пользователем. Пользователь должен быть
+--заблокирован вызывающим, поэтому его покупки не меняются до конца транзакции. Если покупка превышает
+--лимит на пользователя - ошибка STK02, если остатка не хватает - STK01. В DETAIL передается, сколько еще
+--можно купить, в HINT - название товара.
+CREATE FUNCTION take_item_stock(user_id_param INT, item_id_param INT, quantity_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    item items%ROWTYPE;
+    purchased INT;
+BEGIN
+    SELECT * INTO item FROM items WHERE items.id = item_id_param;
+
+    IF item.per_user_limit IS NOT NULL THEN
+        purchased := item_purchased_quantity(user_id_param, item.id);
+        IF purchased + quantity_param > item.per_user_limit THEN
+            RAISE EXCEPTION USING
+                ERRCODE = 'STK02',
+                MESSAGE = 'Превышен лимит покупок товара на пользователя: ' || item.name,
+                DETAIL = GREATEST(item.per_user_limit - purchased, 0)::TEXT,
+                HINT = item.name;
+        END IF;
+    END IF;
+
+    UPDATE items SET stock = items.stock - quantity_param
+    WHERE items.id = item.id AND items.stock IS NOT NULL AND items.stock >= quantity_param;
+    IF NOT FOUND AND item.stock IS NOT NULL THEN
+        SELECT items.stock INTO item.stock FROM items WHERE items.id = item.id;
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK01',
+            MESSAGE = 'Товар закончился: ' || item.name,
+            DETAIL = item.stock::TEXT,
+            HINT = item.name;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+--Покупка списывает товар из остатка. Стоимость считается в BIGINT: если она не помещается в INTEGER -
+--ошибка STK04.
+CREATE OR REPLACE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT,
+                                    per_transfer_limit_param INT, daily_limit_param INT,
+                                    monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    purchase_cost INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF item_amount_param::BIGINT * item_price > 2147483647 THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK04',
+            MESSAGE = 'Стоимость покупки не помещается в INTEGER';
+    END IF;
+    purchase_cost := item_amount_param * item_price;
+
+    IF user_balance < purchase_cost THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, purchase_cost, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    PERFORM take_item_stock(user_id_param, item_id_param, item_amount_param);
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, purchase_cost)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              purchase_cost, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+--Заказ списывает товары из остатков. Товары заказа блокируются в порядке id, чтобы одновременные заказы
+--с теми же товарами в другом порядке не взаимоблокировались. Если сумма заказа не помещается в INTEGER -
+--ошибка STK04.
+CREATE OR REPLACE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[],
+                                       per_transfer_limit_param INT, daily_limit_param INT,
+                                       monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        IF order_total + quantities_param[i]::BIGINT * line_price > 2147483647 THEN
+            RAISE EXCEPTION USING
+                ERRCODE = 'STK04',
+                MESSAGE = 'Стоимость заказа не помещается в INTEGER';
+        END IF;
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, order_total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    PERFORM 1 FROM items WHERE items.name = ANY (item_names_param) AND items.stock IS NOT NULL
+    ORDER BY items.id
+    FOR UPDATE;
+
+    --Позиции списываются по очереди после записи предыдущих покупок, поэтому лимит на пользователя
+    --учитывает сумму позиций с одним товаром
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        PERFORM take_item_stock(user_id_param, line_item_id, quantities_param[i]);
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+--Каталог товаров с остатками. Для товаров с лимитом на пользователя purchased - сколько единиц
+--пользователь user_id_param уже купил за вычетом возвратов, для остальных - 0.
+CREATE FUNCTION get_catalog(user_id_param INT)
+    RETURNS TABLE(name VARCHAR(32), price INT, stock INT, per_user_limit INT, purchased INT) AS $$
+    SELECT items.name, items.price, items.stock, items.per_user_limit,
+           CASE WHEN items.per_user_limit IS NULL THEN 0 ELSE item_purchased_quantity(user_id_param, items.id) END
+    FROM items
+    ORDER BY items.id;
+$$ LANGUAGE sql STABLE;
+
+--Пополняет остаток товара от имени администратора. Если товара нет, ничего не возвращает, если остаток
+--товара не ограничен - ошибка STK03.
+CREATE FUNCTION restock_item(admin_id_param INT, item_name_param VARCHAR(32), quantity_param INT)
+    RETURNS TABLE(name VARCHAR(32), price INT, stock INT, per_user_limit INT) AS $$
+DECLARE
+    item items%ROWTYPE;
+BEGIN
+    IF quantity_param <= 0 THEN
+        RAISE EXCEPTION 'Количество пополнения должно быть > 0';
+    END IF;
+
+    SELECT * INTO item FROM items WHERE items.name = item_name_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF item.stock IS NULL THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK03',
+            MESSAGE = 'Остаток товара не ограничен: ' || item.name;
+    END IF;
+
+    UPDATE items SET stock = items.stock + quantity_param WHERE items.id = item.id;
+    INSERT INTO item_stock_changes (item_id, admin_id, previous_stock, new_stock, per_user_limit)
+    VALUES (item.id, admin_id_param, item.stock, item.stock + quantity_param, item.per_user_limit);
+
+    RETURN QUERY SELECT items.name, items.price, items.stock, items.per_user_limit FROM items WHERE items.id = item.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Задает остаток товара (NULL - без ограничений) и лимит на пользователя (NULL - без ограничений)
+--от имени администратора. Если товара нет, ничего не возвращает.
+CREATE FUNCTION set_item_stock(admin_id_param INT, item_name_param VARCHAR(32), stock_param INT,
+                               per_user_limit_param INT)
+    RETURNS TABLE(name VARCHAR(32), price INT, stock INT, per_user_limit INT) AS $$
+DECLARE
+    item items%ROWTYPE;
+BEGIN
+    SELECT * INTO item FROM items WHERE items.name = item_name_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    UPDATE items SET stock = stock_param, per_user_limit = per_user_limit_param WHERE items.id = item.id;
+    INSERT INTO item_stock_changes (item_id, admin_id, previous_stock, new_stock, per_user_limit)
+    VALUES (item.id, admin_id_param, item.stock, stock_param, per_user_limit_param);
+
+    RETURN QUERY SELECT items.name, items.price, items.stock, items.per_user_limit FROM items WHERE items.id = item.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Одобренный возврат возвращает предметы в остаток товара, если он ограничен
+CREATE OR REPLACE FUNCTION approve_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+    purchase purchases%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    SELECT * INTO purchase FROM purchases WHERE purchases.id = purchase_return.purchase_id;
+    PERFORM 1 FROM users WHERE users.id = purchase.buyer_id FOR UPDATE;
+
+    UPDATE user_items
+    SET amount = user_items.amount - purchase_return.quantity
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount >= purchase_return.quantity;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET04',
+            MESSAGE = 'У покупателя нет возвращаемых предметов';
+    END IF;
+    DELETE FROM user_items
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount = 0;
+
+    UPDATE items SET stock = items.stock + purchase_return.quantity
+    WHERE items.id = purchase.item_id AND items.stock IS NOT NULL;
+
+    UPDATE purchase_returns
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    PERFORM post_ledger_entry('refund', ledger_system_account('shop_revenue'), ledger_user_account(purchase.buyer_id),
+                              purchase_return.quantity * purchase.unit_price, NULL, purchase.id);
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
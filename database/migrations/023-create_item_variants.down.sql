@@ -0,0 +1,278 @@
+--Варианты товаров удаляются: инвентари снова хранятся по товарам, количества вариантов одного товара
+--складываются
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT, expiry_period_param INTERVAL, expiring_window_param INTERVAL)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_build_object('type', items.name, 'quantity', user_items.amount) ORDER BY items.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason,
+                                    'message', transactions.message,
+                                    'category', transactions.category))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason,
+                                    'message', transactions.message,
+                                    'category', transactions.category))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        ),
+        'expiringSoon', (
+            SELECT json_agg(json_build_object('amount', lots.amount, 'expiresAt', lots.expires_at)
+                            ORDER BY lots.expires_at)
+            FROM (
+                SELECT SUM(coin_lots.amount)::INT AS amount,
+                       (coin_lots.issued_at + expiry_period_param) AT TIME ZONE 'UTC' AS expires_at
+                FROM coin_lots
+                WHERE coin_lots.user_id = users.id
+                  AND expiry_period_param > INTERVAL '0'
+                  AND coin_lots.issued_at + expiry_period_param < CURRENT_TIMESTAMP + expiring_window_param
+                GROUP BY coin_lots.issued_at
+            ) lots
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION approve_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+    purchase purchases%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    SELECT * INTO purchase FROM purchases WHERE purchases.id = purchase_return.purchase_id;
+    PERFORM 1 FROM users WHERE users.id = purchase.buyer_id FOR UPDATE;
+
+    UPDATE user_items
+    SET amount = user_items.amount - purchase_return.quantity
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount >= purchase_return.quantity;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET04',
+            MESSAGE = 'У покупателя нет возвращаемых предметов';
+    END IF;
+    DELETE FROM user_items
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.item_id = purchase.item_id
+      AND user_items.amount = 0;
+
+    UPDATE items SET stock = items.stock + purchase_return.quantity
+    WHERE items.id = purchase.item_id AND items.stock IS NOT NULL;
+
+    UPDATE purchase_returns
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    PERFORM post_ledger_entry('refund', ledger_system_account('shop_revenue'), ledger_user_account(purchase.buyer_id),
+                              purchase_return.quantity * purchase.unit_price, NULL, purchase.id);
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION get_catalog(INT);
+
+CREATE FUNCTION get_catalog(user_id_param INT)
+    RETURNS TABLE(name VARCHAR(32), price INT, stock INT, per_user_limit INT, purchased INT) AS $$
+    SELECT items.name, items.price, items.stock, items.per_user_limit,
+           CASE WHEN items.per_user_limit IS NULL THEN 0 ELSE item_purchased_quantity(user_id_param, items.id) END
+    FROM items
+    ORDER BY items.id;
+$$ LANGUAGE sql STABLE;
+
+DROP FUNCTION place_order(INT, VARCHAR[], VARCHAR[], INT[], INT, INT, INT, INT);
+
+CREATE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], quantities_param INT[],
+                            per_transfer_limit_param INT, daily_limit_param INT,
+                            monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    line_item_id INT;
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT items.price INTO line_price FROM items WHERE items.name = item_names_param[i];
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %', item_names_param[i];
+        END IF;
+
+        IF order_total + quantities_param[i]::BIGINT * line_price > 2147483647 THEN
+            RAISE EXCEPTION USING
+                ERRCODE = 'STK04',
+                MESSAGE = 'Стоимость заказа не помещается в INTEGER';
+        END IF;
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, order_total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    PERFORM 1 FROM items WHERE items.name = ANY (item_names_param) AND items.stock IS NOT NULL
+    ORDER BY items.id
+    FOR UPDATE;
+
+    --Позиции списываются по очереди после записи предыдущих покупок, поэтому лимит на пользователя
+    --учитывает сумму позиций с одним товаром
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT items.id, items.price INTO line_item_id, line_price FROM items WHERE items.name = item_names_param[i];
+
+        PERFORM take_item_stock(user_id_param, line_item_id, quantities_param[i]);
+
+        INSERT INTO user_items (user_id, item_id, amount)
+        VALUES (user_id_param, line_item_id, quantities_param[i])
+        ON CONFLICT (user_id, item_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, line_item_id, quantities_param[i], line_price, quantities_param[i] * line_price,
+                new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION buy_item(INT, VARCHAR, VARCHAR, INT, INT, INT, INT, INT);
+
+CREATE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), item_amount_param INT,
+                         per_transfer_limit_param INT, daily_limit_param INT,
+                         monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    purchase_cost INT;
+    item_exists BOOLEAN;
+    item_id_param INT;
+    new_purchase_id INT;
+BEGIN
+    SELECT EXISTS (SELECT 1 FROM items WHERE name = item_name_param) INTO item_exists;
+    IF NOT item_exists THEN
+        RAISE EXCEPTION 'Предмет не существует: %', item_name_param;
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT items.id INTO item_id_param FROM items WHERE name = item_name_param;
+
+    SELECT price INTO item_price FROM items WHERE items.id = item_id_param;
+
+    IF item_amount_param::BIGINT * item_price > 2147483647 THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK04',
+            MESSAGE = 'Стоимость покупки не помещается в INTEGER';
+    END IF;
+    purchase_cost := item_amount_param * item_price;
+
+    IF user_balance < purchase_cost THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, purchase_cost, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    PERFORM take_item_stock(user_id_param, item_id_param, item_amount_param);
+
+    INSERT INTO user_items (user_id, item_id, amount)
+    VALUES (user_id_param, item_id_param, item_amount_param)
+    ON CONFLICT (user_id, item_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, item_id_param, item_amount_param, item_price, purchase_cost)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              purchase_cost, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION restock_item_variant(INT, VARCHAR, INT);
+DROP FUNCTION create_item_variant(INT, VARCHAR, VARCHAR, JSONB, INT, INT);
+DROP FUNCTION take_variant_stock(INT, INT);
+DROP FUNCTION find_item_variant(VARCHAR, VARCHAR);
+
+ALTER TABLE item_stock_changes DROP COLUMN variant_id;
+ALTER TABLE purchases DROP COLUMN variant_id;
+
+ALTER TABLE user_items DROP CONSTRAINT user_items_pkey;
+ALTER TABLE user_items DROP COLUMN variant_id;
+CREATE TEMPORARY TABLE merged_user_items ON COMMIT DROP AS
+SELECT user_items.user_id, user_items.item_id, SUM(user_items.amount)::INT AS amount
+FROM user_items
+GROUP BY user_items.user_id, user_items.item_id;
+DELETE FROM user_items;
+INSERT INTO user_items (user_id, item_id, amount)
+SELECT merged_user_items.user_id, merged_user_items.item_id, merged_user_items.amount FROM merged_user_items;
+ALTER TABLE user_items ADD PRIMARY KEY (user_id, item_id);
+
+DROP TABLE item_variants;
@@ -0,0 +1,431 @@
+--Варианты товаров (размеры, цвета): у каждого варианта свой артикул sku, атрибуты, необязательная цена
+--вместо цены товара (NULL - цена товара) и необязательный остаток варианта (NULL - без ограничений).
+--Остаток и лимит на пользователя самого товара действуют на все его варианты вместе.
+CREATE TABLE item_variants (
+    id SERIAL PRIMARY KEY,
+    item_id INT NOT NULL REFERENCES items(id),
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    price INT CHECK (price > 0),
+    stock INT CHECK (stock >= 0),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INT REFERENCES users(id)
+);
+
+CREATE INDEX idx_item_variants_item_id ON item_variants (item_id);
+CREATE UNIQUE INDEX idx_item_variants_default ON item_variants (item_id) WHERE is_default;
+
+--Существующие товары становятся товарами с одним вариантом по умолчанию, артикул которого совпадает
+--с названием товара. Инвентари и покупки переносятся на эти варианты.
+INSERT INTO item_variants (item_id, sku, is_default)
+SELECT items.id, items.name, TRUE FROM items ORDER BY items.id;
+
+ALTER TABLE user_items ADD COLUMN variant_id INT REFERENCES item_variants(id);
+UPDATE user_items
+SET variant_id = item_variants.id
+FROM item_variants
+WHERE item_variants.item_id = user_items.item_id AND item_variants.is_default;
+ALTER TABLE user_items ALTER COLUMN variant_id SET NOT NULL;
+ALTER TABLE user_items DROP CONSTRAINT user_items_pkey;
+ALTER TABLE user_items ADD PRIMARY KEY (user_id, variant_id);
+
+ALTER TABLE purchases ADD COLUMN variant_id INT REFERENCES item_variants(id);
+UPDATE purchases
+SET variant_id = item_variants.id
+FROM item_variants
+WHERE item_variants.item_id = purchases.item_id AND item_variants.is_default;
+ALTER TABLE purchases ALTER COLUMN variant_id SET NOT NULL;
+
+ALTER TABLE item_stock_changes ADD COLUMN variant_id INT REFERENCES item_variants(id);
+
+--Вариант товара item_name_param с артикулом sku_param, NULL - вариант по умолчанию.
+--Если товара или такого его варианта нет, ничего не возвращает.
+CREATE FUNCTION find_item_variant(item_name_param VARCHAR(32), sku_param VARCHAR(64))
+    RETURNS SETOF item_variants AS $$
+    SELECT item_variants.* FROM item_variants
+             JOIN items ON items.id = item_variants.item_id
+    WHERE items.name = item_name_param
+      AND CASE WHEN sku_param IS NULL THEN item_variants.is_default ELSE item_variants.sku = sku_param END;
+$$ LANGUAGE sql STABLE;
+
+--Списывает quantity_param единиц из остатка варианта, если он ограничен. Если остатка не хватает -
+--ошибка STK01: в DETAIL передается остаток, в HINT - название товара, в CONSTRAINT - артикул варианта.
+CREATE FUNCTION take_variant_stock(variant_id_param INT, quantity_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    variant item_variants%ROWTYPE;
+BEGIN
+    UPDATE item_variants SET stock = item_variants.stock - quantity_param
+    WHERE item_variants.id = variant_id_param AND item_variants.stock >= quantity_param;
+    IF FOUND THEN
+        RETURN;
+    END IF;
+
+    SELECT * INTO variant FROM item_variants WHERE item_variants.id = variant_id_param;
+    IF variant.stock IS NOT NULL THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK01',
+            MESSAGE = 'Вариант товара закончился: ' || variant.sku,
+            DETAIL = variant.stock::TEXT,
+            HINT = (SELECT items.name FROM items WHERE items.id = variant.item_id),
+            CONSTRAINT = variant.sku;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+--Покупка варианта товара: variant_sku_param - артикул, NULL - вариант по умолчанию. Цена варианта
+--заменяет цену товара, списываются остатки и товара, и варианта. Если стоимость не помещается в INTEGER -
+--ошибка STK04.
+DROP FUNCTION buy_item(INT, VARCHAR, INT, INT, INT, INT, INT);
+
+CREATE FUNCTION buy_item(user_id_param INT, item_name_param VARCHAR(32), variant_sku_param VARCHAR(64),
+                         item_amount_param INT, per_transfer_limit_param INT, daily_limit_param INT,
+                         monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS VOID AS $$
+DECLARE
+    user_balance INT;
+    item_price INT;
+    purchase_cost INT;
+    variant item_variants%ROWTYPE;
+    new_purchase_id INT;
+BEGIN
+    SELECT * INTO variant FROM find_item_variant(item_name_param, variant_sku_param);
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Предмет не существует: %', concat_ws('/', item_name_param, variant_sku_param);
+    END IF;
+
+    IF item_amount_param <= 0 THEN
+        RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+    END IF;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    SELECT COALESCE(variant.price, items.price) INTO item_price FROM items WHERE items.id = variant.item_id;
+
+    IF item_amount_param::BIGINT * item_price > 2147483647 THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK04',
+            MESSAGE = 'Стоимость покупки не помещается в INTEGER';
+    END IF;
+    purchase_cost := item_amount_param * item_price;
+
+    IF user_balance < purchase_cost THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, purchase_cost, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    PERFORM take_item_stock(user_id_param, variant.item_id, item_amount_param);
+    PERFORM take_variant_stock(variant.id, item_amount_param);
+
+    INSERT INTO user_items (user_id, item_id, variant_id, amount)
+    VALUES (user_id_param, variant.item_id, variant.id, item_amount_param)
+    ON CONFLICT (user_id, variant_id)
+        DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+    INSERT INTO purchases (buyer_id, item_id, variant_id, amount, unit_price, total_cost)
+    VALUES (user_id_param, variant.item_id, variant.id, item_amount_param, item_price, purchase_cost)
+    RETURNING id INTO new_purchase_id;
+
+    PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param), ledger_system_account('shop_revenue'),
+                              purchase_cost, NULL, new_purchase_id);
+END;
+$$ LANGUAGE plpgsql;
+
+--Заказ вариантов товаров: variant_skus_param - артикулы позиций, пустая строка - вариант по умолчанию.
+--Товары и варианты с ограниченным остатком блокируются в порядке id. Если сумма заказа не помещается
+--в INTEGER - ошибка STK04.
+DROP FUNCTION place_order(INT, VARCHAR[], INT[], INT, INT, INT, INT);
+
+CREATE FUNCTION place_order(user_id_param INT, item_names_param VARCHAR(32)[], variant_skus_param VARCHAR(64)[],
+                            quantities_param INT[], per_transfer_limit_param INT, daily_limit_param INT,
+                            monthly_limit_param INT, per_recipient_limit_param INT)
+    RETURNS TABLE(placed_order_id INT, placed_total_cost INT) AS $$
+DECLARE
+    user_balance INT;
+    order_total INT := 0;
+    new_order_id INT;
+    new_purchase_id INT;
+    variant item_variants%ROWTYPE;
+    line_variant_ids INT[] := '{}';
+    line_price INT;
+    i INT;
+BEGIN
+    IF COALESCE(array_length(item_names_param, 1), 0) = 0 THEN
+        RAISE EXCEPTION 'Заказ должен содержать хотя бы одну позицию';
+    END IF;
+
+    IF array_length(item_names_param, 1) IS DISTINCT FROM array_length(quantities_param, 1)
+        OR array_length(item_names_param, 1) IS DISTINCT FROM array_length(variant_skus_param, 1) THEN
+        RAISE EXCEPTION 'Количество названий, артикулов и количеств в заказе не совпадает';
+    END IF;
+
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        IF quantities_param[i] IS NULL OR quantities_param[i] <= 0 THEN
+            RAISE EXCEPTION 'Количество покупаемых предметов должно быть > 0';
+        END IF;
+
+        SELECT * INTO variant FROM find_item_variant(item_names_param[i], NULLIF(variant_skus_param[i], ''));
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Предмет не существует: %',
+                concat_ws('/', item_names_param[i], NULLIF(variant_skus_param[i], ''));
+        END IF;
+
+        SELECT COALESCE(variant.price, items.price) INTO line_price FROM items WHERE items.id = variant.item_id;
+        line_variant_ids := array_append(line_variant_ids, variant.id);
+        IF order_total + quantities_param[i]::BIGINT * line_price > 2147483647 THEN
+            RAISE EXCEPTION USING
+                ERRCODE = 'STK04',
+                MESSAGE = 'Стоимость заказа не помещается в INTEGER';
+        END IF;
+        order_total := order_total + quantities_param[i] * line_price;
+    END LOOP;
+
+    SELECT balance INTO user_balance FROM users WHERE users.id = user_id_param FOR UPDATE;
+
+    IF user_balance < order_total THEN
+        RAISE EXCEPTION 'Недостаточно средств на балансе пользователя';
+    END IF;
+
+    PERFORM check_spending_limits(user_id_param, NULL, order_total, per_transfer_limit_param,
+                                  daily_limit_param, monthly_limit_param, per_recipient_limit_param);
+
+    INSERT INTO orders (buyer_id, total_cost)
+    VALUES (user_id_param, order_total)
+    RETURNING id INTO new_order_id;
+
+    PERFORM 1 FROM items
+    WHERE items.id IN (SELECT item_variants.item_id FROM item_variants WHERE item_variants.id = ANY (line_variant_ids))
+      AND items.stock IS NOT NULL
+    ORDER BY items.id
+    FOR UPDATE;
+    PERFORM 1 FROM item_variants WHERE item_variants.id = ANY (line_variant_ids) AND item_variants.stock IS NOT NULL
+    ORDER BY item_variants.id
+    FOR UPDATE;
+
+    --Позиции списываются по очереди после записи предыдущих покупок, поэтому лимит на пользователя
+    --учитывает сумму позиций с одним товаром
+    FOR i IN 1 .. array_length(item_names_param, 1) LOOP
+        SELECT * INTO variant FROM item_variants WHERE item_variants.id = line_variant_ids[i];
+        SELECT COALESCE(variant.price, items.price) INTO line_price FROM items WHERE items.id = variant.item_id;
+
+        PERFORM take_item_stock(user_id_param, variant.item_id, quantities_param[i]);
+        PERFORM take_variant_stock(variant.id, quantities_param[i]);
+
+        INSERT INTO user_items (user_id, item_id, variant_id, amount)
+        VALUES (user_id_param, variant.item_id, variant.id, quantities_param[i])
+        ON CONFLICT (user_id, variant_id)
+            DO UPDATE SET amount = user_items.amount + EXCLUDED.amount;
+
+        INSERT INTO purchases (buyer_id, item_id, variant_id, amount, unit_price, total_cost, order_id)
+        VALUES (user_id_param, variant.item_id, variant.id, quantities_param[i], line_price,
+                quantities_param[i] * line_price, new_order_id)
+        RETURNING id INTO new_purchase_id;
+
+        PERFORM post_ledger_entry('purchase', ledger_user_account(user_id_param),
+                                  ledger_system_account('shop_revenue'), quantities_param[i] * line_price,
+                                  NULL, new_purchase_id);
+    END LOOP;
+
+    RETURN QUERY SELECT new_order_id, order_total;
+END;
+$$ LANGUAGE plpgsql;
+
+--Каталог товаров с вариантами: variants - варианты кроме варианта по умолчанию с ценой с учетом замены
+DROP FUNCTION get_catalog(INT);
+
+CREATE FUNCTION get_catalog(user_id_param INT)
+    RETURNS TABLE(name VARCHAR(32), price INT, stock INT, per_user_limit INT, purchased INT, variants JSON) AS $$
+    SELECT items.name, items.price, items.stock, items.per_user_limit,
+           CASE WHEN items.per_user_limit IS NULL THEN 0 ELSE item_purchased_quantity(user_id_param, items.id) END,
+           (SELECT json_agg(json_build_object(
+                                'sku', item_variants.sku,
+                                'attributes', item_variants.attributes,
+                                'price', COALESCE(item_variants.price, items.price),
+                                'stock', item_variants.stock)
+                            ORDER BY item_variants.id)
+            FROM item_variants
+            WHERE item_variants.item_id = items.id AND NOT item_variants.is_default)
+    FROM items
+    ORDER BY items.id;
+$$ LANGUAGE sql STABLE;
+
+--Создает вариант товара от имени администратора. Если товара нет, ничего не возвращает,
+--занятый артикул - ошибка уникальности.
+CREATE FUNCTION create_item_variant(admin_id_param INT, item_name_param VARCHAR(32), sku_param VARCHAR(64),
+                                    attributes_param JSONB, price_param INT, stock_param INT)
+    RETURNS TABLE(sku VARCHAR(64), attributes JSONB, price INT, stock INT) AS $$
+DECLARE
+    item items%ROWTYPE;
+    new_variant item_variants%ROWTYPE;
+BEGIN
+    SELECT * INTO item FROM items WHERE items.name = item_name_param;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO item_variants (item_id, sku, attributes, price, stock, created_by)
+    VALUES (item.id, sku_param, COALESCE(attributes_param, '{}'), price_param, stock_param, admin_id_param)
+    RETURNING * INTO new_variant;
+
+    IF stock_param IS NOT NULL THEN
+        INSERT INTO item_stock_changes (item_id, variant_id, admin_id, previous_stock, new_stock, per_user_limit)
+        VALUES (item.id, new_variant.id, admin_id_param, NULL, stock_param, item.per_user_limit);
+    END IF;
+
+    RETURN QUERY SELECT new_variant.sku, new_variant.attributes, COALESCE(new_variant.price, item.price),
+                        new_variant.stock;
+END;
+$$ LANGUAGE plpgsql;
+
+--Пополняет остаток варианта от имени администратора. Если варианта нет, ничего не возвращает, если его
+--остаток не ограничен - ошибка STK03.
+CREATE FUNCTION restock_item_variant(admin_id_param INT, sku_param VARCHAR(64), quantity_param INT)
+    RETURNS TABLE(sku VARCHAR(64), attributes JSONB, price INT, stock INT) AS $$
+DECLARE
+    variant item_variants%ROWTYPE;
+BEGIN
+    IF quantity_param <= 0 THEN
+        RAISE EXCEPTION 'Количество пополнения должно быть > 0';
+    END IF;
+
+    SELECT * INTO variant FROM item_variants WHERE item_variants.sku = sku_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF variant.stock IS NULL THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'STK03',
+            MESSAGE = 'Остаток варианта товара не ограничен: ' || variant.sku;
+    END IF;
+
+    UPDATE item_variants SET stock = item_variants.stock + quantity_param WHERE item_variants.id = variant.id;
+    INSERT INTO item_stock_changes (item_id, variant_id, admin_id, previous_stock, new_stock, per_user_limit)
+    SELECT variant.item_id, variant.id, admin_id_param, variant.stock, variant.stock + quantity_param,
+           items.per_user_limit
+    FROM items
+    WHERE items.id = variant.item_id;
+
+    RETURN QUERY SELECT item_variants.sku, item_variants.attributes, COALESCE(item_variants.price, items.price),
+                        item_variants.stock
+                 FROM item_variants
+                          JOIN items ON items.id = item_variants.item_id
+                 WHERE item_variants.id = variant.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Одобренный возврат списывает предметы того варианта, который был куплен, и возвращает их в остатки
+--товара и варианта
+CREATE OR REPLACE FUNCTION approve_purchase_return(admin_id_param INT, return_id_param INT)
+    RETURNS SETOF purchase_returns_view AS $$
+DECLARE
+    purchase_return purchase_returns%ROWTYPE;
+    purchase purchases%ROWTYPE;
+BEGIN
+    SELECT * INTO purchase_return FROM purchase_returns WHERE purchase_returns.id = return_id_param FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    IF purchase_return.status <> 'pending' THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET03',
+            MESSAGE = 'Возврат уже рассмотрен: ' || purchase_return.status;
+    END IF;
+
+    SELECT * INTO purchase FROM purchases WHERE purchases.id = purchase_return.purchase_id;
+    PERFORM 1 FROM users WHERE users.id = purchase.buyer_id FOR UPDATE;
+
+    UPDATE user_items
+    SET amount = user_items.amount - purchase_return.quantity
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.variant_id = purchase.variant_id
+      AND user_items.amount >= purchase_return.quantity;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION USING
+            ERRCODE = 'RET04',
+            MESSAGE = 'У покупателя нет возвращаемых предметов';
+    END IF;
+    DELETE FROM user_items
+    WHERE user_items.user_id = purchase.buyer_id AND user_items.variant_id = purchase.variant_id
+      AND user_items.amount = 0;
+
+    UPDATE items SET stock = items.stock + purchase_return.quantity
+    WHERE items.id = purchase.item_id AND items.stock IS NOT NULL;
+    UPDATE item_variants SET stock = item_variants.stock + purchase_return.quantity
+    WHERE item_variants.id = purchase.variant_id AND item_variants.stock IS NOT NULL;
+
+    UPDATE purchase_returns
+    SET status = 'approved', resolved_at = CURRENT_TIMESTAMP, admin_id = admin_id_param
+    WHERE purchase_returns.id = purchase_return.id;
+
+    PERFORM post_ledger_entry('refund', ledger_system_account('shop_revenue'), ledger_user_account(purchase.buyer_id),
+                              purchase_return.quantity * purchase.unit_price, NULL, purchase.id);
+
+    RETURN QUERY SELECT * FROM purchase_returns_view WHERE purchase_returns_view.id = purchase_return.id;
+END;
+$$ LANGUAGE plpgsql;
+
+--Инвентарь показывает артикул и атрибуты вариантов, кроме вариантов по умолчанию
+CREATE OR REPLACE FUNCTION get_user_info(user_id_param INT, expiry_period_param INTERVAL, expiring_window_param INTERVAL)
+    RETURNS JSON AS $$
+    SELECT json_build_object(
+        'coins', users.balance,
+        'inventory', (
+            SELECT json_agg(json_strip_nulls(json_build_object(
+                                'type', items.name,
+                                'variant', CASE WHEN NOT item_variants.is_default THEN item_variants.sku END,
+                                'attributes', CASE WHEN item_variants.attributes <> '{}' THEN item_variants.attributes END,
+                                'quantity', user_items.amount))
+                            ORDER BY items.id, item_variants.id)
+            FROM user_items
+                     JOIN items ON user_items.item_id = items.id
+                     JOIN item_variants ON item_variants.id = user_items.variant_id
+            WHERE user_items.user_id = users.id
+        ),
+        'coinHistory', json_build_object(
+            'received', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(senders.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason,
+                                    'message', transactions.message,
+                                    'category', transactions.category))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users senders ON senders.id = COALESCE(transactions.sender_id, transactions.admin_id)
+                WHERE transactions.receiver_id = users.id
+            ),
+            'sent', (
+                SELECT json_agg(json_strip_nulls(json_build_object(
+                                    'user', COALESCE(receivers.username, ''),
+                                    'amount', transactions.amount,
+                                    'type', NULLIF(transactions.kind, 'transfer'),
+                                    'reason', transactions.reason,
+                                    'message', transactions.message,
+                                    'category', transactions.category))
+                                ORDER BY transactions.id)
+                FROM transactions
+                         LEFT JOIN users receivers ON receivers.id = COALESCE(transactions.receiver_id, transactions.admin_id)
+                WHERE transactions.sender_id = users.id
+            )
+        ),
+        'expiringSoon', (
+            SELECT json_agg(json_build_object('amount', lots.amount, 'expiresAt', lots.expires_at)
+                            ORDER BY lots.expires_at)
+            FROM (
+                SELECT SUM(coin_lots.amount)::INT AS amount,
+                       (coin_lots.issued_at + expiry_period_param) AT TIME ZONE 'UTC' AS expires_at
+                FROM coin_lots
+                WHERE coin_lots.user_id = users.id
+                  AND expiry_period_param > INTERVAL '0'
+                  AND coin_lots.issued_at + expiry_period_param < CURRENT_TIMESTAMP + expiring_window_param
+                GROUP BY coin_lots.issued_at
+            ) lots
+        )
+    )
+    FROM users
+    WHERE users.id = user_id_param;
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/schedule"
+	"time"
+)
+
+// runAllowances выполняет правила регулярных начислений, у которых наступил очередной период.
+// Пропущенные периоды не наверстываются: если сервис не работал, выполняется только последний из них.
+// Повторное выполнение периода другой репликой исключает хранилище.
+func (a *App) runAllowances() {
+	rules, err := a.store.GetAllowanceRules()
+	if err != nil {
+		a.logger.Printf("Ошибка получения правил начислений: %v", err)
+		return
+	}
+	now := a.clock().UTC()
+	for _, rule := range rules {
+		if rule.Paused {
+			continue
+		}
+		period, ok, err := duePeriod(rule, now)
+		if err != nil {
+			a.logger.Printf("Правило начислений %d %q: %v", rule.ID, rule.Name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		run, claimed, err := a.store.RunAllowance(rule.ID, period)
+		if err != nil {
+			a.logger.Printf("Ошибка выполнения правила начислений %d %q: %v", rule.ID, rule.Name, err)
+			continue
+		}
+		if claimed {
+			a.logger.Printf("Правило начислений %d %q за %s: %d пользователей, %d монет",
+				rule.ID, rule.Name, period.Format(time.RFC3339), run.Users, run.Total)
+		}
+	}
+}
+
+// duePeriod возвращает последний наступивший к now и еще не выполненный период правила.
+// Периоды до создания правила не выполняются.
+func duePeriod(rule models.AllowanceRule, now time.Time) (time.Time, bool, error) {
+	s, err := schedule.Parse(rule.Schedule)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	since := rule.CreatedAt.UTC()
+	if rule.LastRun != nil && rule.LastRun.After(since) {
+		since = rule.LastRun.UTC()
+	}
+	period, ok := s.Last(since, now)
+	return period, ok, nil
+}
@@ -1,11 +1,125 @@
 package app
 
 import (
+	"avito_internship/internal/auth"
+	"avito_internship/internal/config"
 	"avito_internship/internal/repository"
 	"avito_internship/internal/transport"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
 )
 
+// Dependencies - внешние зависимости приложения.
+// Незаданные поля заполняются значениями по умолчанию на основе конфигурации.
+type Dependencies struct {
+	Store  repository.Store
+	Tokens *auth.TokenService
+	Clock  func() time.Time
+	Logger *log.Logger
+}
+
+// App - экземпляр сервиса со всеми его зависимостями.
+// Несколько экземпляров могут работать в одном процессе независимо друг от друга.
+type App struct {
+	cfg     *config.Config
+	store   repository.Store
+	tokens  *auth.TokenService
+	clock   func() time.Time
+	logger  *log.Logger
+	handler http.Handler
+}
+
+// New собирает приложение из конфигурации и явно переданных зависимостей
+func New(cfg *config.Config, deps Dependencies) (*App, error) {
+	a := &App{
+		cfg:    cfg,
+		store:  deps.Store,
+		tokens: deps.Tokens,
+		clock:  deps.Clock,
+		logger: deps.Logger,
+	}
+	if a.clock == nil {
+		a.clock = time.Now
+	}
+	if a.logger == nil {
+		a.logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	if a.tokens == nil {
+		a.tokens = auth.NewTokenService(cfg.JWTSecret, a.clock)
+	}
+	if a.store == nil {
+		store, err := newStore(cfg, a.logger)
+		if err != nil {
+			return nil, err
+		}
+		a.store = store
+	}
+	a.handler = transport.NewRouter(a.store, a.tokens, cfg, a.clock)
+	return a, nil
+}
+
+// Handler возвращает корневой http.Handler приложения
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// Serve запускает фоновые задачи и HTTP-сервер на порту из конфигурации и блокируется до его остановки
+func (a *App) Serve() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.startJobs(ctx)
+
+	server := transport.NewServer(":"+a.cfg.ServerPort, a.handler, a.logger)
+	a.logger.Printf("Сервер запущен на порту %s", a.cfg.ServerPort)
+	return server.ListenAndServe()
+}
+
+// Run собирает приложение из переменных окружения и запускает его
 func Run() {
-	repository.Connect()
-	transport.Run()
+	a, err := New(config.Get(), Dependencies{})
+	if err != nil {
+		log.Fatalf("Ошибка инициализации приложения: %v", err)
+	}
+	log.Fatal(a.Serve())
+}
+
+// applyMigrations применяет недостающие миграции через отдельное соединение,
+// которое закрывается до создания основного пула
+func applyMigrations(cfg *config.Config, logger *log.Logger) error {
+	db, err := repository.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	runner, err := newMigrationRunner(db)
+	if err != nil {
+		return err
+	}
+	applied, err := runner.Up(context.Background())
+	for _, m := range applied {
+		logger.Printf("Применена миграция %03d-%s", m.Version, m.Name)
+	}
+	return err
+}
+
+// newStore выбирает реализацию хранилища по конфигурации.
+// Для PostgreSQL при включенном MigrateOnStart предварительно применяет недостающие миграции.
+func newStore(cfg *config.Config, logger *log.Logger) (repository.Store, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		return repository.NewMemory(), nil
+	case config.StoragePostgres:
+		if cfg.MigrateOnStart {
+			if err := applyMigrations(cfg, logger); err != nil {
+				return nil, fmt.Errorf("ошибка применения миграций: %w", err)
+			}
+		}
+		return repository.Connect(cfg)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища: %s", cfg.Storage)
+	}
 }
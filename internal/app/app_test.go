@@ -0,0 +1,221 @@
+package app
+
+import (
+	"avito_internship/internal/config"
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// -------------
+// Тесты New
+// -------------
+func TestNewIndependentInstances(t *testing.T) {
+	cfg := &config.Config{JWTSecret: []byte("secret")}
+	first, err := New(cfg, Dependencies{Store: repository.NewMemory()})
+	require.NoError(t, err)
+	second, err := New(cfg, Dependencies{Store: repository.NewMemory()})
+	require.NoError(t, err)
+
+	// Один и тот же логин с разными паролями регистрируется в каждом экземпляре независимо
+	assert.Equal(t, http.StatusOK, authStatus(first, "user", "first"))
+	assert.Equal(t, http.StatusOK, authStatus(second, "user", "second"))
+	assert.Equal(t, http.StatusUnauthorized, authStatus(first, "user", "second"))
+}
+
+func TestNewUnknownStorage(t *testing.T) {
+	_, err := New(&config.Config{Storage: "unknown"}, Dependencies{})
+	assert.Error(t, err)
+}
+
+func TestNewHandlersUseClock(t *testing.T) {
+	cfg := &config.Config{JWTSecret: []byte("secret"), PaymentRequestTTL: time.Hour, AdminOperationLimit: 100,
+		AdminUsers: []string{"admin"}}
+	now := time.Date(2031, 3, 1, 12, 0, 0, 0, time.UTC)
+	a, err := New(cfg, Dependencies{Store: repository.NewMemory(), Clock: func() time.Time { return now }})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, authStatus(a, "bob", "password"))
+
+	// Срок запроса монет по умолчанию отсчитывается от часов приложения
+	req := httptest.NewRequest("POST", "/api/paymentRequests", strings.NewReader(`{"payer": "bob", "amount": 10}`))
+	req.Header.Set("Authorization", "Bearer "+authToken(t, a, "alice", "password"))
+	rr := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var created models.PaymentRequest
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, now.Add(time.Hour), created.ExpiresAt)
+
+	// Пробный запуск правила начислений показывает запуски после часов приложения
+	req = httptest.NewRequest("POST", "/api/admin/allowances/preview",
+		strings.NewReader(`{"name": "daily", "amount": 10, "schedule": "@daily"}`))
+	req.Header.Set("Authorization", "Bearer "+authToken(t, a, "admin", "password"))
+	rr = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var preview models.AllowancePreview
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&preview))
+	assert.Equal(t, time.Date(2031, 3, 2, 0, 0, 0, 0, time.UTC), preview.NextRuns[0])
+}
+
+// authStatus выполняет запрос /api/auth к приложению и возвращает код ответа
+func authStatus(a *App, username, password string) int {
+	return authRequest(a, username, password).Code
+}
+
+// authToken выполняет запрос /api/auth к приложению и возвращает выданный токен
+func authToken(t *testing.T, a *App, username, password string) string {
+	rr := authRequest(a, username, password)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response models.AuthResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return response.Token
+}
+
+// authRequest выполняет запрос /api/auth к приложению
+func authRequest(a *App, username, password string) *httptest.ResponseRecorder {
+	body := `{"username": "` + username + `", "password": "` + password + `"}`
+	req := httptest.NewRequest("POST", "/api/auth", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+// ---------------------
+// Тесты runPeriodically
+// ---------------------
+func TestRunPeriodicallyStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		runPeriodically(ctx, time.Millisecond, func() { calls <- struct{}{} })
+		close(done)
+	}()
+
+	<-calls
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runPeriodically не остановился после отмены контекста")
+	}
+}
+
+func TestRunPeriodicallyDisabled(t *testing.T) {
+	called := false
+	runPeriodically(context.Background(), 0, func() { called = true })
+	assert.False(t, called)
+}
+
+// -------------------
+// Тесты runAllowances
+// -------------------
+func TestRunAllowancesOncePerPeriod(t *testing.T) {
+	store := repository.NewMemory()
+	userID, _, err := store.GetUserIDPassHashOrRegister("alice", "hash", 1000)
+	require.NoError(t, err)
+	_, err = store.CreateAllowanceRule(userID, models.AllowanceRule{Name: "hourly", Amount: 10, Schedule: "@hourly"})
+	require.NoError(t, err)
+	_, err = store.CreateAllowanceRule(userID, models.AllowanceRule{
+		Name: "paused", Amount: 10, Schedule: "* * * * *", Paused: true,
+	})
+	require.NoError(t, err)
+
+	now := time.Now().Add(3 * time.Hour)
+	a, err := New(&config.Config{JWTSecret: []byte("secret")}, Dependencies{
+		Store:  store,
+		Clock:  func() time.Time { return now },
+		Logger: log.New(io.Discard, "", 0),
+	})
+	require.NoError(t, err)
+
+	// Пропущенные периоды не наверстываются, повторный вызов ничего не начисляет
+	a.runAllowances()
+	a.runAllowances()
+	info, err := store.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1010, info.Coins)
+
+	rules, err := store.GetAllowanceRules()
+	require.NoError(t, err)
+	for _, rule := range rules {
+		runs, err := store.GetAllowanceRuns(rule.ID, 10)
+		require.NoError(t, err)
+		if rule.Paused {
+			assert.Empty(t, runs)
+			continue
+		}
+		require.Len(t, runs, 1)
+		assert.Equal(t, now.UTC().Truncate(time.Hour), runs[0].Period.UTC())
+	}
+}
+
+// -----------------
+// Тесты expireCoins
+// -----------------
+func TestExpireCoins(t *testing.T) {
+	store := repository.NewMemory()
+	userID, _, err := store.GetUserIDPassHashOrRegister("alice", "hash", 1000)
+	require.NoError(t, err)
+
+	cfg := &config.Config{JWTSecret: []byte("secret"), CoinExpiryPeriod: time.Hour}
+	now := time.Now()
+	a, err := New(cfg, Dependencies{
+		Store:  store,
+		Clock:  func() time.Time { return now },
+		Logger: log.New(io.Discard, "", 0),
+	})
+	require.NoError(t, err)
+
+	// Монеты еще не просрочены
+	a.expireCoins()
+	info, err := store.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+
+	now = now.Add(2 * time.Hour)
+	a.expireCoins()
+	info, err = store.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, info.Coins)
+	assert.Equal(t, []models.CoinTransaction{{Amount: 1000, Type: models.TransactionExpiry}}, info.CoinHistory.Sent)
+}
+
+// ---------------------
+// Тесты settleTransfers
+// ---------------------
+func TestSettleTransfers(t *testing.T) {
+	store := repository.NewMemory()
+	alice, _, err := store.GetUserIDPassHashOrRegister("alice", "hash", 1000)
+	require.NoError(t, err)
+	bob, _, err := store.GetUserIDPassHashOrRegister("bob", "hash", 1000)
+	require.NoError(t, err)
+	_, err = store.HoldTransfer(alice, 300, "bob", models.TransferNote{}, time.Nanosecond, models.SpendingLimits{})
+	require.NoError(t, err)
+
+	a, err := New(&config.Config{JWTSecret: []byte("secret")}, Dependencies{
+		Store:  store,
+		Logger: log.New(io.Discard, "", 0),
+	})
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	a.settleTransfers()
+	info, err := store.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1300, info.Coins)
+	pending, err := store.GetPendingTransfers(alice, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
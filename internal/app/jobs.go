@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// startJobs запускает фоновые задачи сервиса. Задачи останавливаются при отмене ctx.
+func (a *App) startJobs(ctx context.Context) {
+	go runPeriodically(ctx, a.cfg.IdempotencyCleanupInterval, a.cleanupIdempotencyKeys)
+	go runPeriodically(ctx, a.cfg.AllowanceCheckInterval, a.runAllowances)
+	go runPeriodically(ctx, a.cfg.TransferSettleInterval, a.settleTransfers)
+	if a.cfg.CoinExpiryPeriod > 0 {
+		go runPeriodically(ctx, a.cfg.CoinExpiryCheckInterval, a.expireCoins)
+	}
+}
+
+// runPeriodically вызывает job каждые interval до отмены ctx.
+// Неположительный interval отключает задачу.
+func runPeriodically(ctx context.Context, interval time.Duration, job func()) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job()
+		}
+	}
+}
+
+// cleanupIdempotencyKeys удаляет ключи идемпотентности старше IdempotencyKeyTTL
+func (a *App) cleanupIdempotencyKeys() {
+	deleted, err := a.store.DeleteExpiredIdempotencyKeys(a.cfg.IdempotencyKeyTTL)
+	if err != nil {
+		a.logger.Printf("Ошибка удаления устаревших ключей идемпотентности: %v", err)
+		return
+	}
+	if deleted > 0 {
+		a.logger.Printf("Удалено устаревших ключей идемпотентности: %d", deleted)
+	}
+}
+
+// expireCoins сжигает монеты, выпущенные раньше чем CoinExpiryPeriod назад
+func (a *App) expireCoins() {
+	users, total, err := a.store.ExpireCoins(a.clock().UTC().Add(-a.cfg.CoinExpiryPeriod))
+	if err != nil {
+		a.logger.Printf("Ошибка сжигания просроченных монет: %v", err)
+		return
+	}
+	if users > 0 {
+		a.logger.Printf("Сгорело монет: %d у %d пользователей", total, users)
+	}
+}
+
+// settleTransfers зачисляет получателям отложенные переводы, срок которых наступил
+func (a *App) settleTransfers() {
+	settled, err := a.store.SettlePendingTransfers()
+	if err != nil {
+		a.logger.Printf("Ошибка зачисления отложенных переводов: %v", err)
+		return
+	}
+	if settled > 0 {
+		a.logger.Printf("Зачислено отложенных переводов: %d", settled)
+	}
+}
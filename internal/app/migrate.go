@@ -0,0 +1,85 @@
+package app
+
+import (
+	"avito_internship/database"
+	"avito_internship/internal/config"
+	"avito_internship/internal/migrate"
+	"avito_internship/internal/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+)
+
+// Migrate выполняет подкоманду migrate: up применяет недостающие миграции,
+// down [N] откатывает N последних (по умолчанию одну), status выводит состояние всех миграций.
+func Migrate(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: migrate up|down [N]|status")
+	}
+	db, err := repository.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	runner, err := newMigrationRunner(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied  %03d-%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("некорректное количество шагов: %s", args[1])
+			}
+		}
+		reverted, err := runner.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %03d-%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified)"
+			}
+			fmt.Fprintf(out, "%03d-%-30s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда migrate: %s", args[0])
+	}
+}
+
+// newMigrationRunner создает Runner для встроенных в бинарник миграций
+func newMigrationRunner(db *sql.DB) (*migrate.Runner, error) {
+	fsys, err := fs.Sub(database.Migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, migrations), nil
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"avito_internship/internal/config"
+	"avito_internship/internal/reconcile"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrBalanceMismatch - подкоманда reconcile нашла пользователей с расходящимся балансом
+var ErrBalanceMismatch = errors.New("balance mismatches found")
+
+// Reconcile выполняет подкоманду reconcile [-fix] [-report file.json]: сверяет балансы всех пользователей
+// с историей переводов и покупок и с журналом проводок, выводит расхождения и строки, из которых
+// складывается баланс. При расхождениях возвращает ErrBalanceMismatch.
+// С флагом -fix перед проверкой пересчитывает кеш балансов по журналу проводок и выводит исправленные балансы.
+// С флагом -report дополнительно записывает полный отчет в JSON.
+func Reconcile(cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	flags.SetOutput(out)
+	reportPath := flags.String("report", "", "путь к файлу JSON-отчета")
+	fix := flags.Bool("fix", false, "пересчитать кеш балансов по журналу проводок перед проверкой")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := repository.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+	var recomputed []reconcile.Recomputed
+	if *fix {
+		if recomputed, err = reconcile.Recompute(ctx, db); err != nil {
+			return err
+		}
+	}
+	report, err := reconcile.Check(ctx, db)
+	if err != nil {
+		return err
+	}
+	report.Recomputed = recomputed
+
+	printReport(out, report)
+	if *reportPath != "" {
+		if err := writeReport(*reportPath, report); err != nil {
+			return err
+		}
+	}
+	if len(report.Mismatches) > 0 {
+		return ErrBalanceMismatch
+	}
+	return nil
+}
+
+// printReport выводит расхождения и итог проверки в текстовом виде
+func printReport(out io.Writer, report reconcile.Report) {
+	const dateLayout = "2006-01-02 15:04:05"
+	for _, r := range report.Recomputed {
+		fmt.Fprintf(out, "recomputed user %d: balance %d -> %d\n", r.UserID, r.CachedBalance, r.LedgerBalance)
+	}
+	for _, m := range report.Mismatches {
+		fmt.Fprintf(out, "user %d %s: balance %d, expected %d (received %d - sent %d - purchases %d + refunds %d - held %d), ledger %d\n",
+			m.UserID, m.Username, m.Balance, m.Expected, m.Received, m.Sent, m.Purchases, m.Refunds, m.Held,
+			m.LedgerBalance)
+		for _, t := range m.Transfers {
+			fmt.Fprintf(out, "  transfer %d  %s  %-8s %-32s %d\n", t.ID, t.Date.Format(dateLayout), t.Direction, t.User, t.Amount)
+		}
+		for _, p := range m.PurchaseRows {
+			fmt.Fprintf(out, "  purchase %d  %s  %s x%d = %d", p.ID, p.Date.Format(dateLayout), p.Item, p.Quantity, p.TotalCost)
+			if p.Refunded > 0 {
+				fmt.Fprintf(out, ", refunded %d", p.Refunded)
+			}
+			fmt.Fprintln(out)
+		}
+		for _, p := range m.Postings {
+			fmt.Fprintf(out, "  ledger   %d  %s  %-8s %d\n", p.EntryID, p.Date.Format(dateLayout), p.Kind, p.Amount)
+		}
+	}
+	fmt.Fprintf(out, "checked %d users, %d mismatches\n", report.UsersChecked, len(report.Mismatches))
+}
+
+// writeReport записывает отчет в файл path в формате JSON
+func writeReport(path string, report reconcile.Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
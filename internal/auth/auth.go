@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"avito_internship/internal/config"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
@@ -11,10 +10,21 @@ import (
 
 var ErrInvalidCredentials = errors.New("invalid credentials")
 
+// TokenService выпускает и проверяет JWT-токены, подписанные секретом сервиса.
+type TokenService struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewTokenService создает сервис токенов с заданным секретом и источником текущего времени
+func NewTokenService(secret []byte, now func() time.Time) *TokenService {
+	return &TokenService{secret: secret, now: now}
+}
+
 // Authenticate выполняет вход или регистрирует пользователя.
 // Если пользователь найден, проверяет пароль и возвращает JWT если пароль верен.
 // Если пользователя нет, регистрирует его и выдает JWT.
-func Authenticate(username, password string, GetUserFromDB func(string, string) (int, []byte, error)) (string, error) {
+func (s *TokenService) Authenticate(username, password string, GetUserFromDB func(string, string) (int, []byte, error)) (string, error) {
 	if username == "" || password == "" || len(username) >= 32 {
 		return "", ErrInvalidCredentials
 	}
@@ -24,20 +34,20 @@ func Authenticate(username, password string, GetUserFromDB func(string, string)
 		return "", err
 	}
 	if isPasswordCorrect([]byte(password), passHash) {
-		return getJWT(userID), nil
+		return s.getJWT(userID), nil
 	} else {
 		return "", ErrInvalidCredentials
 	}
 }
 
 // VerifyJWT проверяет JWT и возвращает userID, если токен валиден.
-func VerifyJWT(tokenString string) (int, error) {
+func (s *TokenService) VerifyJWT(tokenString string) (int, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return config.Get().JWTSecret, nil
-	})
+		return s.secret, nil
+	}, jwt.WithTimeFunc(s.now))
 	if err != nil {
 		return 0, err
 	}
@@ -71,12 +81,12 @@ func isPasswordCorrect(providedPass, passHashFromDB []byte) bool {
 }
 
 // getJWT создает JWT-токен для user_id со сроком действия 24 часа.
-func getJWT(userID int) string {
+func (s *TokenService) getJWT(userID int) string {
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"exp":     s.now().Add(time.Hour * 24).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString(config.Get().JWTSecret)
+	tokenString, _ := token.SignedString(s.secret)
 	return tokenString
 }
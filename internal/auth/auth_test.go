@@ -1,11 +1,10 @@
 package auth
 
 import (
-	"avito_internship/internal/config"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,12 +12,8 @@ import (
 // --------------------
 // Инициализация тестов
 // --------------------
-// TestMain устанавливает заведомо известный секрет для проверки правильности работы авторизации
-func TestMain(m *testing.M) {
-	config.Get().SetJWTSecret([]byte("secret"))
-	code := m.Run()
-	os.Exit(code)
-}
+// tokens использует заведомо известный секрет для проверки правильности работы авторизации
+var tokens = NewTokenService([]byte("secret"), time.Now)
 
 // Валидная пара пароль - хэш для тестов
 var validPasswordHashPair = passHashPair{
@@ -71,25 +66,34 @@ func TestGetHashNilPass(t *testing.T) {
 // Тесты VerifyJWT
 // ---------------
 func TestVerifyJWTValid(t *testing.T) {
-	userID, err := VerifyJWT(validToken.token)
+	userID, err := tokens.VerifyJWT(validToken.token)
 	assert.Equal(t, userID, validToken.expectedUserID)
 	assert.NoError(t, err)
 }
 
 func TestVerifyJWTInvalid(t *testing.T) {
-	userID, err := VerifyJWT(invalidToken.token)
+	userID, err := tokens.VerifyJWT(invalidToken.token)
 	assert.Equal(t, userID, 0)
 	assert.Error(t, err)
 }
 
 func TestVerifyJWTExpiredToken(t *testing.T) {
-	userID, err := VerifyJWT(expiredToken.token)
+	userID, err := tokens.VerifyJWT(expiredToken.token)
+	assert.Equal(t, userID, 0)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestVerifyJWTExpiredByInjectedClock(t *testing.T) {
+	future := NewTokenService([]byte("secret"), func() time.Time {
+		return time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+	userID, err := future.VerifyJWT(validToken.token)
 	assert.Equal(t, userID, 0)
 	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
 }
 
 func TestVerifyJWTValidButSignedWithOtherKey(t *testing.T) {
-	userID, err := VerifyJWT(validOtherKeyToken.token)
+	userID, err := tokens.VerifyJWT(validOtherKeyToken.token)
 	assert.Equal(t, userID, 0)
 	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
 }
@@ -127,14 +131,14 @@ type tokenData struct {
 // Тесты getJWT
 // ------------
 func TestGetJWTValidUserID(t *testing.T) {
-	token := getJWT(1)
-	parsedID, _ := VerifyJWT(token)
+	token := tokens.getJWT(1)
+	parsedID, _ := tokens.VerifyJWT(token)
 	assert.Equal(t, parsedID, 1)
 }
 
 func TestGetJWTValidNegativeUserID(t *testing.T) {
-	token := getJWT(-1)
-	parsedID, _ := VerifyJWT(token)
+	token := tokens.getJWT(-1)
+	parsedID, _ := tokens.VerifyJWT(token)
 	assert.Equal(t, parsedID, -1)
 }
 
@@ -142,37 +146,37 @@ func TestGetJWTValidNegativeUserID(t *testing.T) {
 // Тесты Authentication
 // --------------------
 func TestAuthenticateValid(t *testing.T) {
-	token, err := Authenticate("test", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("test", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
 	assert.NoError(t, err, "Ожидалось что аутентификация пройдет успешно")
 	assert.NotEmpty(t, token, "Ожидался валидный токен, так как данные верны")
 }
 
 func TestAuthenticateInvalidPassword(t *testing.T) {
-	token, err := Authenticate("test", string(invalidPasswordHashPair.password), invalidGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("test", string(invalidPasswordHashPair.password), invalidGetUserIDPassHashFromDB)
 	assert.Error(t, err, "Ожидалась ошибка аутентификации из-за неверного пароля")
 	assert.Empty(t, token, "Ожидался пустой токен, так как пароль неверный")
 }
 
 func TestAuthenticateEmptyUsername(t *testing.T) {
-	token, err := Authenticate("", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
 	assert.Error(t, err, "Ожидалась ошибка аутентификации из-за невалидного логина")
 	assert.Empty(t, token, "Ожидался пустой токен, так как аутентификация не пройдена")
 }
 
 func TestAuthenticateLongUsername(t *testing.T) {
-	token, err := Authenticate("1234567890123456789012345678901234567890", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("1234567890123456789012345678901234567890", string(validPasswordHashPair.password), validGetUserIDPassHashFromDB)
 	assert.Error(t, err, "Ожидалась ошибка аутентификации из-за невалидного логина")
 	assert.Empty(t, token, "Ожидался пустой токен, так как аутентификация не пройдена")
 }
 
 func TestAuthenticateEmptyPassword(t *testing.T) {
-	token, err := Authenticate("test", "", validGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("test", "", validGetUserIDPassHashFromDB)
 	assert.Error(t, err, "Ожидалась ошибка аутентификации из-за невалидного пароля")
 	assert.Empty(t, token, "Ожидался пустой токен, так как аутентификация не пройдена")
 }
 
 func TestAuthenticateErrorFromRepository(t *testing.T) {
-	token, err := Authenticate("test", string(validPasswordHashPair.password), errorGetUserIDPassHashFromDB)
+	token, err := tokens.Authenticate("test", string(validPasswordHashPair.password), errorGetUserIDPassHashFromDB)
 	assert.ErrorIs(t, err, databaseError, "Ожидалась ошибка аутентификации из-за ошибки базы данных")
 	assert.Empty(t, token, "Ожидался пустой токен, так как аутентификация не пройдена")
 }
@@ -4,7 +4,22 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+// Поддерживаемые типы хранилища
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+// Режимы отмены перевода, когда у получателя не хватает монет
+const (
+	ReversalPartial = "partial"
+	ReversalDebt    = "debt"
 )
 
 var (
@@ -20,26 +35,105 @@ type Config struct {
 	DatabasePass string
 	DatabaseName string
 	DatabaseHost string
-	JWTSecret    []byte
+	// Параметры пула соединений с базой данных
+	DatabaseMaxConns          int32
+	DatabaseMinConns          int32
+	DatabaseMaxConnLifetime   time.Duration
+	DatabaseMaxConnIdleTime   time.Duration
+	DatabaseHealthCheckPeriod time.Duration
+	JWTSecret                 []byte
+	// Storage - тип хранилища: postgres или memory
+	Storage string
+	// MigrateOnStart - применять ли недостающие миграции при запуске сервиса
+	MigrateOnStart bool
+	// IdempotencyKeyTTL - сколько хранятся ключи идемпотентности и сохраненные ответы
+	IdempotencyKeyTTL time.Duration
+	// IdempotencyCleanupInterval - период удаления устаревших ключей идемпотентности
+	IdempotencyCleanupInterval time.Duration
+	// AdminUsers - имена пользователей, которые считаются администраторами независимо от роли в базе
+	AdminUsers []string
+	// AdminOperationLimit - наибольшая сумма, которую администратор может начислить или списать
+	// одному пользователю за одну операцию
+	AdminOperationLimit int
+	// StartingBalance - приветственное начисление новому пользователю, ноль отключает его
+	StartingBalance int
+	// AllowanceCheckInterval - как часто планировщик проверяет, не наступил ли период правил начислений
+	AllowanceCheckInterval time.Duration
+	// CoinExpiryPeriod - через сколько после выпуска монеты сгорают, ноль - не сгорают
+	CoinExpiryPeriod time.Duration
+	// CoinExpiryWarning - за сколько до сгорания монеты показываются в /api/info
+	CoinExpiryWarning time.Duration
+	// CoinExpiryCheckInterval - период задачи, которая сжигает просроченные монеты
+	CoinExpiryCheckInterval time.Duration
+	// LimitPerTransfer, LimitDaily, LimitMonthly и LimitPerRecipient - лимиты трат по умолчанию:
+	// на один перевод, на переводы и покупки за сутки и за месяц, на переводы одному получателю за сутки.
+	// Ноль отключает лимит. Администратор может задать пользователю свои лимиты.
+	LimitPerTransfer  int
+	LimitDaily        int
+	LimitMonthly      int
+	LimitPerRecipient int
+	// PaymentRequestTTL - наибольший срок действия запроса монет, он же срок по умолчанию
+	PaymentRequestTTL time.Duration
+	// TransferMaxDelay - наибольшая задержка отложенного перевода, ноль запрещает отложенные переводы
+	TransferMaxDelay time.Duration
+	// TransferSettleInterval - период задачи, которая зачисляет отложенные переводы получателям
+	TransferSettleInterval time.Duration
+	// ReversalMode - что делать при отмене перевода, если у получателя не хватает монет: partial - вернуть
+	// отправителю то, что есть, debt - вернуть всю сумму, оставив получателю долг (минус на балансе).
+	// Любое другое значение считается partial.
+	ReversalMode string
+	// PurchaseReturnWindow - сколько времени после покупки можно запросить ее возврат, ноль запрещает возвраты
+	PurchaseReturnWindow time.Duration
 }
 
 // Get загружает конфигурацию из переменных окружения (только при первом вызове)
 // и возвращает указатель на структуру Config
 func Get() *Config {
 	once.Do(func() {
-		cfg = &Config{
-			ServerPort:   getEnv("SERVER_PORT", "8080", os.LookupEnv),
-			DatabasePort: getEnv("DATABASE_PORT", "5432", os.LookupEnv),
-			DatabaseUser: getEnv("DATABASE_USER", "postgres", os.LookupEnv),
-			DatabasePass: getEnv("DATABASE_PASSWORD", "password", os.LookupEnv),
-			DatabaseName: getEnv("DATABASE_NAME", "mydb", os.LookupEnv),
-			DatabaseHost: getEnv("DATABASE_HOST", "localhost", os.LookupEnv),
-			JWTSecret:    []byte(getEnv("JWT_SECRET", generateJWTSecret(), os.LookupEnv)),
-		}
+		cfg = Load(os.LookupEnv)
 	})
 	return cfg
 }
 
+// Load собирает новую конфигурацию, получая значения через lookupEnv.
+// В отличие от Get не кеширует результат, что позволяет создавать независимые конфигурации.
+func Load(lookupEnv func(string) (string, bool)) *Config {
+	return &Config{
+		ServerPort:                 getEnv("SERVER_PORT", "8080", lookupEnv),
+		DatabasePort:               getEnv("DATABASE_PORT", "5432", lookupEnv),
+		DatabaseUser:               getEnv("DATABASE_USER", "postgres", lookupEnv),
+		DatabasePass:               getEnv("DATABASE_PASSWORD", "password", lookupEnv),
+		DatabaseName:               getEnv("DATABASE_NAME", "mydb", lookupEnv),
+		DatabaseHost:               getEnv("DATABASE_HOST", "localhost", lookupEnv),
+		DatabaseMaxConns:           int32(getEnvInt("DATABASE_MAX_CONNS", 50, lookupEnv)),
+		DatabaseMinConns:           int32(getEnvInt("DATABASE_MIN_CONNS", 10, lookupEnv)),
+		DatabaseMaxConnLifetime:    getEnvDuration("DATABASE_MAX_CONN_LIFETIME", time.Hour, lookupEnv),
+		DatabaseMaxConnIdleTime:    getEnvDuration("DATABASE_MAX_CONN_IDLE_TIME", 30*time.Minute, lookupEnv),
+		DatabaseHealthCheckPeriod:  getEnvDuration("DATABASE_HEALTH_CHECK_PERIOD", time.Minute, lookupEnv),
+		JWTSecret:                  []byte(getEnv("JWT_SECRET", generateJWTSecret(), lookupEnv)),
+		Storage:                    getEnv("STORAGE", StoragePostgres, lookupEnv),
+		MigrateOnStart:             getEnvBool("MIGRATE_ON_START", true, lookupEnv),
+		IdempotencyKeyTTL:          getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour, lookupEnv),
+		IdempotencyCleanupInterval: getEnvDuration("IDEMPOTENCY_CLEANUP_INTERVAL", time.Hour, lookupEnv),
+		AdminUsers:                 getEnvList("ADMIN_USERS", lookupEnv),
+		AdminOperationLimit:        getEnvInt("ADMIN_OPERATION_LIMIT", 10000, lookupEnv),
+		StartingBalance:            getEnvInt("STARTING_BALANCE", 1000, lookupEnv),
+		AllowanceCheckInterval:     getEnvDuration("ALLOWANCE_CHECK_INTERVAL", time.Minute, lookupEnv),
+		CoinExpiryPeriod:           getEnvDuration("COIN_EXPIRY_PERIOD", 0, lookupEnv),
+		CoinExpiryWarning:          getEnvDuration("COIN_EXPIRY_WARNING", 30*24*time.Hour, lookupEnv),
+		CoinExpiryCheckInterval:    getEnvDuration("COIN_EXPIRY_CHECK_INTERVAL", time.Hour, lookupEnv),
+		LimitPerTransfer:           getEnvInt("LIMIT_PER_TRANSFER", 0, lookupEnv),
+		LimitDaily:                 getEnvInt("LIMIT_DAILY", 0, lookupEnv),
+		LimitMonthly:               getEnvInt("LIMIT_MONTHLY", 0, lookupEnv),
+		LimitPerRecipient:          getEnvInt("LIMIT_PER_RECIPIENT", 0, lookupEnv),
+		PaymentRequestTTL:          getEnvDuration("PAYMENT_REQUEST_TTL", 7*24*time.Hour, lookupEnv),
+		TransferMaxDelay:           getEnvDuration("TRANSFER_MAX_DELAY", time.Hour, lookupEnv),
+		TransferSettleInterval:     getEnvDuration("TRANSFER_SETTLE_INTERVAL", time.Minute, lookupEnv),
+		ReversalMode:               getEnv("TRANSFER_REVERSAL_MODE", ReversalPartial, lookupEnv),
+		PurchaseReturnWindow:       getEnvDuration("PURCHASE_RETURN_WINDOW", 14*24*time.Hour, lookupEnv),
+	}
+}
+
 // getEnv получает значение переменной окружения по ключу.
 // Если переменная не задана, возвращает значение по умолчанию.
 func getEnv(key, fallback string, getEnvFunc func(string) (string, bool)) string {
@@ -49,14 +143,51 @@ func getEnv(key, fallback string, getEnvFunc func(string) (string, bool)) string
 	return fallback
 }
 
+// getEnvBool получает булево значение переменной окружения по ключу.
+// Если переменная не задана или не разбирается как bool, возвращает значение по умолчанию.
+func getEnvBool(key string, fallback bool, getEnvFunc func(string) (string, bool)) bool {
+	value, err := strconv.ParseBool(getEnv(key, "", getEnvFunc))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInt получает целое значение переменной окружения по ключу.
+// Если переменная не задана или не является числом, возвращает значение по умолчанию.
+func getEnvInt(key string, fallback int, getEnvFunc func(string) (string, bool)) int {
+	value, err := strconv.Atoi(getEnv(key, "", getEnvFunc))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration получает длительность (например 30s, 5m, 1h) из переменной окружения по ключу.
+// Если переменная не задана или не разбирается, возвращает значение по умолчанию.
+func getEnvDuration(key string, fallback time.Duration, getEnvFunc func(string) (string, bool)) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, "", getEnvFunc))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvList получает список значений, разделенных запятыми, из переменной окружения по ключу.
+// Пробелы вокруг значений и пустые значения отбрасываются.
+func getEnvList(key string, getEnvFunc func(string) (string, bool)) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, "", getEnvFunc), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // generateJWTSecret генерирует ключ для jwt токенов
 func generateJWTSecret() string {
 	secret := make([]byte, 32)
 	rand.Read(secret)
 	return base64.StdEncoding.EncodeToString(secret)
 }
-
-// SetJWTSecret позволяет устанавливать известный секрет для тестирования
-func (c *Config) SetJWTSecret(secret []byte) {
-	c.JWTSecret = secret
-}
@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 // ------------
@@ -23,6 +24,69 @@ func TestGetEnvEmpty(t *testing.T) {
 	assert.Equal(t, value, "test")
 }
 
+// ----------------
+// Тесты getEnvBool
+// ----------------
+func TestGetEnvBool(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		values := map[string]string{"ON": "true", "OFF": "false", "BROKEN": "maybe"}
+		value, ok := values[key]
+		return value, ok
+	}
+	assert.True(t, getEnvBool("ON", false, lookup))
+	assert.False(t, getEnvBool("OFF", true, lookup))
+	assert.True(t, getEnvBool("BROKEN", true, lookup))
+	assert.False(t, getEnvBool("MISSING", false, lookup))
+}
+
+// ----------------
+// Тесты getEnvList
+// ----------------
+func TestGetEnvList(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		return " hr, alice ,,bob ", key == "ADMIN_USERS"
+	}
+	assert.Equal(t, []string{"hr", "alice", "bob"}, getEnvList("ADMIN_USERS", lookup))
+	assert.Empty(t, getEnvList("MISSING", lookup))
+}
+
+// ----------
+// Тесты Load
+// ----------
+func TestLoad(t *testing.T) {
+	cfg := Load(mockGetEnv)
+	assert.Equal(t, "8888", cfg.ServerPort)
+	assert.Equal(t, "test", cfg.DatabaseName)
+	assert.Equal(t, "postgres", cfg.DatabaseUser)
+	assert.Equal(t, StoragePostgres, cfg.Storage)
+	assert.True(t, cfg.MigrateOnStart)
+	assert.NotEmpty(t, cfg.JWTSecret)
+	assert.Equal(t, 1000, cfg.StartingBalance)
+	assert.Zero(t, cfg.CoinExpiryPeriod)
+	assert.Equal(t, 30*24*time.Hour, cfg.CoinExpiryWarning)
+	assert.Zero(t, cfg.LimitPerTransfer)
+	assert.Zero(t, cfg.LimitDaily)
+	assert.Equal(t, 7*24*time.Hour, cfg.PaymentRequestTTL)
+	assert.Equal(t, time.Hour, cfg.TransferMaxDelay)
+	assert.Equal(t, time.Minute, cfg.TransferSettleInterval)
+	assert.Equal(t, ReversalPartial, cfg.ReversalMode)
+	assert.Equal(t, 14*24*time.Hour, cfg.PurchaseReturnWindow)
+}
+
+func TestLoadZeroStartingBalance(t *testing.T) {
+	cfg := Load(func(key string) (string, bool) {
+		return "0", key == "STARTING_BALANCE"
+	})
+	assert.Equal(t, 0, cfg.StartingBalance)
+}
+
+func TestLoadIndependentInstances(t *testing.T) {
+	first := Load(mockGetEnv)
+	second := Load(mockGetEnv)
+	assert.NotSame(t, first, second)
+	assert.NotEqual(t, first.JWTSecret, second.JWTSecret)
+}
+
 // -----------------------
 // Тесты generateJWTSecret
 // -----------------------
@@ -0,0 +1,308 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey - ключ advisory lock, под которым выполняются миграции.
+// Гарантирует, что несколько реплик сервиса не применяют миграции одновременно.
+const lockKey = 7240163
+
+// legacyVersion - последняя миграция, которую применял docker-entrypoint через database/init.sql.
+// Базы, созданные до появления schema_migrations, помечаются применившими миграции до этой версии включительно.
+const legacyVersion = 3
+
+var (
+	ErrChecksumMismatch = errors.New("checksum of applied migration has changed")
+	ErrNoDownMigration  = errors.New("down migration is missing")
+)
+
+// fileNamePattern разбирает имена вида 002-create_functions.sql и 002-create_functions.down.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)-(.+?)(\.down)?\.sql$`)
+
+// Migration - одна версия схемы с SQL для применения и отката
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status - состояние миграции в конкретной базе данных
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified - файл миграции изменился после применения
+	Modified bool
+}
+
+// Load читает миграции из корня fsys и возвращает их упорядоченными по версии
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		parts := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || parts == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(parts[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("миграции %s и %s имеют одинаковую версию %d", m.Name, parts[2], version)
+		}
+		if parts[3] != "" {
+			m.Down = string(content)
+		} else {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("у миграции %03d-%s нет файла применения", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Runner применяет и откатывает миграции, учитывая их в таблице schema_migrations
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New создает Runner для базы db и набора миграций
+func New(db *sql.DB, migrations []Migration) *Runner {
+	return &Runner{db: db, migrations: migrations}
+}
+
+// Up применяет все еще не примененные миграции по порядку, каждую в своей транзакции.
+// Возвращает список примененных миграций.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		state, err := r.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			checksum, ok := state[m.Version]
+			if ok {
+				if checksum != m.Checksum {
+					return fmt.Errorf("%03d-%s: %w", m.Version, m.Name, ErrChecksumMismatch)
+				}
+				continue
+			}
+			if err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3);",
+					m.Version, m.Name, m.Checksum)
+				return err
+			}); err != nil {
+				return fmt.Errorf("%03d-%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних примененных миграций в обратном порядке.
+// Возвращает список откаченных миграций.
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		state, err := r.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := state[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("%03d-%s: %w", m.Version, m.Name, ErrNoDownMigration)
+			}
+			if err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1;", m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("%03d-%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status возвращает состояние всех известных миграций, не изменяя базу данных
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	type appliedRow struct {
+		checksum  string
+		appliedAt time.Time
+	}
+	applied := make(map[int]appliedRow)
+	if exists {
+		rows, err := r.db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations;")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var row appliedRow
+			if err := rows.Scan(&version, &row.checksum, &row.appliedAt); err != nil {
+				return nil, err
+			}
+			applied[version] = row
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := Status{Migration: m}
+		if row, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = row.appliedAt
+			status.Modified = row.checksum != m.Checksum
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// withLock выполняет fn на выделенном соединении под advisory lock миграций
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", lockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedVersions возвращает контрольные суммы примененных миграций по версиям.
+// Если таблица пуста, а схема уже создана через database/init.sql, сначала помечает
+// миграции до legacyVersion примененными.
+func (r *Runner) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]string, error) {
+	if err := r.baselineLegacy(ctx, conn); err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	state := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		state[version] = checksum
+	}
+	return state, rows.Err()
+}
+
+// baselineLegacy регистрирует миграции, примененные docker-entrypoint до появления schema_migrations
+func (r *Runner) baselineLegacy(ctx context.Context, conn *sql.Conn) error {
+	var legacy bool
+	err := conn.QueryRowContext(ctx, `SELECT NOT EXISTS (SELECT 1 FROM schema_migrations)
+    AND to_regclass('users') IS NOT NULL;`).Scan(&legacy)
+	if err != nil || !legacy {
+		return err
+	}
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		for _, m := range r.migrations {
+			if m.Version > legacyVersion {
+				break
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3);",
+				m.Version, m.Name, m.Checksum); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTx выполняет fn в транзакции на соединении conn
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
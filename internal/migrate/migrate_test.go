@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"avito_internship/database"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// ----------
+// Тесты Load
+// ----------
+func TestLoadOrdersAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001-second.sql":      {Data: []byte("CREATE TABLE b ();")},
+		"000-first.sql":       {Data: []byte("CREATE TABLE a ();")},
+		"000-first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"README.md":           {Data: []byte("not a migration")},
+		"002-third.sql":       {Data: []byte("CREATE TABLE c ();")},
+		"002-third.down.sql":  {Data: []byte("DROP TABLE c;")},
+		"001-second.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	assert.Equal(t, 0, migrations[0].Version)
+	assert.Equal(t, "first", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE a;", migrations[0].Down)
+	assert.Equal(t, "second", migrations[1].Name)
+	assert.Equal(t, "third", migrations[2].Name)
+	assert.Len(t, migrations[0].Checksum, 64)
+	assert.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+}
+
+func TestLoadMissingUp(t *testing.T) {
+	fsys := fstest.MapFS{"000-first.down.sql": {Data: []byte("DROP TABLE a;")}}
+	_, err := Load(fsys)
+	assert.Error(t, err)
+}
+
+func TestLoadDuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000-first.sql":  {Data: []byte("CREATE TABLE a ();")},
+		"000-second.sql": {Data: []byte("CREATE TABLE b ();")},
+	}
+	_, err := Load(fsys)
+	assert.Error(t, err)
+}
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	fsys, err := fs.Sub(database.Migrations, "migrations")
+	require.NoError(t, err)
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i, m.Version, "версии миграций должны идти подряд")
+		assert.NotEmpty(t, m.Down, "у миграции %03d-%s нет отката", m.Version, m.Name)
+	}
+}
+
+// ------------
+// Тесты Runner
+// ------------
+func TestUpAppliesPendingMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	migrations := []Migration{
+		{Version: 0, Name: "first", Up: "CREATE TABLE a ();", Checksum: "aaa"},
+		{Version: 1, Name: "second", Up: "CREATE TABLE b ();", Checksum: "bbb"},
+	}
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT NOT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"legacy"}).AddRow(false))
+	mock.ExpectQuery("SELECT version, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(0, "aaa"))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(1, "second", "bbb").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := New(db, migrations).Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "second", applied[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpRejectsModifiedMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	migrations := []Migration{{Version: 0, Name: "first", Up: "CREATE TABLE a ();", Checksum: "changed"}}
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT NOT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"legacy"}).AddRow(false))
+	mock.ExpectQuery("SELECT version, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(0, "original"))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = New(db, migrations).Up(context.Background())
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpBaselinesLegacyDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	migrations := []Migration{
+		{Version: 0, Name: "first", Up: "CREATE TABLE a ();", Checksum: "aaa"},
+		{Version: legacyVersion + 1, Name: "new", Up: "CREATE TABLE b ();", Checksum: "bbb"},
+	}
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT NOT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"legacy"}).AddRow(true))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(0, "first", "aaa").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT version, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(0, "aaa"))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(legacyVersion+1, "new", "bbb").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := New(db, migrations).Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "new", applied[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownRevertsLastMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	migrations := []Migration{
+		{Version: 0, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;", Checksum: "aaa"},
+		{Version: 1, Name: "second", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;", Checksum: "bbb"},
+	}
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT NOT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"legacy"}).AddRow(false))
+	mock.ExpectQuery("SELECT version, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(0, "aaa").AddRow(1, "bbb"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := New(db, migrations).Down(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, "second", reverted[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,14 +1,28 @@
 package models
 
+import "time"
+
 type InfoResponse struct {
 	Coins       int         `json:"coins"`
 	Inventory   []Item      `json:"inventory"`
 	CoinHistory CoinHistory `json:"coinHistory"`
+	// ExpiringSoon - монеты, которые сгорят в ближайшее время, от ранних к поздним
+	ExpiringSoon []ExpiringCoins `json:"expiringSoon,omitempty"`
+}
+
+// ExpiringCoins - монеты одной партии, которые сгорят в момент ExpiresAt
+type ExpiringCoins struct {
+	Amount    int       `json:"amount"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
 
+// Item - предметы в инвентаре. Для вариантов товара, кроме варианта по умолчанию, указываются
+// артикул Variant и атрибуты варианта.
 type Item struct {
-	Type     string `json:"type"`
-	Quantity int    `json:"quantity"`
+	Type       string            `json:"type"`
+	Variant    string            `json:"variant,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Quantity   int               `json:"quantity"`
 }
 
 type CoinHistory struct {
@@ -16,9 +30,15 @@ type CoinHistory struct {
 	Sent     []CoinTransaction `json:"sent"`
 }
 
+// CoinTransaction - запись истории в /api/info. Для обычных переводов Type не указывается,
+// для начислений и списаний администратором User - имя администратора.
 type CoinTransaction struct {
-	User   string `json:"user"`
-	Amount int    `json:"amount"`
+	User     string `json:"user"`
+	Amount   int    `json:"amount"`
+	Type     string `json:"type,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -35,6 +55,455 @@ type AuthResponse struct {
 }
 
 type SendCoinRequest struct {
-	ToUser string `json:"toUser"`
-	Amount int    `json:"amount"`
+	ToUser   string `json:"toUser"`
+	Amount   int    `json:"amount"`
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
+	// DelayMinutes - через сколько минут зачислить перевод получателю, до этого отправитель может его отменить.
+	// Ноль - перевод выполняется сразу.
+	DelayMinutes int `json:"delayMinutes,omitempty"`
+}
+
+// TransferNote - необязательные сообщение и категория перевода, которые видят обе стороны в истории
+type TransferNote struct {
+	Message  string
+	Category string
+}
+
+// Категории переводов
+const (
+	CategoryThanks        = "thanks"
+	CategoryReimbursement = "reimbursement"
+	CategoryGift          = "gift"
+)
+
+// Направления перевода в истории
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// HistoryEntry - запись истории переводов пользователя
+type HistoryEntry struct {
+	ID        int       `json:"id"`
+	Direction string    `json:"direction"`
+	User      string    `json:"user"`
+	Amount    int       `json:"amount"`
+	Date      time.Time `json:"date"`
+	Type      string    `json:"type,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	// ReversalOf - перевод, который отменяет операция reversal, ReversedBy - операция, отменившая перевод
+	ReversalOf int `json:"reversalOf,omitempty"`
+	ReversedBy int `json:"reversedBy,omitempty"`
+}
+
+// HistoryFilter - фильтры и курсор для выборки истории переводов.
+// Нулевые значения полей означают отсутствие фильтра.
+type HistoryFilter struct {
+	Direction    string
+	Counterparty string
+	From         time.Time
+	To           time.Time
+	MinAmount    int
+	MaxAmount    int
+	// BeforeID - курсор: выбираются записи с идентификатором меньше заданного
+	BeforeID int
+	Limit    int
+}
+
+type HistoryResponse struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// PurchaseEntry - запись истории покупок пользователя
+type PurchaseEntry struct {
+	ID        int    `json:"id"`
+	Item      string `json:"item"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int    `json:"unitPrice"`
+	TotalCost int    `json:"totalCost"`
+	// PriceEstimated - цена восстановлена по текущему прайсу, а не записана в момент покупки
+	PriceEstimated bool      `json:"priceEstimated"`
+	Date           time.Time `json:"date"`
+	// ReturnedQuantity - сколько предметов покупки возвращено, Refunded - сколько монет за них получено
+	ReturnedQuantity int `json:"returnedQuantity,omitempty"`
+	Refunded         int `json:"refunded,omitempty"`
+}
+
+// PurchaseFilter - фильтры и курсор для выборки истории покупок.
+// Нулевые значения полей означают отсутствие фильтра.
+type PurchaseFilter struct {
+	Item string
+	From time.Time
+	To   time.Time
+	// BeforeID - курсор: выбираются записи с идентификатором меньше заданного
+	BeforeID int
+	Limit    int
+}
+
+type PurchasesResponse struct {
+	Entries    []PurchaseEntry `json:"entries"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// OrderLine - позиция заказа: предмет, артикул его варианта (пустой - вариант по умолчанию) и количество
+type OrderLine struct {
+	Item     string `json:"item"`
+	Variant  string `json:"variant,omitempty"`
+	Quantity int    `json:"quantity"`
+}
+
+type OrderRequest struct {
+	Items []OrderLine `json:"items"`
+}
+
+type OrderResponse struct {
+	OrderID int `json:"orderId"`
+	Total   int `json:"total"`
+}
+
+// IdempotentResponse - ответ на мутирующий запрос, сохраненный вместе с ключом идемпотентности
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// SpendingLimits - лимиты трат пользователя: на один перевод, на сумму переводов и покупок за сутки
+// и за месяц, на сумму переводов одному получателю за сутки. Ноль означает отсутствие лимита.
+type SpendingLimits struct {
+	PerTransfer  int `json:"perTransfer"`
+	Daily        int `json:"daily"`
+	Monthly      int `json:"monthly"`
+	PerRecipient int `json:"perRecipient"`
+}
+
+// UserLimits - действующие лимиты пользователя. Override - заданы ли они администратором
+// вместо лимитов из конфигурации.
+type UserLimits struct {
+	User     string         `json:"user"`
+	Limits   SpendingLimits `json:"limits"`
+	Override bool           `json:"override"`
+}
+
+// LimitErrorResponse - ответ на перевод или покупку, превысившие лимит трат.
+// Remaining - сколько еще можно потратить в рамках лимита Limit.
+type LimitErrorResponse struct {
+	Errors    string `json:"errors"`
+	Code      string `json:"code"`
+	Limit     string `json:"limit"`
+	Remaining int    `json:"remaining"`
+}
+
+// Названия лимитов трат
+const (
+	LimitPerTransfer  = "per_transfer"
+	LimitDaily        = "daily"
+	LimitMonthly      = "monthly"
+	LimitPerRecipient = "per_recipient"
+)
+
+// Виды операций в истории переводов
+const (
+	TransactionTransfer  = "transfer"
+	TransactionMint      = "mint"
+	TransactionClawback  = "clawback"
+	TransactionGrant     = "grant"
+	TransactionAllowance = "allowance"
+	TransactionExpiry    = "expiry"
+	TransactionReversal  = "reversal"
+)
+
+// WelcomeGrantReason - причина приветственного начисления при регистрации
+const WelcomeGrantReason = "welcome grant"
+
+// Роли пользователей
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type User struct {
+	ID       int
+	Username string
+	Role     string
+}
+
+// AdjustmentRequest - начисление или списание монет администратором одному или нескольким пользователям
+type AdjustmentRequest struct {
+	Users  []string `json:"users"`
+	Amount int      `json:"amount"`
+	Reason string   `json:"reason"`
+}
+
+// GrantCampaign - кампания начислений: каждый пользователь, зарегистрированный в [StartsAt, EndsAt),
+// получает Amount монет. Granted - сколько пользователей уже получили монеты по кампании.
+type GrantCampaign struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Amount   int       `json:"amount"`
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+	Granted  int       `json:"granted"`
+}
+
+type GrantCampaignsResponse struct {
+	Campaigns []GrantCampaign `json:"campaigns"`
+}
+
+// AllowanceRule - правило регулярных начислений: Amount монет по расписанию Schedule (cron, UTC)
+// всем пользователям или только пользователям с ролью Role. LastRun - период последнего запуска.
+type AllowanceRule struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Amount    int        `json:"amount"`
+	Schedule  string     `json:"schedule"`
+	Role      string     `json:"role,omitempty"`
+	Paused    bool       `json:"paused"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+}
+
+type AllowanceRulesResponse struct {
+	Rules []AllowanceRule `json:"rules"`
+}
+
+// AllowanceRun - запуск правила начислений за период Period
+type AllowanceRun struct {
+	ID       int       `json:"id"`
+	RuleID   int       `json:"ruleId"`
+	RuleName string    `json:"ruleName"`
+	Period   time.Time `json:"period"`
+	RunAt    time.Time `json:"runAt"`
+	Users    int       `json:"users"`
+	Total    int       `json:"total"`
+}
+
+type AllowanceRunsResponse struct {
+	Runs []AllowanceRun `json:"runs"`
+}
+
+// AllowancePreview - результат пробного запуска правила: ближайшие запуски и сколько монет получат пользователи
+type AllowancePreview struct {
+	NextRuns []time.Time `json:"nextRuns"`
+	Users    int         `json:"users"`
+	Total    int         `json:"total"`
+}
+
+// Статусы запроса монет. Просроченный запрос хранится как pending, а expired показывается при чтении.
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestApproved  = "approved"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestCancelled = "cancelled"
+	PaymentRequestExpired   = "expired"
+)
+
+// Направления списка запросов монет: входящие ждут оплаты от пользователя, исходящие созданы им
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// PaymentRequest - запрос монет: Requester просит Payer перевести Amount до ExpiresAt.
+// При одобрении перевод выполняется с сообщением Note.
+type PaymentRequest struct {
+	ID         int        `json:"id"`
+	Requester  string     `json:"requester"`
+	Payer      string     `json:"payer"`
+	Amount     int        `json:"amount"`
+	Note       string     `json:"note,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type PaymentRequestsResponse struct {
+	Requests []PaymentRequest `json:"requests"`
+}
+
+// Статусы отложенного перевода
+const (
+	PendingTransferPending   = "pending"
+	PendingTransferSettled   = "settled"
+	PendingTransferCancelled = "cancelled"
+)
+
+// PendingTransfer - отложенный перевод: Amount монет зарезервированы у отправителя и поступят ToUser
+// в SettleAt, если отправитель не отменит перевод раньше
+type PendingTransfer struct {
+	ID         int        `json:"id"`
+	ToUser     string     `json:"toUser"`
+	Amount     int        `json:"amount"`
+	Message    string     `json:"message,omitempty"`
+	Category   string     `json:"category,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	SettleAt   time.Time  `json:"settleAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type PendingTransfersResponse struct {
+	Transfers []PendingTransfer `json:"transfers"`
+}
+
+// BatchTransferLine - строка пакетного перевода: Amount монет пользователю ToUser с необязательными
+// сообщением и категорией
+type BatchTransferLine struct {
+	ToUser   string `json:"toUser"`
+	Amount   int    `json:"amount"`
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+type BatchTransferRequest struct {
+	Transfers []BatchTransferLine `json:"transfers"`
+}
+
+// Статусы строки пакетного перевода
+const (
+	BatchLineTransferred = "transferred"
+	BatchLineRejected    = "rejected"
+	BatchLineSkipped     = "skipped"
+)
+
+// Причины отклонения строки пакетного перевода
+const (
+	BatchErrorUserNotFound      = "user_not_found"
+	BatchErrorSelfTransfer      = "self_transfer"
+	BatchErrorInvalidAmount     = "invalid_amount"
+	BatchErrorDuplicateReceiver = "duplicate_recipient"
+)
+
+// BatchTransferResult - результат строки пакетного перевода. Если хотя бы одна строка отклонена (rejected)
+// с причиной Error, остальные строки не выполняются (skipped).
+type BatchTransferResult struct {
+	Line          int    `json:"line"`
+	ToUser        string `json:"toUser"`
+	Amount        int    `json:"amount"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	TransactionID int    `json:"transactionId,omitempty"`
+}
+
+type BatchTransferResponse struct {
+	Total   int                   `json:"total"`
+	Results []BatchTransferResult `json:"results"`
+	Errors  string                `json:"errors,omitempty"`
+}
+
+type ReversalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// TransferReversal - отмена перевода TransferID администратором: Returned из Amount монет возвращены
+// от ToUser отправителю FromUser. Debt - долг получателя (минус на балансе), если монет у него не хватило.
+type TransferReversal struct {
+	ID         int       `json:"id"`
+	TransferID int       `json:"transferId"`
+	FromUser   string    `json:"fromUser"`
+	ToUser     string    `json:"toUser"`
+	Amount     int       `json:"amount"`
+	Returned   int       `json:"returned"`
+	Debt       int       `json:"debt,omitempty"`
+	Reason     string    `json:"reason"`
+	Date       time.Time `json:"date"`
+}
+
+// Статусы возврата покупки
+const (
+	ReturnPending  = "pending"
+	ReturnApproved = "approved"
+	ReturnRejected = "rejected"
+)
+
+type ReturnRequest struct {
+	Quantity int    `json:"quantity"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PurchaseReturn - возврат Quantity предметов из покупки PurchaseID. После одобрения администратором
+// предметы списываются из инвентаря, а покупатель получает Refund монет по цене покупки UnitPrice.
+type PurchaseReturn struct {
+	ID          int        `json:"id"`
+	PurchaseID  int        `json:"purchaseId"`
+	User        string     `json:"user"`
+	Item        string     `json:"item"`
+	Quantity    int        `json:"quantity"`
+	UnitPrice   int        `json:"unitPrice"`
+	Refund      int        `json:"refund"`
+	Reason      string     `json:"reason,omitempty"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type PurchaseReturnsResponse struct {
+	Returns []PurchaseReturn `json:"returns"`
+}
+
+// CatalogItem - товар каталога. Stock - остаток, null означает неограниченный товар. PerUserLimit - сколько
+// единиц товара может купить один пользователь, UserRemaining - сколько из них еще может купить текущий
+// пользователь с учетом остатка; для товаров без лимита на пользователя оба поля отсутствуют.
+// Variants - варианты товара, кроме варианта по умолчанию.
+type CatalogItem struct {
+	Name          string           `json:"name"`
+	Price         int              `json:"price"`
+	Stock         *int             `json:"stock"`
+	Available     bool             `json:"available"`
+	PerUserLimit  int              `json:"perUserLimit,omitempty"`
+	UserRemaining *int             `json:"userRemaining,omitempty"`
+	Variants      []CatalogVariant `json:"variants,omitempty"`
+}
+
+// CatalogVariant - вариант товара в каталоге. Price - цена варианта с учетом замены цены товара,
+// Stock - остаток варианта, null - без ограничений. Available учитывает и остаток самого товара.
+type CatalogVariant struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Price      int               `json:"price"`
+	Stock      *int              `json:"stock"`
+	Available  bool              `json:"available"`
+}
+
+type CatalogResponse struct {
+	Items []CatalogItem `json:"items"`
+}
+
+type RestockRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// ItemVariantRequest - новый вариант товара: артикул, атрибуты, цена вместо цены товара (0 - цена товара)
+// и остаток варианта (null - без ограничений)
+type ItemVariantRequest struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Price      int               `json:"price,omitempty"`
+	Stock      *int              `json:"stock"`
+}
+
+// ItemStockRequest - новый остаток товара (null - без ограничений) и лимит на пользователя (0 - без ограничений)
+type ItemStockRequest struct {
+	Stock        *int `json:"stock"`
+	PerUserLimit int  `json:"perUserLimit,omitempty"`
+}
+
+// Коды ошибок покупки, которой не хватает остатка товара
+const (
+	StockOutOfStock    = "out_of_stock"
+	StockPurchaseLimit = "purchase_limit"
+)
+
+// StockErrorResponse - ответ на покупку, которой не хватает остатка товара Item, его варианта Variant
+// или лимита на пользователя. Available - сколько единиц товара еще можно купить.
+type StockErrorResponse struct {
+	Errors    string `json:"errors"`
+	Code      string `json:"code"`
+	Item      string `json:"item"`
+	Variant   string `json:"variant,omitempty"`
+	Available int    `json:"available"`
 }
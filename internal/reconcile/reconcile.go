@@ -0,0 +1,226 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Transfer - перевод, повлиявший на баланс пользователя
+type Transfer struct {
+	ID        int       `json:"id"`
+	Date      time.Time `json:"date"`
+	Direction string    `json:"direction"`
+	User      string    `json:"user"`
+	Amount    int       `json:"amount"`
+}
+
+// Purchase - покупка, повлиявшая на баланс пользователя
+type Purchase struct {
+	ID        int       `json:"id"`
+	Date      time.Time `json:"date"`
+	Item      string    `json:"item"`
+	Quantity  int       `json:"quantity"`
+	TotalCost int       `json:"totalCost"`
+	// Refunded - сумма одобренных возвратов покупки
+	Refunded int `json:"refunded,omitempty"`
+}
+
+// Posting - запись журнала проводок по счету пользователя, не связанная с переводом или покупкой
+type Posting struct {
+	EntryID int       `json:"entryId"`
+	Date    time.Time `json:"date"`
+	Kind    string    `json:"kind"`
+	Amount  int       `json:"amount"`
+}
+
+// Mismatch - пользователь, баланс которого не сходится с историей операций или с журналом проводок
+type Mismatch struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+	Balance  int    `json:"balance"`
+	// Expected = Received - Sent - Purchases + Refunds - Held, приветственное начисление входит в Received
+	Expected  int `json:"expected"`
+	Received  int `json:"received"`
+	Sent      int `json:"sent"`
+	Purchases int `json:"purchases"`
+	// Refunds - монеты, возвращенные по одобренным возвратам покупок
+	Refunds int `json:"refunds"`
+	// Held - монеты в резерве отложенных переводов, еще не зачисленных получателям
+	Held          int `json:"held"`
+	LedgerBalance int `json:"ledgerBalance"`
+
+	Transfers    []Transfer `json:"transfers"`
+	PurchaseRows []Purchase `json:"purchaseRows"`
+	Postings     []Posting  `json:"postings"`
+}
+
+// Recomputed - пользователь, у которого кеш users.balance расходился с журналом проводок и был пересчитан
+type Recomputed struct {
+	UserID        int `json:"userId"`
+	CachedBalance int `json:"cachedBalance"`
+	LedgerBalance int `json:"ledgerBalance"`
+}
+
+// Report - результат проверки всех пользователей
+type Report struct {
+	CheckedAt    time.Time  `json:"checkedAt"`
+	UsersChecked int        `json:"usersChecked"`
+	Mismatches   []Mismatch `json:"mismatches"`
+	// Recomputed - балансы, пересчитанные по журналу перед проверкой
+	Recomputed []Recomputed `json:"recomputed,omitempty"`
+}
+
+// Check сверяет баланс каждого пользователя с суммой стартового баланса, переводов, покупок,
+// возвратов покупок и резерва отложенных переводов
+// и с журналом проводок. Для расходящихся пользователей собирает строки, из которых складывается баланс.
+// Все чтения выполняются в одной транзакции REPEATABLE READ READ ONLY, поэтому видят согласованный снимок.
+// Отрицательный баланс сам по себе не расхождение: после отмены перевода с долгом он допустим в пределах
+// users.reversal_debt, и это гарантирует ограничение users_balance_check (миграция 020).
+func Check(ctx context.Context, db *sql.DB) (Report, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	report := Report{CheckedAt: time.Now().UTC()}
+	rows, err := tx.QueryContext(ctx, `SELECT users.id, users.username, users.balance,
+       COALESCE(received.total, 0), COALESCE(sent.total, 0), COALESCE(spent.total, 0),
+       COALESCE(refunded.total, 0), COALESCE(held.total, 0), COALESCE(ledger.total, 0)
+FROM users
+         LEFT JOIN (SELECT receiver_id AS user_id, SUM(amount) AS total FROM transactions GROUP BY receiver_id) received
+                   ON received.user_id = users.id
+         LEFT JOIN (SELECT sender_id AS user_id, SUM(amount) AS total FROM transactions GROUP BY sender_id) sent
+                   ON sent.user_id = users.id
+         LEFT JOIN (SELECT buyer_id AS user_id, SUM(total_cost) AS total FROM purchases GROUP BY buyer_id) spent
+                   ON spent.user_id = users.id
+         LEFT JOIN (SELECT purchases.buyer_id AS user_id, SUM(purchase_returns.quantity * purchases.unit_price) AS total
+                    FROM purchase_returns
+                             JOIN purchases ON purchases.id = purchase_returns.purchase_id
+                    WHERE purchase_returns.status = 'approved' GROUP BY purchases.buyer_id) refunded
+                   ON refunded.user_id = users.id
+         LEFT JOIN (SELECT sender_id AS user_id, SUM(amount) AS total FROM pending_transfers
+                    WHERE status = 'pending' GROUP BY sender_id) held
+                   ON held.user_id = users.id
+         LEFT JOIN (SELECT ledger_accounts.user_id, SUM(ledger_postings.amount) AS total
+                    FROM ledger_accounts
+                             JOIN ledger_postings ON ledger_postings.account_id = ledger_accounts.id
+                    GROUP BY ledger_accounts.user_id) ledger
+                   ON ledger.user_id = users.id
+ORDER BY users.id;`)
+	if err != nil {
+		return Report{}, err
+	}
+	for rows.Next() {
+		var m Mismatch
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Balance,
+			&m.Received, &m.Sent, &m.Purchases, &m.Refunds, &m.Held, &m.LedgerBalance); err != nil {
+			rows.Close()
+			return Report{}, err
+		}
+		report.UsersChecked++
+		m.Expected = m.Received - m.Sent - m.Purchases + m.Refunds - m.Held
+		if m.Balance != m.Expected || m.Balance != m.LedgerBalance {
+			report.Mismatches = append(report.Mismatches, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+
+	for i := range report.Mismatches {
+		if err := collectRows(ctx, tx, &report.Mismatches[i]); err != nil {
+			return Report{}, err
+		}
+	}
+	return report, nil
+}
+
+// Recompute пересчитывает кеш users.balance по журналу проводок функцией recompute_user_balances
+// и возвращает пользователей, у которых кеш расходился с журналом
+func Recompute(ctx context.Context, db *sql.DB) ([]Recomputed, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT user_id, cached_balance, ledger_balance FROM recompute_user_balances();")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recomputed []Recomputed
+	for rows.Next() {
+		var r Recomputed
+		if err := rows.Scan(&r.UserID, &r.CachedBalance, &r.LedgerBalance); err != nil {
+			return nil, err
+		}
+		recomputed = append(recomputed, r)
+	}
+	return recomputed, rows.Err()
+}
+
+// collectRows загружает переводы, покупки и прочие проводки пользователя, из которых складывается его баланс
+func collectRows(ctx context.Context, tx *sql.Tx, m *Mismatch) error {
+	var err error
+	m.Transfers, err = queryRows(ctx, tx, `SELECT transactions.id, transactions.transaction_date,
+       CASE WHEN transactions.sender_id = $1 THEN 'sent' ELSE 'received' END,
+       COALESCE(users.username, ''), transactions.amount
+FROM transactions
+         LEFT JOIN users ON users.id = COALESCE(CASE WHEN transactions.sender_id = $1
+                                                THEN transactions.receiver_id ELSE transactions.sender_id END,
+                                           transactions.admin_id)
+WHERE transactions.sender_id = $1 OR transactions.receiver_id = $1
+ORDER BY transactions.id;`, m.UserID, func(rows *sql.Rows, t *Transfer) error {
+		return rows.Scan(&t.ID, &t.Date, &t.Direction, &t.User, &t.Amount)
+	})
+	if err != nil {
+		return err
+	}
+	m.PurchaseRows, err = queryRows(ctx, tx, `SELECT purchases.id, purchases.purchase_date, items.name,
+       purchases.amount, purchases.total_cost,
+       COALESCE(refunded.quantity, 0) * purchases.unit_price
+FROM purchases
+         JOIN items ON items.id = purchases.item_id
+         LEFT JOIN (SELECT purchase_returns.purchase_id, SUM(purchase_returns.quantity) AS quantity
+                    FROM purchase_returns
+                    WHERE purchase_returns.status = 'approved' GROUP BY purchase_returns.purchase_id) refunded
+                   ON refunded.purchase_id = purchases.id
+WHERE purchases.buyer_id = $1
+ORDER BY purchases.id;`, m.UserID, func(rows *sql.Rows, p *Purchase) error {
+		return rows.Scan(&p.ID, &p.Date, &p.Item, &p.Quantity, &p.TotalCost, &p.Refunded)
+	})
+	if err != nil {
+		return err
+	}
+	m.Postings, err = queryRows(ctx, tx, `SELECT ledger_entries.id, ledger_entries.entry_date, ledger_entries.kind,
+       ledger_postings.amount
+FROM ledger_postings
+         JOIN ledger_entries ON ledger_entries.id = ledger_postings.entry_id
+         JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+WHERE ledger_accounts.user_id = $1
+  AND ledger_entries.transaction_id IS NULL AND ledger_entries.purchase_id IS NULL
+ORDER BY ledger_entries.id;`, m.UserID, func(rows *sql.Rows, p *Posting) error {
+		return rows.Scan(&p.EntryID, &p.Date, &p.Kind, &p.Amount)
+	})
+	return err
+}
+
+// queryRows выполняет запрос с параметром userID и читает все строки результата
+func queryRows[T any](ctx context.Context, tx *sql.Tx, query string, userID int,
+	scan func(*sql.Rows, *T) error) ([]T, error) {
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collected []T
+	for rows.Next() {
+		var value T
+		if err := scan(rows, &value); err != nil {
+			return nil, err
+		}
+		collected = append(collected, value)
+	}
+	return collected, rows.Err()
+}
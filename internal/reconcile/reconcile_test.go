@@ -0,0 +1,163 @@
+package reconcile
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// -----------
+// Тесты Check
+// -----------
+func TestCheckReportsMismatchWithRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	balanceColumns := []string{"id", "username", "balance", "received", "sent", "purchases", "refunds", "held", "ledger"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT users.id, users.username, users.balance").
+		WillReturnRows(sqlmock.NewRows(balanceColumns).
+			AddRow(1, "alice", 930, 1000, 50, 20, 0, 0, 930).
+			AddRow(2, "bob", 1000, 1050, 0, 0, 0, 0, 1050))
+	mock.ExpectQuery("FROM transactions").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "direction", "user", "amount"}).
+			AddRow(2, date, "received", "", 1000).
+			AddRow(3, date, "received", "alice", 50))
+	mock.ExpectQuery("FROM purchases").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "item", "quantity", "total_cost", "refunded"}))
+	mock.ExpectQuery("FROM ledger_postings").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "kind", "amount"}).
+			AddRow(7, date, "adjustment", 50))
+	mock.ExpectRollback()
+
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.UsersChecked)
+	require.Len(t, report.Mismatches, 1)
+	m := report.Mismatches[0]
+	assert.Equal(t, "bob", m.Username)
+	assert.Equal(t, 1050, m.Expected)
+	assert.Equal(t, 1050, m.LedgerBalance)
+	assert.Equal(t, []Transfer{
+		{ID: 2, Date: date, Direction: "received", Amount: 1000},
+		{ID: 3, Date: date, Direction: "received", User: "alice", Amount: 50},
+	}, m.Transfers)
+	assert.Empty(t, m.PurchaseRows)
+	assert.Equal(t, []Posting{{EntryID: 7, Date: date, Kind: "adjustment", Amount: 50}}, m.Postings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckLedgerMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT users.id, users.username, users.balance").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "balance", "received", "sent", "purchases", "refunds", "held", "ledger"}).
+			AddRow(1, "alice", 1000, 1000, 0, 0, 0, 0, 900))
+	mock.ExpectQuery("FROM transactions").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("FROM purchases").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("FROM ledger_postings").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, report.Mismatches, 1)
+	assert.Equal(t, 1000, report.Mismatches[0].Expected)
+	assert.Equal(t, 900, report.Mismatches[0].LedgerBalance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckConsistent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT users.id, users.username, users.balance").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "balance", "received", "sent", "purchases", "refunds", "held", "ledger"}).
+			AddRow(1, "alice", 930, 1000, 50, 20, 0, 0, 930))
+	mock.ExpectRollback()
+
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.UsersChecked)
+	assert.Empty(t, report.Mismatches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckSubtractsHeldTransfers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM pending_transfers").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "balance", "received", "sent", "purchases", "refunds", "held", "ledger"}).
+			AddRow(1, "alice", 900, 1000, 0, 0, 0, 100, 900))
+	mock.ExpectRollback()
+
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	assert.Empty(t, report.Mismatches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckAddsRefunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM purchase_returns").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "balance", "received", "sent", "purchases", "refunds", "held", "ledger"}).
+			AddRow(1, "alice", 980, 1000, 0, 60, 40, 0, 980))
+	mock.ExpectRollback()
+
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	assert.Empty(t, report.Mismatches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------
+// Тесты Recompute
+// ---------------
+func TestRecompute(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("FROM recompute_user_balances").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "cached_balance", "ledger_balance"}).
+			AddRow(2, 1000, 1050).
+			AddRow(5, 10, 0))
+
+	recomputed, err := Recompute(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, []Recomputed{
+		{UserID: 2, CachedBalance: 1000, LedgerBalance: 1050},
+		{UserID: 5, CachedBalance: 10, LedgerBalance: 0},
+	}, recomputed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecomputeNothingDrifted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("FROM recompute_user_balances").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "cached_balance", "ledger_balance"}))
+
+	recomputed, err := Recompute(context.Background(), db)
+	require.NoError(t, err)
+	assert.Empty(t, recomputed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
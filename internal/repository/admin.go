@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"sort"
+	"strings"
+)
+
+// GetUser возвращает имя и роль пользователя
+func (p *Postgres) GetUser(userID int) (models.User, error) {
+	user := models.User{ID: userID}
+	err := p.db.QueryRow(context.Background(), "SELECT username, role FROM get_user($1);", userID).
+		Scan(&user.Username, &user.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// AdjustBalances начисляет или списывает монеты пользователям от имени администратора
+func (p *Postgres) AdjustBalances(adminID int, kind string, usernames []string, amount int, reason string) error {
+	_, err := p.db.Exec(context.Background(), "SELECT adjust_balances($1, $2, $3, $4, $5);",
+		adminID, kind, usernames, amount, reason)
+	return err
+}
+
+// GetUser возвращает имя и роль пользователя
+func (m *Memory) GetUser(userID int) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.userByID(userID)
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return models.User{ID: user.id, Username: user.username, Role: user.role}, nil
+}
+
+// AdjustBalances начисляет или списывает монеты пользователям от имени администратора
+func (m *Memory) AdjustBalances(adminID int, kind string, usernames []string, amount int, reason string) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if kind != models.TransactionMint && kind != models.TransactionClawback {
+		return ErrUnknownOperation
+	}
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if strings.TrimSpace(reason) == "" {
+		return ErrEmptyReason
+	}
+	if len(usernames) == 0 {
+		return ErrUserNotFound
+	}
+	targets := make([]*memUser, 0, len(usernames))
+	seen := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		if seen[username] {
+			return ErrDuplicateUser
+		}
+		seen[username] = true
+		user, ok := m.usersByName[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if kind == models.TransactionClawback && user.balance < amount {
+			return ErrInsufficientFunds
+		}
+		targets = append(targets, user)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].id < targets[j].id })
+
+	for _, user := range targets {
+		transfer := memTransfer{
+			id:      len(m.transfers) + 1,
+			date:    m.now().UTC(),
+			amount:  amount,
+			kind:    kind,
+			reason:  reason,
+			adminID: adminID,
+		}
+		if kind == models.TransactionMint {
+			transfer.receiverID = user.id
+			m.postEntry(kind, transfer.date, accountIssuance, user.id, amount, transfer.id, 0)
+		} else {
+			transfer.senderID = user.id
+			m.postEntry(kind, transfer.date, user.id, accountIssuance, amount, transfer.id, 0)
+		}
+		m.transfers = append(m.transfers, transfer)
+	}
+	return nil
+}
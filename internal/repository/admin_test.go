@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// ----------------------
+// Тесты Postgres.GetUser
+// ----------------------
+func TestGetUser(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT username, role FROM get_user").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"username", "role"}).AddRow("hr", models.RoleAdmin))
+
+	user, err := store.GetUser(1)
+	require.NoError(t, err)
+	assert.Equal(t, models.User{ID: 1, Username: "hr", Role: models.RoleAdmin}, user)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT username, role FROM get_user").
+		WithArgs(7).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := store.GetUser(7)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------------
+// Тесты Postgres.AdjustBalances
+// -----------------------------
+func TestAdjustBalances(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("SELECT adjust_balances").
+		WithArgs(1, models.TransactionMint, []string{"alice", "bob"}, 200, "bonus").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+
+	err := store.AdjustBalances(1, models.TransactionMint, []string{"alice", "bob"}, 200, "bonus")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------
+// Тесты Memory.AdjustBalances
+// ---------------------------
+func TestMemoryAdjustBalancesMint(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+
+	require.NoError(t, m.AdjustBalances(admin, models.TransactionMint, []string{"bob", "alice"}, 200, "bonus"))
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, info.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		{User: "", Amount: 1000, Type: models.TransactionGrant, Reason: models.WelcomeGrantReason},
+		{User: "hr", Amount: 200, Type: models.TransactionMint, Reason: "bonus"},
+	}, info.CoinHistory.Received)
+
+	history, err := m.GetUserHistory(alice, models.HistoryFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.DirectionReceived, history[0].Direction)
+	assert.Equal(t, models.TransactionMint, history[0].Type)
+	assert.Equal(t, 1000, m.ledgerBalance(admin))
+	assert.Equal(t, -3400, m.ledgerBalance(accountIssuance))
+}
+
+func TestMemoryAdjustBalancesClawbackIsAtomic(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	require.NoError(t, m.SendCoins(bob, 900, "alice", models.TransferNote{}, models.SpendingLimits{}))
+
+	err := m.AdjustBalances(admin, models.TransactionClawback, []string{"alice", "bob"}, 500, "mistake")
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	require.NoError(t, m.AdjustBalances(admin, models.TransactionClawback, []string{"alice"}, 500, "mistake"))
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1400, info.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		{User: "hr", Amount: 500, Type: models.TransactionClawback, Reason: "mistake"},
+	}, info.CoinHistory.Sent)
+	bobInfo, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 100, bobInfo.Coins)
+}
+
+func TestMemoryAdjustBalancesValidation(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	registerMemoryUser(t, m, "alice")
+
+	assert.ErrorIs(t, m.AdjustBalances(admin, "gift", []string{"alice"}, 1, "x"), ErrUnknownOperation)
+	assert.ErrorIs(t, m.AdjustBalances(admin, models.TransactionMint, []string{"alice"}, 0, "x"), ErrInvalidAmount)
+	assert.ErrorIs(t, m.AdjustBalances(admin, models.TransactionMint, []string{"alice"}, 1, " "), ErrEmptyReason)
+	assert.ErrorIs(t, m.AdjustBalances(admin, models.TransactionMint, []string{"alice", "nobody"}, 1, "x"),
+		ErrUserNotFound)
+	assert.ErrorIs(t, m.AdjustBalances(admin, models.TransactionMint, []string{"alice", "alice"}, 1, "x"),
+		ErrDuplicateUser)
+	// в журнале только приветственные начисления
+	assert.Len(t, m.transfers, 2)
+}
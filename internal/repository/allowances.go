@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"sort"
+	"time"
+)
+
+// memAllowanceRule - правило регулярных начислений в Memory
+type memAllowanceRule struct {
+	id        int
+	name      string
+	amount    int
+	schedule  string
+	role      string
+	paused    bool
+	adminID   int
+	createdAt time.Time
+}
+
+// memAllowanceRun - запуск правила. После удаления правила ruleID равен нулю.
+type memAllowanceRun struct {
+	id       int
+	ruleID   int
+	ruleName string
+	period   time.Time
+	runAt    time.Time
+	users    int
+	total    int
+}
+
+// CreateAllowanceRule создает правило регулярных начислений
+func (p *Postgres) CreateAllowanceRule(adminID int, rule models.AllowanceRule) (models.AllowanceRule, error) {
+	err := p.db.QueryRow(context.Background(), "SELECT id, created_at FROM create_allowance_rule($1, $2, $3, $4, $5, $6);",
+		adminID, rule.Name, rule.Amount, rule.Schedule, rule.Role, rule.Paused).
+		Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		return models.AllowanceRule{}, err
+	}
+	rule.LastRun = nil
+	return rule, nil
+}
+
+// UpdateAllowanceRule изменяет правило регулярных начислений
+func (p *Postgres) UpdateAllowanceRule(rule models.AllowanceRule) (models.AllowanceRule, error) {
+	err := p.db.QueryRow(context.Background(),
+		"SELECT created_at, last_period FROM update_allowance_rule($1, $2, $3, $4, $5, $6);",
+		rule.ID, rule.Name, rule.Amount, rule.Schedule, rule.Role, rule.Paused).
+		Scan(&rule.CreatedAt, &rule.LastRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AllowanceRule{}, ErrRuleNotFound
+	}
+	if err != nil {
+		return models.AllowanceRule{}, err
+	}
+	return rule, nil
+}
+
+// DeleteAllowanceRule удаляет правило регулярных начислений
+func (p *Postgres) DeleteAllowanceRule(ruleID int) error {
+	var deleted bool
+	if err := p.db.QueryRow(context.Background(), "SELECT delete_allowance_rule($1);", ruleID).Scan(&deleted); err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// GetAllowanceRules возвращает правила начислений от новых к старым
+func (p *Postgres) GetAllowanceRules() ([]models.AllowanceRule, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT id, name, amount, schedule, target_role, paused, created_at, last_period FROM get_allowance_rules();")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.AllowanceRule
+	for rows.Next() {
+		var rule models.AllowanceRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Amount, &rule.Schedule, &rule.Role, &rule.Paused,
+			&rule.CreatedAt, &rule.LastRun); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetAllowanceRuns возвращает запуски правила от новых к старым
+func (p *Postgres) GetAllowanceRuns(ruleID int, limit int) ([]models.AllowanceRun, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT id, rule_name, period, run_at, users_granted, total_amount FROM get_allowance_runs($1, $2);",
+		ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.AllowanceRun
+	for rows.Next() {
+		run := models.AllowanceRun{RuleID: ruleID}
+		if err := rows.Scan(&run.ID, &run.RuleName, &run.Period, &run.RunAt, &run.Users, &run.Total); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// RunAllowance выполняет правило за период, если этот период еще не выполнен
+func (p *Postgres) RunAllowance(ruleID int, period time.Time) (models.AllowanceRun, bool, error) {
+	run := models.AllowanceRun{RuleID: ruleID, Period: period}
+	err := p.db.QueryRow(context.Background(),
+		"SELECT run_id, run_at, users_granted, total_amount FROM run_allowance($1, $2);", ruleID, period).
+		Scan(&run.ID, &run.RunAt, &run.Users, &run.Total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AllowanceRun{}, false, nil
+	}
+	if err != nil {
+		return models.AllowanceRun{}, false, err
+	}
+	return run, true, nil
+}
+
+// CountUsersWithRole возвращает число пользователей с ролью role или всех пользователей
+func (p *Postgres) CountUsersWithRole(role string) (int, error) {
+	var count int
+	err := p.db.QueryRow(context.Background(), "SELECT count_users_with_role($1);", role).Scan(&count)
+	return count, err
+}
+
+// CreateAllowanceRule создает правило регулярных начислений
+func (m *Memory) CreateAllowanceRule(adminID int, rule models.AllowanceRule) (models.AllowanceRule, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if err := m.validateAllowanceRule(rule); err != nil {
+		return models.AllowanceRule{}, err
+	}
+	m.allowanceRuleSeq++
+	created := &memAllowanceRule{
+		id:        m.allowanceRuleSeq,
+		name:      rule.Name,
+		amount:    rule.Amount,
+		schedule:  rule.Schedule,
+		role:      rule.Role,
+		paused:    rule.Paused,
+		adminID:   adminID,
+		createdAt: m.now().UTC(),
+	}
+	m.allowanceRules[created.id] = created
+	return m.allowanceRule(created), nil
+}
+
+// UpdateAllowanceRule изменяет правило регулярных начислений
+func (m *Memory) UpdateAllowanceRule(rule models.AllowanceRule) (models.AllowanceRule, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.allowanceRules[rule.ID]
+	if !ok {
+		return models.AllowanceRule{}, ErrRuleNotFound
+	}
+	if err := m.validateAllowanceRule(rule); err != nil {
+		return models.AllowanceRule{}, err
+	}
+	existing.name = rule.Name
+	existing.amount = rule.Amount
+	existing.schedule = rule.Schedule
+	existing.role = rule.Role
+	existing.paused = rule.Paused
+	return m.allowanceRule(existing), nil
+}
+
+// DeleteAllowanceRule удаляет правило регулярных начислений
+func (m *Memory) DeleteAllowanceRule(ruleID int) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.allowanceRules[ruleID]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(m.allowanceRules, ruleID)
+	for i := range m.allowanceRuns {
+		if m.allowanceRuns[i].ruleID == ruleID {
+			m.allowanceRuns[i].ruleID = 0
+		}
+	}
+	return nil
+}
+
+// GetAllowanceRules возвращает правила начислений от новых к старым
+func (m *Memory) GetAllowanceRules() ([]models.AllowanceRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules := make([]models.AllowanceRule, 0, len(m.allowanceRules))
+	for _, rule := range m.allowanceRules {
+		rules = append(rules, m.allowanceRule(rule))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID > rules[j].ID })
+	return rules, nil
+}
+
+// GetAllowanceRuns возвращает запуски правила от новых к старым
+func (m *Memory) GetAllowanceRuns(ruleID int, limit int) ([]models.AllowanceRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var runs []models.AllowanceRun
+	for i := len(m.allowanceRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		run := m.allowanceRuns[i]
+		if run.ruleID != ruleID {
+			continue
+		}
+		runs = append(runs, models.AllowanceRun{
+			ID: run.id, RuleID: run.ruleID, RuleName: run.ruleName, Period: run.period, RunAt: run.runAt,
+			Users: run.users, Total: run.total,
+		})
+	}
+	return runs, nil
+}
+
+// RunAllowance выполняет правило за период, если этот период еще не выполнен
+func (m *Memory) RunAllowance(ruleID int, period time.Time) (models.AllowanceRun, bool, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	rule, ok := m.allowanceRules[ruleID]
+	if !ok {
+		return models.AllowanceRun{}, false, ErrRuleNotFound
+	}
+	for _, run := range m.allowanceRuns {
+		if run.ruleID == ruleID && run.period.Equal(period) {
+			return models.AllowanceRun{}, false, nil
+		}
+	}
+
+	run := memAllowanceRun{
+		id:       len(m.allowanceRuns) + 1,
+		ruleID:   ruleID,
+		ruleName: rule.name,
+		period:   period,
+		runAt:    m.now().UTC(),
+	}
+	for _, user := range m.users {
+		if rule.role != "" && user.role != rule.role {
+			continue
+		}
+		transfer := memTransfer{
+			id:             len(m.transfers) + 1,
+			date:           run.runAt,
+			receiverID:     user.id,
+			amount:         rule.amount,
+			kind:           models.TransactionAllowance,
+			reason:         rule.name,
+			allowanceRunID: run.id,
+		}
+		m.transfers = append(m.transfers, transfer)
+		m.postEntry(entryAllowance, run.runAt, accountIssuance, user.id, rule.amount, transfer.id, 0)
+		run.users++
+		run.total += rule.amount
+	}
+	m.allowanceRuns = append(m.allowanceRuns, run)
+	return models.AllowanceRun{
+		ID: run.id, RuleID: ruleID, RuleName: run.ruleName, Period: period, RunAt: run.runAt,
+		Users: run.users, Total: run.total,
+	}, true, nil
+}
+
+// CountUsersWithRole возвращает число пользователей с ролью role или всех пользователей
+func (m *Memory) CountUsersWithRole(role string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, user := range m.users {
+		if role == "" || user.role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// validateAllowanceRule проверяет сумму, роль и уникальность названия правила. Вызывается под блокировкой.
+func (m *Memory) validateAllowanceRule(rule models.AllowanceRule) error {
+	if rule.Name == "" {
+		return ErrEmptyName
+	}
+	if rule.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if rule.Role != "" && rule.Role != models.RoleUser && rule.Role != models.RoleAdmin {
+		return ErrUnknownRole
+	}
+	for _, existing := range m.allowanceRules {
+		if existing.name == rule.Name && existing.id != rule.ID {
+			return ErrRuleExists
+		}
+	}
+	return nil
+}
+
+// allowanceRule собирает правило с периодом последнего запуска. Вызывается под блокировкой.
+func (m *Memory) allowanceRule(rule *memAllowanceRule) models.AllowanceRule {
+	result := models.AllowanceRule{
+		ID:        rule.id,
+		Name:      rule.name,
+		Amount:    rule.amount,
+		Schedule:  rule.schedule,
+		Role:      rule.role,
+		Paused:    rule.paused,
+		CreatedAt: rule.createdAt,
+	}
+	for _, run := range m.allowanceRuns {
+		if run.ruleID == rule.id && (result.LastRun == nil || run.period.After(*result.LastRun)) {
+			period := run.period
+			result.LastRun = &period
+		}
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// ----------------------------------
+// Тесты Postgres.CreateAllowanceRule
+// ----------------------------------
+func TestCreateAllowanceRule(t *testing.T) {
+	resetMockDB(t)
+	createdAt := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	rule := models.AllowanceRule{Name: "monthly", Amount: 100, Schedule: "@monthly", Role: models.RoleUser}
+	mock.ExpectQuery("SELECT id, created_at FROM create_allowance_rule").
+		WithArgs(1, "monthly", 100, "@monthly", models.RoleUser, false).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(4, createdAt))
+
+	created, err := store.CreateAllowanceRule(1, rule)
+	require.NoError(t, err)
+	rule.ID, rule.CreatedAt = 4, createdAt
+	assert.Equal(t, rule, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -------------------------------------------
+// Тесты Postgres.UpdateAllowanceRule и Delete
+// -------------------------------------------
+func TestUpdateAllowanceRuleNotFound(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT created_at, last_period FROM update_allowance_rule").
+		WithArgs(9, "monthly", 100, "@monthly", "", true).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := store.UpdateAllowanceRule(models.AllowanceRule{
+		ID: 9, Name: "monthly", Amount: 100, Schedule: "@monthly", Paused: true,
+	})
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAllowanceRule(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT delete_allowance_rule").WithArgs(4).
+		WillReturnRows(pgxmock.NewRows([]string{"delete_allowance_rule"}).AddRow(true))
+	mock.ExpectQuery("SELECT delete_allowance_rule").WithArgs(9).
+		WillReturnRows(pgxmock.NewRows([]string{"delete_allowance_rule"}).AddRow(false))
+
+	assert.NoError(t, store.DeleteAllowanceRule(4))
+	assert.ErrorIs(t, store.DeleteAllowanceRule(9), ErrRuleNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// --------------------------------
+// Тесты Postgres.GetAllowanceRules
+// --------------------------------
+func TestGetAllowanceRules(t *testing.T) {
+	resetMockDB(t)
+	createdAt := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	lastPeriod := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM get_allowance_rules").
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "name", "amount", "schedule", "target_role", "paused", "created_at", "last_period",
+		}).
+			AddRow(2, "weekly admins", 50, "@weekly", models.RoleAdmin, true, createdAt, nil).
+			AddRow(1, "monthly", 100, "@monthly", "", false, createdAt, &lastPeriod))
+
+	rules, err := store.GetAllowanceRules()
+	require.NoError(t, err)
+	assert.Equal(t, []models.AllowanceRule{
+		{ID: 2, Name: "weekly admins", Amount: 50, Schedule: "@weekly", Role: models.RoleAdmin, Paused: true,
+			CreatedAt: createdAt},
+		{ID: 1, Name: "monthly", Amount: 100, Schedule: "@monthly", CreatedAt: createdAt, LastRun: &lastPeriod},
+	}, rules)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------
+// Тесты Postgres.RunAllowance
+// ---------------------------
+func TestRunAllowance(t *testing.T) {
+	resetMockDB(t)
+	period := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	runAt := period.Add(time.Minute)
+	mock.ExpectQuery("FROM run_allowance").WithArgs(1, period).
+		WillReturnRows(pgxmock.NewRows([]string{"run_id", "run_at", "users_granted", "total_amount"}).
+			AddRow(7, runAt, 3, 300))
+	mock.ExpectQuery("FROM run_allowance").WithArgs(1, period).
+		WillReturnError(pgx.ErrNoRows)
+
+	run, claimed, err := store.RunAllowance(1, period)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, models.AllowanceRun{ID: 7, RuleID: 1, Period: period, RunAt: runAt, Users: 3, Total: 300}, run)
+
+	_, claimed, err = store.RunAllowance(1, period)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -------------------------
+// Тесты Memory.RunAllowance
+// -------------------------
+func TestMemoryRunAllowanceOncePerPeriod(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	alice := registerMemoryUser(t, m, "alice")
+	m.users[admin-1].role = models.RoleAdmin
+	rule, err := m.CreateAllowanceRule(admin, models.AllowanceRule{
+		Name: "monthly", Amount: 100, Schedule: "@monthly", Role: models.RoleUser,
+	})
+	require.NoError(t, err)
+	period := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	run, claimed, err := m.RunAllowance(rule.ID, period)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, 1, run.Users)
+	assert.Equal(t, 100, run.Total)
+	_, claimed, err = m.RunAllowance(rule.ID, period)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1100, info.Coins)
+	assert.Contains(t, info.CoinHistory.Received,
+		models.CoinTransaction{Amount: 100, Type: models.TransactionAllowance, Reason: "monthly"})
+	adminInfo, err := m.GetUserBalanceInventoryLogs(admin, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, adminInfo.Coins)
+
+	rules, err := m.GetAllowanceRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.NotNil(t, rules[0].LastRun)
+	assert.Equal(t, period, *rules[0].LastRun)
+}
+
+// --------------------------
+// Тесты CRUD правил в Memory
+// --------------------------
+func TestMemoryAllowanceRuleCRUD(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	rule := models.AllowanceRule{Name: "monthly", Amount: 100, Schedule: "@monthly"}
+	created, err := m.CreateAllowanceRule(admin, rule)
+	require.NoError(t, err)
+	_, err = m.CreateAllowanceRule(admin, rule)
+	assert.ErrorIs(t, err, ErrRuleExists)
+	_, err = m.CreateAllowanceRule(admin, models.AllowanceRule{Name: "x", Amount: 1, Schedule: "@daily", Role: "boss"})
+	assert.ErrorIs(t, err, ErrUnknownRole)
+
+	created.Amount, created.Paused = 150, true
+	updated, err := m.UpdateAllowanceRule(created)
+	require.NoError(t, err)
+	assert.Equal(t, 150, updated.Amount)
+	assert.True(t, updated.Paused)
+	_, err = m.UpdateAllowanceRule(models.AllowanceRule{ID: 9, Name: "x", Amount: 1, Schedule: "@daily"})
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+
+	_, _, err = m.RunAllowance(created.ID, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.NoError(t, m.DeleteAllowanceRule(created.ID))
+	assert.ErrorIs(t, m.DeleteAllowanceRule(created.ID), ErrRuleNotFound)
+	rules, err := m.GetAllowanceRules()
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+	// запуски удаленного правила сохраняются
+	assert.Len(t, m.allowanceRuns, 1)
+	assert.Zero(t, m.allowanceRuns[0].ruleID)
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// batchInsufficientFundsCode - SQLSTATE ошибки send_coins_batch, когда баланса не хватает на весь пакет
+const batchInsufficientFundsCode = "BAT01"
+
+// newBatchResults возвращает результаты строк пакета без статусов
+func newBatchResults(lines []models.BatchTransferLine) []models.BatchTransferResult {
+	results := make([]models.BatchTransferResult, len(lines))
+	for i, line := range lines {
+		results[i] = models.BatchTransferResult{Line: i + 1, ToUser: line.ToUser, Amount: line.Amount}
+	}
+	return results
+}
+
+// rejectBatch проверяет, есть ли в пакете строки с причиной отклонения. Если есть, проставляет
+// им статус rejected, остальным - skipped и возвращает ErrBatchRejected.
+func rejectBatch(results []models.BatchTransferResult) ([]models.BatchTransferResult, error) {
+	rejected := false
+	for _, result := range results {
+		rejected = rejected || result.Error != ""
+	}
+	if !rejected {
+		return results, nil
+	}
+	for i := range results {
+		results[i].Status = models.BatchLineSkipped
+		if results[i].Error != "" {
+			results[i].Status = models.BatchLineRejected
+		}
+	}
+	return results, ErrBatchRejected
+}
+
+// SendCoinsBatch атомарно выполняет переводы lines от userFromID: либо все, либо ни одного
+func (p *Postgres) SendCoinsBatch(userFromID int, lines []models.BatchTransferLine,
+	limits models.SpendingLimits) ([]models.BatchTransferResult, error) {
+	if len(lines) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	receivers := make([]string, len(lines))
+	amounts := make([]int32, len(lines))
+	messages := make([]string, len(lines))
+	categories := make([]string, len(lines))
+	results := newBatchResults(lines)
+	for i, line := range lines {
+		if !ValidCategory(line.Category) {
+			return nil, ErrUnknownCategory
+		}
+		// Сумма больше MaxAmount не помещается в INTEGER, такую строку отклоняем до обращения к базе
+		if line.Amount > MaxAmount {
+			results[i].Error = models.BatchErrorInvalidAmount
+			continue
+		}
+		receivers[i] = line.ToUser
+		amounts[i] = int32(line.Amount)
+		messages[i] = line.Message
+		categories[i] = line.Category
+	}
+	if results, err := rejectBatch(results); err != nil {
+		return results, err
+	}
+
+	rows, err := p.db.Query(context.Background(),
+		"SELECT line_number, line_transaction_id, line_error FROM send_coins_batch($1, $2, $3, $4, $5, $6, $7, $8, $9);",
+		userFromID, receivers, amounts, messages, categories,
+		limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient)
+	if err != nil {
+		return nil, batchError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line int
+		var transactionID *int
+		var lineError *string
+		if err := rows.Scan(&line, &transactionID, &lineError); err != nil {
+			return nil, err
+		}
+		result := &results[line-1]
+		switch {
+		case lineError != nil:
+			result.Error = *lineError
+		case transactionID != nil:
+			result.Status = models.BatchLineTransferred
+			result.TransactionID = *transactionID
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, batchError(err)
+	}
+	return rejectBatch(results)
+}
+
+// batchError преобразует ошибку send_coins_batch в ErrInsufficientFunds или *LimitError
+func batchError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == batchInsufficientFundsCode {
+		return ErrInsufficientFunds
+	}
+	return limitError(err)
+}
+
+// SendCoinsBatch атомарно выполняет переводы lines от userFromID: либо все, либо ни одного
+func (m *Memory) SendCoinsBatch(userFromID int, lines []models.BatchTransferLine,
+	limits models.SpendingLimits) ([]models.BatchTransferResult, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if len(lines) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	for _, line := range lines {
+		if !ValidCategory(line.Category) {
+			return nil, ErrUnknownCategory
+		}
+	}
+	sender, ok := m.userByID(userFromID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	results := newBatchResults(lines)
+	receivers := make([]*memUser, len(lines))
+	listed := make(map[int]bool, len(lines))
+	total := 0
+	for i, line := range lines {
+		receiver, ok := m.usersByName[line.ToUser]
+		switch {
+		case !ok:
+			results[i].Error = models.BatchErrorUserNotFound
+		case receiver.id == sender.id:
+			results[i].Error = models.BatchErrorSelfTransfer
+		case line.Amount <= 0 || line.Amount > MaxAmount:
+			results[i].Error = models.BatchErrorInvalidAmount
+		case listed[receiver.id]:
+			results[i].Error = models.BatchErrorDuplicateReceiver
+		}
+		if ok {
+			listed[receiver.id] = true
+		}
+		receivers[i] = receiver
+		total += line.Amount
+	}
+	if results, err := rejectBatch(results); err != nil {
+		return results, err
+	}
+
+	if sender.balance < total {
+		return nil, ErrInsufficientFunds
+	}
+	// Лимиты за день и месяц проверяются на всю сумму, лимиты на перевод и получателя - по строкам
+	if err := m.checkLimits(sender, 0, total, limits); err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		if err := m.checkLimits(sender, receivers[i].id, line.Amount, limits); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, line := range lines {
+		results[i].Status = models.BatchLineTransferred
+		results[i].TransactionID = m.addTransfer(sender, receivers[i], line.Amount,
+			models.TransferNote{Message: line.Message, Category: line.Category})
+	}
+	return results, nil
+}
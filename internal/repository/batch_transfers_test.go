@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+// batchResultColumns - поля результата send_coins_batch
+var batchResultColumns = []string{"line_number", "line_transaction_id", "line_error"}
+
+// -----------------------------
+// Тесты Postgres.SendCoinsBatch
+// -----------------------------
+func TestSendCoinsBatch(t *testing.T) {
+	resetMockDB(t)
+	first, second := 7, 8
+	mock.ExpectQuery("FROM send_coins_batch").
+		WithArgs(1, []string{"bob", "carol"}, []int32{100, 50}, []string{"премия", ""},
+			[]string{models.CategoryGift, ""}, 0, 500, 0, 0).
+		WillReturnRows(pgxmock.NewRows(batchResultColumns).AddRow(1, &first, nil).AddRow(2, &second, nil))
+
+	results, err := store.SendCoinsBatch(1, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: 100, Message: "премия", Category: models.CategoryGift},
+		{ToUser: "carol", Amount: 50},
+	}, models.SpendingLimits{Daily: 500})
+	require.NoError(t, err)
+	assert.Equal(t, []models.BatchTransferResult{
+		{Line: 1, ToUser: "bob", Amount: 100, Status: models.BatchLineTransferred, TransactionID: 7},
+		{Line: 2, ToUser: "carol", Amount: 50, Status: models.BatchLineTransferred, TransactionID: 8},
+	}, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinsBatchRejected(t *testing.T) {
+	resetMockDB(t)
+	userNotFound := models.BatchErrorUserNotFound
+	mock.ExpectQuery("FROM send_coins_batch").
+		WithArgs(1, []string{"bob", "ghost"}, []int32{100, 50}, []string{"", ""}, []string{"", ""}, 0, 0, 0, 0).
+		WillReturnRows(pgxmock.NewRows(batchResultColumns).AddRow(1, nil, nil).AddRow(2, nil, &userNotFound))
+
+	results, err := store.SendCoinsBatch(1, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: 100}, {ToUser: "ghost", Amount: 50},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrBatchRejected)
+	assert.Equal(t, []models.BatchTransferResult{
+		{Line: 1, ToUser: "bob", Amount: 100, Status: models.BatchLineSkipped},
+		{Line: 2, ToUser: "ghost", Amount: 50, Status: models.BatchLineRejected, Error: models.BatchErrorUserNotFound},
+	}, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinsBatchErrors(t *testing.T) {
+	resetMockDB(t)
+	lines := []models.BatchTransferLine{{ToUser: "bob", Amount: 100}}
+	mock.ExpectQuery("FROM send_coins_batch").
+		WithArgs(1, []string{"bob"}, []int32{100}, []string{""}, []string{""}, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: batchInsufficientFundsCode})
+	mock.ExpectQuery("FROM send_coins_batch").
+		WithArgs(1, []string{"bob"}, []int32{100}, []string{""}, []string{""}, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: limitExceededCode, ConstraintName: models.LimitMonthly, Detail: "30"})
+
+	_, err := store.SendCoinsBatch(1, lines, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = store.SendCoinsBatch(1, lines, models.SpendingLimits{})
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, &LimitError{Limit: models.LimitMonthly, Remaining: 30}, limitErr)
+	_, err = store.SendCoinsBatch(1, nil, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrEmptyBatch)
+	_, err = store.SendCoinsBatch(1, []models.BatchTransferLine{{ToUser: "bob", Amount: 1, Category: "bribe"}},
+		models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrUnknownCategory)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinsBatchRejectsAmountAboveInteger(t *testing.T) {
+	resetMockDB(t)
+
+	// Сумма не помещается в INTEGER: строка отклоняется без обращения к базе, а не обрезается
+	results, err := store.SendCoinsBatch(1, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: 100}, {ToUser: "carol", Amount: 4294967301},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrBatchRejected)
+	assert.Equal(t, []models.BatchTransferResult{
+		{Line: 1, ToUser: "bob", Amount: 100, Status: models.BatchLineSkipped},
+		{Line: 2, ToUser: "carol", Amount: 4294967301, Status: models.BatchLineRejected,
+			Error: models.BatchErrorInvalidAmount},
+	}, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------
+// Тесты Memory.SendCoinsBatch
+// ---------------------------
+func TestMemorySendCoinsBatch(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	carol := registerMemoryUser(t, m, "carol")
+
+	results, err := m.SendCoinsBatch(alice, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: 300, Message: "премия", Category: models.CategoryGift},
+		{ToUser: "carol", Amount: 200},
+	}, models.SpendingLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, []models.BatchTransferResult{
+		{Line: 1, ToUser: "bob", Amount: 300, Status: models.BatchLineTransferred, TransactionID: 4},
+		{Line: 2, ToUser: "carol", Amount: 200, Status: models.BatchLineTransferred, TransactionID: 5},
+	}, results)
+	assert.Equal(t, 500, memoryCoins(t, m, alice))
+	assert.Equal(t, 1300, memoryCoins(t, m, bob))
+	assert.Equal(t, 1200, memoryCoins(t, m, carol))
+	assert.Equal(t, 500, m.ledgerBalance(alice))
+
+	info, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Contains(t, info.CoinHistory.Received, models.CoinTransaction{
+		User: "alice", Amount: 300, Message: "премия", Category: models.CategoryGift,
+	})
+}
+
+func TestMemorySendCoinsBatchRejectsInvalidLines(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+
+	results, err := m.SendCoinsBatch(alice, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: 100},
+		{ToUser: "ghost", Amount: 100},
+		{ToUser: "alice", Amount: 100},
+		{ToUser: "bob", Amount: 0},
+		{ToUser: "bob", Amount: 50},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrBatchRejected)
+	assert.Equal(t, []models.BatchTransferResult{
+		{Line: 1, ToUser: "bob", Amount: 100, Status: models.BatchLineSkipped},
+		{Line: 2, ToUser: "ghost", Amount: 100, Status: models.BatchLineRejected, Error: models.BatchErrorUserNotFound},
+		{Line: 3, ToUser: "alice", Amount: 100, Status: models.BatchLineRejected, Error: models.BatchErrorSelfTransfer},
+		{Line: 4, ToUser: "bob", Amount: 0, Status: models.BatchLineRejected, Error: models.BatchErrorInvalidAmount},
+		{Line: 5, ToUser: "bob", Amount: 50, Status: models.BatchLineRejected, Error: models.BatchErrorDuplicateReceiver},
+	}, results)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+}
+
+func TestMemorySendCoinsBatchRejectsHugeAmounts(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+
+	// Сумма пакета без ограничения строк переполнила бы int и прошла проверку баланса
+	results, err := m.SendCoinsBatch(alice, []models.BatchTransferLine{
+		{ToUser: "bob", Amount: math.MaxInt}, {ToUser: "carol", Amount: 2},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrBatchRejected)
+	assert.Equal(t, models.BatchErrorInvalidAmount, results[0].Error)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+	assert.Equal(t, 1000, memoryCoins(t, m, bob))
+}
+
+func TestMemorySendCoinsBatchIsAtomic(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+	lines := []models.BatchTransferLine{{ToUser: "bob", Amount: 600}, {ToUser: "carol", Amount: 300}}
+
+	// Дневной лимит проверяется по сумме пакета, хотя каждая строка в него укладывается
+	_, err := m.SendCoinsBatch(alice, lines, models.SpendingLimits{Daily: 800})
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 800}, limitErr)
+	_, err = m.SendCoinsBatch(alice, lines, models.SpendingLimits{PerTransfer: 500})
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, models.LimitPerTransfer, limitErr.Limit)
+
+	_, err = m.SendCoinsBatch(alice, append(lines, models.BatchTransferLine{ToUser: "carol", Amount: 200}),
+		models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrBatchRejected)
+	lines[1].Amount = 500
+	_, err = m.SendCoinsBatch(alice, lines, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, info.CoinHistory.Sent)
+}
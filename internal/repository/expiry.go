@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"time"
+)
+
+// ExpireCoins сжигает партии монет, выпущенные раньше before.
+// Вся работа выполняется функцией expire_coins, которая блокирует пользователей по очереди,
+// поэтому одновременный запуск на нескольких репликах сжигает монеты один раз.
+func (p *Postgres) ExpireCoins(before time.Time) (int, int, error) {
+	var users, total int
+	err := p.db.QueryRow(context.Background(),
+		"SELECT users_expired, total_expired FROM expire_coins($1);", before).Scan(&users, &total)
+	if err != nil {
+		return 0, 0, err
+	}
+	return users, total, nil
+}
+
+// memLot - партия монет пользователя, выпущенных в момент issuedAt
+type memLot struct {
+	issuedAt time.Time
+	amount   int
+}
+
+// ExpireCoins сжигает партии монет, выпущенные раньше before
+func (m *Memory) ExpireCoins(before time.Time) (int, int, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	users, total := 0, 0
+	date := m.now().UTC()
+	for _, user := range m.users {
+		expired := 0
+		for _, lot := range user.lots {
+			if lot.issuedAt.Before(before) {
+				expired += lot.amount
+			}
+		}
+		if expired == 0 {
+			continue
+		}
+		transfer := memTransfer{
+			id:       len(m.transfers) + 1,
+			date:     date,
+			senderID: user.id,
+			amount:   expired,
+			kind:     models.TransactionExpiry,
+		}
+		m.transfers = append(m.transfers, transfer)
+		// Партии упорядочены по дате выпуска, поэтому списание забирает ровно сгоревшие
+		m.postEntry(entryExpiry, date, user.id, accountIssuance, expired, transfer.id, 0)
+		users++
+		total += expired
+	}
+	return users, total, nil
+}
+
+// moveLots переносит партии монет по проводке на amount со счета from на счет to.
+// Списание со счета пользователя забирает его старейшие партии, зачисление пользователю сначала гасит
+// его долг, а остаток добавляет партиями: монеты другого пользователя сохраняют дату выпуска,
+// монеты с системных счетов выпускаются в момент date. Вызывается под блокировкой до изменения балансов.
+func (m *Memory) moveLots(from, to, amount int, date time.Time) {
+	var taken []memLot
+	if sender, ok := m.userByID(from); ok {
+		taken = sender.takeLots(amount)
+	}
+	if receiver, ok := m.userByID(to); ok {
+		receiver.creditLots(taken, amount, date)
+	}
+}
+
+// creditLots зачисляет пользователю amount монет из партий lots: зачисление сначала гасит его долг,
+// а остаток добавляет партиями с прежней датой выпуска. Монеты сверх партий выпускаются в момент date.
+// Вызывается до изменения баланса.
+func (u *memUser) creditLots(lots []memLot, amount int, date time.Time) {
+	debt := max(-u.balance, 0)
+	remaining := amount
+	for _, lot := range lots {
+		remaining -= lot.amount
+		repaid := min(debt, lot.amount)
+		debt -= repaid
+		u.addLot(memLot{issuedAt: lot.issuedAt, amount: lot.amount - repaid})
+	}
+	u.addLot(memLot{issuedAt: date, amount: remaining - min(debt, remaining)})
+}
+
+// takeLots забирает до amount монет из партий пользователя, начиная со старейших, и возвращает забранные части
+func (u *memUser) takeLots(amount int) []memLot {
+	var taken []memLot
+	for amount > 0 && len(u.lots) > 0 {
+		lot := u.lots[0]
+		part := min(lot.amount, amount)
+		taken = append(taken, memLot{issuedAt: lot.issuedAt, amount: part})
+		amount -= part
+		if part == lot.amount {
+			u.lots = u.lots[1:]
+		} else {
+			u.lots[0].amount -= part
+		}
+	}
+	return taken
+}
+
+// addLot добавляет партию, сохраняя порядок по дате выпуска. Пустая партия не добавляется.
+func (u *memUser) addLot(lot memLot) {
+	if lot.amount <= 0 {
+		return
+	}
+	i := len(u.lots)
+	for i > 0 && u.lots[i-1].issuedAt.After(lot.issuedAt) {
+		i--
+	}
+	u.lots = append(u.lots[:i], append([]memLot{lot}, u.lots[i:]...)...)
+}
+
+// expiringSoon возвращает монеты, которые сгорят раньше until, сгруппированные по моменту сгорания
+func (u *memUser) expiringSoon(expiryPeriod time.Duration, until time.Time) []models.ExpiringCoins {
+	var result []models.ExpiringCoins
+	for _, lot := range u.lots {
+		expiresAt := lot.issuedAt.Add(expiryPeriod)
+		if !expiresAt.Before(until) {
+			break
+		}
+		if n := len(result); n > 0 && result[n-1].ExpiresAt.Equal(expiresAt) {
+			result[n-1].Amount += lot.amount
+			continue
+		}
+		result = append(result, models.ExpiringCoins{Amount: lot.amount, ExpiresAt: expiresAt})
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// --------------------------
+// Тесты Postgres.ExpireCoins
+// --------------------------
+func TestExpireCoins(t *testing.T) {
+	resetMockDB(t)
+	before := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM expire_coins").WithArgs(before).
+		WillReturnRows(pgxmock.NewRows([]string{"users_expired", "total_expired"}).AddRow(2, 1500))
+
+	users, total, err := store.ExpireCoins(before)
+	require.NoError(t, err)
+	assert.Equal(t, 2, users)
+	assert.Equal(t, 1500, total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserBalanceInventoryLogsExpiringSoon(t *testing.T) {
+	resetMockDB(t)
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("BEGIN").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectQuery("get_user_info").
+		WithArgs(1, 90*24*time.Hour, 30*24*time.Hour).
+		WillReturnRows(pgxmock.NewRows([]string{"info"}).AddRow([]byte(`{
+			"coins": 1000, "inventory": null, "coinHistory": {"received": null, "sent": null},
+			"expiringSoon": [{"amount": 300, "expiresAt": "2025-03-01T09:00:00.5+00:00"}]}`)))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+
+	result, err := store.GetUserBalanceInventoryLogs(1, 90*24*time.Hour, 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, result.ExpiringSoon, 1)
+	assert.Equal(t, 300, result.ExpiringSoon[0].Amount)
+	assert.True(t, time.Date(2025, 3, 1, 9, 0, 0, 5e8, time.UTC).Equal(result.ExpiringSoon[0].ExpiresAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------
+// Тесты партий монет в Memory
+// ---------------------------
+func TestMemoryLotsSpentOldestFirst(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	clock = clock.AddDate(0, 1, 0)
+	bob := registerMemoryUser(t, m, "bob")
+	require.NoError(t, m.SendCoins(alice, 300, "bob", models.TransferNote{}, models.SpendingLimits{}))
+
+	// Полученные монеты сохраняют дату выпуска и тратятся раньше собственных монет bob
+	assert.Equal(t, []memLot{
+		{issuedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), amount: 300},
+		{issuedAt: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), amount: 1000},
+	}, m.users[bob-1].lots)
+	require.NoError(t, m.BuyItemsForUser(bob, "t-shirt", "", 5, models.SpendingLimits{}))
+	assert.Equal(t, []memLot{
+		{issuedAt: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), amount: 900},
+	}, m.users[bob-1].lots)
+	assert.Equal(t, []memLot{
+		{issuedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), amount: 700},
+	}, m.users[alice-1].lots)
+}
+
+func TestMemoryLotsRepayDebtFirst(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	user := m.users[alice-1]
+	user.balance, user.lots = -50, nil
+
+	m.grant(alice, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 80, "bonus", 0, entryGrant)
+	assert.Equal(t, 30, user.balance)
+	assert.Equal(t, []memLot{{issuedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), amount: 30}}, user.lots)
+}
+
+// -------------------------
+// Тесты Memory.ExpireCoins
+// -------------------------
+func TestMemoryExpireCoins(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	clock = clock.AddDate(0, 2, 0)
+	bob := registerMemoryUser(t, m, "bob")
+	require.NoError(t, m.SendCoins(alice, 400, "bob", models.TransferNote{}, models.SpendingLimits{}))
+	clock = clock.AddDate(0, 1, 0)
+
+	users, total, err := m.ExpireCoins(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 2, users)
+	assert.Equal(t, 1000, total)
+
+	infoAlice, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, infoAlice.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		{User: "bob", Amount: 400},
+		{Amount: 600, Type: models.TransactionExpiry},
+	}, infoAlice.CoinHistory.Sent)
+	infoBob, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, infoBob.Coins)
+	assert.Equal(t, infoBob.Coins, m.ledgerBalance(bob))
+
+	// Повторный запуск ничего не сжигает
+	users, total, err = m.ExpireCoins(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Zero(t, users)
+	assert.Zero(t, total)
+}
+
+func TestMemoryExpiringSoon(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	clock = clock.AddDate(0, 0, 20)
+	m.grant(alice, clock, 100, "bonus", 0, entryGrant)
+	m.grant(alice, clock, 50, "bonus", 0, entryGrant)
+	clock = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 60*24*time.Hour, 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ExpiringCoins{
+		{Amount: 1000, ExpiresAt: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{Amount: 150, ExpiresAt: time.Date(2025, 3, 22, 0, 0, 0, 0, time.UTC)},
+	}, info.ExpiringSoon)
+
+	info, err = m.GetUserBalanceInventoryLogs(alice, 0, 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, info.ExpiringSoon)
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"strings"
+	"time"
+)
+
+// memCampaign - кампания начислений в Memory
+type memCampaign struct {
+	id       int
+	name     string
+	amount   int
+	startsAt time.Time
+	endsAt   time.Time
+	adminID  int
+}
+
+// covers сообщает, попадает ли дата регистрации в период кампании
+func (c memCampaign) covers(registeredAt time.Time) bool {
+	return !registeredAt.Before(c.startsAt) && registeredAt.Before(c.endsAt)
+}
+
+// CreateGrantCampaign создает кампанию начислений и начисляет монеты уже зарегистрированным в ее период пользователям
+func (p *Postgres) CreateGrantCampaign(adminID int, campaign models.GrantCampaign) (models.GrantCampaign, error) {
+	err := p.db.QueryRow(context.Background(), "SELECT id, granted FROM create_grant_campaign($1, $2, $3, $4, $5);",
+		adminID, campaign.Name, campaign.Amount, campaign.StartsAt, campaign.EndsAt).
+		Scan(&campaign.ID, &campaign.Granted)
+	if err != nil {
+		return models.GrantCampaign{}, err
+	}
+	return campaign, nil
+}
+
+// GetGrantCampaigns возвращает кампании начислений от новых к старым
+func (p *Postgres) GetGrantCampaigns() ([]models.GrantCampaign, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT id, name, amount, starts_at, ends_at, granted FROM get_grant_campaigns();")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []models.GrantCampaign
+	for rows.Next() {
+		var campaign models.GrantCampaign
+		if err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.Amount,
+			&campaign.StartsAt, &campaign.EndsAt, &campaign.Granted); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// CreateGrantCampaign создает кампанию начислений и начисляет монеты уже зарегистрированным в ее период пользователям
+func (m *Memory) CreateGrantCampaign(adminID int, campaign models.GrantCampaign) (models.GrantCampaign, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if strings.TrimSpace(campaign.Name) == "" {
+		return models.GrantCampaign{}, ErrEmptyName
+	}
+	if campaign.Amount <= 0 {
+		return models.GrantCampaign{}, ErrInvalidAmount
+	}
+	if !campaign.StartsAt.Before(campaign.EndsAt) {
+		return models.GrantCampaign{}, ErrInvalidPeriod
+	}
+	for _, existing := range m.campaigns {
+		if existing.name == campaign.Name {
+			return models.GrantCampaign{}, ErrCampaignExists
+		}
+	}
+
+	created := memCampaign{
+		id:       len(m.campaigns) + 1,
+		name:     campaign.Name,
+		amount:   campaign.Amount,
+		startsAt: campaign.StartsAt,
+		endsAt:   campaign.EndsAt,
+		adminID:  adminID,
+	}
+	m.campaigns = append(m.campaigns, created)
+	campaign.ID = created.id
+	date := m.now().UTC()
+	for _, user := range m.users {
+		if created.covers(user.registeredAt) {
+			m.grant(user.id, date, created.amount, created.name, created.id, entryGrant)
+			campaign.Granted++
+		}
+	}
+	return campaign, nil
+}
+
+// GetGrantCampaigns возвращает кампании начислений от новых к старым
+func (m *Memory) GetGrantCampaigns() ([]models.GrantCampaign, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaigns := make([]models.GrantCampaign, 0, len(m.campaigns))
+	for i := len(m.campaigns) - 1; i >= 0; i-- {
+		c := m.campaigns[i]
+		campaign := models.GrantCampaign{ID: c.id, Name: c.name, Amount: c.amount, StartsAt: c.startsAt, EndsAt: c.endsAt}
+		for _, t := range m.transfers {
+			if t.campaignID == c.id {
+				campaign.Granted++
+			}
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, nil
+}
+
+// grant начисляет пользователю amount монет из выпуска с причиной reason и записывает начисление в историю.
+// Нулевая сумма ничего не записывает. Вызывается под блокировкой.
+func (m *Memory) grant(userID int, date time.Time, amount int, reason string, campaignID int, entryKind string) {
+	if amount == 0 {
+		return
+	}
+	transfer := memTransfer{
+		id:         len(m.transfers) + 1,
+		date:       date,
+		receiverID: userID,
+		amount:     amount,
+		kind:       models.TransactionGrant,
+		reason:     reason,
+		campaignID: campaignID,
+	}
+	m.transfers = append(m.transfers, transfer)
+	m.postEntry(entryKind, date, accountIssuance, userID, amount, transfer.id, 0)
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// ----------------------------------
+// Тесты Postgres.CreateGrantCampaign
+// ----------------------------------
+func TestCreateGrantCampaign(t *testing.T) {
+	resetMockDB(t)
+	start := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	campaign := models.GrantCampaign{Name: "onboarding week", Amount: 200, StartsAt: start, EndsAt: start.AddDate(0, 0, 7)}
+	mock.ExpectQuery("SELECT id, granted FROM create_grant_campaign").
+		WithArgs(1, "onboarding week", 200, campaign.StartsAt, campaign.EndsAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "granted"}).AddRow(3, 12))
+
+	created, err := store.CreateGrantCampaign(1, campaign)
+	require.NoError(t, err)
+	campaign.ID, campaign.Granted = 3, 12
+	assert.Equal(t, campaign, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// --------------------------------
+// Тесты Postgres.GetGrantCampaigns
+// --------------------------------
+func TestGetGrantCampaigns(t *testing.T) {
+	resetMockDB(t)
+	start := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM get_grant_campaigns").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "amount", "starts_at", "ends_at", "granted"}).
+			AddRow(2, "spring", 100, start.AddDate(0, 1, 0), start.AddDate(0, 2, 0), 0).
+			AddRow(1, "onboarding week", 200, start, start.AddDate(0, 0, 7), 12))
+
+	campaigns, err := store.GetGrantCampaigns()
+	require.NoError(t, err)
+	assert.Equal(t, []models.GrantCampaign{
+		{ID: 2, Name: "spring", Amount: 100, StartsAt: start.AddDate(0, 1, 0), EndsAt: start.AddDate(0, 2, 0)},
+		{ID: 1, Name: "onboarding week", Amount: 200, StartsAt: start, EndsAt: start.AddDate(0, 0, 7), Granted: 12},
+	}, campaigns)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// --------------------------------
+// Тесты приветственного начисления
+// --------------------------------
+func TestMemoryWelcomeGrant(t *testing.T) {
+	m := NewMemory()
+	userID, _, err := m.GetUserIDPassHashOrRegister("alice", "passHash", 500)
+	require.NoError(t, err)
+
+	info, err := m.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 500, info.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		{Amount: 500, Type: models.TransactionGrant, Reason: models.WelcomeGrantReason},
+	}, info.CoinHistory.Received)
+	assert.Equal(t, 500, m.ledgerBalance(userID))
+}
+
+func TestMemoryZeroStartingBalance(t *testing.T) {
+	m := NewMemory()
+	userID, _, err := m.GetUserIDPassHashOrRegister("alice", "passHash", 0)
+	require.NoError(t, err)
+
+	info, err := m.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, info.Coins)
+	assert.Empty(t, info.CoinHistory.Received)
+	assert.Empty(t, m.ledger)
+
+	_, _, err = m.GetUserIDPassHashOrRegister("bob", "passHash", -1)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+// --------------------------------
+// Тесты Memory.CreateGrantCampaign
+// --------------------------------
+func TestMemoryGrantCampaign(t *testing.T) {
+	m := NewMemory()
+	start := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	clock := start.Add(-time.Hour)
+	m.now = func() time.Time { return clock }
+	before := registerMemoryUser(t, m, "before")
+	clock = start.Add(time.Hour)
+	during := registerMemoryUser(t, m, "during")
+	admin := registerMemoryUser(t, m, "hr")
+
+	created, err := m.CreateGrantCampaign(admin, models.GrantCampaign{
+		Name: "onboarding week", Amount: 200, StartsAt: start, EndsAt: start.AddDate(0, 0, 7),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created.ID)
+	assert.Equal(t, 2, created.Granted)
+
+	clock = start.AddDate(0, 0, 1)
+	later := registerMemoryUser(t, m, "later")
+	clock = start.AddDate(0, 0, 7)
+	after := registerMemoryUser(t, m, "after")
+
+	for userID, expected := range map[int]int{before: 1000, during: 1200, admin: 1200, later: 1200, after: 1000} {
+		info, err := m.GetUserBalanceInventoryLogs(userID, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, expected, info.Coins, "userID %d", userID)
+	}
+	info, err := m.GetUserBalanceInventoryLogs(later, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CoinTransaction{
+		{Amount: 1000, Type: models.TransactionGrant, Reason: models.WelcomeGrantReason},
+		{Amount: 200, Type: models.TransactionGrant, Reason: "onboarding week"},
+	}, info.CoinHistory.Received)
+
+	campaigns, err := m.GetGrantCampaigns()
+	require.NoError(t, err)
+	require.Len(t, campaigns, 1)
+	assert.Equal(t, 3, campaigns[0].Granted)
+}
+
+func TestMemoryGrantCampaignValidation(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	start := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	valid := models.GrantCampaign{Name: "onboarding week", Amount: 200, StartsAt: start, EndsAt: start.AddDate(0, 0, 7)}
+
+	_, err := m.CreateGrantCampaign(admin, valid)
+	require.NoError(t, err)
+	_, err = m.CreateGrantCampaign(admin, valid)
+	assert.ErrorIs(t, err, ErrCampaignExists)
+
+	invalid := valid
+	invalid.Name = " "
+	_, err = m.CreateGrantCampaign(admin, invalid)
+	assert.ErrorIs(t, err, ErrEmptyName)
+	invalid = valid
+	invalid.Amount = 0
+	_, err = m.CreateGrantCampaign(admin, invalid)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	invalid = valid
+	invalid.EndsAt = invalid.StartsAt
+	_, err = m.CreateGrantCampaign(admin, invalid)
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
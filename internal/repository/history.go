@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+)
+
+// GetUserHistory возвращает историю переводов пользователя от новых к старым с учетом фильтров и курсора
+func (p *Postgres) GetUserHistory(userID int, filter models.HistoryFilter) ([]models.HistoryEntry, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT * FROM get_user_history($1, $2, $3, $4, $5, $6, $7, $8, $9);",
+		userID,
+		nullable(filter.Direction),
+		nullable(filter.Counterparty),
+		nullable(filter.From),
+		nullable(filter.To),
+		nullable(filter.MinAmount),
+		nullable(filter.MaxAmount),
+		nullable(filter.BeforeID),
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.HistoryEntry
+	for rows.Next() {
+		var entry models.HistoryEntry
+		var kind string
+		var reversalOf, reversedBy *int
+		if err := rows.Scan(&entry.ID, &entry.Direction, &entry.User, &entry.Amount, &entry.Date,
+			&kind, &entry.Reason, &entry.Message, &entry.Category, &reversalOf, &reversedBy); err != nil {
+			return nil, err
+		}
+		if kind != models.TransactionTransfer {
+			entry.Type = kind
+		}
+		if reversalOf != nil {
+			entry.ReversalOf = *reversalOf
+		}
+		if reversedBy != nil {
+			entry.ReversedBy = *reversedBy
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+// GetUserHistory возвращает историю переводов пользователя от новых к старым с учетом фильтров и курсора
+func (m *Memory) GetUserHistory(userID int, filter models.HistoryFilter) ([]models.HistoryEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reversedBy := make(map[int]int)
+	for _, t := range m.transfers {
+		if t.reversalOf != 0 {
+			reversedBy[t.reversalOf] = t.id
+		}
+	}
+	var history []models.HistoryEntry
+	for i := len(m.transfers) - 1; i >= 0 && len(history) < filter.Limit; i-- {
+		t := m.transfers[i]
+		entry := models.HistoryEntry{ID: t.id, Amount: t.amount, Date: t.date, Type: t.historyType(), Reason: t.reason,
+			Message: t.message, Category: t.category, ReversalOf: t.reversalOf, ReversedBy: reversedBy[t.id]}
+		switch userID {
+		case t.senderID:
+			entry.Direction = models.DirectionSent
+		case t.receiverID:
+			entry.Direction = models.DirectionReceived
+		default:
+			continue
+		}
+		entry.User = m.counterparty(t, userID)
+		if matchesHistoryFilter(entry, filter) {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+// matchesHistoryFilter проверяет запись истории на соответствие фильтрам
+func matchesHistoryFilter(entry models.HistoryEntry, filter models.HistoryFilter) bool {
+	return (filter.Direction == "" || entry.Direction == filter.Direction) &&
+		(filter.Counterparty == "" || entry.User == filter.Counterparty) &&
+		(filter.From.IsZero() || !entry.Date.Before(filter.From)) &&
+		(filter.To.IsZero() || entry.Date.Before(filter.To)) &&
+		(filter.MinAmount == 0 || entry.Amount >= filter.MinAmount) &&
+		(filter.MaxAmount == 0 || entry.Amount <= filter.MaxAmount) &&
+		(filter.BeforeID == 0 || entry.ID < filter.BeforeID)
+}
+
+// nullable возвращает nil для нулевого значения, чтобы незаданный фильтр передавался в базу как NULL
+func nullable[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// ----------------------------
+// Тесты Postgres.GetUserHistory
+// ----------------------------
+func TestGetUserHistoryPassesFiltersAsNulls(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	reversed, reversal := 42, 43
+	mock.ExpectQuery("SELECT \\* FROM get_user_history").
+		WithArgs(1, "sent", nil, nil, nil, 10, nil, 50, 21).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "direction", "counterparty", "amount", "transaction_date", "kind", "reason", "message", "category",
+			"reversal_of", "reversed_by",
+		}).
+			AddRow(43, "received", "bob", 30, date, "reversal", "ошибка", "", "", &reversed, nil).
+			AddRow(42, "sent", "bob", 30, date, "transfer", "", "за обед", "reimbursement", nil, &reversal).
+			AddRow(41, "received", "hr", 200, date, "mint", "bonus", "", "", nil, nil))
+
+	history, err := store.GetUserHistory(1, models.HistoryFilter{
+		Direction: models.DirectionSent,
+		MinAmount: 10,
+		BeforeID:  50,
+		Limit:     21,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.HistoryEntry{
+		{ID: 43, Direction: "received", User: "bob", Amount: 30, Date: date, Type: "reversal", Reason: "ошибка",
+			ReversalOf: 42},
+		{ID: 42, Direction: "sent", User: "bob", Amount: 30, Date: date, Message: "за обед", Category: "reimbursement",
+			ReversedBy: 43},
+		{ID: 41, Direction: "received", User: "hr", Amount: 200, Date: date, Type: "mint", Reason: "bonus"},
+	}, history)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// --------------------------
+// Тесты Memory.GetUserHistory
+// --------------------------
+func TestMemoryGetUserHistory(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+	start := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	m.now = func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}
+
+	// id 1-3 - приветственные начисления при регистрации
+	require.NoError(t, m.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{}))   // id 4, 01:00
+	require.NoError(t, m.SendCoins(bob, 20, "alice", models.TransferNote{}, models.SpendingLimits{}))   // id 5, 02:00
+	require.NoError(t, m.SendCoins(alice, 30, "carol", models.TransferNote{}, models.SpendingLimits{})) // id 6, 03:00
+	require.NoError(t, m.SendCoins(alice, 40, "bob", models.TransferNote{}, models.SpendingLimits{}))   // id 7, 04:00
+
+	all, err := m.GetUserHistory(alice, models.HistoryFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+	assert.Equal(t, []int{7, 6, 5, 4, 1}, historyIDs(all))
+	assert.Equal(t, models.HistoryEntry{
+		ID: 5, Direction: models.DirectionReceived, User: "bob", Amount: 20, Date: start.Add(2 * time.Hour),
+	}, all[2])
+	assert.Equal(t, models.TransactionGrant, all[4].Type)
+	assert.Equal(t, models.WelcomeGrantReason, all[4].Reason)
+	assert.Equal(t, 1000, all[4].Amount)
+
+	page, err := m.GetUserHistory(alice, models.HistoryFilter{Limit: 2, BeforeID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, []int{6, 5}, historyIDs(page))
+
+	sentToBob, err := m.GetUserHistory(alice, models.HistoryFilter{
+		Limit: 10, Direction: models.DirectionSent, Counterparty: "bob",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{7, 4}, historyIDs(sentToBob))
+
+	ranged, err := m.GetUserHistory(alice, models.HistoryFilter{
+		Limit: 10, From: start.Add(2 * time.Hour), To: start.Add(4 * time.Hour), MinAmount: 25,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{6}, historyIDs(ranged))
+}
+
+// historyIDs возвращает идентификаторы записей истории
+func historyIDs(history []models.HistoryEntry) []int {
+	ids := make([]int, 0, len(history))
+	for _, entry := range history {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"sync"
+	"time"
+)
+
+// txDB позволяет методам хранилища работать внутри уже открытой транзакции.
+// Вложенные транзакции становятся точками сохранения.
+type txDB struct {
+	pgx.Tx
+}
+
+func (t txDB) BeginTx(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+	return t.Tx.Begin(ctx)
+}
+
+// Idempotent выполняет mutation не более одного раза для ключа key пользователя userID.
+// Ключ занимается вставкой строки в начале транзакции: параллельный запрос с тем же ключом
+// ждет ее завершения и затем получает сохраненный ответ. Изменения mutation, ключ и ответ
+// фиксируются одной транзакцией.
+func (p *Postgres) Idempotent(userID int, key, fingerprint string,
+	mutation func(Store) (models.IdempotentResponse, error)) (models.IdempotentResponse, bool, error) {
+	ctx := context.Background()
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return models.IdempotentResponse{}, false, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx, `INSERT INTO idempotency_keys (user_id, key, fingerprint) VALUES ($1, $2, $3)
+    ON CONFLICT (user_id, key) DO NOTHING;`, userID, key, fingerprint)
+	if err != nil {
+		return models.IdempotentResponse{}, false, err
+	}
+	if tag.RowsAffected() == 0 {
+		var storedFingerprint string
+		var stored models.IdempotentResponse
+		err = tx.QueryRow(ctx, `SELECT fingerprint, response_status, response_body FROM idempotency_keys
+    WHERE user_id = $1 AND key = $2;`, userID, key).Scan(&storedFingerprint, &stored.Status, &stored.Body)
+		if err != nil {
+			return models.IdempotentResponse{}, false, err
+		}
+		if storedFingerprint != fingerprint {
+			return models.IdempotentResponse{}, false, ErrIdempotencyKeyReused
+		}
+		return stored, true, nil
+	}
+
+	response, err := mutation(NewPostgres(txDB{tx}))
+	if err != nil {
+		return models.IdempotentResponse{}, false, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE idempotency_keys SET response_status = $3, response_body = $4
+    WHERE user_id = $1 AND key = $2;`, userID, key, response.Status, response.Body)
+	if err != nil {
+		return models.IdempotentResponse{}, false, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.IdempotentResponse{}, false, err
+	}
+	return response, false, nil
+}
+
+// DeleteExpiredIdempotencyKeys удаляет ключи идемпотентности старше ttl и возвращает их количество
+func (p *Postgres) DeleteExpiredIdempotencyKeys(ttl time.Duration) (int, error) {
+	tag, err := p.db.Exec(context.Background(),
+		"DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - $1::interval;", ttl)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+type memIdempotencyKey struct {
+	userID int
+	key    string
+}
+
+type memIdempotent struct {
+	fingerprint string
+	response    models.IdempotentResponse
+	createdAt   time.Time
+}
+
+// memKeyLock - блокировка одного ключа идемпотентности. waiters - сколько запросов держат или ждут
+// блокировку, последний из них удаляет ее из keyLocks.
+type memKeyLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// Idempotent выполняет mutation не более одного раза для ключа key пользователя userID.
+// Запросы с одним ключом выполняются по одному, поэтому повтор не может начаться, пока не завершился
+// исходный запрос, а запросы с разными ключами не ждут друг друга.
+// Как и транзакция в Postgres, mutation работает с копией состояния: при ошибке копия отбрасывается
+// и изменения не видны, при успехе копия подменяет состояние хранилища. Если за время mutation
+// состояние изменил другой запрос, mutation повторяется над новой копией, как повтор сериализуемой
+// транзакции. Копирование занимает время, пропорциональное объему данных в памяти.
+func (m *Memory) Idempotent(userID int, key, fingerprint string,
+	mutation func(Store) (models.IdempotentResponse, error)) (models.IdempotentResponse, bool, error) {
+	id := memIdempotencyKey{userID: userID, key: key}
+	unlock := m.lockIdempotencyKey(id)
+	defer unlock()
+
+	m.idempotencyMu.Lock()
+	stored, ok := m.idempotency[id]
+	m.idempotencyMu.Unlock()
+	if ok {
+		if stored.fingerprint != fingerprint {
+			return models.IdempotentResponse{}, false, ErrIdempotencyKeyReused
+		}
+		return stored.response, true, nil
+	}
+
+	for {
+		m.mu.RLock()
+		tx := &Memory{memState: m.memState.clone(), now: m.now}
+		version := m.version
+		m.mu.RUnlock()
+
+		response, err := mutation(tx)
+		if err != nil {
+			return models.IdempotentResponse{}, false, err
+		}
+		if m.commit(tx, version) {
+			m.idempotencyMu.Lock()
+			m.idempotency[id] = memIdempotent{fingerprint: fingerprint, response: response, createdAt: m.now()}
+			m.idempotencyMu.Unlock()
+			return response, false, nil
+		}
+	}
+}
+
+// commit подменяет состояние хранилища состоянием tx, если с момента копирования version
+// его никто не менял, и сообщает, удалось ли это
+func (m *Memory) commit(tx *Memory, version uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.version != version {
+		return false
+	}
+	m.memState = tx.memState
+	m.version++
+	return true
+}
+
+// lockIdempotencyKey берет блокировку ключа id и возвращает функцию ее освобождения
+func (m *Memory) lockIdempotencyKey(id memIdempotencyKey) func() {
+	m.idempotencyMu.Lock()
+	keyLock, ok := m.keyLocks[id]
+	if !ok {
+		keyLock = &memKeyLock{}
+		m.keyLocks[id] = keyLock
+	}
+	keyLock.waiters++
+	m.idempotencyMu.Unlock()
+
+	keyLock.mu.Lock()
+	return func() {
+		keyLock.mu.Unlock()
+		m.idempotencyMu.Lock()
+		defer m.idempotencyMu.Unlock()
+		if keyLock.waiters--; keyLock.waiters == 0 {
+			delete(m.keyLocks, id)
+		}
+	}
+}
+
+// DeleteExpiredIdempotencyKeys удаляет ключи идемпотентности старше ttl и возвращает их количество
+func (m *Memory) DeleteExpiredIdempotencyKeys(ttl time.Duration) (int, error) {
+	m.idempotencyMu.Lock()
+	defer m.idempotencyMu.Unlock()
+
+	deadline := m.now().Add(-ttl)
+	deleted := 0
+	for id, stored := range m.idempotency {
+		if stored.createdAt.Before(deadline) {
+			delete(m.idempotency, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"errors"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// -------------------------
+// Тесты Postgres.Idempotent
+// -------------------------
+func TestIdempotentExecutesMutationInTransaction(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs(1, "key", "fingerprint").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(stmtTransferCoins).
+		WithArgs(1, "bob", 10, 0, 0, 0, 0, nil, nil).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("UPDATE idempotency_keys").
+		WithArgs(1, "key", 200, []byte(nil)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	response, replayed, err := store.Idempotent(1, "key", "fingerprint",
+		func(tx Store) (models.IdempotentResponse, error) {
+			return models.IdempotentResponse{Status: 200}, tx.SendCoins(1, 10, "bob", models.TransferNote{}, models.SpendingLimits{})
+		})
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 200, response.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotentReplaysStoredResponse(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs(1, "key", "fingerprint").
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery("SELECT fingerprint, response_status, response_body FROM idempotency_keys").
+		WithArgs(1, "key").
+		WillReturnRows(pgxmock.NewRows([]string{"fingerprint", "response_status", "response_body"}).
+			AddRow("fingerprint", 200, []byte(`{"orderId":1}`)))
+	mock.ExpectRollback()
+
+	response, replayed, err := store.Idempotent(1, "key", "fingerprint",
+		func(Store) (models.IdempotentResponse, error) {
+			t.Fatal("повтор не должен выполнять изменение")
+			return models.IdempotentResponse{}, nil
+		})
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, models.IdempotentResponse{Status: 200, Body: []byte(`{"orderId":1}`)}, response)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotentRejectsDifferentRequest(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs(1, "key", "other").
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery("SELECT fingerprint, response_status, response_body FROM idempotency_keys").
+		WithArgs(1, "key").
+		WillReturnRows(pgxmock.NewRows([]string{"fingerprint", "response_status", "response_body"}).
+			AddRow("fingerprint", 200, []byte(nil)))
+	mock.ExpectRollback()
+
+	_, _, err := store.Idempotent(1, "key", "other", nil)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotentRollsBackFailedMutation(t *testing.T) {
+	resetMockDB(t)
+	mutationErr := errors.New("insufficient funds")
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs(1, "key", "fingerprint").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectRollback()
+
+	_, _, err := store.Idempotent(1, "key", "fingerprint",
+		func(Store) (models.IdempotentResponse, error) {
+			return models.IdempotentResponse{}, mutationErr
+		})
+	assert.ErrorIs(t, err, mutationErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpiredIdempotencyKeys(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("DELETE FROM idempotency_keys").
+		WithArgs(24 * time.Hour).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+
+	deleted, err := store.DeleteExpiredIdempotencyKeys(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------
+// Тесты Memory.Idempotent
+// -----------------------
+func TestMemoryIdempotent(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	transfer := func(tx Store) (models.IdempotentResponse, error) {
+		return models.IdempotentResponse{Status: 200}, tx.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{})
+	}
+
+	_, replayed, err := m.Idempotent(alice, "key", "fingerprint", transfer)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	response, replayed, err := m.Idempotent(alice, "key", "fingerprint", transfer)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, 200, response.Status)
+	_, _, err = m.Idempotent(alice, "key", "other", transfer)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 990, info.Coins)
+}
+
+func TestMemoryIdempotentRollsBackFailedMutation(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+	registerMemoryUser(t, m, "bob")
+	_, err := m.SetItemStock(admin, "cup", intPtr(5), 0)
+	require.NoError(t, err)
+	attempts := 0
+	mutation := func(tx Store) (models.IdempotentResponse, error) {
+		attempts++
+		if attempts == 1 {
+			require.NoError(t, tx.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{}))
+			require.NoError(t, tx.BuyItemsForUser(alice, "cup", "", 2, models.SpendingLimits{}))
+			return models.IdempotentResponse{}, ErrInsufficientFunds
+		}
+		return models.IdempotentResponse{Status: 200}, nil
+	}
+
+	_, _, err = m.Idempotent(alice, "key", "fingerprint", mutation)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	// Изменения, сделанные до ошибки, откатываются вместе с остатком товара и журналом проводок
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+	assert.Empty(t, info.Inventory)
+	assert.Empty(t, info.CoinHistory.Sent)
+	assert.Equal(t, 1000, m.ledgerBalance(alice))
+	catalog, err := m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(5), catalog[m.itemsByName["cup"]].Stock)
+
+	// Ключ не сохраняется, повтор выполняет mutation заново
+	_, replayed, err := m.Idempotent(alice, "key", "fingerprint", mutation)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestMemoryIdempotentRetriesAfterConcurrentChange(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	attempts := 0
+	mutation := func(tx Store) (models.IdempotentResponse, error) {
+		attempts++
+		if attempts == 1 {
+			// Параллельный запрос без ключа меняет состояние, пока mutation работает с копией
+			require.NoError(t, m.SendCoins(alice, 20, "bob", models.TransferNote{}, models.SpendingLimits{}))
+		}
+		return models.IdempotentResponse{Status: 200}, tx.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{})
+	}
+
+	_, _, err := m.Idempotent(alice, "key", "fingerprint", mutation)
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 970, memoryCoins(t, m, alice))
+	assert.Equal(t, 970, m.ledgerBalance(alice))
+}
+
+func TestMemoryIdempotentLocksPerKey(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	transfer := func(tx Store) (models.IdempotentResponse, error) {
+		return models.IdempotentResponse{Status: 200}, tx.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{})
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	done := make(chan error)
+	go func() {
+		_, _, err := m.Idempotent(alice, "first", "fingerprint", func(tx Store) (models.IdempotentResponse, error) {
+			once.Do(func() { close(started) })
+			<-release
+			return transfer(tx)
+		})
+		done <- err
+	}()
+
+	// Запрос с другим ключом не ждет незавершенный запрос с первым ключом
+	<-started
+	_, _, err := m.Idempotent(alice, "second", "fingerprint", transfer)
+	require.NoError(t, err)
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, 980, memoryCoins(t, m, alice))
+	assert.Empty(t, m.keyLocks)
+}
+
+func TestMemoryDeleteExpiredIdempotencyKeys(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	now := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	ok := func(Store) (models.IdempotentResponse, error) { return models.IdempotentResponse{Status: 200}, nil }
+
+	_, _, err := m.Idempotent(alice, "old", "fingerprint", ok)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, _, err = m.Idempotent(alice, "new", "fingerprint", ok)
+	require.NoError(t, err)
+
+	deleted, err := m.DeleteExpiredIdempotencyKeys(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, replayed, err := m.Idempotent(alice, "old", "fingerprint", ok)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+}
@@ -0,0 +1,87 @@
+package repository
+
+import "time"
+
+// Виды проводок журнала двойной записи, совпадают с ledger_entries.kind
+const (
+	entryIssuance  = "issuance"
+	entryTransfer  = "transfer"
+	entryPurchase  = "purchase"
+	entryGrant     = "grant"
+	entryAllowance = "allowance"
+	entryExpiry    = "expiry"
+	// entryTransferHold - резерв отложенного перевода, entryTransferRefund - возврат резерва при отмене
+	entryTransferHold   = "transfer_hold"
+	entryTransferRefund = "transfer_refund"
+	entryReversal       = "reversal"
+	// entryRefund - возврат цены покупки из выручки магазина
+	entryRefund = "refund"
+)
+
+// Системные счета журнала в Memory. Счета пользователей совпадают с их идентификаторами.
+const (
+	accountIssuance    = -1
+	accountShopRevenue = -2
+	accountEscrow      = -3
+)
+
+type memPosting struct {
+	account int
+	amount  int
+}
+
+// memEntry - сбалансированная проводка: сумма записей по счетам равна нулю
+type memEntry struct {
+	id         int
+	date       time.Time
+	kind       string
+	transferID int
+	purchaseID int
+	postings   []memPosting
+}
+
+// postEntry записывает проводку с датой date, по которой amount переходит со счета from на счет to,
+// и обновляет кеш балансов и партии монет пользователей. Нулевая сумма проводку не создает.
+// Вызывается под блокировкой.
+func (m *Memory) postEntry(kind string, date time.Time, from, to, amount, transferID, purchaseID int) {
+	if amount == 0 {
+		return
+	}
+	m.moveLots(from, to, amount, date)
+	m.recordEntry(kind, date, from, to, amount, transferID, purchaseID)
+}
+
+// recordEntry записывает проводку и обновляет кеш балансов, не трогая партии монет.
+// Нулевая сумма проводку не создает. Вызывается под блокировкой.
+func (m *Memory) recordEntry(kind string, date time.Time, from, to, amount, transferID, purchaseID int) {
+	if amount == 0 {
+		return
+	}
+	entry := memEntry{
+		id:         len(m.ledger) + 1,
+		date:       date,
+		kind:       kind,
+		transferID: transferID,
+		purchaseID: purchaseID,
+		postings:   []memPosting{{account: from, amount: -amount}, {account: to, amount: amount}},
+	}
+	for _, posting := range entry.postings {
+		if user, ok := m.userByID(posting.account); ok {
+			user.balance += posting.amount
+		}
+	}
+	m.ledger = append(m.ledger, entry)
+}
+
+// ledgerBalance возвращает баланс счета по журналу. Вызывается под блокировкой.
+func (m *Memory) ledgerBalance(account int) int {
+	balance := 0
+	for _, entry := range m.ledger {
+		for _, posting := range entry.postings {
+			if posting.account == account {
+				balance += posting.amount
+			}
+		}
+	}
+	return balance
+}
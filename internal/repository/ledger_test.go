@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// ------------------------
+// Тесты журнала в Memory
+// ------------------------
+func TestMemoryLedgerIsBalanced(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	require.NoError(t, m.SendCoins(alice, 150, "bob", models.TransferNote{}, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(bob, "hoody", "", 1, models.SpendingLimits{}))
+	_, err := m.PlaceOrder(alice, []models.OrderLine{{Item: "cup", Quantity: 2}, {Item: "pen", Quantity: 1}}, models.SpendingLimits{})
+	require.NoError(t, err)
+
+	kinds := make(map[string]int)
+	for _, entry := range m.ledger {
+		sum := 0
+		for _, posting := range entry.postings {
+			sum += posting.amount
+		}
+		assert.Zero(t, sum, "проводка %d не сбалансирована", entry.id)
+		kinds[entry.kind]++
+	}
+	assert.Equal(t, map[string]int{entryIssuance: 2, entryTransfer: 1, entryPurchase: 3}, kinds)
+
+	assert.Equal(t, 800, m.ledgerBalance(alice))
+	assert.Equal(t, 850, m.ledgerBalance(bob))
+	assert.Equal(t, -2000, m.ledgerBalance(accountIssuance))
+	assert.Equal(t, 350, m.ledgerBalance(accountShopRevenue))
+	for _, user := range m.users {
+		assert.Equal(t, m.ledgerBalance(user.id), user.balance)
+	}
+}
+
+func TestMemoryLedgerFailedOperationsPostNothing(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+
+	assert.ErrorIs(t, m.SendCoins(alice, 5000, "bob", models.TransferNote{}, models.SpendingLimits{}), ErrInsufficientFunds)
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "pink-hoody", "", 3, models.SpendingLimits{}), ErrInsufficientFunds)
+	assert.Len(t, m.ledger, 2)
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strconv"
+	"time"
+)
+
+// ErrLimitExceeded - операция превышает лимит трат, подробности в *LimitError
+var ErrLimitExceeded = errors.New("spending limit exceeded")
+
+// limitExceededCode - SQLSTATE ошибки превышения лимита из check_spending_limits
+const limitExceededCode = "LIM01"
+
+// LimitError - превышение лимита трат Limit. Remaining - сколько еще можно потратить в рамках этого лимита.
+type LimitError struct {
+	Limit     string
+	Remaining int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("spending limit %s exceeded, remaining %d", e.Limit, e.Remaining)
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrLimitExceeded)
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// limitError преобразует ошибку превышения лимита из базы в *LimitError, остальные ошибки возвращает как есть
+func limitError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == limitExceededCode {
+		remaining, _ := strconv.Atoi(pgErr.Detail)
+		return &LimitError{Limit: pgErr.ConstraintName, Remaining: remaining}
+	}
+	return err
+}
+
+// GetUserLimits возвращает лимиты, заданные пользователю администратором
+func (p *Postgres) GetUserLimits(username string) (models.SpendingLimits, bool, error) {
+	var userID int
+	var perTransfer, daily, monthly, perRecipient *int
+	err := p.db.QueryRow(context.Background(),
+		"SELECT user_id, per_transfer, daily, monthly, per_recipient FROM get_user_limits($1);", username).
+		Scan(&userID, &perTransfer, &daily, &monthly, &perRecipient)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.SpendingLimits{}, false, ErrUserNotFound
+	}
+	if err != nil {
+		return models.SpendingLimits{}, false, err
+	}
+	if perTransfer == nil {
+		return models.SpendingLimits{}, false, nil
+	}
+	return models.SpendingLimits{PerTransfer: *perTransfer, Daily: *daily, Monthly: *monthly, PerRecipient: *perRecipient},
+		true, nil
+}
+
+// SetUserLimits задает пользователю лимиты вместо лимитов из конфигурации
+func (p *Postgres) SetUserLimits(adminID int, username string, limits models.SpendingLimits) error {
+	if limits.PerTransfer < 0 || limits.Daily < 0 || limits.Monthly < 0 || limits.PerRecipient < 0 {
+		return ErrInvalidAmount
+	}
+	var found bool
+	err := p.db.QueryRow(context.Background(), "SELECT set_user_limits($1, $2, $3, $4, $5, $6);",
+		adminID, username, limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUserLimits возвращает пользователю лимиты из конфигурации
+func (p *Postgres) DeleteUserLimits(username string) error {
+	var found bool
+	if err := p.db.QueryRow(context.Background(), "SELECT delete_user_limits($1);", username).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetUserLimits возвращает лимиты, заданные пользователю администратором
+func (m *Memory) GetUserLimits(username string) (models.SpendingLimits, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.usersByName[username]
+	if !ok {
+		return models.SpendingLimits{}, false, ErrUserNotFound
+	}
+	limits, ok := m.userLimits[user.id]
+	return limits, ok, nil
+}
+
+// SetUserLimits задает пользователю лимиты вместо лимитов из конфигурации
+func (m *Memory) SetUserLimits(adminID int, username string, limits models.SpendingLimits) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if limits.PerTransfer < 0 || limits.Daily < 0 || limits.Monthly < 0 || limits.PerRecipient < 0 {
+		return ErrInvalidAmount
+	}
+	user, ok := m.usersByName[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	m.userLimits[user.id] = limits
+	return nil
+}
+
+// DeleteUserLimits возвращает пользователю лимиты из конфигурации
+func (m *Memory) DeleteUserLimits(username string) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.usersByName[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(m.userLimits, user.id)
+	return nil
+}
+
+// checkLimits проверяет, что списание amount не превышает лимиты трат пользователя, так же как
+// check_spending_limits: для покупок recipientID равен нулю, и лимиты переводов не проверяются.
+// При превышении возвращает *LimitError с лимитом, у которого наименьший остаток. Вызывается под блокировкой.
+func (m *Memory) checkLimits(user *memUser, recipientID, amount int, limits models.SpendingLimits) error {
+	if override, ok := m.userLimits[user.id]; ok {
+		limits = override
+	}
+	if limits.Daily <= 0 && limits.Monthly <= 0 && (recipientID == 0 || limits.PerTransfer <= 0 && limits.PerRecipient <= 0) {
+		return nil
+	}
+	now := m.now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var exceeded *LimitError
+	consider := func(limit string, remaining int) {
+		if exceeded == nil || remaining < exceeded.Remaining {
+			exceeded = &LimitError{Limit: limit, Remaining: remaining}
+		}
+	}
+	if recipientID != 0 && limits.PerTransfer > 0 {
+		consider(models.LimitPerTransfer, limits.PerTransfer)
+	}
+	if limits.Daily > 0 {
+		consider(models.LimitDaily, limits.Daily-m.spentSince(user.id, 0, dayStart))
+	}
+	if limits.Monthly > 0 {
+		consider(models.LimitMonthly, limits.Monthly-m.spentSince(user.id, 0, monthStart))
+	}
+	if recipientID != 0 && limits.PerRecipient > 0 {
+		consider(models.LimitPerRecipient, limits.PerRecipient-m.spentSince(user.id, recipientID, dayStart))
+	}
+	if exceeded == nil || amount <= exceeded.Remaining {
+		return nil
+	}
+	exceeded.Remaining = max(exceeded.Remaining, 0)
+	return exceeded
+}
+
+// spentSince возвращает сумму переводов, покупок за вычетом одобренных возвратов и резерва отложенных переводов
+// пользователя начиная с since. Если recipientID не ноль, учитываются только переводы этому получателю.
+// Вызывается под блокировкой.
+func (m *Memory) spentSince(userID, recipientID int, since time.Time) int {
+	spent := 0
+	for _, t := range m.transfers {
+		if t.senderID == userID && t.kind == models.TransactionTransfer && !t.date.Before(since) &&
+			(recipientID == 0 || t.receiverID == recipientID) {
+			spent += t.amount
+		}
+	}
+	for _, p := range m.pendingTransfers {
+		if p.senderID == userID && p.status == models.PendingTransferPending && !p.createdAt.Before(since) &&
+			(recipientID == 0 || p.receiverID == recipientID) {
+			spent += p.amount
+		}
+	}
+	if recipientID != 0 {
+		return spent
+	}
+	for _, p := range m.purchases {
+		if p.buyerID == userID && !p.date.Before(since) {
+			spent += (p.amount - m.returnedQuantity(p.id)) * p.unitPrice
+		}
+	}
+	return spent
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// -----------------------------------
+// Тесты превышения лимитов в Postgres
+// -----------------------------------
+func TestSendCoinsLimitExceeded(t *testing.T) {
+	resetMockDB(t)
+	limits := models.SpendingLimits{PerTransfer: 500, Daily: 1000}
+	mock.ExpectExec("^transfer_coins$").
+		WithArgs(1, "user2", 600, 500, 1000, 0, 0, nil, nil).
+		WillReturnError(&pgconn.PgError{Code: limitExceededCode, ConstraintName: models.LimitPerTransfer, Detail: "500"})
+
+	err := store.SendCoins(1, 600, "user2", models.TransferNote{}, limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, &LimitError{Limit: models.LimitPerTransfer, Remaining: 500}, limitErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLimitErrorKeepsOtherErrors(t *testing.T) {
+	err := &pgconn.PgError{Code: "P0001", Message: "Недостаточно средств"}
+	assert.Equal(t, error(err), limitError(err))
+	assert.NoError(t, limitError(nil))
+}
+
+// -------------------------------------
+// Тесты лимитов пользователя в Postgres
+// -------------------------------------
+func TestGetUserLimits(t *testing.T) {
+	resetMockDB(t)
+	columns := []string{"user_id", "per_transfer", "daily", "monthly", "per_recipient"}
+	perTransfer, daily, monthly, perRecipient := 100, 200, 0, 50
+	mock.ExpectQuery("FROM get_user_limits").WithArgs("alice").
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(1, &perTransfer, &daily, &monthly, &perRecipient))
+	mock.ExpectQuery("FROM get_user_limits").WithArgs("bob").
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(2, nil, nil, nil, nil))
+	mock.ExpectQuery("FROM get_user_limits").WithArgs("ghost").
+		WillReturnError(pgx.ErrNoRows)
+
+	limits, ok, err := store.GetUserLimits("alice")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, models.SpendingLimits{PerTransfer: 100, Daily: 200, PerRecipient: 50}, limits)
+	_, ok, err = store.GetUserLimits("bob")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = store.GetUserLimits("ghost")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetAndDeleteUserLimits(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT set_user_limits").WithArgs(1, "alice", 100, 200, 0, 50).
+		WillReturnRows(pgxmock.NewRows([]string{"set_user_limits"}).AddRow(true))
+	mock.ExpectQuery("SELECT set_user_limits").WithArgs(1, "ghost", 100, 200, 0, 50).
+		WillReturnRows(pgxmock.NewRows([]string{"set_user_limits"}).AddRow(false))
+	mock.ExpectQuery("SELECT delete_user_limits").WithArgs("alice").
+		WillReturnRows(pgxmock.NewRows([]string{"delete_user_limits"}).AddRow(true))
+	mock.ExpectQuery("SELECT delete_user_limits").WithArgs("ghost").
+		WillReturnRows(pgxmock.NewRows([]string{"delete_user_limits"}).AddRow(false))
+
+	limits := models.SpendingLimits{PerTransfer: 100, Daily: 200, PerRecipient: 50}
+	assert.NoError(t, store.SetUserLimits(1, "alice", limits))
+	assert.ErrorIs(t, store.SetUserLimits(1, "ghost", limits), ErrUserNotFound)
+	assert.ErrorIs(t, store.SetUserLimits(1, "alice", models.SpendingLimits{Daily: -1}), ErrInvalidAmount)
+	assert.NoError(t, store.DeleteUserLimits("alice"))
+	assert.ErrorIs(t, store.DeleteUserLimits("ghost"), ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------
+// Тесты лимитов трат в Memory
+// ---------------------------
+func TestMemoryLimitPerTransferAndRecipient(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+	limits := models.SpendingLimits{PerTransfer: 300, PerRecipient: 400}
+
+	assert.Equal(t, &LimitError{Limit: models.LimitPerTransfer, Remaining: 300},
+		m.SendCoins(alice, 301, "bob", models.TransferNote{}, limits))
+	require.NoError(t, m.SendCoins(alice, 300, "bob", models.TransferNote{}, limits))
+	assert.Equal(t, &LimitError{Limit: models.LimitPerRecipient, Remaining: 100},
+		m.SendCoins(alice, 101, "bob", models.TransferNote{}, limits))
+	require.NoError(t, m.SendCoins(alice, 300, "carol", models.TransferNote{}, limits))
+	// Лимиты переводов не действуют на покупки
+	require.NoError(t, m.BuyItemsForUser(alice, "powerbank", "", 2, limits))
+}
+
+func TestMemoryLimitDailyAndMonthly(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 1, 30, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	limits := models.SpendingLimits{Daily: 300, Monthly: 480}
+
+	require.NoError(t, m.BuyItemsForUser(alice, "powerbank", "", 1, limits))
+	err := m.SendCoins(alice, 150, "bob", models.TransferNote{}, limits)
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 100}, err)
+	_, err = m.PlaceOrder(alice, []models.OrderLine{{Item: "book", Quantity: 3}}, limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	// На следующий день суточный лимит обновляется, а месячный - нет
+	clock = clock.AddDate(0, 0, 1)
+	require.NoError(t, m.SendCoins(alice, 250, "bob", models.TransferNote{}, limits))
+	// Сообщается лимит с наименьшим остатком
+	assert.Equal(t, &LimitError{Limit: models.LimitMonthly, Remaining: 30}, m.SendCoins(alice, 40, "bob", models.TransferNote{}, limits))
+	require.NoError(t, m.SendCoins(alice, 30, "bob", models.TransferNote{}, limits))
+	assert.Equal(t, &LimitError{Limit: models.LimitMonthly, Remaining: 0}, m.BuyItemsForUser(alice, "pen", "", 1, limits))
+
+	// В новом месяце лимиты снова доступны
+	clock = time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, m.BuyItemsForUser(alice, "pen", "", 1, limits))
+}
+
+func TestMemoryLimitSkipsReturnedPurchases(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+	registerMemoryUser(t, m, "bob")
+	limits := models.SpendingLimits{Daily: 300}
+
+	require.NoError(t, m.BuyItemsForUser(alice, "powerbank", "", 1, limits))
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 100},
+		m.SendCoins(alice, 300, "bob", models.TransferNote{}, limits))
+
+	// Одобренный возврат освобождает лимит так же, как purchases_spent_since в базе
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	created, err := m.RequestPurchaseReturn(alice, purchases[0].ID, 1, "", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 100},
+		m.SendCoins(alice, 300, "bob", models.TransferNote{}, limits))
+	_, err = m.ApprovePurchaseReturn(admin, created.ID)
+	require.NoError(t, err)
+	require.NoError(t, m.SendCoins(alice, 300, "bob", models.TransferNote{}, limits))
+}
+
+func TestMemoryUserLimitsOverride(t *testing.T) {
+	m := NewMemory()
+	admin := registerMemoryUser(t, m, "hr")
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	defaults := models.SpendingLimits{PerTransfer: 100}
+
+	_, ok, err := m.GetUserLimits("alice")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, m.SetUserLimits(admin, "alice", models.SpendingLimits{PerTransfer: 500}))
+	limits, ok, err := m.GetUserLimits("alice")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, models.SpendingLimits{PerTransfer: 500}, limits)
+	require.NoError(t, m.SendCoins(alice, 400, "bob", models.TransferNote{}, defaults))
+
+	require.NoError(t, m.DeleteUserLimits("alice"))
+	assert.ErrorIs(t, m.SendCoins(alice, 400, "bob", models.TransferNote{}, defaults), ErrLimitExceeded)
+	assert.ErrorIs(t, m.SetUserLimits(admin, "ghost", limits), ErrUserNotFound)
+	assert.ErrorIs(t, m.DeleteUserLimits("ghost"), ErrUserNotFound)
+	_, _, err = m.GetUserLimits("ghost")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
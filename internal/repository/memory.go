@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultItems - каталог товаров, совпадает с database/migrations/003-insert_items.sql
+var defaultItems = []memItem{
+	{name: "t-shirt", price: 80},
+	{name: "cup", price: 20},
+	{name: "book", price: 50},
+	{name: "pen", price: 10},
+	{name: "powerbank", price: 200},
+	{name: "hoody", price: 300},
+	{name: "umbrella", price: 200},
+	{name: "socks", price: 10},
+	{name: "wallet", price: 50},
+	{name: "pink-hoody", price: 500},
+}
+
+type memItem struct {
+	name  string
+	price int
+	// stock - остаток товара, nil - не ограничен
+	stock *int
+	// perUserLimit - сколько единиц товара может купить один пользователь, 0 - без ограничения
+	perUserLimit int
+	// variants - варианты товара, нулевой - вариант по умолчанию с артикулом, равным названию товара
+	variants []memVariant
+}
+
+type memUser struct {
+	id       int
+	username string
+	passHash string
+	role     string
+	balance  int
+	// registeredAt - дата регистрации, по ней определяется участие в кампаниях начислений
+	registeredAt time.Time
+	inventory    map[memVariantKey]int
+	// lots - партии монет от старейших к новым, их сумма равна положительному балансу
+	lots []memLot
+}
+
+// memTransfer - запись журнала переводов. У начисления нет отправителя, у списания - получателя,
+// для них adminID - администратор, выполнивший операцию. У начислений grant нет и администратора,
+// campaignID - кампания, по которой начислены монеты.
+type memTransfer struct {
+	id         int
+	date       time.Time
+	senderID   int
+	receiverID int
+	amount     int
+	kind       string
+	reason     string
+	message    string
+	category   string
+	adminID    int
+	campaignID int
+	// allowanceRunID - запуск правила регулярных начислений, по которому начислены монеты
+	allowanceRunID int
+	// reversalOf - перевод, который отменяет операция reversal
+	reversalOf int
+}
+
+type memPurchase struct {
+	id        int
+	date      time.Time
+	buyerID   int
+	itemID    int
+	amount    int
+	unitPrice int
+	orderID   int
+	// variant - индекс купленного варианта в item.variants
+	variant int
+}
+
+// Memory потокобезопасная реализация Store в памяти процесса.
+// Предназначена для локального запуска без Docker и для тестов.
+type Memory struct {
+	mu sync.RWMutex
+	memState
+	// version увеличивается при каждой блокировке на запись, по нему Idempotent замечает параллельные изменения
+	version uint64
+	now     func() time.Time
+	// idempotencyMu защищает idempotency и keyLocks и не удерживается во время mutation
+	idempotencyMu sync.Mutex
+	idempotency   map[memIdempotencyKey]memIdempotent
+	keyLocks      map[memIdempotencyKey]*memKeyLock
+}
+
+// memState - данные хранилища. Idempotent выполняет изменения над копией состояния и подменяет им
+// состояние хранилища только в случае успеха.
+type memState struct {
+	users       []*memUser
+	usersByName map[string]*memUser
+	items       []memItem
+	itemsByName map[string]int
+	// variantsBySKU - варианты товаров по артикулу
+	variantsBySKU map[string]memVariantKey
+	transfers     []memTransfer
+	purchases     []memPurchase
+	orders        int
+	campaigns     []memCampaign
+	// allowanceRules - правила регулярных начислений по идентификатору
+	allowanceRules   map[int]*memAllowanceRule
+	allowanceRuleSeq int
+	allowanceRuns    []memAllowanceRun
+	// userLimits - лимиты трат, заданные пользователям администратором
+	userLimits map[int]models.SpendingLimits
+	// paymentRequests - запросы монет, идентификатор запроса на единицу больше индекса
+	paymentRequests []*memPaymentRequest
+	// pendingTransfers - отложенные переводы, идентификатор перевода на единицу больше индекса
+	pendingTransfers []*memPendingTransfer
+	// purchaseReturns - возвраты покупок, идентификатор возврата на единицу больше индекса
+	purchaseReturns []*memPurchaseReturn
+	// ledger - журнал проводок, balance пользователей - производный от него кеш
+	ledger []memEntry
+}
+
+// NewMemory создает пустое хранилище с каталогом товаров по умолчанию
+func NewMemory() *Memory {
+	m := &Memory{
+		memState: memState{
+			usersByName:    make(map[string]*memUser),
+			items:          slices.Clone(defaultItems),
+			itemsByName:    make(map[string]int, len(defaultItems)),
+			variantsBySKU:  make(map[string]memVariantKey, len(defaultItems)),
+			allowanceRules: make(map[int]*memAllowanceRule),
+			userLimits:     make(map[int]models.SpendingLimits),
+		},
+		now:         time.Now,
+		idempotency: make(map[memIdempotencyKey]memIdempotent),
+		keyLocks:    make(map[memIdempotencyKey]*memKeyLock),
+	}
+	for i, item := range m.items {
+		m.itemsByName[item.name] = i
+		m.items[i].variants = []memVariant{{sku: item.name}}
+		m.variantsBySKU[item.name] = memVariantKey{itemID: i}
+	}
+	return m
+}
+
+// lock берет блокировку на запись и отмечает изменение состояния
+func (m *Memory) lock() {
+	m.mu.Lock()
+	m.version++
+}
+
+// clone возвращает глубокую копию состояния: изменения копии не затрагивают исходное состояние.
+// Неизменяемые после создания записи (проводки, атрибуты вариантов) разделяются с исходным состоянием.
+func (s *memState) clone() memState {
+	c := *s
+	c.users = make([]*memUser, len(s.users))
+	c.usersByName = make(map[string]*memUser, len(s.usersByName))
+	for i, user := range s.users {
+		copied := *user
+		copied.inventory = maps.Clone(user.inventory)
+		copied.lots = slices.Clone(user.lots)
+		c.users[i] = &copied
+		c.usersByName[copied.username] = &copied
+	}
+	c.items = slices.Clone(s.items)
+	for i, item := range c.items {
+		c.items[i].stock = copyStock(item.stock)
+		c.items[i].variants = slices.Clone(item.variants)
+		for j, variant := range c.items[i].variants {
+			c.items[i].variants[j].stock = copyStock(variant.stock)
+		}
+	}
+	c.itemsByName = maps.Clone(s.itemsByName)
+	c.variantsBySKU = maps.Clone(s.variantsBySKU)
+	c.transfers = slices.Clone(s.transfers)
+	c.purchases = slices.Clone(s.purchases)
+	c.campaigns = slices.Clone(s.campaigns)
+	c.allowanceRules = make(map[int]*memAllowanceRule, len(s.allowanceRules))
+	for id, rule := range s.allowanceRules {
+		copied := *rule
+		c.allowanceRules[id] = &copied
+	}
+	c.allowanceRuns = slices.Clone(s.allowanceRuns)
+	c.userLimits = maps.Clone(s.userLimits)
+	c.paymentRequests = clonePointers(s.paymentRequests)
+	c.pendingTransfers = clonePointers(s.pendingTransfers)
+	for _, transfer := range c.pendingTransfers {
+		transfer.lots = slices.Clone(transfer.lots)
+	}
+	c.purchaseReturns = clonePointers(s.purchaseReturns)
+	c.ledger = slices.Clone(s.ledger)
+	return c
+}
+
+// clonePointers копирует записи, на которые указывают элементы records
+func clonePointers[T any](records []*T) []*T {
+	copied := make([]*T, len(records))
+	for i, record := range records {
+		value := *record
+		copied[i] = &value
+	}
+	return copied
+}
+
+// GetUserIDPassHashOrRegister ищет или регистрирует пользователя
+func (m *Memory) GetUserIDPassHashOrRegister(username string, providedPassHash string, startingBalance int) (int, []byte, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.usersByName[username]; ok {
+		return user.id, []byte(user.passHash), nil
+	}
+	if startingBalance < 0 {
+		return 0, nil, ErrInvalidAmount
+	}
+	user := &memUser{
+		id:           len(m.users) + 1,
+		username:     username,
+		passHash:     providedPassHash,
+		role:         models.RoleUser,
+		registeredAt: m.now().UTC(),
+		inventory:    make(map[memVariantKey]int),
+	}
+	m.users = append(m.users, user)
+	m.usersByName[username] = user
+	m.grant(user.id, user.registeredAt, startingBalance, models.WelcomeGrantReason, 0, entryIssuance)
+	for _, campaign := range m.campaigns {
+		if campaign.covers(user.registeredAt) {
+			m.grant(user.id, user.registeredAt, campaign.amount, campaign.name, campaign.id, entryGrant)
+		}
+	}
+	return user.id, []byte(user.passHash), nil
+}
+
+// GetUserBalanceInventoryLogs получает баланс пользователя, инвентарь, историю транзакций
+// и монеты, которые сгорят в ближайшие expiringWindow
+func (m *Memory) GetUserBalanceInventoryLogs(userID int, expiryPeriod, expiringWindow time.Duration) (models.InfoResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.userByID(userID)
+	if !ok {
+		return models.InfoResponse{}, ErrUserNotFound
+	}
+
+	var result models.InfoResponse
+	result.Coins = user.balance
+	for itemID, item := range m.items {
+		for variant := range item.variants {
+			if quantity, ok := user.inventory[memVariantKey{itemID: itemID, variant: variant}]; ok {
+				result.Inventory = append(result.Inventory, m.inventoryItem(itemID, variant, quantity))
+			}
+		}
+	}
+	for _, t := range m.transfers {
+		transaction := models.CoinTransaction{Amount: t.amount, Type: t.historyType(), Reason: t.reason,
+			Message: t.message, Category: t.category}
+		if t.receiverID == userID {
+			transaction.User = m.counterparty(t, userID)
+			result.CoinHistory.Received = append(result.CoinHistory.Received, transaction)
+		}
+		if t.senderID == userID {
+			transaction.User = m.counterparty(t, userID)
+			result.CoinHistory.Sent = append(result.CoinHistory.Sent, transaction)
+		}
+	}
+	if expiryPeriod > 0 {
+		result.ExpiringSoon = user.expiringSoon(expiryPeriod, m.now().UTC().Add(expiringWindow))
+	}
+	return result, nil
+}
+
+// SendCoins осуществляет перевод коинов от одного пользователя к другому
+func (m *Memory) SendCoins(userFromID, amount int, userTo string, note models.TransferNote,
+	limits models.SpendingLimits) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	sender, receiver, err := m.checkTransfer(userFromID, amount, userTo, note, limits)
+	if err != nil {
+		return err
+	}
+	m.addTransfer(sender, receiver, amount, note)
+	return nil
+}
+
+// checkTransfer проверяет перевод amount от userFromID пользователю userTo так же, как transfer_coins,
+// и возвращает отправителя и получателя. Вызывается под блокировкой.
+func (m *Memory) checkTransfer(userFromID, amount int, userTo string, note models.TransferNote,
+	limits models.SpendingLimits) (*memUser, *memUser, error) {
+	receiver, ok := m.usersByName[userTo]
+	if !ok {
+		return nil, nil, ErrUserNotFound
+	}
+	if amount <= 0 || amount > MaxAmount {
+		return nil, nil, ErrInvalidAmount
+	}
+	if receiver.id == userFromID {
+		return nil, nil, ErrSelfTransfer
+	}
+	if !ValidCategory(note.Category) {
+		return nil, nil, ErrUnknownCategory
+	}
+	sender, ok := m.userByID(userFromID)
+	if !ok {
+		return nil, nil, ErrUserNotFound
+	}
+	if sender.balance < amount {
+		return nil, nil, ErrInsufficientFunds
+	}
+	if err := m.checkLimits(sender, receiver.id, amount, limits); err != nil {
+		return nil, nil, err
+	}
+	return sender, receiver, nil
+}
+
+// BuyItemsForUser осуществляет покупку определенного количества вещей
+func (m *Memory) BuyItemsForUser(userID int, itemName, variant string, amount int, limits models.SpendingLimits) error {
+	m.lock()
+	defer m.mu.Unlock()
+
+	key, err := m.findVariant(itemName, variant)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 || amount > MaxQuantity {
+		return ErrInvalidAmount
+	}
+	user, ok := m.userByID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	cost, err := addPurchaseCost(0, m.variantPrice(key), amount)
+	if err != nil {
+		return err
+	}
+	if user.balance < cost {
+		return ErrInsufficientFunds
+	}
+	if err := m.checkLimits(user, 0, cost, limits); err != nil {
+		return err
+	}
+	if err := m.checkStock(userID, map[memVariantKey]int{key: amount}); err != nil {
+		return err
+	}
+
+	m.addPurchase(user, key, amount, 0)
+	return nil
+}
+
+// addPurchaseCost прибавляет к total стоимость quantity предметов по цене price. Как и buy_item
+// с place_order, сумму больше MaxAmount отклоняет с ErrInvalidAmount: она не помещается в INTEGER.
+func addPurchaseCost(total, price, quantity int) (int, error) {
+	if quantity > 0 && price > (MaxAmount-total)/quantity {
+		return 0, ErrInvalidAmount
+	}
+	return total + price*quantity, nil
+}
+
+// addTransfer записывает перевод amount от sender к receiver в историю и проводку по их счетам
+// и возвращает идентификатор перевода. Вызывается под блокировкой после всех проверок.
+func (m *Memory) addTransfer(sender, receiver *memUser, amount int, note models.TransferNote) int {
+	transfer := m.newTransfer(sender.id, receiver.id, amount, note)
+	m.postEntry(entryTransfer, transfer.date, sender.id, receiver.id, amount, transfer.id, 0)
+	return transfer.id
+}
+
+// newTransfer записывает перевод в историю без проводки. Вызывается под блокировкой.
+func (m *Memory) newTransfer(senderID, receiverID, amount int, note models.TransferNote) memTransfer {
+	transfer := memTransfer{
+		id:         len(m.transfers) + 1,
+		date:       m.now().UTC(),
+		senderID:   senderID,
+		receiverID: receiverID,
+		amount:     amount,
+		kind:       models.TransactionTransfer,
+		message:    note.Message,
+		category:   note.Category,
+	}
+	m.transfers = append(m.transfers, transfer)
+	return transfer
+}
+
+// addPurchase выдает пользователю предметы варианта key, уменьшает остатки товара и варианта, записывает
+// покупку в историю и проводку списания ее стоимости в выручку магазина. Вызывается под блокировкой.
+func (m *Memory) addPurchase(user *memUser, key memVariantKey, amount, orderID int) {
+	m.changeStock(key, -amount)
+	user.inventory[key] += amount
+	purchase := memPurchase{
+		id:        len(m.purchases) + 1,
+		date:      m.now().UTC(),
+		buyerID:   user.id,
+		itemID:    key.itemID,
+		amount:    amount,
+		unitPrice: m.variantPrice(key),
+		orderID:   orderID,
+		variant:   key.variant,
+	}
+	m.purchases = append(m.purchases, purchase)
+	m.postEntry(entryPurchase, purchase.date, user.id, accountShopRevenue, purchase.amount*purchase.unitPrice, 0, purchase.id)
+}
+
+// counterparty возвращает имя второй стороны перевода для пользователя userID.
+// Для начислений и списаний это администратор. Вызывается под блокировкой.
+func (m *Memory) counterparty(t memTransfer, userID int) string {
+	otherID := t.receiverID
+	if t.receiverID == userID {
+		otherID = t.senderID
+	}
+	if otherID == 0 {
+		otherID = t.adminID
+	}
+	if user, ok := m.userByID(otherID); ok {
+		return user.username
+	}
+	return ""
+}
+
+// historyType возвращает вид операции для истории: для обычных переводов он не указывается
+func (t memTransfer) historyType() string {
+	if t.kind == models.TransactionTransfer {
+		return ""
+	}
+	return t.kind
+}
+
+// userByID возвращает пользователя по идентификатору. Вызывается под блокировкой.
+func (m *Memory) userByID(userID int) (*memUser, bool) {
+	if userID < 1 || userID > len(m.users) {
+		return nil, false
+	}
+	return m.users[userID-1], true
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// ------------------------------------------
+// Тесты Memory.GetUserIDPassHashOrRegister
+// ------------------------------------------
+func TestMemoryRegisterAndLogin(t *testing.T) {
+	m := NewMemory()
+	userID, passHash, err := m.GetUserIDPassHashOrRegister("test", "passHash", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, userID)
+	assert.Equal(t, "passHash", string(passHash))
+
+	userID, passHash, err = m.GetUserIDPassHashOrRegister("test", "otherHash", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, userID)
+	assert.Equal(t, "passHash", string(passHash))
+}
+
+// -------------------------
+// Тесты Memory.SendCoins
+// -------------------------
+func TestMemorySendCoins(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	require.NoError(t, m.SendCoins(alice, 200, "bob", models.TransferNote{}, models.SpendingLimits{}))
+
+	infoAlice, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 800, infoAlice.Coins)
+	assert.Equal(t, []models.CoinTransaction{{User: "bob", Amount: 200}}, infoAlice.CoinHistory.Sent)
+
+	infoBob, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, infoBob.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		{User: "", Amount: 1000, Type: models.TransactionGrant, Reason: models.WelcomeGrantReason},
+		{User: "alice", Amount: 200},
+	}, infoBob.CoinHistory.Received)
+}
+
+func TestMemorySendCoinsWithNote(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	note := models.TransferNote{Message: "спасибо за ревью", Category: models.CategoryThanks}
+
+	require.NoError(t, m.SendCoins(alice, 50, "bob", note, models.SpendingLimits{}))
+
+	infoBob, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Contains(t, infoBob.CoinHistory.Received, models.CoinTransaction{
+		User: "alice", Amount: 50, Message: note.Message, Category: note.Category,
+	})
+
+	history, err := m.GetUserHistory(alice, models.HistoryFilter{Direction: models.DirectionSent, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, note.Message, history[0].Message)
+	assert.Equal(t, note.Category, history[0].Category)
+}
+
+func TestMemorySendCoinsErrors(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+
+	assert.ErrorIs(t, m.SendCoins(alice, 10, "nobody", models.TransferNote{}, models.SpendingLimits{}), ErrUserNotFound)
+	assert.ErrorIs(t, m.SendCoins(alice, 0, "bob", models.TransferNote{}, models.SpendingLimits{}), ErrInvalidAmount)
+	assert.ErrorIs(t, m.SendCoins(alice, MaxAmount+1, "bob", models.TransferNote{}, models.SpendingLimits{}),
+		ErrInvalidAmount)
+	assert.ErrorIs(t, m.SendCoins(alice, 10, "alice", models.TransferNote{}, models.SpendingLimits{}), ErrSelfTransfer)
+	assert.ErrorIs(t, m.SendCoins(alice, 1001, "bob", models.TransferNote{}, models.SpendingLimits{}), ErrInsufficientFunds)
+	assert.ErrorIs(t, m.SendCoins(alice, 10, "bob", models.TransferNote{Category: "bribe"}, models.SpendingLimits{}),
+		ErrUnknownCategory)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+	assert.Empty(t, info.CoinHistory.Sent)
+}
+
+func TestMemorySendCoinsConcurrent(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = m.SendCoins(alice, 10, "bob", models.TransferNote{}, models.SpendingLimits{})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = m.SendCoins(bob, 10, "alice", models.TransferNote{}, models.SpendingLimits{})
+		}()
+	}
+	wg.Wait()
+
+	infoAlice, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	infoBob, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2000, infoAlice.Coins+infoBob.Coins)
+	assert.GreaterOrEqual(t, infoAlice.Coins, 0)
+	assert.GreaterOrEqual(t, infoBob.Coins, 0)
+}
+
+// -------------------------------
+// Тесты Memory.BuyItemsForUser
+// -------------------------------
+func TestMemoryBuyItems(t *testing.T) {
+	m := NewMemory()
+	user := registerMemoryUser(t, m, "alice")
+
+	require.NoError(t, m.BuyItemsForUser(user, "t-shirt", "", 2, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(user, "cup", "", 1, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(user, "t-shirt", "", 1, models.SpendingLimits{}))
+
+	info, err := m.GetUserBalanceInventoryLogs(user, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000-3*80-20, info.Coins)
+	assert.Equal(t, []models.Item{{Type: "t-shirt", Quantity: 3}, {Type: "cup", Quantity: 1}}, info.Inventory)
+}
+
+func TestMemoryBuyItemsErrors(t *testing.T) {
+	m := NewMemory()
+	user := registerMemoryUser(t, m, "alice")
+
+	assert.ErrorIs(t, m.BuyItemsForUser(user, "unknown", "", 1, models.SpendingLimits{}), ErrItemNotFound)
+	assert.ErrorIs(t, m.BuyItemsForUser(user, "cup", "", 0, models.SpendingLimits{}), ErrInvalidAmount)
+	assert.ErrorIs(t, m.BuyItemsForUser(user, "pink-hoody", "", 3, models.SpendingLimits{}), ErrInsufficientFunds)
+	assert.ErrorIs(t, m.BuyItemsForUser(999, "cup", "", 1, models.SpendingLimits{}), ErrUserNotFound)
+
+	info, err := m.GetUserBalanceInventoryLogs(user, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+	assert.Empty(t, info.Inventory)
+}
+
+// registerMemoryUser регистрирует пользователя в хранилище и возвращает его идентификатор
+func registerMemoryUser(t *testing.T, m *Memory, username string) int {
+	userID, _, err := m.GetUserIDPassHashOrRegister(username, "passHash", 1000)
+	require.NoError(t, err)
+	return userID
+}
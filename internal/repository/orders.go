@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+)
+
+// PlaceOrder атомарно оплачивает все позиции заказа: либо все, либо ни одной
+func (p *Postgres) PlaceOrder(userID int, lines []models.OrderLine, limits models.SpendingLimits) (models.OrderResponse, error) {
+	itemNames := make([]string, len(lines))
+	variants := make([]string, len(lines))
+	quantities := make([]int32, len(lines))
+	for i, line := range lines {
+		if line.Quantity > MaxQuantity {
+			return models.OrderResponse{}, ErrInvalidAmount
+		}
+		itemNames[i] = line.Item
+		variants[i] = line.Variant
+		quantities[i] = int32(line.Quantity)
+	}
+
+	var order models.OrderResponse
+	err := p.db.QueryRow(context.Background(), "SELECT * FROM place_order($1, $2, $3, $4, $5, $6, $7, $8);",
+		userID, itemNames, variants, quantities, limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient).
+		Scan(&order.OrderID, &order.Total)
+	if err != nil {
+		return models.OrderResponse{}, purchaseError(err)
+	}
+	return order, nil
+}
+
+// PlaceOrder атомарно оплачивает все позиции заказа: либо все, либо ни одной
+func (m *Memory) PlaceOrder(userID int, lines []models.OrderLine, limits models.SpendingLimits) (models.OrderResponse, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if len(lines) == 0 {
+		return models.OrderResponse{}, ErrEmptyOrder
+	}
+	keys := make([]memVariantKey, len(lines))
+	quantities := make(map[memVariantKey]int, len(lines))
+	total := 0
+	for i, line := range lines {
+		if line.Quantity <= 0 || line.Quantity > MaxQuantity {
+			return models.OrderResponse{}, ErrInvalidAmount
+		}
+		key, err := m.findVariant(line.Item, line.Variant)
+		if err != nil {
+			return models.OrderResponse{}, err
+		}
+		keys[i] = key
+		quantities[key] += line.Quantity
+		if total, err = addPurchaseCost(total, m.variantPrice(key), line.Quantity); err != nil {
+			return models.OrderResponse{}, err
+		}
+	}
+	user, ok := m.userByID(userID)
+	if !ok {
+		return models.OrderResponse{}, ErrUserNotFound
+	}
+	if user.balance < total {
+		return models.OrderResponse{}, ErrInsufficientFunds
+	}
+	if err := m.checkLimits(user, 0, total, limits); err != nil {
+		return models.OrderResponse{}, err
+	}
+	if err := m.checkStock(userID, quantities); err != nil {
+		return models.OrderResponse{}, err
+	}
+
+	m.orders++
+	for i, line := range lines {
+		m.addPurchase(user, keys[i], line.Quantity, m.orders)
+	}
+	return models.OrderResponse{OrderID: m.orders, Total: total}, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// -------------------------
+// Тесты Postgres.PlaceOrder
+// -------------------------
+func TestPlaceOrder(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT \\* FROM place_order").
+		WithArgs(1, []string{"cup", "pen"}, []string{"", ""}, []int32{2, 3}, 0, 0, 0, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"placed_order_id", "placed_total_cost"}).AddRow(4, 70))
+
+	order, err := store.PlaceOrder(1, []models.OrderLine{{Item: "cup", Quantity: 2}, {Item: "pen", Quantity: 3}}, models.SpendingLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderResponse{OrderID: 4, Total: 70}, order)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderError(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT \\* FROM place_order").
+		WithArgs(1, []string{"pink-hoody"}, []string{""}, []int32{3}, 0, 0, 0, 0).
+		WillReturnError(errors.New("Insufficient balance"))
+
+	_, err := store.PlaceOrder(1, []models.OrderLine{{Item: "pink-hoody", Quantity: 3}}, models.SpendingLimits{})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurchasesRejectQuantityAboveInteger(t *testing.T) {
+	resetMockDB(t)
+
+	// Количество не помещается в INTEGER: заказ и покупка отклоняются без обращения к базе, а не обрезаются
+	_, err := store.PlaceOrder(1, []models.OrderLine{{Item: "cup", Quantity: 4294967297}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.ErrorIs(t, store.BuyItemsForUser(1, "cup", "", 4294967297, models.SpendingLimits{}), ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurchasesRejectCostAboveInteger(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("^buy_item$").
+		WithArgs(1, "hoody", nil, 10000, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: costOverflowCode})
+	mock.ExpectQuery("FROM place_order").
+		WithArgs(1, []string{"hoody"}, []string{""}, []int32{10000}, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: costOverflowCode})
+
+	assert.ErrorIs(t, store.BuyItemsForUser(1, "hoody", "", 10000, models.SpendingLimits{}), ErrInvalidAmount)
+	_, err := store.PlaceOrder(1, []models.OrderLine{{Item: "hoody", Quantity: 10000}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------
+// Тесты Memory.PlaceOrder
+// -----------------------
+func TestMemoryPlaceOrder(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+
+	order, err := m.PlaceOrder(alice, []models.OrderLine{{Item: "cup", Quantity: 2}, {Item: "pen", Quantity: 3}}, models.SpendingLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderResponse{OrderID: 1, Total: 70}, order)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 930, info.Coins)
+	assert.ElementsMatch(t, []models.Item{{Type: "cup", Quantity: 2}, {Type: "pen", Quantity: 3}}, info.Inventory)
+
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, purchases, 2)
+}
+
+func TestMemoryPlaceOrderIsAtomic(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+
+	_, err := m.PlaceOrder(alice, []models.OrderLine{{Item: "cup", Quantity: 1}, {Item: "unknown", Quantity: 1}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrItemNotFound)
+	_, err = m.PlaceOrder(alice, []models.OrderLine{{Item: "cup", Quantity: 1}, {Item: "pink-hoody", Quantity: 2}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = m.PlaceOrder(alice, []models.OrderLine{{Item: "cup", Quantity: 0}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = m.PlaceOrder(alice, nil, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrEmptyOrder)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+	assert.Empty(t, info.Inventory)
+}
+
+func TestMemoryPurchaseHugeQuantity(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+
+	// Стоимость огромного количества не должна переполняться и оплачиваться бесплатно
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "t-shirt", "", 1<<61, models.SpendingLimits{}), ErrInvalidAmount)
+	_, err := m.PlaceOrder(alice, []models.OrderLine{{Item: "t-shirt", Quantity: 1 << 61}}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	// Количество небольшое, но стоимость покупки или сумма заказа не помещается в INTEGER, как в buy_item
+	_, err = m.CreateItemVariant(admin, "t-shirt", models.ItemVariantRequest{SKU: "t-shirt-gold", Price: 1 << 20})
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "t-shirt", "t-shirt-gold", 1<<12, models.SpendingLimits{}),
+		ErrInvalidAmount)
+	_, err = m.PlaceOrder(alice, []models.OrderLine{
+		{Item: "t-shirt", Variant: "t-shirt-gold", Quantity: 1 << 10},
+		{Item: "t-shirt", Variant: "t-shirt-gold", Quantity: 1 << 10},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = m.PlaceOrder(alice, []models.OrderLine{
+		{Item: "t-shirt", Variant: "t-shirt-gold", Quantity: 1 << 10},
+		{Item: "t-shirt", Variant: "t-shirt-gold", Quantity: 1<<10 - 1},
+	}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, info.Coins)
+	assert.Empty(t, info.Inventory)
+}
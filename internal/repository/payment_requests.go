@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+// SQLSTATE ошибок закрытия запроса монет
+const (
+	paymentRequestClosedCode  = "PRQ01"
+	paymentRequestExpiredCode = "PRQ02"
+	payerFundsCode            = "PRQ03"
+)
+
+// paymentRequestColumns - поля payment_requests_view в порядке сканирования в models.PaymentRequest
+const paymentRequestColumns = "id, requester, payer, amount, note, status, created_at, expires_at, resolved_at"
+
+// memPaymentRequest - запрос монет в Memory. Просроченный запрос остается в статусе pending.
+type memPaymentRequest struct {
+	id          int
+	requesterID int
+	payerID     int
+	amount      int
+	note        string
+	status      string
+	createdAt   time.Time
+	expiresAt   time.Time
+	resolvedAt  *time.Time
+	// transferID - перевод, выполненный при одобрении
+	transferID int
+}
+
+// paymentRequestError преобразует ошибки закрытия запроса из базы в ошибки пакета
+func paymentRequestError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case paymentRequestClosedCode:
+			return ErrPaymentRequestClosed
+		case paymentRequestExpiredCode:
+			return ErrPaymentRequestExpired
+		case payerFundsCode:
+			return ErrInsufficientFunds
+		}
+	}
+	return limitError(err)
+}
+
+// scanPaymentRequest читает запрос монет из строки с полями paymentRequestColumns
+func scanPaymentRequest(row pgx.Row) (models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	err := row.Scan(&request.ID, &request.Requester, &request.Payer, &request.Amount, &request.Note, &request.Status,
+		&request.CreatedAt, &request.ExpiresAt, &request.ResolvedAt)
+	return request, err
+}
+
+// queryPaymentRequest выполняет функцию, которая возвращает один запрос монет или ничего,
+// если запроса нет или он недоступен пользователю
+func (p *Postgres) queryPaymentRequest(query string, args ...any) (models.PaymentRequest, error) {
+	request, err := scanPaymentRequest(p.db.QueryRow(context.Background(), query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	if err != nil {
+		return models.PaymentRequest{}, paymentRequestError(err)
+	}
+	return request, nil
+}
+
+// CreatePaymentRequest создает запрос монет у пользователя request.Payer
+func (p *Postgres) CreatePaymentRequest(requesterID int, request models.PaymentRequest) (models.PaymentRequest, error) {
+	if request.Amount <= 0 {
+		return models.PaymentRequest{}, ErrInvalidAmount
+	}
+	created, err := p.queryPaymentRequest(
+		"SELECT "+paymentRequestColumns+" FROM create_payment_request($1, $2, $3, $4, $5);",
+		requesterID, request.Payer, request.Amount, nullable(request.Note), request.ExpiresAt.UTC())
+	if errors.Is(err, ErrPaymentRequestNotFound) {
+		return models.PaymentRequest{}, ErrUserNotFound
+	}
+	return created, err
+}
+
+// GetPaymentRequests возвращает входящие или исходящие запросы монет пользователя от новых к старым
+func (p *Postgres) GetPaymentRequests(userID int, direction, status string, limit int) ([]models.PaymentRequest, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT "+paymentRequestColumns+" FROM get_payment_requests($1, $2, $3, $4);",
+		userID, direction, nullable(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.PaymentRequest
+	for rows.Next() {
+		request, err := scanPaymentRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// ApprovePaymentRequest одобряет запрос плательщиком и переводит монеты в той же транзакции
+func (p *Postgres) ApprovePaymentRequest(payerID, requestID int, limits models.SpendingLimits) (models.PaymentRequest, error) {
+	return p.queryPaymentRequest(
+		"SELECT "+paymentRequestColumns+" FROM approve_payment_request($1, $2, $3, $4, $5, $6);",
+		payerID, requestID, limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient)
+}
+
+// ClosePaymentRequest отклоняет запрос плательщиком или отменяет его запросившим
+func (p *Postgres) ClosePaymentRequest(userID, requestID int, status string) (models.PaymentRequest, error) {
+	if status != models.PaymentRequestDeclined && status != models.PaymentRequestCancelled {
+		return models.PaymentRequest{}, ErrUnknownOperation
+	}
+	return p.queryPaymentRequest(
+		"SELECT "+paymentRequestColumns+" FROM close_payment_request($1, $2, $3);", userID, requestID, status)
+}
+
+// CreatePaymentRequest создает запрос монет у пользователя request.Payer
+func (m *Memory) CreatePaymentRequest(requesterID int, request models.PaymentRequest) (models.PaymentRequest, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	payer, ok := m.usersByName[request.Payer]
+	if !ok {
+		return models.PaymentRequest{}, ErrUserNotFound
+	}
+	if request.Amount <= 0 {
+		return models.PaymentRequest{}, ErrInvalidAmount
+	}
+	if payer.id == requesterID {
+		return models.PaymentRequest{}, ErrSelfTransfer
+	}
+	if _, ok := m.userByID(requesterID); !ok {
+		return models.PaymentRequest{}, ErrUserNotFound
+	}
+	now := m.now().UTC()
+	created := &memPaymentRequest{
+		id:          len(m.paymentRequests) + 1,
+		requesterID: requesterID,
+		payerID:     payer.id,
+		amount:      request.Amount,
+		note:        request.Note,
+		status:      models.PaymentRequestPending,
+		createdAt:   now,
+		expiresAt:   request.ExpiresAt.UTC(),
+	}
+	m.paymentRequests = append(m.paymentRequests, created)
+	return m.paymentRequestView(created, now), nil
+}
+
+// GetPaymentRequests возвращает входящие или исходящие запросы монет пользователя от новых к старым
+func (m *Memory) GetPaymentRequests(userID int, direction, status string, limit int) ([]models.PaymentRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now().UTC()
+	var requests []models.PaymentRequest
+	for i := len(m.paymentRequests) - 1; i >= 0 && len(requests) < limit; i-- {
+		request := m.paymentRequests[i]
+		partyID := request.requesterID
+		if direction == models.DirectionIncoming {
+			partyID = request.payerID
+		}
+		if partyID != userID {
+			continue
+		}
+		view := m.paymentRequestView(request, now)
+		if status == "" || view.Status == status {
+			requests = append(requests, view)
+		}
+	}
+	return requests, nil
+}
+
+// ApprovePaymentRequest одобряет запрос плательщиком и переводит монеты атомарно с закрытием запроса
+func (m *Memory) ApprovePaymentRequest(payerID, requestID int, limits models.SpendingLimits) (models.PaymentRequest, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.paymentRequestByID(requestID)
+	if !ok || request.payerID != payerID {
+		return models.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	now := m.now().UTC()
+	if err := request.checkPending(now); err != nil {
+		return models.PaymentRequest{}, err
+	}
+	payer, _ := m.userByID(request.payerID)
+	requester, _ := m.userByID(request.requesterID)
+	if payer.balance < request.amount {
+		return models.PaymentRequest{}, ErrInsufficientFunds
+	}
+	if err := m.checkLimits(payer, requester.id, request.amount, limits); err != nil {
+		return models.PaymentRequest{}, err
+	}
+
+	request.transferID = m.addTransfer(payer, requester, request.amount, models.TransferNote{Message: request.note})
+	request.status = models.PaymentRequestApproved
+	request.resolvedAt = &now
+	return m.paymentRequestView(request, now), nil
+}
+
+// ClosePaymentRequest отклоняет запрос плательщиком или отменяет его запросившим
+func (m *Memory) ClosePaymentRequest(userID, requestID int, status string) (models.PaymentRequest, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.paymentRequestByID(requestID)
+	if !ok {
+		return models.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	switch status {
+	case models.PaymentRequestDeclined:
+		ok = request.payerID == userID
+	case models.PaymentRequestCancelled:
+		ok = request.requesterID == userID
+	default:
+		return models.PaymentRequest{}, ErrUnknownOperation
+	}
+	if !ok {
+		return models.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	now := m.now().UTC()
+	if err := request.checkPending(now); err != nil {
+		return models.PaymentRequest{}, err
+	}
+
+	request.status = status
+	request.resolvedAt = &now
+	return m.paymentRequestView(request, now), nil
+}
+
+// paymentRequestByID возвращает запрос монет по идентификатору. Вызывается под блокировкой.
+func (m *Memory) paymentRequestByID(requestID int) (*memPaymentRequest, bool) {
+	if requestID < 1 || requestID > len(m.paymentRequests) {
+		return nil, false
+	}
+	return m.paymentRequests[requestID-1], true
+}
+
+// paymentRequestView возвращает запрос монет с именами участников и статусом на момент now.
+// Вызывается под блокировкой.
+func (m *Memory) paymentRequestView(request *memPaymentRequest, now time.Time) models.PaymentRequest {
+	requester, _ := m.userByID(request.requesterID)
+	payer, _ := m.userByID(request.payerID)
+	view := models.PaymentRequest{
+		ID:         request.id,
+		Requester:  requester.username,
+		Payer:      payer.username,
+		Amount:     request.amount,
+		Note:       request.note,
+		Status:     request.status,
+		CreatedAt:  request.createdAt,
+		ExpiresAt:  request.expiresAt,
+		ResolvedAt: request.resolvedAt,
+	}
+	if request.status == models.PaymentRequestPending && !now.Before(request.expiresAt) {
+		view.Status = models.PaymentRequestExpired
+	}
+	return view
+}
+
+// checkPending проверяет, что запрос еще можно закрыть на момент now
+func (r *memPaymentRequest) checkPending(now time.Time) error {
+	if r.status != models.PaymentRequestPending {
+		return ErrPaymentRequestClosed
+	}
+	if !now.Before(r.expiresAt) {
+		return ErrPaymentRequestExpired
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// paymentRequestRows возвращает строки результата функций запросов монет с одним запросом
+func paymentRequestRows(request models.PaymentRequest) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{
+		"id", "requester", "payer", "amount", "note", "status", "created_at", "expires_at", "resolved_at",
+	}).AddRow(request.ID, request.Requester, request.Payer, request.Amount, request.Note, request.Status,
+		request.CreatedAt, request.ExpiresAt, request.ResolvedAt)
+}
+
+// -----------------------------------
+// Тесты Postgres.CreatePaymentRequest
+// -----------------------------------
+func TestCreatePaymentRequest(t *testing.T) {
+	resetMockDB(t)
+	createdAt := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PaymentRequest{
+		ID: 3, Requester: "alice", Payer: "bob", Amount: 100, Note: "за обед", Status: models.PaymentRequestPending,
+		CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour),
+	}
+	mock.ExpectQuery("FROM create_payment_request").
+		WithArgs(1, "bob", 100, "за обед", expected.ExpiresAt).
+		WillReturnRows(paymentRequestRows(expected))
+
+	created, err := store.CreatePaymentRequest(1, models.PaymentRequest{
+		Payer: "bob", Amount: 100, Note: "за обед", ExpiresAt: expected.ExpiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePaymentRequestUnknownPayer(t *testing.T) {
+	resetMockDB(t)
+	expiresAt := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM create_payment_request").
+		WithArgs(1, "nobody", 100, nil, expiresAt).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := store.CreatePaymentRequest(1, models.PaymentRequest{Payer: "nobody", Amount: 100, ExpiresAt: expiresAt})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------------------------------------------
+// Тесты Postgres.ApprovePaymentRequest и ClosePaymentRequest
+// ----------------------------------------------------------
+func TestApprovePaymentRequest(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PaymentRequest{
+		ID: 3, Requester: "alice", Payer: "bob", Amount: 100, Status: models.PaymentRequestApproved,
+		CreatedAt: date, ExpiresAt: date.Add(time.Hour), ResolvedAt: &date,
+	}
+	mock.ExpectQuery("FROM approve_payment_request").
+		WithArgs(2, 3, 0, 500, 0, 0).
+		WillReturnRows(paymentRequestRows(expected))
+
+	approved, err := store.ApprovePaymentRequest(2, 3, models.SpendingLimits{Daily: 500})
+	require.NoError(t, err)
+	assert.Equal(t, expected, approved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApprovePaymentRequestErrors(t *testing.T) {
+	resetMockDB(t)
+	for _, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{pgx.ErrNoRows, ErrPaymentRequestNotFound},
+		{&pgconn.PgError{Code: paymentRequestClosedCode}, ErrPaymentRequestClosed},
+		{&pgconn.PgError{Code: paymentRequestExpiredCode}, ErrPaymentRequestExpired},
+		{&pgconn.PgError{Code: payerFundsCode}, ErrInsufficientFunds},
+		{&pgconn.PgError{Code: limitExceededCode, ConstraintName: models.LimitDaily, Detail: "20"}, ErrLimitExceeded},
+	} {
+		mock.ExpectQuery("FROM approve_payment_request").
+			WithArgs(2, 3, 0, 0, 0, 0).
+			WillReturnError(tc.err)
+
+		_, err := store.ApprovePaymentRequest(2, 3, models.SpendingLimits{})
+		assert.ErrorIs(t, err, tc.expected)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClosePaymentRequest(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM close_payment_request").
+		WithArgs(1, 3, models.PaymentRequestCancelled).
+		WillReturnError(&pgconn.PgError{Code: paymentRequestClosedCode})
+
+	_, err := store.ClosePaymentRequest(1, 3, models.PaymentRequestCancelled)
+	assert.ErrorIs(t, err, ErrPaymentRequestClosed)
+	_, err = store.ClosePaymentRequest(1, 3, models.PaymentRequestApproved)
+	assert.ErrorIs(t, err, ErrUnknownOperation)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------------
+// Тесты Postgres.GetPaymentRequests
+// ---------------------------------
+func TestGetPaymentRequests(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PaymentRequest{
+		ID: 3, Requester: "alice", Payer: "bob", Amount: 100, Status: models.PaymentRequestExpired,
+		CreatedAt: date, ExpiresAt: date.Add(time.Hour),
+	}
+	mock.ExpectQuery("FROM get_payment_requests").
+		WithArgs(2, models.DirectionIncoming, nil, 50).
+		WillReturnRows(paymentRequestRows(expected))
+
+	requests, err := store.GetPaymentRequests(2, models.DirectionIncoming, "", 50)
+	require.NoError(t, err)
+	assert.Equal(t, []models.PaymentRequest{expected}, requests)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------------
+// Тесты запросов монет в Memory
+// -----------------------------
+func TestMemoryPaymentRequestApprove(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	expiresAt := time.Now().Add(time.Hour)
+
+	created, err := m.CreatePaymentRequest(alice, models.PaymentRequest{
+		Payer: "bob", Amount: 300, Note: "за билеты", ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestPending, created.Status)
+	assert.Equal(t, "alice", created.Requester)
+
+	_, err = m.ApprovePaymentRequest(alice, created.ID, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrPaymentRequestNotFound)
+
+	approved, err := m.ApprovePaymentRequest(bob, created.ID, models.SpendingLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestApproved, approved.Status)
+	assert.NotNil(t, approved.ResolvedAt)
+
+	infoAlice, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1300, infoAlice.Coins)
+	assert.Contains(t, infoAlice.CoinHistory.Received, models.CoinTransaction{User: "bob", Amount: 300, Message: "за билеты"})
+
+	_, err = m.ApprovePaymentRequest(bob, created.ID, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrPaymentRequestClosed)
+	_, err = m.ClosePaymentRequest(alice, created.ID, models.PaymentRequestCancelled)
+	assert.ErrorIs(t, err, ErrPaymentRequestClosed)
+}
+
+func TestMemoryPaymentRequestApproveFailsCleanly(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	created, err := m.CreatePaymentRequest(alice, models.PaymentRequest{
+		Payer: "bob", Amount: 600, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.SendCoins(bob, 500, "alice", models.TransferNote{}, models.SpendingLimits{}))
+
+	_, err = m.ApprovePaymentRequest(bob, created.ID, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	small, err := m.CreatePaymentRequest(alice, models.PaymentRequest{
+		Payer: "bob", Amount: 200, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	_, err = m.ApprovePaymentRequest(bob, small.ID, models.SpendingLimits{PerTransfer: 100})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	requests, err := m.GetPaymentRequests(bob, models.DirectionIncoming, models.PaymentRequestPending, 10)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, small.ID, requests[0].ID)
+	assert.Equal(t, created.ID, requests[1].ID)
+	info, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 500, info.Coins)
+}
+
+func TestMemoryPaymentRequestDeclineCancelExpire(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	_, err := m.CreatePaymentRequest(alice, models.PaymentRequest{Payer: "alice", Amount: 10, ExpiresAt: clock})
+	assert.ErrorIs(t, err, ErrSelfTransfer)
+	_, err = m.CreatePaymentRequest(alice, models.PaymentRequest{Payer: "nobody", Amount: 10, ExpiresAt: clock})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		created, err := m.CreatePaymentRequest(alice, models.PaymentRequest{
+			Payer: "bob", Amount: 10, ExpiresAt: clock.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+
+	_, err = m.ClosePaymentRequest(alice, ids[0], models.PaymentRequestDeclined)
+	assert.ErrorIs(t, err, ErrPaymentRequestNotFound)
+	declined, err := m.ClosePaymentRequest(bob, ids[0], models.PaymentRequestDeclined)
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestDeclined, declined.Status)
+	cancelled, err := m.ClosePaymentRequest(alice, ids[1], models.PaymentRequestCancelled)
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestCancelled, cancelled.Status)
+
+	clock = clock.Add(time.Hour)
+	_, err = m.ApprovePaymentRequest(bob, ids[2], models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrPaymentRequestExpired)
+
+	outgoing, err := m.GetPaymentRequests(alice, models.DirectionOutgoing, "", 10)
+	require.NoError(t, err)
+	var statuses []string
+	for _, request := range outgoing {
+		statuses = append(statuses, request.Status)
+	}
+	assert.Equal(t, []string{
+		models.PaymentRequestExpired, models.PaymentRequestCancelled, models.PaymentRequestDeclined,
+	}, statuses)
+	incoming, err := m.GetPaymentRequests(alice, models.DirectionIncoming, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, incoming)
+}
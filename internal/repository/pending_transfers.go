@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+// pendingTransferClosedCode - SQLSTATE ошибки отмены перевода, который уже зачислен, отменен или срок которого наступил
+const pendingTransferClosedCode = "PTR01"
+
+// pendingTransferColumns - поля pending_transfers_view в порядке сканирования в models.PendingTransfer
+const pendingTransferColumns = "id, to_user, amount, message, category, status, created_at, settle_at, resolved_at"
+
+// memPendingTransfer - отложенный перевод в Memory. До зачисления или отмены lots хранит партии монет
+// в резерве, после - пуст.
+type memPendingTransfer struct {
+	id         int
+	senderID   int
+	receiverID int
+	amount     int
+	message    string
+	category   string
+	status     string
+	createdAt  time.Time
+	settleAt   time.Time
+	resolvedAt *time.Time
+	lots       []memLot
+	// transferID - перевод, выполненный при зачислении
+	transferID int
+}
+
+// scanPendingTransfer читает отложенный перевод из строки с полями pendingTransferColumns
+func scanPendingTransfer(row pgx.Row) (models.PendingTransfer, error) {
+	var transfer models.PendingTransfer
+	err := row.Scan(&transfer.ID, &transfer.ToUser, &transfer.Amount, &transfer.Message, &transfer.Category,
+		&transfer.Status, &transfer.CreatedAt, &transfer.SettleAt, &transfer.ResolvedAt)
+	return transfer, err
+}
+
+// HoldTransfer резервирует перевод у отправителя и откладывает его зачисление на delay
+func (p *Postgres) HoldTransfer(userFromID, amount int, userTo string, note models.TransferNote, delay time.Duration,
+	limits models.SpendingLimits) (models.PendingTransfer, error) {
+	if !ValidCategory(note.Category) {
+		return models.PendingTransfer{}, ErrUnknownCategory
+	}
+	if delay <= 0 {
+		return models.PendingTransfer{}, ErrInvalidDelay
+	}
+	if amount > MaxAmount {
+		return models.PendingTransfer{}, ErrInvalidAmount
+	}
+	transfer, err := scanPendingTransfer(p.db.QueryRow(context.Background(),
+		"SELECT "+pendingTransferColumns+" FROM hold_transfer($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);",
+		userFromID, userTo, amount, limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient,
+		nullable(note.Message), nullable(note.Category), delay))
+	if err != nil {
+		return models.PendingTransfer{}, limitError(err)
+	}
+	return transfer, nil
+}
+
+// GetPendingTransfers возвращает незачисленные отложенные переводы отправителя от новых к старым
+func (p *Postgres) GetPendingTransfers(userID, limit int) ([]models.PendingTransfer, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT "+pendingTransferColumns+" FROM get_pending_transfers($1, $2);", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []models.PendingTransfer
+	for rows.Next() {
+		transfer, err := scanPendingTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// CancelPendingTransfer отменяет отложенный перевод отправителем и возвращает ему резерв
+func (p *Postgres) CancelPendingTransfer(userID, transferID int) (models.PendingTransfer, error) {
+	transfer, err := scanPendingTransfer(p.db.QueryRow(context.Background(),
+		"SELECT "+pendingTransferColumns+" FROM cancel_pending_transfer($1, $2);", userID, transferID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PendingTransfer{}, ErrPendingTransferNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pendingTransferClosedCode {
+		return models.PendingTransfer{}, ErrPendingTransferClosed
+	}
+	if err != nil {
+		return models.PendingTransfer{}, err
+	}
+	return transfer, nil
+}
+
+// SettlePendingTransfers зачисляет получателям отложенные переводы, срок которых наступил.
+// Строки переводов блокируются с SKIP LOCKED, поэтому одновременный запуск на нескольких репликах
+// зачисляет каждый перевод один раз.
+func (p *Postgres) SettlePendingTransfers() (int, error) {
+	var settled int
+	if err := p.db.QueryRow(context.Background(), "SELECT settle_pending_transfers();").Scan(&settled); err != nil {
+		return 0, err
+	}
+	return settled, nil
+}
+
+// HoldTransfer резервирует перевод у отправителя и откладывает его зачисление на delay
+func (m *Memory) HoldTransfer(userFromID, amount int, userTo string, note models.TransferNote, delay time.Duration,
+	limits models.SpendingLimits) (models.PendingTransfer, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if delay <= 0 {
+		return models.PendingTransfer{}, ErrInvalidDelay
+	}
+	sender, receiver, err := m.checkTransfer(userFromID, amount, userTo, note, limits)
+	if err != nil {
+		return models.PendingTransfer{}, err
+	}
+	now := m.now().UTC()
+	transfer := &memPendingTransfer{
+		id:         len(m.pendingTransfers) + 1,
+		senderID:   sender.id,
+		receiverID: receiver.id,
+		amount:     amount,
+		message:    note.Message,
+		category:   note.Category,
+		status:     models.PendingTransferPending,
+		createdAt:  now,
+		settleAt:   now.Add(delay),
+		lots:       sender.takeLots(amount),
+	}
+	m.pendingTransfers = append(m.pendingTransfers, transfer)
+	m.recordEntry(entryTransferHold, now, sender.id, accountEscrow, amount, 0, 0)
+	return m.pendingTransferView(transfer), nil
+}
+
+// GetPendingTransfers возвращает незачисленные отложенные переводы отправителя от новых к старым
+func (m *Memory) GetPendingTransfers(userID, limit int) ([]models.PendingTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var transfers []models.PendingTransfer
+	for i := len(m.pendingTransfers) - 1; i >= 0 && len(transfers) < limit; i-- {
+		transfer := m.pendingTransfers[i]
+		if transfer.senderID == userID && transfer.status == models.PendingTransferPending {
+			transfers = append(transfers, m.pendingTransferView(transfer))
+		}
+	}
+	return transfers, nil
+}
+
+// CancelPendingTransfer отменяет отложенный перевод отправителем и возвращает ему резерв
+func (m *Memory) CancelPendingTransfer(userID, transferID int) (models.PendingTransfer, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if transferID < 1 || transferID > len(m.pendingTransfers) {
+		return models.PendingTransfer{}, ErrPendingTransferNotFound
+	}
+	transfer := m.pendingTransfers[transferID-1]
+	if transfer.senderID != userID {
+		return models.PendingTransfer{}, ErrPendingTransferNotFound
+	}
+	now := m.now().UTC()
+	if transfer.status != models.PendingTransferPending || !now.Before(transfer.settleAt) {
+		return models.PendingTransfer{}, ErrPendingTransferClosed
+	}
+
+	m.releasePendingTransfer(transfer, transfer.senderID, entryTransferRefund, 0, now)
+	transfer.status = models.PendingTransferCancelled
+	transfer.resolvedAt = &now
+	return m.pendingTransferView(transfer), nil
+}
+
+// SettlePendingTransfers зачисляет получателям отложенные переводы, срок которых наступил
+func (m *Memory) SettlePendingTransfers() (int, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	now := m.now().UTC()
+	settled := 0
+	for _, transfer := range m.pendingTransfers {
+		if transfer.status != models.PendingTransferPending || now.Before(transfer.settleAt) {
+			continue
+		}
+		record := m.newTransfer(transfer.senderID, transfer.receiverID, transfer.amount,
+			models.TransferNote{Message: transfer.message, Category: transfer.category})
+		m.releasePendingTransfer(transfer, transfer.receiverID, entryTransfer, record.id, record.date)
+		transfer.status = models.PendingTransferSettled
+		transfer.resolvedAt = &record.date
+		transfer.transferID = record.id
+		settled++
+	}
+	return settled, nil
+}
+
+// releasePendingTransfer возвращает резерв перевода со счета escrow пользователю userID проводкой kind:
+// партии сохраняют дату выпуска, зачисление сначала гасит долг. Вызывается под блокировкой.
+func (m *Memory) releasePendingTransfer(transfer *memPendingTransfer, userID int, kind string, transferID int,
+	date time.Time) {
+	user, _ := m.userByID(userID)
+	user.creditLots(transfer.lots, transfer.amount, date)
+	transfer.lots = nil
+	m.recordEntry(kind, date, accountEscrow, userID, transfer.amount, transferID, 0)
+}
+
+// pendingTransferView возвращает отложенный перевод с именем получателя. Вызывается под блокировкой.
+func (m *Memory) pendingTransferView(transfer *memPendingTransfer) models.PendingTransfer {
+	receiver, _ := m.userByID(transfer.receiverID)
+	return models.PendingTransfer{
+		ID:         transfer.id,
+		ToUser:     receiver.username,
+		Amount:     transfer.amount,
+		Message:    transfer.message,
+		Category:   transfer.category,
+		Status:     transfer.status,
+		CreatedAt:  transfer.createdAt,
+		SettleAt:   transfer.settleAt,
+		ResolvedAt: transfer.resolvedAt,
+	}
+}
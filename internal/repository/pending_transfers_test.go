@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// pendingTransferRows возвращает строки результата функций отложенных переводов с одним переводом
+func pendingTransferRows(transfer models.PendingTransfer) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{
+		"id", "to_user", "amount", "message", "category", "status", "created_at", "settle_at", "resolved_at",
+	}).AddRow(transfer.ID, transfer.ToUser, transfer.Amount, transfer.Message, transfer.Category, transfer.Status,
+		transfer.CreatedAt, transfer.SettleAt, transfer.ResolvedAt)
+}
+
+// memoryCoins возвращает баланс пользователя Memory
+func memoryCoins(t *testing.T, m *Memory, userID int) int {
+	info, err := m.GetUserBalanceInventoryLogs(userID, 0, 0)
+	require.NoError(t, err)
+	return info.Coins
+}
+
+// ---------------------------
+// Тесты Postgres.HoldTransfer
+// ---------------------------
+func TestHoldTransfer(t *testing.T) {
+	resetMockDB(t)
+	createdAt := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PendingTransfer{
+		ID: 4, ToUser: "bob", Amount: 100, Category: models.CategoryGift, Status: models.PendingTransferPending,
+		CreatedAt: createdAt, SettleAt: createdAt.Add(10 * time.Minute),
+	}
+	mock.ExpectQuery("FROM hold_transfer").
+		WithArgs(1, "bob", 100, 0, 500, 0, 0, nil, models.CategoryGift, 10*time.Minute).
+		WillReturnRows(pendingTransferRows(expected))
+
+	held, err := store.HoldTransfer(1, 100, "bob", models.TransferNote{Category: models.CategoryGift},
+		10*time.Minute, models.SpendingLimits{Daily: 500})
+	require.NoError(t, err)
+	assert.Equal(t, expected, held)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHoldTransferErrors(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM hold_transfer").
+		WithArgs(1, "bob", 100, 0, 0, 0, 0, nil, nil, time.Minute).
+		WillReturnError(&pgconn.PgError{Code: limitExceededCode, ConstraintName: models.LimitDaily, Detail: "20"})
+
+	_, err := store.HoldTransfer(1, 100, "bob", models.TransferNote{}, time.Minute, models.SpendingLimits{})
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 20, limitErr.Remaining)
+	_, err = store.HoldTransfer(1, 100, "bob", models.TransferNote{}, 0, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidDelay)
+	_, err = store.HoldTransfer(1, 100, "bob", models.TransferNote{Category: "bribe"}, time.Minute, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrUnknownCategory)
+	_, err = store.HoldTransfer(1, MaxAmount+1, "bob", models.TransferNote{}, time.Minute, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------------------------------------------------------
+// Тесты Postgres.CancelPendingTransfer и Postgres.SettlePendingTransfers
+// ----------------------------------------------------------------------
+func TestCancelPendingTransferErrors(t *testing.T) {
+	resetMockDB(t)
+	for _, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{pgx.ErrNoRows, ErrPendingTransferNotFound},
+		{&pgconn.PgError{Code: pendingTransferClosedCode}, ErrPendingTransferClosed},
+	} {
+		mock.ExpectQuery("FROM cancel_pending_transfer").
+			WithArgs(1, 4).
+			WillReturnError(tc.err)
+
+		_, err := store.CancelPendingTransfer(1, 4)
+		assert.ErrorIs(t, err, tc.expected)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlePendingTransfers(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT settle_pending_transfers").
+		WillReturnRows(pgxmock.NewRows([]string{"settle_pending_transfers"}).AddRow(3))
+
+	settled, err := store.SettlePendingTransfers()
+	require.NoError(t, err)
+	assert.Equal(t, 3, settled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------------------
+// Тесты отложенных переводов в Memory
+// -----------------------------------
+func TestMemoryPendingTransferSettle(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	aliceIssuedAt := clock
+	clock = clock.Add(time.Hour)
+	bob := registerMemoryUser(t, m, "bob")
+
+	held, err := m.HoldTransfer(alice, 700, "bob", models.TransferNote{Message: "за обед"}, 10*time.Minute,
+		models.SpendingLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, models.PendingTransfer{
+		ID: 1, ToUser: "bob", Amount: 700, Message: "за обед", Status: models.PendingTransferPending,
+		CreatedAt: clock, SettleAt: clock.Add(10 * time.Minute),
+	}, held)
+
+	// Резерв уменьшает баланс отправителя, и одновременные траты его не превышают
+	err = m.SendCoins(alice, 400, "bob", models.TransferNote{}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	assert.Equal(t, 300, memoryCoins(t, m, alice))
+	assert.Equal(t, 1000, memoryCoins(t, m, bob))
+	assert.Equal(t, 700, m.ledgerBalance(accountEscrow))
+
+	settled, err := m.SettlePendingTransfers()
+	require.NoError(t, err)
+	assert.Zero(t, settled)
+
+	clock = clock.Add(10 * time.Minute)
+	settled, err = m.SettlePendingTransfers()
+	require.NoError(t, err)
+	assert.Equal(t, 1, settled)
+	assert.Equal(t, 1700, memoryCoins(t, m, bob))
+	assert.Zero(t, m.ledgerBalance(accountEscrow))
+	info, err := m.GetUserBalanceInventoryLogs(bob, 0, 0)
+	require.NoError(t, err)
+	assert.Contains(t, info.CoinHistory.Received, models.CoinTransaction{User: "alice", Amount: 700, Message: "за обед"})
+	// Монеты из резерва сохраняют дату выпуска у отправителя
+	bobUser, _ := m.userByID(bob)
+	assert.Equal(t, []memLot{
+		{issuedAt: aliceIssuedAt, amount: 700}, {issuedAt: aliceIssuedAt.Add(time.Hour), amount: 1000},
+	}, bobUser.lots)
+
+	_, err = m.CancelPendingTransfer(alice, held.ID)
+	assert.ErrorIs(t, err, ErrPendingTransferClosed)
+	settled, err = m.SettlePendingTransfers()
+	require.NoError(t, err)
+	assert.Zero(t, settled)
+	pending, err := m.GetPendingTransfers(alice, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestMemoryPendingTransferCancel(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	first, err := m.HoldTransfer(alice, 100, "bob", models.TransferNote{}, time.Minute, models.SpendingLimits{})
+	require.NoError(t, err)
+	second, err := m.HoldTransfer(alice, 200, "bob", models.TransferNote{}, time.Hour, models.SpendingLimits{})
+	require.NoError(t, err)
+	pending, err := m.GetPendingTransfers(alice, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, second.ID, pending[0].ID)
+
+	_, err = m.CancelPendingTransfer(bob, second.ID)
+	assert.ErrorIs(t, err, ErrPendingTransferNotFound)
+	_, err = m.CancelPendingTransfer(alice, 99)
+	assert.ErrorIs(t, err, ErrPendingTransferNotFound)
+	cancelled, err := m.CancelPendingTransfer(alice, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.PendingTransferCancelled, cancelled.Status)
+	assert.Equal(t, &clock, cancelled.ResolvedAt)
+	assert.Equal(t, 900, memoryCoins(t, m, alice))
+	_, err = m.CancelPendingTransfer(alice, second.ID)
+	assert.ErrorIs(t, err, ErrPendingTransferClosed)
+
+	// После наступления срока отменить перевод нельзя, даже если он еще не зачислен
+	clock = clock.Add(time.Minute)
+	_, err = m.CancelPendingTransfer(alice, first.ID)
+	assert.ErrorIs(t, err, ErrPendingTransferClosed)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, info.CoinHistory.Sent)
+	assert.Equal(t, 900, m.ledgerBalance(alice))
+}
+
+func TestMemoryHoldTransferRejectsAmountAboveInteger(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+
+	_, err := m.HoldTransfer(alice, MaxAmount+1, "bob", models.TransferNote{}, time.Minute, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+}
+
+func TestMemoryPendingTransferCountsAgainstLimits(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	registerMemoryUser(t, m, "bob")
+	limits := models.SpendingLimits{Daily: 500}
+
+	_, err := m.HoldTransfer(alice, 400, "bob", models.TransferNote{}, time.Hour, limits)
+	require.NoError(t, err)
+	err = m.SendCoins(alice, 200, "bob", models.TransferNote{}, limits)
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 100}, limitErr)
+
+	_, err = m.CancelPendingTransfer(alice, 1)
+	require.NoError(t, err)
+	assert.NoError(t, m.SendCoins(alice, 200, "bob", models.TransferNote{}, limits))
+}
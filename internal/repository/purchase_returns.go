@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+// SQLSTATE ошибок возвратов покупок
+const (
+	returnWindowExpiredCode    = "RET01"
+	returnQuantityExceededCode = "RET02"
+	returnClosedCode           = "RET03"
+	notEnoughItemsCode         = "RET04"
+)
+
+// purchaseReturnColumns - поля purchase_returns_view в порядке сканирования в models.PurchaseReturn
+const purchaseReturnColumns = "id, purchase_id, buyer, item, quantity, unit_price, refund, reason, status, " +
+	"requested_at, resolved_at"
+
+// memPurchaseReturn - возврат покупки в Memory
+type memPurchaseReturn struct {
+	id          int
+	purchaseID  int
+	quantity    int
+	reason      string
+	status      string
+	requestedAt time.Time
+	resolvedAt  *time.Time
+	adminID     int
+}
+
+// purchaseReturnError преобразует ошибки возврата из базы в ошибки пакета
+func purchaseReturnError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case returnWindowExpiredCode:
+			return ErrReturnWindowExpired
+		case returnQuantityExceededCode:
+			return ErrReturnQuantityExceeded
+		case returnClosedCode:
+			return ErrReturnClosed
+		case notEnoughItemsCode:
+			return ErrNotEnoughItems
+		}
+	}
+	return err
+}
+
+// scanPurchaseReturn читает возврат покупки из строки с полями purchaseReturnColumns
+func scanPurchaseReturn(row pgx.Row) (models.PurchaseReturn, error) {
+	var purchaseReturn models.PurchaseReturn
+	err := row.Scan(&purchaseReturn.ID, &purchaseReturn.PurchaseID, &purchaseReturn.User, &purchaseReturn.Item,
+		&purchaseReturn.Quantity, &purchaseReturn.UnitPrice, &purchaseReturn.Refund, &purchaseReturn.Reason,
+		&purchaseReturn.Status, &purchaseReturn.RequestedAt, &purchaseReturn.ResolvedAt)
+	return purchaseReturn, err
+}
+
+// queryPurchaseReturn выполняет функцию, которая возвращает один возврат или ничего, если его нет.
+// Отсутствие строки превращается в notFound.
+func (p *Postgres) queryPurchaseReturn(notFound error, query string, args ...any) (models.PurchaseReturn, error) {
+	purchaseReturn, err := scanPurchaseReturn(p.db.QueryRow(context.Background(), query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PurchaseReturn{}, notFound
+	}
+	if err != nil {
+		return models.PurchaseReturn{}, purchaseReturnError(err)
+	}
+	return purchaseReturn, nil
+}
+
+// RequestPurchaseReturn создает запрос на возврат части или всей покупки пользователя
+func (p *Postgres) RequestPurchaseReturn(userID, purchaseID, quantity int, reason string,
+	window time.Duration) (models.PurchaseReturn, error) {
+	if quantity <= 0 {
+		return models.PurchaseReturn{}, ErrInvalidAmount
+	}
+	if window <= 0 {
+		return models.PurchaseReturn{}, ErrReturnWindowExpired
+	}
+	return p.queryPurchaseReturn(ErrPurchaseNotFound,
+		"SELECT "+purchaseReturnColumns+" FROM request_purchase_return($1, $2, $3, $4, $5);",
+		userID, purchaseID, quantity, nullable(reason), window)
+}
+
+// GetPurchaseReturns возвращает возвраты покупателя или всех покупателей от новых к старым
+func (p *Postgres) GetPurchaseReturns(userID int, status string, limit int) ([]models.PurchaseReturn, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT "+purchaseReturnColumns+" FROM get_purchase_returns($1, $2, $3);",
+		nullable(userID), nullable(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var returns []models.PurchaseReturn
+	for rows.Next() {
+		purchaseReturn, err := scanPurchaseReturn(rows)
+		if err != nil {
+			return nil, err
+		}
+		returns = append(returns, purchaseReturn)
+	}
+	return returns, rows.Err()
+}
+
+// ApprovePurchaseReturn одобряет возврат: списывает предметы и возвращает монеты в одной транзакции
+func (p *Postgres) ApprovePurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error) {
+	return p.queryPurchaseReturn(ErrReturnNotFound,
+		"SELECT "+purchaseReturnColumns+" FROM approve_purchase_return($1, $2);", adminID, returnID)
+}
+
+// RejectPurchaseReturn отклоняет возврат
+func (p *Postgres) RejectPurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error) {
+	return p.queryPurchaseReturn(ErrReturnNotFound,
+		"SELECT "+purchaseReturnColumns+" FROM reject_purchase_return($1, $2);", adminID, returnID)
+}
+
+// RequestPurchaseReturn создает запрос на возврат части или всей покупки пользователя
+func (m *Memory) RequestPurchaseReturn(userID, purchaseID, quantity int, reason string,
+	window time.Duration) (models.PurchaseReturn, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if purchaseID < 1 || purchaseID > len(m.purchases) || m.purchases[purchaseID-1].buyerID != userID {
+		return models.PurchaseReturn{}, ErrPurchaseNotFound
+	}
+	if quantity <= 0 {
+		return models.PurchaseReturn{}, ErrInvalidAmount
+	}
+	purchase := m.purchases[purchaseID-1]
+	now := m.now().UTC()
+	if window <= 0 || purchase.date.Before(now.Add(-window)) {
+		return models.PurchaseReturn{}, ErrReturnWindowExpired
+	}
+	claimed := 0
+	for _, r := range m.purchaseReturns {
+		if r.purchaseID == purchase.id && r.status != models.ReturnRejected {
+			claimed += r.quantity
+		}
+	}
+	if claimed+quantity > purchase.amount {
+		return models.PurchaseReturn{}, ErrReturnQuantityExceeded
+	}
+
+	created := &memPurchaseReturn{
+		id:          len(m.purchaseReturns) + 1,
+		purchaseID:  purchase.id,
+		quantity:    quantity,
+		reason:      reason,
+		status:      models.ReturnPending,
+		requestedAt: now,
+	}
+	m.purchaseReturns = append(m.purchaseReturns, created)
+	return m.purchaseReturnView(created), nil
+}
+
+// GetPurchaseReturns возвращает возвраты покупателя или всех покупателей от новых к старым
+func (m *Memory) GetPurchaseReturns(userID int, status string, limit int) ([]models.PurchaseReturn, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var returns []models.PurchaseReturn
+	for i := len(m.purchaseReturns) - 1; i >= 0 && len(returns) < limit; i-- {
+		r := m.purchaseReturns[i]
+		if userID != 0 && m.purchases[r.purchaseID-1].buyerID != userID {
+			continue
+		}
+		if status == "" || r.status == status {
+			returns = append(returns, m.purchaseReturnView(r))
+		}
+	}
+	return returns, nil
+}
+
+// ApprovePurchaseReturn одобряет возврат: списывает предметы и возвращает монеты атомарно
+func (m *Memory) ApprovePurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	r, err := m.pendingPurchaseReturn(returnID)
+	if err != nil {
+		return models.PurchaseReturn{}, err
+	}
+	purchase := m.purchases[r.purchaseID-1]
+	buyer, _ := m.userByID(purchase.buyerID)
+	key := memVariantKey{itemID: purchase.itemID, variant: purchase.variant}
+	if buyer.inventory[key] < r.quantity {
+		return models.PurchaseReturn{}, ErrNotEnoughItems
+	}
+
+	buyer.inventory[key] -= r.quantity
+	if buyer.inventory[key] == 0 {
+		delete(buyer.inventory, key)
+	}
+	m.changeStock(key, r.quantity)
+	now := m.now().UTC()
+	r.status = models.ReturnApproved
+	r.resolvedAt = &now
+	r.adminID = adminID
+	m.postEntry(entryRefund, now, accountShopRevenue, buyer.id, r.quantity*purchase.unitPrice, 0, purchase.id)
+	return m.purchaseReturnView(r), nil
+}
+
+// RejectPurchaseReturn отклоняет возврат
+func (m *Memory) RejectPurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	r, err := m.pendingPurchaseReturn(returnID)
+	if err != nil {
+		return models.PurchaseReturn{}, err
+	}
+	now := m.now().UTC()
+	r.status = models.ReturnRejected
+	r.resolvedAt = &now
+	r.adminID = adminID
+	return m.purchaseReturnView(r), nil
+}
+
+// pendingPurchaseReturn возвращает открытый возврат по идентификатору. Вызывается под блокировкой.
+func (m *Memory) pendingPurchaseReturn(returnID int) (*memPurchaseReturn, error) {
+	if returnID < 1 || returnID > len(m.purchaseReturns) {
+		return nil, ErrReturnNotFound
+	}
+	r := m.purchaseReturns[returnID-1]
+	if r.status != models.ReturnPending {
+		return nil, ErrReturnClosed
+	}
+	return r, nil
+}
+
+// returnedQuantity возвращает число предметов покупки purchaseID в одобренных возвратах.
+// Вызывается под блокировкой.
+func (m *Memory) returnedQuantity(purchaseID int) int {
+	returned := 0
+	for _, r := range m.purchaseReturns {
+		if r.purchaseID == purchaseID && r.status == models.ReturnApproved {
+			returned += r.quantity
+		}
+	}
+	return returned
+}
+
+// purchaseReturnView возвращает возврат с покупателем, предметом и суммой. Вызывается под блокировкой.
+func (m *Memory) purchaseReturnView(r *memPurchaseReturn) models.PurchaseReturn {
+	purchase := m.purchases[r.purchaseID-1]
+	buyer, _ := m.userByID(purchase.buyerID)
+	return models.PurchaseReturn{
+		ID:          r.id,
+		PurchaseID:  purchase.id,
+		User:        buyer.username,
+		Item:        m.items[purchase.itemID].name,
+		Quantity:    r.quantity,
+		UnitPrice:   purchase.unitPrice,
+		Refund:      r.quantity * purchase.unitPrice,
+		Reason:      r.reason,
+		Status:      r.status,
+		RequestedAt: r.requestedAt,
+		ResolvedAt:  r.resolvedAt,
+	}
+}
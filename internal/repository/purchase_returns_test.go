@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// purchaseReturnRows возвращает строки результата функций возвратов с одним возвратом
+func purchaseReturnRows(purchaseReturn models.PurchaseReturn) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{
+		"id", "purchase_id", "buyer", "item", "quantity", "unit_price", "refund", "reason", "status",
+		"requested_at", "resolved_at",
+	}).AddRow(purchaseReturn.ID, purchaseReturn.PurchaseID, purchaseReturn.User, purchaseReturn.Item,
+		purchaseReturn.Quantity, purchaseReturn.UnitPrice, purchaseReturn.Refund, purchaseReturn.Reason,
+		purchaseReturn.Status, purchaseReturn.RequestedAt, purchaseReturn.ResolvedAt)
+}
+
+// ------------------------------------
+// Тесты Postgres.RequestPurchaseReturn
+// ------------------------------------
+func TestRequestPurchaseReturn(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PurchaseReturn{
+		ID: 2, PurchaseID: 7, User: "alice", Item: "cup", Quantity: 1, UnitPrice: 20, Refund: 20,
+		Reason: "брак", Status: models.ReturnPending, RequestedAt: date,
+	}
+	mock.ExpectQuery("FROM request_purchase_return").
+		WithArgs(1, 7, 1, "брак", 24*time.Hour).
+		WillReturnRows(purchaseReturnRows(expected))
+
+	created, err := store.RequestPurchaseReturn(1, 7, 1, "брак", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, expected, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequestPurchaseReturnErrors(t *testing.T) {
+	resetMockDB(t)
+	for _, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{pgx.ErrNoRows, ErrPurchaseNotFound},
+		{&pgconn.PgError{Code: returnWindowExpiredCode}, ErrReturnWindowExpired},
+		{&pgconn.PgError{Code: returnQuantityExceededCode}, ErrReturnQuantityExceeded},
+	} {
+		mock.ExpectQuery("FROM request_purchase_return").
+			WithArgs(1, 7, 2, nil, time.Hour).
+			WillReturnError(tc.err)
+
+		_, err := store.RequestPurchaseReturn(1, 7, 2, "", time.Hour)
+		assert.ErrorIs(t, err, tc.expected)
+	}
+
+	_, err := store.RequestPurchaseReturn(1, 7, 0, "", time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = store.RequestPurchaseReturn(1, 7, 1, "", 0)
+	assert.ErrorIs(t, err, ErrReturnWindowExpired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -------------------------------------------------------------------------------
+// Тесты Postgres.ApprovePurchaseReturn, RejectPurchaseReturn и GetPurchaseReturns
+// -------------------------------------------------------------------------------
+func TestApprovePurchaseReturn(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PurchaseReturn{
+		ID: 2, PurchaseID: 7, User: "alice", Item: "cup", Quantity: 1, UnitPrice: 20, Refund: 20,
+		Status: models.ReturnApproved, RequestedAt: date, ResolvedAt: &date,
+	}
+	mock.ExpectQuery("FROM approve_purchase_return").
+		WithArgs(5, 2).
+		WillReturnRows(purchaseReturnRows(expected))
+
+	approved, err := store.ApprovePurchaseReturn(5, 2)
+	require.NoError(t, err)
+	assert.Equal(t, expected, approved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolvePurchaseReturnErrors(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM approve_purchase_return").
+		WithArgs(5, 2).
+		WillReturnError(&pgconn.PgError{Code: notEnoughItemsCode})
+	mock.ExpectQuery("FROM approve_purchase_return").
+		WithArgs(5, 3).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("FROM reject_purchase_return").
+		WithArgs(5, 2).
+		WillReturnError(&pgconn.PgError{Code: returnClosedCode})
+
+	_, err := store.ApprovePurchaseReturn(5, 2)
+	assert.ErrorIs(t, err, ErrNotEnoughItems)
+	_, err = store.ApprovePurchaseReturn(5, 3)
+	assert.ErrorIs(t, err, ErrReturnNotFound)
+	_, err = store.RejectPurchaseReturn(5, 2)
+	assert.ErrorIs(t, err, ErrReturnClosed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPurchaseReturns(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	expected := models.PurchaseReturn{
+		ID: 2, PurchaseID: 7, User: "alice", Item: "cup", Quantity: 1, UnitPrice: 20, Refund: 20,
+		Status: models.ReturnPending, RequestedAt: date,
+	}
+	mock.ExpectQuery("FROM get_purchase_returns").
+		WithArgs(nil, models.ReturnPending, 50).
+		WillReturnRows(purchaseReturnRows(expected))
+
+	returns, err := store.GetPurchaseReturns(0, models.ReturnPending, 50)
+	require.NoError(t, err)
+	assert.Equal(t, []models.PurchaseReturn{expected}, returns)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// --------------------------------
+// Тесты возвратов покупок в Memory
+// --------------------------------
+func TestMemoryPurchaseReturnApprove(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 3, models.SpendingLimits{}))
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	purchaseID := purchases[0].ID
+
+	_, err = m.RequestPurchaseReturn(bob, purchaseID, 1, "", time.Hour)
+	assert.ErrorIs(t, err, ErrPurchaseNotFound)
+	_, err = m.RequestPurchaseReturn(alice, purchaseID, 4, "", time.Hour)
+	assert.ErrorIs(t, err, ErrReturnQuantityExceeded)
+
+	first, err := m.RequestPurchaseReturn(alice, purchaseID, 2, "брак", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, models.PurchaseReturn{
+		ID: 1, PurchaseID: purchaseID, User: "alice", Item: "cup", Quantity: 2, UnitPrice: 20, Refund: 40,
+		Reason: "брак", Status: models.ReturnPending, RequestedAt: first.RequestedAt,
+	}, first)
+	_, err = m.RequestPurchaseReturn(alice, purchaseID, 2, "", time.Hour)
+	assert.ErrorIs(t, err, ErrReturnQuantityExceeded)
+
+	approved, err := m.ApprovePurchaseReturn(bob, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReturnApproved, approved.Status)
+	assert.NotNil(t, approved.ResolvedAt)
+	_, err = m.ApprovePurchaseReturn(bob, first.ID)
+	assert.ErrorIs(t, err, ErrReturnClosed)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000-60+40, info.Coins)
+	assert.Equal(t, []models.Item{{Type: "cup", Quantity: 1}}, info.Inventory)
+	assert.Equal(t, info.Coins, m.ledgerBalance(alice))
+
+	purchases, err = m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, purchases[0].ReturnedQuantity)
+	assert.Equal(t, 40, purchases[0].Refunded)
+	assert.Equal(t, 60, purchases[0].TotalCost)
+
+	// Отклоненный возврат не занимает количество покупки
+	second, err := m.RequestPurchaseReturn(alice, purchaseID, 1, "", time.Hour)
+	require.NoError(t, err)
+	rejected, err := m.RejectPurchaseReturn(bob, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReturnRejected, rejected.Status)
+	_, err = m.RequestPurchaseReturn(alice, purchaseID, 1, "", time.Hour)
+	require.NoError(t, err)
+
+	returns, err := m.GetPurchaseReturns(alice, "", 10)
+	require.NoError(t, err)
+	require.Len(t, returns, 3)
+	assert.Equal(t, 3, returns[0].ID)
+	pending, err := m.GetPurchaseReturns(0, models.ReturnPending, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	none, err := m.GetPurchaseReturns(bob, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestMemoryPurchaseReturnWindowAndItems(t *testing.T) {
+	m := NewMemory()
+	clock := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 2, models.SpendingLimits{}))
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	purchaseID := purchases[0].ID
+
+	created, err := m.RequestPurchaseReturn(alice, purchaseID, 2, "", 24*time.Hour)
+	require.NoError(t, err)
+	clock = clock.Add(25 * time.Hour)
+	_, err = m.RequestPurchaseReturn(alice, purchaseID, 1, "", 24*time.Hour)
+	assert.ErrorIs(t, err, ErrReturnWindowExpired)
+
+	// Предметы успели передать другому пользователю: возврат остается открытым, монеты не двигаются
+	m.mu.Lock()
+	m.users[alice-1].inventory[memVariantKey{itemID: m.itemsByName["cup"]}] = 1
+	m.mu.Unlock()
+	_, err = m.ApprovePurchaseReturn(bob, created.ID)
+	assert.ErrorIs(t, err, ErrNotEnoughItems)
+	assert.Equal(t, 960, memoryCoins(t, m, alice))
+	pending, err := m.GetPurchaseReturns(alice, models.ReturnPending, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
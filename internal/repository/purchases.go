@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+)
+
+// GetUserPurchases возвращает историю покупок пользователя от новых к старым с учетом фильтров и курсора
+func (p *Postgres) GetUserPurchases(userID int, filter models.PurchaseFilter) ([]models.PurchaseEntry, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT * FROM get_user_purchases($1, $2, $3, $4, $5, $6);",
+		userID,
+		nullable(filter.Item),
+		nullable(filter.From),
+		nullable(filter.To),
+		nullable(filter.BeforeID),
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []models.PurchaseEntry
+	for rows.Next() {
+		var entry models.PurchaseEntry
+		err := rows.Scan(&entry.ID, &entry.Item, &entry.Quantity, &entry.UnitPrice, &entry.TotalCost,
+			&entry.PriceEstimated, &entry.Date, &entry.ReturnedQuantity, &entry.Refunded)
+		if err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, entry)
+	}
+	return purchases, rows.Err()
+}
+
+// GetUserPurchases возвращает историю покупок пользователя от новых к старым с учетом фильтров и курсора
+func (m *Memory) GetUserPurchases(userID int, filter models.PurchaseFilter) ([]models.PurchaseEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var purchases []models.PurchaseEntry
+	for i := len(m.purchases) - 1; i >= 0 && len(purchases) < filter.Limit; i-- {
+		p := m.purchases[i]
+		if p.buyerID != userID {
+			continue
+		}
+		entry := models.PurchaseEntry{
+			ID:        p.id,
+			Item:      m.items[p.itemID].name,
+			Quantity:  p.amount,
+			UnitPrice: p.unitPrice,
+			TotalCost: p.unitPrice * p.amount,
+			Date:      p.date,
+		}
+		entry.ReturnedQuantity = m.returnedQuantity(p.id)
+		entry.Refunded = entry.ReturnedQuantity * p.unitPrice
+		if matchesPurchaseFilter(entry, filter) {
+			purchases = append(purchases, entry)
+		}
+	}
+	return purchases, nil
+}
+
+// matchesPurchaseFilter проверяет запись истории покупок на соответствие фильтрам
+func matchesPurchaseFilter(entry models.PurchaseEntry, filter models.PurchaseFilter) bool {
+	return (filter.Item == "" || entry.Item == filter.Item) &&
+		(filter.From.IsZero() || !entry.Date.Before(filter.From)) &&
+		(filter.To.IsZero() || entry.Date.Before(filter.To)) &&
+		(filter.BeforeID == 0 || entry.ID < filter.BeforeID)
+}
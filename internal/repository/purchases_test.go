@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// -------------------------------
+// Тесты Postgres.GetUserPurchases
+// -------------------------------
+func TestGetUserPurchases(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT \\* FROM get_user_purchases").
+		WithArgs(1, "cup", nil, nil, nil, 11).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "item_name", "amount", "unit_price", "total_cost", "price_estimated", "purchase_date",
+			"returned_quantity", "refunded",
+		}).AddRow(7, "cup", 2, 20, 40, true, date, 1, 20))
+
+	purchases, err := store.GetUserPurchases(1, models.PurchaseFilter{Item: "cup", Limit: 11})
+	require.NoError(t, err)
+	assert.Equal(t, []models.PurchaseEntry{{
+		ID: 7, Item: "cup", Quantity: 2, UnitPrice: 20, TotalCost: 40, PriceEstimated: true, Date: date,
+		ReturnedQuantity: 1, Refunded: 20,
+	}}, purchases)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------------
+// Тесты Memory.GetUserPurchases
+// -----------------------------
+func TestMemoryGetUserPurchases(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 2, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(bob, "pen", "", 1, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(alice, "book", "", 1, models.SpendingLimits{}))
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 1, models.SpendingLimits{}))
+
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, purchases, 3)
+	assert.Equal(t, "cup", purchases[0].Item)
+	assert.Equal(t, 1, purchases[0].Quantity)
+	assert.Equal(t, 20, purchases[0].UnitPrice)
+	assert.Equal(t, "book", purchases[1].Item)
+
+	cups, err := m.GetUserPurchases(alice, models.PurchaseFilter{Item: "cup", Limit: 10, BeforeID: purchases[0].ID})
+	require.NoError(t, err)
+	require.Len(t, cups, 1)
+	assert.Equal(t, 2, cups[0].Quantity)
+	assert.Equal(t, 40, cups[0].TotalCost)
+	assert.False(t, cups[0].PriceEstimated)
+}
@@ -1,63 +1,343 @@
 package repository
 
 import (
+	"avito_internship/internal/config"
 	"avito_internship/internal/models"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"math"
+	"time"
 )
 import _ "github.com/jackc/pgx/v5/stdlib"
-import "avito_internship/internal/config"
 
-var db *sql.DB
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrItemNotFound      = errors.New("item not found")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrSelfTransfer      = errors.New("cannot transfer coins to yourself")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrEmptyOrder        = errors.New("order has no items")
+	ErrEmptyReason       = errors.New("reason is required")
+	ErrDuplicateUser     = errors.New("user is listed more than once")
+	ErrUnknownOperation  = errors.New("unknown operation")
+	ErrEmptyName         = errors.New("name is required")
+	ErrInvalidPeriod     = errors.New("period must start before it ends")
+	ErrCampaignExists    = errors.New("campaign with this name already exists")
+	ErrRuleNotFound      = errors.New("allowance rule not found")
+	ErrRuleExists        = errors.New("allowance rule with this name already exists")
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrUnknownCategory   = errors.New("unknown transfer category")
+	// Ошибки запросов монет
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+	ErrPaymentRequestClosed   = errors.New("payment request is already closed")
+	ErrPaymentRequestExpired  = errors.New("payment request has expired")
+	// Ошибки отложенных переводов
+	ErrInvalidDelay            = errors.New("delay must be positive")
+	ErrPendingTransferNotFound = errors.New("pending transfer not found")
+	ErrPendingTransferClosed   = errors.New("pending transfer can no longer be cancelled")
+	// Ошибки пакетных переводов
+	ErrEmptyBatch    = errors.New("batch has no transfers")
+	ErrBatchRejected = errors.New("batch has invalid transfers")
+	// Ошибки отмены переводов
+	ErrTransferNotFound        = errors.New("transfer not found")
+	ErrTransferAlreadyReversed = errors.New("transfer is already reversed")
+	// Ошибки возвратов покупок
+	ErrPurchaseNotFound       = errors.New("purchase not found")
+	ErrReturnWindowExpired    = errors.New("return window has expired")
+	ErrReturnQuantityExceeded = errors.New("return quantity exceeds purchased quantity")
+	ErrReturnNotFound         = errors.New("purchase return not found")
+	ErrReturnClosed           = errors.New("purchase return is already resolved")
+	ErrNotEnoughItems         = errors.New("not enough items to return")
+	// Ошибки остатков товаров
+	ErrOutOfStock           = errors.New("item is out of stock")
+	ErrPurchaseLimitReached = errors.New("per-user purchase limit reached")
+	ErrUnlimitedStock       = errors.New("item stock is unlimited")
+	// Ошибки вариантов товаров
+	ErrVariantNotFound = errors.New("item variant not found")
+	ErrVariantExists   = errors.New("item variant sku already exists")
+	// ErrIdempotencyKeyReused - ключ идемпотентности уже использован с другим запросом
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with different request")
+)
 
-// Connect устанавливает соединение с базой данных и сохраняет его в переменной db.
-func Connect() {
-	cfg := config.Get()
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.DatabaseUser, cfg.DatabasePass, cfg.DatabaseHost, cfg.DatabasePort, cfg.DatabaseName)
-	conn, err := sql.Open("pgx/v5", dsn)
+// Наибольшие сумма перевода и количество предметов в покупке: в базе они хранятся в колонках INTEGER
+const (
+	MaxAmount   = math.MaxInt32
+	MaxQuantity = math.MaxInt32
+)
+
+// ValidCategory проверяет, что category - известная категория перевода. Пустая категория допустима.
+func ValidCategory(category string) bool {
+	switch category {
+	case "", models.CategoryThanks, models.CategoryReimbursement, models.CategoryGift:
+		return true
+	}
+	return false
+}
+
+// Store описывает хранилище пользователей, балансов, переводов, покупок и истории.
+// Реализации обязаны сохранять одинаковую семантику: баланс уходит в минус только при отмене перевода с долгом,
+// перевод самому себе запрещен, покупка выполняется атомарно.
+type Store interface {
+	// GetUserIDPassHashOrRegister ищет пользователя по имени или регистрирует нового.
+	// Новый пользователь получает приветственное начисление startingBalance и начисления
+	// по кампаниям, действующим в момент регистрации.
+	GetUserIDPassHashOrRegister(username string, providedPassHash string, startingBalance int) (int, []byte, error)
+	// GetUserBalanceInventoryLogs получает баланс пользователя, инвентарь и историю транзакций.
+	// Монеты сгорают через expiryPeriod после выпуска (ноль - не сгорают), в ответ попадают монеты,
+	// которые сгорят в ближайшие expiringWindow.
+	GetUserBalanceInventoryLogs(userID int, expiryPeriod, expiringWindow time.Duration) (models.InfoResponse, error)
+	// SendCoins осуществляет перевод коинов от одного пользователя к другому с сообщением и категорией note.
+	// Лимиты limits действуют, если администратор не задал пользователю свои, превышение - *LimitError.
+	SendCoins(userFromID, amount int, userTo string, note models.TransferNote, limits models.SpendingLimits) error
+	// BuyItemsForUser осуществляет покупку определенного количества вещей варианта variant (артикул,
+	// пустой - вариант по умолчанию) с проверкой лимитов трат и остатков товара и варианта.
+	// Нехватка остатка или лимита покупок на пользователя - *StockError.
+	BuyItemsForUser(userID int, itemName, variant string, amount int, limits models.SpendingLimits) error
+	// GetUserHistory возвращает не более filter.Limit записей истории переводов от новых к старым
+	GetUserHistory(userID int, filter models.HistoryFilter) ([]models.HistoryEntry, error)
+	// GetUserPurchases возвращает не более filter.Limit записей истории покупок от новых к старым
+	GetUserPurchases(userID int, filter models.PurchaseFilter) ([]models.PurchaseEntry, error)
+	// PlaceOrder атомарно оплачивает все позиции заказа: либо все, либо ни одной.
+	// Стоимость заказа целиком проверяется по лимитам трат, позиции - по остаткам товаров.
+	PlaceOrder(userID int, lines []models.OrderLine, limits models.SpendingLimits) (models.OrderResponse, error)
+	// Idempotent выполняет mutation не более одного раза для ключа key пользователя userID.
+	// Повтор с тем же fingerprint возвращает сохраненный ответ и replayed = true,
+	// с другим fingerprint - ErrIdempotencyKeyReused. При ошибке mutation ключ не сохраняется,
+	// а ее изменения откатываются: Postgres выполняет mutation в одной транзакции с ключом и ответом,
+	// Memory - над копией состояния, которая подменяет состояние хранилища только при успехе.
+	Idempotent(userID int, key, fingerprint string,
+		mutation func(Store) (models.IdempotentResponse, error)) (response models.IdempotentResponse, replayed bool, err error)
+	// GetUser возвращает имя и роль пользователя
+	GetUser(userID int) (models.User, error)
+	// AdjustBalances начисляет (models.TransactionMint) или списывает (models.TransactionClawback) amount монет
+	// каждому из пользователей usernames от имени администратора adminID. Атомарно: либо всем, либо никому.
+	AdjustBalances(adminID int, kind string, usernames []string, amount int, reason string) error
+	// CreateGrantCampaign создает кампанию начислений от имени администратора adminID и сразу начисляет
+	// монеты пользователям, уже зарегистрированным в ее период. Возвращает кампанию с заполненными ID и Granted.
+	CreateGrantCampaign(adminID int, campaign models.GrantCampaign) (models.GrantCampaign, error)
+	// GetGrantCampaigns возвращает кампании начислений от новых к старым
+	GetGrantCampaigns() ([]models.GrantCampaign, error)
+	// CreateAllowanceRule создает правило регулярных начислений от имени администратора adminID
+	CreateAllowanceRule(adminID int, rule models.AllowanceRule) (models.AllowanceRule, error)
+	// UpdateAllowanceRule изменяет название, сумму, расписание, роль и паузу правила rule.ID
+	UpdateAllowanceRule(rule models.AllowanceRule) (models.AllowanceRule, error)
+	// DeleteAllowanceRule удаляет правило, история его запусков сохраняется
+	DeleteAllowanceRule(ruleID int) error
+	// GetAllowanceRules возвращает правила начислений от новых к старым
+	GetAllowanceRules() ([]models.AllowanceRule, error)
+	// GetAllowanceRuns возвращает не более limit запусков правила от новых к старым
+	GetAllowanceRuns(ruleID int, limit int) ([]models.AllowanceRun, error)
+	// RunAllowance выполняет правило за период period. Каждый период выполняется не более одного раза
+	// даже при одновременном вызове из нескольких реплик: если период уже выполнен, claimed = false.
+	RunAllowance(ruleID int, period time.Time) (run models.AllowanceRun, claimed bool, err error)
+	// CountUsersWithRole возвращает число пользователей с ролью role, пустая роль - всех пользователей
+	CountUsersWithRole(role string) (int, error)
+	// ExpireCoins сжигает монеты, выпущенные раньше before, и возвращает число затронутых пользователей
+	// и сумму сгоревших монет. Каждому пользователю в историю записывается одна операция expiry.
+	ExpireCoins(before time.Time) (users int, total int, err error)
+	// GetUserLimits возвращает лимиты, заданные пользователю username администратором, и признак их наличия
+	GetUserLimits(username string) (limits models.SpendingLimits, ok bool, err error)
+	// SetUserLimits задает пользователю username лимиты вместо лимитов из конфигурации
+	SetUserLimits(adminID int, username string, limits models.SpendingLimits) error
+	// DeleteUserLimits возвращает пользователю username лимиты из конфигурации
+	DeleteUserLimits(username string) error
+	// CreatePaymentRequest создает запрос монет пользователя requesterID у пользователя request.Payer
+	// на сумму request.Amount со сроком request.ExpiresAt
+	CreatePaymentRequest(requesterID int, request models.PaymentRequest) (models.PaymentRequest, error)
+	// GetPaymentRequests возвращает не более limit входящих (incoming) или исходящих (outgoing) запросов
+	// монет пользователя от новых к старым. Пустой status означает все статусы.
+	GetPaymentRequests(userID int, direction, status string, limit int) ([]models.PaymentRequest, error)
+	// ApprovePaymentRequest одобряет запрос плательщиком payerID: перевод по запросу и его закрытие
+	// выполняются атомарно с проверкой баланса и лимитов. При ошибке запрос остается открытым.
+	ApprovePaymentRequest(payerID, requestID int, limits models.SpendingLimits) (models.PaymentRequest, error)
+	// ClosePaymentRequest закрывает запрос без перевода: статус declined ставит плательщик,
+	// cancelled - запросивший. Для остальных пользователей запрос не найден.
+	ClosePaymentRequest(userID, requestID int, status string) (models.PaymentRequest, error)
+	// HoldTransfer проверяет перевод так же, как SendCoins, но не выполняет его сразу: монеты списываются
+	// у отправителя в резерв и поступят получателю через delay. Резерв уменьшает баланс отправителя
+	// и учитывается в лимитах трат с момента создания.
+	HoldTransfer(userFromID, amount int, userTo string, note models.TransferNote, delay time.Duration,
+		limits models.SpendingLimits) (models.PendingTransfer, error)
+	// GetPendingTransfers возвращает не более limit незачисленных отложенных переводов отправителя от новых к старым
+	GetPendingTransfers(userID, limit int) ([]models.PendingTransfer, error)
+	// CancelPendingTransfer отменяет отложенный перевод отправителем userID до наступления срока
+	// и возвращает резерв. Для остальных пользователей перевод не найден.
+	CancelPendingTransfer(userID, transferID int) (models.PendingTransfer, error)
+	// SettlePendingTransfers зачисляет получателям отложенные переводы, срок которых наступил,
+	// и возвращает их число. Каждый перевод зачисляется один раз.
+	SettlePendingTransfers() (int, error)
+	// SendCoinsBatch атомарно выполняет переводы lines от userFromID: либо все, либо ни одного.
+	// Сначала проверяются все строки; если хотя бы одна некорректна, возвращает ErrBatchRejected
+	// и результаты с причинами отклонения. Баланс и лимиты за день и месяц проверяются по сумме пакета.
+	SendCoinsBatch(userFromID int, lines []models.BatchTransferLine,
+		limits models.SpendingLimits) ([]models.BatchTransferResult, error)
+	// ReverseTransfer отменяет перевод transferID от имени администратора adminID: компенсирующая операция
+	// возвращает монеты отправителю и ссылается на перевод. Если у получателя не хватает монет, при allowDebt
+	// возвращается вся сумма и его баланс уходит в минус, иначе - только то, что у него есть. Если возвращать
+	// нечего, возвращает ErrInsufficientFunds.
+	ReverseTransfer(adminID, transferID int, reason string, allowDebt bool) (models.TransferReversal, error)
+	// RequestPurchaseReturn создает запрос на возврат quantity предметов из покупки purchaseID пользователя
+	// userID, если с покупки прошло не больше window. Вместе с открытыми и одобренными возвратами нельзя
+	// вернуть больше, чем куплено. Чужая покупка не найдена.
+	RequestPurchaseReturn(userID, purchaseID, quantity int, reason string,
+		window time.Duration) (models.PurchaseReturn, error)
+	// GetPurchaseReturns возвращает не более limit возвратов покупателя userID от новых к старым.
+	// Нулевой userID означает всех покупателей, пустой status - все статусы.
+	GetPurchaseReturns(userID int, status string, limit int) ([]models.PurchaseReturn, error)
+	// ApprovePurchaseReturn одобряет возврат от имени администратора adminID: списание предметов
+	// из инвентаря и возврат уплаченной цены выполняются атомарно. Если предметов у покупателя уже
+	// не хватает, возвращает ErrNotEnoughItems и возврат остается открытым. Предметы товара
+	// с ограниченным остатком возвращаются на склад.
+	ApprovePurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error)
+	// RejectPurchaseReturn отклоняет возврат от имени администратора adminID
+	RejectPurchaseReturn(adminID, returnID int) (models.PurchaseReturn, error)
+	// GetCatalog возвращает каталог товаров с остатками и тем, сколько еще может купить пользователь userID
+	GetCatalog(userID int) ([]models.CatalogItem, error)
+	// RestockItem пополняет остаток товара itemName на quantity от имени администратора adminID.
+	// Если остаток товара не ограничен, возвращает ErrUnlimitedStock.
+	RestockItem(adminID int, itemName string, quantity int) (models.CatalogItem, error)
+	// SetItemStock задает остаток товара itemName (nil - без ограничений) и лимит покупок на пользователя
+	// (0 - без ограничений) от имени администратора adminID
+	SetItemStock(adminID int, itemName string, stock *int, perUserLimit int) (models.CatalogItem, error)
+	// CreateItemVariant создает вариант товара itemName от имени администратора adminID.
+	// Если артикул уже занят, возвращает ErrVariantExists.
+	CreateItemVariant(adminID int, itemName string, variant models.ItemVariantRequest) (models.CatalogVariant, error)
+	// RestockItemVariant пополняет остаток варианта с артикулом sku на quantity от имени администратора adminID.
+	// Если остаток варианта не ограничен, возвращает ErrUnlimitedStock.
+	RestockItemVariant(adminID int, sku string, quantity int) (models.CatalogVariant, error)
+	// DeleteExpiredIdempotencyKeys удаляет ключи идемпотентности старше ttl и возвращает их количество
+	DeleteExpiredIdempotencyKeys(ttl time.Duration) (int, error)
+}
+
+// Имена подготовленных выражений для самых частых вызовов
+const (
+	stmtBuyItem        = "buy_item"
+	stmtTransferCoins  = "transfer_coins"
+	stmtGetUserBalance = "get_user_balance"
+	stmtGetUserInfo    = "get_user_info"
+)
+
+// preparedStatements подготавливаются на каждом новом соединении пула
+var preparedStatements = map[string]string{
+	stmtBuyItem:        "SELECT buy_item($1, $2, $3, $4, $5, $6, $7, $8);",
+	stmtTransferCoins:  "SELECT transfer_coins($1, $2, $3, $4, $5, $6, $7, $8, $9);",
+	stmtGetUserBalance: "SELECT get_user_balance($1);",
+	stmtGetUserInfo:    "SELECT get_user_info($1, $2, $3);",
+}
+
+// DB - подмножество методов *pgxpool.Pool, которые использует хранилище
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// Postgres реализация Store поверх PostgreSQL и хранимых функций из database/migrations
+type Postgres struct {
+	db DB
+}
+
+// NewPostgres создает хранилище поверх уже открытого пула соединений
+func NewPostgres(db DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Open открывает соединение database/sql с базой данных по параметрам из конфигурации.
+// Используется миграциями, которым нужен database/sql и которые выполняются до подготовки выражений.
+func Open(cfg *config.Config) (*sql.DB, error) {
+	return sql.Open("pgx/v5", dsn(cfg))
+}
+
+// Connect создает пул соединений pgxpool с параметрами из конфигурации и хранилище поверх него.
+// На каждом новом соединении подготавливаются выражения для частых вызовов.
+func Connect(cfg *config.Config) (*Postgres, error) {
+	poolCfg, err := pgxpool.ParseConfig(dsn(cfg))
+	if err != nil {
+		return nil, err
+	}
+	poolCfg.MaxConns = cfg.DatabaseMaxConns
+	poolCfg.MinConns = cfg.DatabaseMinConns
+	poolCfg.MaxConnLifetime = cfg.DatabaseMaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.DatabaseMaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.DatabaseHealthCheckPeriod
+	poolCfg.AfterConnect = prepareStatements
+	// Даты в базе пишутся во времени сессии, а окна лимитов трат считаются по UTC
+	poolCfg.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+		return nil, err
+	}
+	return NewPostgres(pool), nil
+}
+
+// prepareStatements подготавливает выражения для частых вызовов на соединении conn
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for name, query := range preparedStatements {
+		if _, err := conn.Prepare(ctx, name, query); err != nil {
+			return fmt.Errorf("подготовка выражения %s: %w", name, err)
+		}
 	}
-	db = conn
-	db.SetMaxOpenConns(50)
-	db.SetMaxIdleConns(10)
+	return nil
+}
+
+// dsn собирает строку подключения к базе данных
+func dsn(cfg *config.Config) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+		cfg.DatabaseUser, cfg.DatabasePass, cfg.DatabaseHost, cfg.DatabasePort, cfg.DatabaseName)
 }
 
 // BuyItemsForUser осуществляет покупку определенного количества вещей
-func BuyItemsForUser(userID int, itemName string, amount int) error {
-	_, err := db.Exec("SELECT buy_item($1, $2, $3);", userID, itemName, amount)
-	return err
+func (p *Postgres) BuyItemsForUser(userID int, itemName, variant string, amount int, limits models.SpendingLimits) error {
+	if amount > MaxQuantity {
+		return ErrInvalidAmount
+	}
+	_, err := p.db.Exec(context.Background(), stmtBuyItem, userID, itemName, nullable(variant), amount,
+		limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient)
+	return purchaseError(err)
 }
 
 // SendCoins осуществляет перевод коинов от одного пользователя к другому
-func SendCoins(userFromID, amount int, userTo string) error {
-	_, err := db.Exec("SELECT transfer_coins($1, $2, $3);", userFromID, userTo, amount)
-	return err
+func (p *Postgres) SendCoins(userFromID, amount int, userTo string, note models.TransferNote,
+	limits models.SpendingLimits) error {
+	if !ValidCategory(note.Category) {
+		return ErrUnknownCategory
+	}
+	if amount > MaxAmount {
+		return ErrInvalidAmount
+	}
+	_, err := p.db.Exec(context.Background(), stmtTransferCoins, userFromID, userTo, amount,
+		limits.PerTransfer, limits.Daily, limits.Monthly, limits.PerRecipient, nullable(note.Message), nullable(note.Category))
+	return limitError(err)
 }
 
 // GetUserIDPassHashOrRegister ищет или регистрирует пользователя
-func GetUserIDPassHashOrRegister(username string, providedPassHash string) (int, []byte, error) {
-	tx, err := db.Begin()
+func (p *Postgres) GetUserIDPassHashOrRegister(username string, providedPassHash string, startingBalance int) (int, []byte, error) {
+	ctx := context.Background()
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
 		return 0, nil, err
 	}
 	defer func() {
-		if tx != nil {
-			_ = tx.Rollback()
-		}
+		_ = tx.Rollback(ctx)
 	}()
 
 	var userId int
 	var userPassHash string
 
-	row := tx.QueryRow("SELECT id, password_hash FROM get_user_id_password_hash($1);", username)
+	row := tx.QueryRow(ctx, "SELECT id, password_hash FROM get_user_id_password_hash($1);", username)
 	err = row.Scan(&userId, &userPassHash)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		row := tx.QueryRow("SELECT register_user($1, $2);", username, providedPassHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		row := tx.QueryRow(ctx, "SELECT register_user($1, $2, $3);", username, providedPassHash, startingBalance)
 		if err = row.Scan(&userId); err != nil {
 			return 0, nil, err
 		}
@@ -66,83 +346,44 @@ func GetUserIDPassHashOrRegister(username string, providedPassHash string) (int,
 		return 0, nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
+	if err = tx.Commit(ctx); err != nil {
 		return 0, nil, err
 	}
 
 	return userId, []byte(userPassHash), nil
 }
 
-// GetUserBalanceInventoryLogs получает баланс пользователя, инвентарь и историю транзакций
-func GetUserBalanceInventoryLogs(userID int) (models.InfoResponse, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return models.InfoResponse{}, err
-	}
-	defer func() {
-		if tx != nil {
-			_ = tx.Rollback()
-		}
-	}()
-
-	var result models.InfoResponse
+// GetUserBalanceInventoryLogs получает баланс пользователя, инвентарь и историю транзакций.
+// Вся информация собирается функцией get_user_info в один JSON. Запрос выполняется в транзакции
+// REPEATABLE READ READ ONLY, при этом BEGIN, запрос и COMMIT отправляются одним батчем - за один сетевой обмен.
+func (p *Postgres) GetUserBalanceInventoryLogs(userID int, expiryPeriod, expiringWindow time.Duration) (models.InfoResponse, error) {
+	ctx := context.Background()
+	batch := &pgx.Batch{}
+	batch.Queue("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY;")
+	batch.Queue(stmtGetUserInfo, userID, expiryPeriod, expiringWindow)
+	batch.Queue("COMMIT;")
+	results := p.db.SendBatch(ctx, batch)
+	defer results.Close()
 
-	err = tx.QueryRow("SELECT get_user_balance($1);", userID).Scan(&result.Coins)
-	if err != nil {
+	var info []byte
+	if _, err := results.Exec(); err != nil {
 		return models.InfoResponse{}, err
 	}
-
-	rows, err := tx.Query("SELECT * FROM get_user_inventory($1);", userID)
-	if err != nil {
+	if err := results.QueryRow().Scan(&info); err != nil {
 		return models.InfoResponse{}, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var item models.Item
-		if err := rows.Scan(&item.Type, &item.Quantity); err != nil {
-			return models.InfoResponse{}, err
-		}
-		result.Inventory = append(result.Inventory, item)
-	}
-	if err = rows.Err(); err != nil {
+	if _, err := results.Exec(); err != nil {
 		return models.InfoResponse{}, err
 	}
-
-	rows, err = tx.Query("SELECT * FROM get_user_receive_history($1);", userID)
-	if err != nil {
+	if err := results.Close(); err != nil {
 		return models.InfoResponse{}, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var received models.CoinTransaction
-		if err := rows.Scan(&received.User, &received.Amount); err != nil {
-			return models.InfoResponse{}, err
-		}
-		result.CoinHistory.Received = append(result.CoinHistory.Received, received)
-	}
-	if err = rows.Err(); err != nil {
-		return models.InfoResponse{}, err
+	if info == nil {
+		return models.InfoResponse{}, ErrUserNotFound
 	}
 
-	rows, err = tx.Query("SELECT * FROM get_user_send_history($1);", userID)
-	if err != nil {
-		return models.InfoResponse{}, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var sent models.CoinTransaction
-		if err := rows.Scan(&sent.User, &sent.Amount); err != nil {
-			return models.InfoResponse{}, err
-		}
-		result.CoinHistory.Sent = append(result.CoinHistory.Sent, sent)
-	}
-	if err = rows.Err(); err != nil {
-		return models.InfoResponse{}, err
-	}
-	if err = tx.Commit(); err != nil {
+	var result models.InfoResponse
+	if err := json.Unmarshal(info, &result); err != nil {
 		return models.InfoResponse{}, err
 	}
 	return result, nil
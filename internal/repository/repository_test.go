@@ -2,31 +2,32 @@ package repository
 
 import (
 	"avito_internship/internal/models"
-	"database/sql"
 	"fmt"
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
-var mockDB *sql.DB
-var mock sqlmock.Sqlmock
+var mock pgxmock.PgxPoolIface
+var store *Postgres
 
 // -------------------------------------------
 // Инициализация тестов и мокнутой базы данных
 // -------------------------------------------
 func initMock() {
 	var err error
-	mockDB, mock, err = sqlmock.New()
+	mock, err = pgxmock.NewPool()
 	if err != nil {
 		panic("Ошибка при создании мока БД: " + err.Error())
 	}
-	db = mockDB
+	store = NewPostgres(mock)
 }
 
 func teardown() {
-	mockDB.Close()
+	mock.Close()
 }
 
 func TestMain(m *testing.M) {
@@ -44,9 +45,9 @@ func TestGetUserIDPassHashOrRegisterValidLogin(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("SELECT id, password_hash FROM get_user_id_password_hash\\(\\$1\\);").
 		WithArgs("test").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(1, "userPassHash"))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "password_hash"}).AddRow(1, "userPassHash"))
 	mock.ExpectCommit()
-	userID, passHash, err := GetUserIDPassHashOrRegister("test", "passHash")
+	userID, passHash, err := store.GetUserIDPassHashOrRegister("test", "passHash", 1000)
 	assert.NoError(t, err)
 	assert.Equal(t, userID, 1)
 	assert.Equal(t, string(passHash), "userPassHash")
@@ -61,7 +62,7 @@ func TestGetUserIDPassHashOrRegisterLoginWithError(t *testing.T) {
 		WithArgs("test").
 		WillReturnError(returningError)
 	mock.ExpectRollback()
-	userID, passHash, err := GetUserIDPassHashOrRegister("test", "passHash")
+	userID, passHash, err := store.GetUserIDPassHashOrRegister("test", "passHash", 1000)
 	assert.ErrorIs(t, err, returningError)
 	assert.Equal(t, userID, 0)
 	assert.Equal(t, string(passHash), "")
@@ -73,12 +74,12 @@ func TestGetUserIDPassHashOrRegisterValidRegistration(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("SELECT id, password_hash FROM get_user_id_password_hash\\(\\$1\\);").
 		WithArgs("test").
-		WillReturnError(sql.ErrNoRows)
-	mock.ExpectQuery("SELECT register_user\\(\\$1, \\$2\\);").
-		WithArgs("test", "passHash").
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("SELECT register_user\\(\\$1, \\$2, \\$3\\);").
+		WithArgs("test", "passHash", 1000).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
-	userID, passHash, err := GetUserIDPassHashOrRegister("test", "passHash")
+	userID, passHash, err := store.GetUserIDPassHashOrRegister("test", "passHash", 1000)
 	assert.NoError(t, err)
 	assert.Equal(t, userID, 1)
 	assert.Equal(t, string(passHash), "passHash")
@@ -90,73 +91,148 @@ func TestGetUserIDPassHashOrRegisterValidRegistration(t *testing.T) {
 // ---------------------------------
 func TestGetUserBalanceInventoryLogsValid(t *testing.T) {
 	resetMockDB(t)
-	mock.ExpectBegin()
-	mock.ExpectQuery("SELECT get_user_balance\\(\\$1\\);").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"coins"}).AddRow(250))
-	mock.ExpectQuery("SELECT \\* FROM get_user_inventory\\(\\$1\\);").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"type", "quantity"}).
-			AddRow("t_shirt", 1).
-			AddRow("cup", 2).
-			AddRow("book", 1).
-			AddRow("powerbank", 1),
-		)
-	mock.ExpectQuery("SELECT \\* FROM get_user_receive_history\\(\\$1\\);").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"user", "amount"}).
-			AddRow("user1", 100).
-			AddRow("user2", 50),
-		)
-	mock.ExpectQuery("SELECT \\* FROM get_user_send_history\\(\\$1\\);").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"user", "amount"}).
-			AddRow("user3", 80).
-			AddRow("user4", 30),
-		)
-	mock.ExpectCommit()
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").
+		WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectQuery("get_user_info").
+		WithArgs(1, time.Duration(0), time.Duration(0)).
+		WillReturnRows(pgxmock.NewRows([]string{"info"}).AddRow([]byte(`{
+			"coins": 250,
+			"inventory": [
+				{"type": "t_shirt", "quantity": 1},
+				{"type": "cup", "quantity": 2},
+				{"type": "book", "quantity": 1},
+				{"type": "powerbank", "quantity": 1}
+			],
+			"coinHistory": {
+				"received": [{"user": "user1", "amount": 100}, {"user": "user2", "amount": 50}],
+				"sent": [{"user": "user3", "amount": 80}, {"user": "user4", "amount": 30}]
+			}
+		}`)))
+	batch.ExpectExec("COMMIT").
+		WillReturnResult(pgxmock.NewResult("COMMIT", 0))
 
-	result, err := GetUserBalanceInventoryLogs(1)
+	result, err := store.GetUserBalanceInventoryLogs(1, 0, 0)
 	assert.NoError(t, err)
 	assert.Equal(t, 250, result.Coins)
 	expectedItems := []models.Item{
-		{"t_shirt", 1},
-		{"cup", 2},
-		{"book", 1},
-		{"powerbank", 1},
+		{Type: "t_shirt", Quantity: 1},
+		{Type: "cup", Quantity: 2},
+		{Type: "book", Quantity: 1},
+		{Type: "powerbank", Quantity: 1},
 	}
 	assert.Equal(t, expectedItems, result.Inventory)
 	expectedReceived := []models.CoinTransaction{
-		{"user1", 100},
-		{"user2", 50},
+		{User: "user1", Amount: 100},
+		{User: "user2", Amount: 50},
 	}
 	assert.Equal(t, expectedReceived, result.CoinHistory.Received)
 	expectedSent := []models.CoinTransaction{
-		{"user3", 80},
-		{"user4", 30},
+		{User: "user3", Amount: 80},
+		{User: "user4", Amount: 30},
 	}
 	assert.Equal(t, expectedSent, result.CoinHistory.Sent)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestGetUserBalanceInventoryLogsEmptyCollections(t *testing.T) {
+	resetMockDB(t)
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("BEGIN").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectQuery("get_user_info").
+		WithArgs(1, time.Duration(0), time.Duration(0)).
+		WillReturnRows(pgxmock.NewRows([]string{"info"}).AddRow([]byte(
+			`{"coins": 1000, "inventory": null, "coinHistory": {"received": null, "sent": null}}`)))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+
+	result, err := store.GetUserBalanceInventoryLogs(1, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, models.InfoResponse{Coins: 1000}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetUserBalanceInventoryLogsInvalid(t *testing.T) {
 	resetMockDB(t)
-	mock.ExpectBegin()
-	returningError := fmt.Errorf("пользователь не найден")
-	mock.ExpectQuery("SELECT get_user_balance\\(\\$1\\);").
-		WithArgs(999).
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("BEGIN").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectQuery("get_user_info").
+		WithArgs(999, time.Duration(0), time.Duration(0)).
+		WillReturnRows(pgxmock.NewRows([]string{"info"}).AddRow(nil))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+	_, err := store.GetUserBalanceInventoryLogs(999, 0, 0)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserBalanceInventoryLogsQueryError(t *testing.T) {
+	resetMockDB(t)
+	returningError := fmt.Errorf("ошибка базы данных")
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("BEGIN").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectQuery("get_user_info").
+		WithArgs(1, time.Duration(0), time.Duration(0)).
 		WillReturnError(returningError)
-	mock.ExpectRollback()
-	_, err := GetUserBalanceInventoryLogs(999)
+	batch.ExpectExec("COMMIT")
+	_, err := store.GetUserBalanceInventoryLogs(1, 0, 0)
 	assert.ErrorIs(t, err, returningError)
+}
+
+// ---------------------------------
+// Тесты SendCoins и BuyItemsForUser
+// ---------------------------------
+func TestSendCoinsUsesPreparedStatement(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("^transfer_coins$").
+		WithArgs(1, "user2", 50, 0, 0, 0, 0, nil, nil).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	assert.NoError(t, store.SendCoins(1, 50, "user2", models.TransferNote{}, models.SpendingLimits{}))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSendCoinsPassesNote(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("^transfer_coins$").
+		WithArgs(1, "user2", 50, 0, 0, 0, 0, "за помощь", models.CategoryThanks).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	note := models.TransferNote{Message: "за помощь", Category: models.CategoryThanks}
+	assert.NoError(t, store.SendCoins(1, 50, "user2", note, models.SpendingLimits{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinsUnknownCategory(t *testing.T) {
+	resetMockDB(t)
+	err := store.SendCoins(1, 50, "user2", models.TransferNote{Category: "bribe"}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrUnknownCategory)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinsRejectsAmountAboveInteger(t *testing.T) {
+	resetMockDB(t)
+	err := store.SendCoins(1, MaxAmount+1, "user2", models.TransferNote{}, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuyItemsForUserUsesPreparedStatement(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("^buy_item$").
+		WithArgs(1, "cup", nil, 2, 0, 0, 0, 0).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	assert.NoError(t, store.BuyItemsForUser(1, "cup", "", 2, models.SpendingLimits{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreparedStatementsCoverHotCalls(t *testing.T) {
+	for _, name := range []string{stmtBuyItem, stmtTransferCoins, stmtGetUserBalance, stmtGetUserInfo} {
+		assert.Contains(t, preparedStatements[name], "SELECT "+name+"(")
+	}
+}
+
 func resetMockDB(t *testing.T) {
 	var err error
-	mockDB, mock, err = sqlmock.New()
+	mock, err = pgxmock.NewPool()
 	if err != nil {
 		t.Fatalf("Ошибка при создании мока БД: %v", err)
 	}
-	db = mockDB
+	store = NewPostgres(mock)
 }
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strings"
+)
+
+// SQLSTATE ошибок reverse_transfer: перевод уже отменен, у получателя нет монет для возврата
+const (
+	transferReversedCode = "REV01"
+	nothingToReverseCode = "REV02"
+)
+
+// ReverseTransfer отменяет перевод от имени администратора компенсирующей операцией
+func (p *Postgres) ReverseTransfer(adminID, transferID int, reason string,
+	allowDebt bool) (models.TransferReversal, error) {
+	if strings.TrimSpace(reason) == "" {
+		return models.TransferReversal{}, ErrEmptyReason
+	}
+	var reversal models.TransferReversal
+	err := p.db.QueryRow(context.Background(),
+		"SELECT * FROM reverse_transfer($1, $2, $3, $4);", adminID, transferID, reason, allowDebt).
+		Scan(&reversal.ID, &reversal.TransferID, &reversal.FromUser, &reversal.ToUser, &reversal.Amount,
+			&reversal.Returned, &reversal.Debt, &reversal.Reason, &reversal.Date)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TransferReversal{}, ErrTransferNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case transferReversedCode:
+			return models.TransferReversal{}, ErrTransferAlreadyReversed
+		case nothingToReverseCode:
+			return models.TransferReversal{}, ErrInsufficientFunds
+		}
+	}
+	if err != nil {
+		return models.TransferReversal{}, err
+	}
+	return reversal, nil
+}
+
+// ReverseTransfer отменяет перевод от имени администратора компенсирующей операцией
+func (m *Memory) ReverseTransfer(adminID, transferID int, reason string,
+	allowDebt bool) (models.TransferReversal, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if strings.TrimSpace(reason) == "" {
+		return models.TransferReversal{}, ErrEmptyReason
+	}
+	if transferID < 1 || transferID > len(m.transfers) || m.transfers[transferID-1].kind != models.TransactionTransfer {
+		return models.TransferReversal{}, ErrTransferNotFound
+	}
+	original := m.transfers[transferID-1]
+	for _, t := range m.transfers {
+		if t.reversalOf == original.id {
+			return models.TransferReversal{}, ErrTransferAlreadyReversed
+		}
+	}
+	sender, _ := m.userByID(original.senderID)
+	receiver, _ := m.userByID(original.receiverID)
+
+	amount := original.amount
+	if !allowDebt {
+		amount = min(amount, max(receiver.balance, 0))
+	}
+	if amount == 0 {
+		return models.TransferReversal{}, ErrInsufficientFunds
+	}
+
+	reversal := memTransfer{
+		id:         len(m.transfers) + 1,
+		date:       m.now().UTC(),
+		senderID:   receiver.id,
+		receiverID: sender.id,
+		amount:     amount,
+		kind:       models.TransactionReversal,
+		reason:     reason,
+		adminID:    adminID,
+		reversalOf: original.id,
+	}
+	m.transfers = append(m.transfers, reversal)
+	m.postEntry(entryReversal, reversal.date, receiver.id, sender.id, amount, reversal.id, 0)
+	return models.TransferReversal{
+		ID:         reversal.id,
+		TransferID: original.id,
+		FromUser:   sender.username,
+		ToUser:     receiver.username,
+		Amount:     original.amount,
+		Returned:   amount,
+		Debt:       max(-receiver.balance, 0),
+		Reason:     reason,
+		Date:       reversal.date,
+	}, nil
+}
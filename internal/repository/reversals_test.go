@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// ------------------------------
+// Тесты Postgres.ReverseTransfer
+// ------------------------------
+func TestReverseTransfer(t *testing.T) {
+	resetMockDB(t)
+	date := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT \\* FROM reverse_transfer").
+		WithArgs(9, 42, "ошибочный перевод", true).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"reversal_id", "original_id", "original_sender", "original_receiver", "original_amount",
+			"returned_amount", "receiver_debt", "reversal_reason", "reversal_date",
+		}).AddRow(50, 42, "alice", "bob", 300, 300, 100, "ошибочный перевод", date))
+
+	reversal, err := store.ReverseTransfer(9, 42, "ошибочный перевод", true)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransferReversal{
+		ID: 50, TransferID: 42, FromUser: "alice", ToUser: "bob", Amount: 300, Returned: 300, Debt: 100,
+		Reason: "ошибочный перевод", Date: date,
+	}, reversal)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReverseTransferErrors(t *testing.T) {
+	resetMockDB(t)
+	for _, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{pgx.ErrNoRows, ErrTransferNotFound},
+		{&pgconn.PgError{Code: transferReversedCode}, ErrTransferAlreadyReversed},
+		{&pgconn.PgError{Code: nothingToReverseCode}, ErrInsufficientFunds},
+	} {
+		mock.ExpectQuery("SELECT \\* FROM reverse_transfer").
+			WithArgs(9, 42, "ошибка", false).
+			WillReturnError(tc.err)
+
+		_, err := store.ReverseTransfer(9, 42, "ошибка", false)
+		assert.ErrorIs(t, err, tc.expected)
+	}
+	_, err := store.ReverseTransfer(9, 42, " ", false)
+	assert.ErrorIs(t, err, ErrEmptyReason)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------------
+// Тесты Memory.ReverseTransfer
+// ----------------------------
+func TestMemoryReverseTransfer(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	admin := registerMemoryUser(t, m, "admin")
+	require.NoError(t, m.SendCoins(alice, 300, "bob", models.TransferNote{Message: "за обед"}, models.SpendingLimits{}))
+
+	reversal, err := m.ReverseTransfer(admin, 4, "ошибочный перевод", false)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransferReversal{
+		ID: 5, TransferID: 4, FromUser: "alice", ToUser: "bob", Amount: 300, Returned: 300,
+		Reason: "ошибочный перевод", Date: reversal.Date,
+	}, reversal)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+	assert.Equal(t, 1000, memoryCoins(t, m, bob))
+	assert.Equal(t, 1000, m.ledgerBalance(bob))
+
+	history, err := m.GetUserHistory(alice, models.HistoryFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, models.HistoryEntry{
+		ID: 5, Direction: models.DirectionReceived, User: "bob", Amount: 300, Date: reversal.Date,
+		Type: models.TransactionReversal, Reason: "ошибочный перевод", ReversalOf: 4,
+	}, history[0])
+	assert.Equal(t, 5, history[1].ReversedBy)
+
+	_, err = m.ReverseTransfer(admin, 4, "повтор", false)
+	assert.ErrorIs(t, err, ErrTransferAlreadyReversed)
+	_, err = m.ReverseTransfer(admin, 5, "отмена отмены", false)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+	_, err = m.ReverseTransfer(admin, 1, "начисление", false)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+	_, err = m.ReverseTransfer(admin, 99, "нет такого", false)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+}
+
+func TestMemoryReverseTransferPartial(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+	admin := registerMemoryUser(t, m, "admin")
+	require.NoError(t, m.SendCoins(alice, 500, "bob", models.TransferNote{}, models.SpendingLimits{})) // id 5
+	require.NoError(t, m.SendCoins(bob, 1300, "carol", models.TransferNote{}, models.SpendingLimits{}))
+
+	reversal, err := m.ReverseTransfer(admin, 5, "мошенничество", false)
+	require.NoError(t, err)
+	assert.Equal(t, 500, reversal.Amount)
+	assert.Equal(t, 200, reversal.Returned)
+	assert.Zero(t, reversal.Debt)
+	assert.Equal(t, 700, memoryCoins(t, m, alice))
+	assert.Zero(t, memoryCoins(t, m, bob))
+
+	// Возвращать нечего: перевод остается неотмененным
+	require.NoError(t, m.SendCoins(alice, 100, "bob", models.TransferNote{}, models.SpendingLimits{})) // id 8
+	require.NoError(t, m.SendCoins(bob, 100, "carol", models.TransferNote{}, models.SpendingLimits{}))
+	_, err = m.ReverseTransfer(admin, 8, "мошенничество", false)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	history, err := m.GetUserHistory(alice, models.HistoryFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Zero(t, history[0].ReversedBy)
+}
+
+func TestMemoryReverseTransferDebt(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	registerMemoryUser(t, m, "carol")
+	admin := registerMemoryUser(t, m, "admin")
+	require.NoError(t, m.SendCoins(alice, 500, "bob", models.TransferNote{}, models.SpendingLimits{})) // id 5
+	require.NoError(t, m.SendCoins(bob, 1300, "carol", models.TransferNote{}, models.SpendingLimits{}))
+
+	reversal, err := m.ReverseTransfer(admin, 5, "мошенничество", true)
+	require.NoError(t, err)
+	assert.Equal(t, 500, reversal.Returned)
+	assert.Equal(t, 300, reversal.Debt)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+	assert.Equal(t, -300, memoryCoins(t, m, bob))
+	assert.Equal(t, -300, m.ledgerBalance(bob))
+
+	// С долгом тратить нельзя, а зачисления сначала гасят его
+	assert.ErrorIs(t, m.SendCoins(bob, 1, "alice", models.TransferNote{}, models.SpendingLimits{}), ErrInsufficientFunds)
+	require.NoError(t, m.SendCoins(alice, 400, "bob", models.TransferNote{}, models.SpendingLimits{}))
+	assert.Equal(t, 100, memoryCoins(t, m, bob))
+	bobUser, _ := m.userByID(bob)
+	require.Len(t, bobUser.lots, 1)
+	assert.Equal(t, 100, bobUser.lots[0].amount)
+}
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strconv"
+)
+
+// SQLSTATE ошибок остатков: товар закончился, превышен лимит на пользователя, остаток не ограничен,
+// стоимость покупки не помещается в INTEGER
+const (
+	outOfStockCode     = "STK01"
+	purchaseLimitCode  = "STK02"
+	unlimitedStockCode = "STK03"
+	costOverflowCode   = "STK04"
+)
+
+// StockError - покупке не хватает остатка товара Item или его варианта Variant (Code = out_of_stock)
+// или лимита покупок на пользователя (Code = purchase_limit). Available - сколько единиц еще можно купить.
+type StockError struct {
+	Item      string
+	Variant   string
+	Code      string
+	Available int
+}
+
+func (e *StockError) Error() string {
+	item := e.Item
+	if e.Variant != "" {
+		item += "/" + e.Variant
+	}
+	return fmt.Sprintf("%s: %s, available %d", item, e.Code, e.Available)
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrOutOfStock) и errors.Is(err, ErrPurchaseLimitReached)
+func (e *StockError) Is(target error) bool {
+	return (target == ErrOutOfStock && e.Code == models.StockOutOfStock) ||
+		(target == ErrPurchaseLimitReached && e.Code == models.StockPurchaseLimit)
+}
+
+// purchaseError преобразует ошибку остатка из базы в *StockError, а слишком большую стоимость покупки -
+// в ErrInvalidAmount, остальные ошибки - как limitError. Для остатка варианта артикул передается в имени
+// ограничения.
+func purchaseError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == costOverflowCode {
+		return ErrInvalidAmount
+	}
+	if errors.As(err, &pgErr) && (pgErr.Code == outOfStockCode || pgErr.Code == purchaseLimitCode) {
+		available, _ := strconv.Atoi(pgErr.Detail)
+		code := models.StockOutOfStock
+		if pgErr.Code == purchaseLimitCode {
+			code = models.StockPurchaseLimit
+		}
+		return &StockError{Item: pgErr.Hint, Variant: pgErr.ConstraintName, Code: code, Available: available}
+	}
+	return limitError(err)
+}
+
+// catalogItem собирает товар каталога. purchased - сколько единиц товара пользователь уже купил,
+// учитывается только при лимите на пользователя perUserLimit. Доступность вариантов variants
+// вычисляется по их остаткам и доступности товара.
+func catalogItem(name string, price int, stock *int, perUserLimit, purchased int,
+	variants []models.CatalogVariant) models.CatalogItem {
+	item := models.CatalogItem{
+		Name:      name,
+		Price:     price,
+		Stock:     stock,
+		Available: stock == nil || *stock > 0,
+	}
+	if perUserLimit > 0 {
+		remaining := max(perUserLimit-purchased, 0)
+		if stock != nil {
+			remaining = min(remaining, *stock)
+		}
+		item.PerUserLimit = perUserLimit
+		item.UserRemaining = &remaining
+		item.Available = remaining > 0
+	}
+	for i, variant := range variants {
+		variants[i].Available = item.Available && (variant.Stock == nil || *variant.Stock > 0)
+	}
+	item.Variants = variants
+	return item
+}
+
+// GetCatalog возвращает каталог товаров с остатками
+func (p *Postgres) GetCatalog(userID int) ([]models.CatalogItem, error) {
+	rows, err := p.db.Query(context.Background(),
+		"SELECT name, price, stock, per_user_limit, purchased, variants FROM get_catalog($1);", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var catalog []models.CatalogItem
+	for rows.Next() {
+		var name string
+		var price, purchased int
+		var stock, perUserLimit *int
+		var variantsJSON []byte
+		if err := rows.Scan(&name, &price, &stock, &perUserLimit, &purchased, &variantsJSON); err != nil {
+			return nil, err
+		}
+		var variants []models.CatalogVariant
+		if variantsJSON != nil {
+			if err := json.Unmarshal(variantsJSON, &variants); err != nil {
+				return nil, err
+			}
+		}
+		catalog = append(catalog, catalogItem(name, price, stock, derefInt(perUserLimit), purchased, variants))
+	}
+	return catalog, rows.Err()
+}
+
+// RestockItem пополняет остаток товара
+func (p *Postgres) RestockItem(adminID int, itemName string, quantity int) (models.CatalogItem, error) {
+	if quantity <= 0 {
+		return models.CatalogItem{}, ErrInvalidAmount
+	}
+	return p.queryItemStock("SELECT name, price, stock, per_user_limit FROM restock_item($1, $2, $3);",
+		adminID, itemName, quantity)
+}
+
+// SetItemStock задает остаток товара и лимит покупок на пользователя
+func (p *Postgres) SetItemStock(adminID int, itemName string, stock *int, perUserLimit int) (models.CatalogItem, error) {
+	if (stock != nil && *stock < 0) || perUserLimit < 0 {
+		return models.CatalogItem{}, ErrInvalidAmount
+	}
+	return p.queryItemStock("SELECT name, price, stock, per_user_limit FROM set_item_stock($1, $2, $3, $4);",
+		adminID, itemName, stock, nullable(perUserLimit))
+}
+
+// queryItemStock выполняет функцию изменения остатка, которая возвращает товар или ничего, если его нет
+func (p *Postgres) queryItemStock(query string, args ...any) (models.CatalogItem, error) {
+	var name string
+	var price int
+	var stock, perUserLimit *int
+	err := p.db.QueryRow(context.Background(), query, args...).Scan(&name, &price, &stock, &perUserLimit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CatalogItem{}, ErrItemNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == unlimitedStockCode {
+		return models.CatalogItem{}, ErrUnlimitedStock
+	}
+	if err != nil {
+		return models.CatalogItem{}, err
+	}
+	return catalogItem(name, price, stock, derefInt(perUserLimit), 0, nil), nil
+}
+
+// derefInt возвращает значение необязательного числа, nil - ноль
+func derefInt(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// GetCatalog возвращает каталог товаров с остатками
+func (m *Memory) GetCatalog(userID int) ([]models.CatalogItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	catalog := make([]models.CatalogItem, len(m.items))
+	for itemID, item := range m.items {
+		purchased := 0
+		if item.perUserLimit > 0 {
+			purchased = m.purchasedQuantity(userID, itemID)
+		}
+		catalog[itemID] = catalogItem(item.name, item.price, copyStock(item.stock), item.perUserLimit, purchased,
+			m.catalogVariants(itemID))
+	}
+	return catalog, nil
+}
+
+// RestockItem пополняет остаток товара
+func (m *Memory) RestockItem(adminID int, itemName string, quantity int) (models.CatalogItem, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if quantity <= 0 {
+		return models.CatalogItem{}, ErrInvalidAmount
+	}
+	itemID, ok := m.itemsByName[itemName]
+	if !ok {
+		return models.CatalogItem{}, ErrItemNotFound
+	}
+	item := &m.items[itemID]
+	if item.stock == nil {
+		return models.CatalogItem{}, ErrUnlimitedStock
+	}
+	*item.stock += quantity
+	return catalogItem(item.name, item.price, copyStock(item.stock), item.perUserLimit, 0, nil), nil
+}
+
+// SetItemStock задает остаток товара и лимит покупок на пользователя
+func (m *Memory) SetItemStock(adminID int, itemName string, stock *int, perUserLimit int) (models.CatalogItem, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if (stock != nil && *stock < 0) || perUserLimit < 0 {
+		return models.CatalogItem{}, ErrInvalidAmount
+	}
+	itemID, ok := m.itemsByName[itemName]
+	if !ok {
+		return models.CatalogItem{}, ErrItemNotFound
+	}
+	item := &m.items[itemID]
+	item.stock = copyStock(stock)
+	item.perUserLimit = perUserLimit
+	return catalogItem(item.name, item.price, copyStock(item.stock), item.perUserLimit, 0, nil), nil
+}
+
+// checkStock проверяет, что пользователь может купить quantities единиц вариантов товаров
+// с учетом остатков товаров и вариантов и лимитов на пользователя. Вызывается под блокировкой.
+func (m *Memory) checkStock(userID int, quantities map[memVariantKey]int) error {
+	itemQuantities := make(map[int]int, len(quantities))
+	for key, quantity := range quantities {
+		itemQuantities[key.itemID] += quantity
+	}
+	for itemID, quantity := range itemQuantities {
+		item := m.items[itemID]
+		if item.perUserLimit > 0 {
+			purchased := m.purchasedQuantity(userID, itemID)
+			if purchased+quantity > item.perUserLimit {
+				return &StockError{Item: item.name, Code: models.StockPurchaseLimit,
+					Available: max(item.perUserLimit-purchased, 0)}
+			}
+		}
+		if item.stock != nil && *item.stock < quantity {
+			return &StockError{Item: item.name, Code: models.StockOutOfStock, Available: *item.stock}
+		}
+	}
+	for key, quantity := range quantities {
+		variant := m.items[key.itemID].variants[key.variant]
+		if variant.stock != nil && *variant.stock < quantity {
+			return &StockError{Item: m.items[key.itemID].name, Variant: variant.sku, Code: models.StockOutOfStock,
+				Available: *variant.stock}
+		}
+	}
+	return nil
+}
+
+// purchasedQuantity возвращает, сколько единиц товара пользователь купил за вычетом одобренных возвратов.
+// Вызывается под блокировкой.
+func (m *Memory) purchasedQuantity(userID, itemID int) int {
+	purchased := 0
+	for _, p := range m.purchases {
+		if p.buyerID == userID && p.itemID == itemID {
+			purchased += p.amount - m.returnedQuantity(p.id)
+		}
+	}
+	return purchased
+}
+
+// copyStock возвращает копию остатка, чтобы его нельзя было изменить снаружи хранилища
+func copyStock(stock *int) *int {
+	if stock == nil {
+		return nil
+	}
+	value := *stock
+	return &value
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// intPtr возвращает указатель на value
+func intPtr(value int) *int {
+	return &value
+}
+
+// --------------------------------
+// Тесты ошибок остатков в Postgres
+// --------------------------------
+func TestBuyItemsForUserOutOfStock(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectExec("^buy_item$").
+		WithArgs(1, "pink-hoody", nil, 2, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: outOfStockCode, Detail: "1", Hint: "pink-hoody"})
+
+	err := store.BuyItemsForUser(1, "pink-hoody", "", 2, models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrOutOfStock)
+	assert.NotErrorIs(t, err, ErrPurchaseLimitReached)
+	var stockErr *StockError
+	require.ErrorAs(t, err, &stockErr)
+	assert.Equal(t, &StockError{Item: "pink-hoody", Code: models.StockOutOfStock, Available: 1}, stockErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderPurchaseLimitReached(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("SELECT \\* FROM place_order").
+		WithArgs(1, []string{"cup", "pink-hoody"}, []string{"", ""}, []int32{1, 2}, 0, 0, 0, 0).
+		WillReturnError(&pgconn.PgError{Code: purchaseLimitCode, Detail: "0", Hint: "pink-hoody"})
+
+	_, err := store.PlaceOrder(1, []models.OrderLine{{Item: "cup", Quantity: 1}, {Item: "pink-hoody", Quantity: 2}},
+		models.SpendingLimits{})
+	assert.ErrorIs(t, err, ErrPurchaseLimitReached)
+	var stockErr *StockError
+	require.ErrorAs(t, err, &stockErr)
+	assert.Equal(t, &StockError{Item: "pink-hoody", Code: models.StockPurchaseLimit, Available: 0}, stockErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurchaseErrorKeepsLimitErrors(t *testing.T) {
+	err := purchaseError(&pgconn.PgError{Code: limitExceededCode, ConstraintName: models.LimitDaily, Detail: "20"})
+	assert.Equal(t, &LimitError{Limit: models.LimitDaily, Remaining: 20}, err)
+	assert.NoError(t, purchaseError(nil))
+}
+
+// -----------------------------------------------------
+// Тесты Postgres.GetCatalog, RestockItem и SetItemStock
+// -----------------------------------------------------
+func TestGetCatalog(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM get_catalog").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "price", "stock", "per_user_limit", "purchased", "variants"}).
+			AddRow("cup", 20, nil, nil, 0, nil).
+			AddRow("pink-hoody", 500, intPtr(5), intPtr(2), 1,
+				[]byte(`[{"sku":"pink-hoody-xl","attributes":{"size":"XL"},"price":550,"stock":0}]`)).
+			AddRow("umbrella", 200, intPtr(0), nil, 0, nil))
+
+	catalog, err := store.GetCatalog(1)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CatalogItem{
+		{Name: "cup", Price: 20, Available: true},
+		{Name: "pink-hoody", Price: 500, Stock: intPtr(5), Available: true, PerUserLimit: 2, UserRemaining: intPtr(1),
+			Variants: []models.CatalogVariant{
+				{SKU: "pink-hoody-xl", Attributes: map[string]string{"size": "XL"}, Price: 550, Stock: intPtr(0)},
+			}},
+		{Name: "umbrella", Price: 200, Stock: intPtr(0)},
+	}, catalog)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockItem(t *testing.T) {
+	resetMockDB(t)
+	rows := pgxmock.NewRows([]string{"name", "price", "stock", "per_user_limit"})
+	mock.ExpectQuery("FROM restock_item").
+		WithArgs(9, "pink-hoody", 10).
+		WillReturnRows(rows.AddRow("pink-hoody", 500, intPtr(12), nil))
+	mock.ExpectQuery("FROM restock_item").
+		WithArgs(9, "cup", 10).
+		WillReturnError(&pgconn.PgError{Code: unlimitedStockCode})
+	mock.ExpectQuery("FROM restock_item").
+		WithArgs(9, "yacht", 10).
+		WillReturnError(pgx.ErrNoRows)
+
+	item, err := store.RestockItem(9, "pink-hoody", 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{Name: "pink-hoody", Price: 500, Stock: intPtr(12), Available: true}, item)
+	_, err = store.RestockItem(9, "cup", 10)
+	assert.ErrorIs(t, err, ErrUnlimitedStock)
+	_, err = store.RestockItem(9, "yacht", 10)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+	_, err = store.RestockItem(9, "pink-hoody", 0)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetItemStock(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM set_item_stock").
+		WithArgs(9, "pink-hoody", intPtr(3), 1).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "price", "stock", "per_user_limit"}).
+			AddRow("pink-hoody", 500, intPtr(3), intPtr(1)))
+	mock.ExpectQuery("FROM set_item_stock").
+		WithArgs(9, "cup", (*int)(nil), nil).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "price", "stock", "per_user_limit"}).
+			AddRow("cup", 20, nil, nil))
+
+	item, err := store.SetItemStock(9, "pink-hoody", intPtr(3), 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{
+		Name: "pink-hoody", Price: 500, Stock: intPtr(3), Available: true, PerUserLimit: 1, UserRemaining: intPtr(1),
+	}, item)
+	item, err = store.SetItemStock(9, "cup", nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{Name: "cup", Price: 20, Available: true}, item)
+
+	_, err = store.SetItemStock(9, "cup", intPtr(-1), 0)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = store.SetItemStock(9, "cup", nil, -1)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// -----------------------
+// Тесты остатков в Memory
+// -----------------------
+func TestMemoryStockAndRestock(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+	_, err := m.SetItemStock(admin, "cup", intPtr(3), 0)
+	require.NoError(t, err)
+
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 2, models.SpendingLimits{}))
+	err = m.BuyItemsForUser(alice, "cup", "", 2, models.SpendingLimits{})
+	assert.Equal(t, &StockError{Item: "cup", Code: models.StockOutOfStock, Available: 1}, err)
+	assert.Equal(t, 960, memoryCoins(t, m, alice))
+
+	require.NoError(t, m.BuyItemsForUser(alice, "cup", "", 1, models.SpendingLimits{}))
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "cup", "", 1, models.SpendingLimits{}), ErrOutOfStock)
+
+	item, err := m.RestockItem(admin, "cup", 5)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{Name: "cup", Price: 20, Stock: intPtr(5), Available: true}, item)
+	_, err = m.RestockItem(admin, "pen", 5)
+	assert.ErrorIs(t, err, ErrUnlimitedStock)
+	_, err = m.RestockItem(admin, "yacht", 5)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+
+	// Остаток одного хранилища не влияет на каталог другого
+	catalog, err := NewMemory().GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Nil(t, catalog[1].Stock)
+}
+
+func TestMemoryPurchaseLimitCountsReturns(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	bob := registerMemoryUser(t, m, "bob")
+	_, err := m.SetItemStock(bob, "hoody", intPtr(10), 2)
+	require.NoError(t, err)
+
+	require.NoError(t, m.BuyItemsForUser(alice, "hoody", "", 2, models.SpendingLimits{}))
+	err = m.BuyItemsForUser(alice, "hoody", "", 1, models.SpendingLimits{})
+	assert.Equal(t, &StockError{Item: "hoody", Code: models.StockPurchaseLimit, Available: 0}, err)
+	require.NoError(t, m.BuyItemsForUser(bob, "hoody", "", 1, models.SpendingLimits{}))
+
+	catalog, err := m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{
+		Name: "hoody", Price: 300, Stock: intPtr(7), PerUserLimit: 2, UserRemaining: intPtr(0),
+	}, catalog[m.itemsByName["hoody"]])
+
+	// Одобренный возврат возвращает предмет на склад и в лимит покупателя
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	created, err := m.RequestPurchaseReturn(alice, purchases[0].ID, 1, "", time.Hour)
+	require.NoError(t, err)
+	_, err = m.ApprovePurchaseReturn(bob, created.ID)
+	require.NoError(t, err)
+
+	catalog, err = m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogItem{
+		Name: "hoody", Price: 300, Stock: intPtr(8), Available: true, PerUserLimit: 2, UserRemaining: intPtr(1),
+	}, catalog[m.itemsByName["hoody"]])
+	require.NoError(t, m.BuyItemsForUser(alice, "hoody", "", 1, models.SpendingLimits{}))
+}
+
+func TestMemoryPlaceOrderChecksStockAcrossLines(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	_, err := m.SetItemStock(alice, "book", intPtr(3), 0)
+	require.NoError(t, err)
+
+	_, err = m.PlaceOrder(alice, []models.OrderLine{
+		{Item: "cup", Quantity: 1}, {Item: "book", Quantity: 2}, {Item: "book", Quantity: 2},
+	}, models.SpendingLimits{})
+	assert.Equal(t, &StockError{Item: "book", Code: models.StockOutOfStock, Available: 3}, err)
+	assert.Equal(t, 1000, memoryCoins(t, m, alice))
+
+	_, err = m.PlaceOrder(alice, []models.OrderLine{{Item: "book", Quantity: 2}, {Item: "book", Quantity: 1}},
+		models.SpendingLimits{})
+	require.NoError(t, err)
+	catalog, err := m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(0), catalog[m.itemsByName["book"]].Stock)
+	assert.False(t, catalog[m.itemsByName["book"]].Available)
+}
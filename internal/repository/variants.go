@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"maps"
+)
+
+// uniqueViolationCode - SQLSTATE нарушения уникальности
+const uniqueViolationCode = "23505"
+
+// memVariantKey - вариант variant (индекс в memItem.variants) товара itemID
+type memVariantKey struct {
+	itemID  int
+	variant int
+}
+
+// memVariant - вариант товара. price - цена вместо цены товара (0 - цена товара),
+// stock - остаток варианта (nil - не ограничен).
+type memVariant struct {
+	sku        string
+	attributes map[string]string
+	price      int
+	stock      *int
+}
+
+// CreateItemVariant создает вариант товара
+func (p *Postgres) CreateItemVariant(adminID int, itemName string,
+	variant models.ItemVariantRequest) (models.CatalogVariant, error) {
+	if variant.Price < 0 || (variant.Stock != nil && *variant.Stock < 0) {
+		return models.CatalogVariant{}, ErrInvalidAmount
+	}
+	attributes := variant.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	created, err := p.queryItemVariant(
+		"SELECT sku, attributes, price, stock FROM create_item_variant($1, $2, $3, $4, $5, $6);",
+		adminID, itemName, variant.SKU, attributes, nullable(variant.Price), variant.Stock)
+	if errors.Is(err, ErrVariantNotFound) {
+		return models.CatalogVariant{}, ErrItemNotFound
+	}
+	return created, err
+}
+
+// RestockItemVariant пополняет остаток варианта товара
+func (p *Postgres) RestockItemVariant(adminID int, sku string, quantity int) (models.CatalogVariant, error) {
+	if quantity <= 0 {
+		return models.CatalogVariant{}, ErrInvalidAmount
+	}
+	return p.queryItemVariant("SELECT sku, attributes, price, stock FROM restock_item_variant($1, $2, $3);",
+		adminID, sku, quantity)
+}
+
+// queryItemVariant выполняет функцию изменения варианта, которая возвращает вариант или ничего, если его нет
+func (p *Postgres) queryItemVariant(query string, args ...any) (models.CatalogVariant, error) {
+	var variant models.CatalogVariant
+	err := p.db.QueryRow(context.Background(), query, args...).
+		Scan(&variant.SKU, &variant.Attributes, &variant.Price, &variant.Stock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CatalogVariant{}, ErrVariantNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolationCode:
+			return models.CatalogVariant{}, ErrVariantExists
+		case unlimitedStockCode:
+			return models.CatalogVariant{}, ErrUnlimitedStock
+		}
+	}
+	if err != nil {
+		return models.CatalogVariant{}, err
+	}
+	if len(variant.Attributes) == 0 {
+		variant.Attributes = nil
+	}
+	variant.Available = variant.Stock == nil || *variant.Stock > 0
+	return variant, nil
+}
+
+// CreateItemVariant создает вариант товара
+func (m *Memory) CreateItemVariant(adminID int, itemName string,
+	variant models.ItemVariantRequest) (models.CatalogVariant, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if variant.Price < 0 || (variant.Stock != nil && *variant.Stock < 0) {
+		return models.CatalogVariant{}, ErrInvalidAmount
+	}
+	itemID, ok := m.itemsByName[itemName]
+	if !ok {
+		return models.CatalogVariant{}, ErrItemNotFound
+	}
+	if _, ok := m.variantsBySKU[variant.SKU]; ok {
+		return models.CatalogVariant{}, ErrVariantExists
+	}
+	item := &m.items[itemID]
+	key := memVariantKey{itemID: itemID, variant: len(item.variants)}
+	item.variants = append(item.variants, memVariant{
+		sku:        variant.SKU,
+		attributes: maps.Clone(variant.Attributes),
+		price:      variant.Price,
+		stock:      copyStock(variant.Stock),
+	})
+	m.variantsBySKU[variant.SKU] = key
+	return m.catalogVariant(key), nil
+}
+
+// RestockItemVariant пополняет остаток варианта товара
+func (m *Memory) RestockItemVariant(adminID int, sku string, quantity int) (models.CatalogVariant, error) {
+	m.lock()
+	defer m.mu.Unlock()
+
+	if quantity <= 0 {
+		return models.CatalogVariant{}, ErrInvalidAmount
+	}
+	key, ok := m.variantsBySKU[sku]
+	if !ok {
+		return models.CatalogVariant{}, ErrVariantNotFound
+	}
+	variant := m.items[key.itemID].variants[key.variant]
+	if variant.stock == nil {
+		return models.CatalogVariant{}, ErrUnlimitedStock
+	}
+	*variant.stock += quantity
+	return m.catalogVariant(key), nil
+}
+
+// findVariant возвращает вариант с артикулом sku товара itemName, пустой sku - вариант по умолчанию.
+// Вызывается под блокировкой.
+func (m *Memory) findVariant(itemName, sku string) (memVariantKey, error) {
+	itemID, ok := m.itemsByName[itemName]
+	if !ok {
+		return memVariantKey{}, ErrItemNotFound
+	}
+	if sku == "" {
+		return memVariantKey{itemID: itemID}, nil
+	}
+	key, ok := m.variantsBySKU[sku]
+	if !ok || key.itemID != itemID {
+		return memVariantKey{}, ErrVariantNotFound
+	}
+	return key, nil
+}
+
+// variantPrice возвращает цену варианта с учетом замены цены товара. Вызывается под блокировкой.
+func (m *Memory) variantPrice(key memVariantKey) int {
+	item := m.items[key.itemID]
+	if price := item.variants[key.variant].price; price > 0 {
+		return price
+	}
+	return item.price
+}
+
+// changeStock изменяет на delta ограниченные остатки товара и варианта. Вызывается под блокировкой.
+func (m *Memory) changeStock(key memVariantKey, delta int) {
+	item := m.items[key.itemID]
+	if item.stock != nil {
+		*item.stock += delta
+	}
+	if stock := item.variants[key.variant].stock; stock != nil {
+		*stock += delta
+	}
+}
+
+// inventoryItem возвращает предметы варианта в инвентаре. Вызывается под блокировкой.
+func (m *Memory) inventoryItem(itemID, variant, quantity int) models.Item {
+	item := models.Item{Type: m.items[itemID].name, Quantity: quantity}
+	if variant > 0 {
+		item.Variant = m.items[itemID].variants[variant].sku
+		item.Attributes = maps.Clone(m.items[itemID].variants[variant].attributes)
+	}
+	return item
+}
+
+// catalogVariants возвращает варианты товара, кроме варианта по умолчанию. Вызывается под блокировкой.
+func (m *Memory) catalogVariants(itemID int) []models.CatalogVariant {
+	var variants []models.CatalogVariant
+	for variant := 1; variant < len(m.items[itemID].variants); variant++ {
+		variants = append(variants, m.catalogVariant(memVariantKey{itemID: itemID, variant: variant}))
+	}
+	return variants
+}
+
+// catalogVariant возвращает вариант в формате каталога. Доступность учитывает только остаток варианта.
+// Вызывается под блокировкой.
+func (m *Memory) catalogVariant(key memVariantKey) models.CatalogVariant {
+	variant := m.items[key.itemID].variants[key.variant]
+	return models.CatalogVariant{
+		SKU:        variant.sku,
+		Attributes: maps.Clone(variant.attributes),
+		Price:      m.variantPrice(key),
+		Stock:      copyStock(variant.stock),
+		Available:  variant.stock == nil || *variant.stock > 0,
+	}
+}
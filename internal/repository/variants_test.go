@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"avito_internship/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------
+// Тесты Postgres.CreateItemVariant и RestockItemVariant
+// -----------------------------------------------------
+func TestCreateItemVariant(t *testing.T) {
+	resetMockDB(t)
+	columns := []string{"sku", "attributes", "price", "stock"}
+	mock.ExpectQuery("FROM create_item_variant").
+		WithArgs(9, "hoody", "hoody-m", map[string]string{"size": "M"}, 350, intPtr(2)).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow("hoody-m", map[string]string{"size": "M"}, 350, intPtr(2)))
+	mock.ExpectQuery("FROM create_item_variant").
+		WithArgs(9, "hoody", "hoody-l", map[string]string{}, nil, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow("hoody-l", map[string]string{}, 300, nil))
+	mock.ExpectQuery("FROM create_item_variant").
+		WithArgs(9, "hoody", "hoody-m", map[string]string{}, nil, (*int)(nil)).
+		WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+	mock.ExpectQuery("FROM create_item_variant").
+		WithArgs(9, "yacht", "yacht-s", map[string]string{}, nil, (*int)(nil)).
+		WillReturnError(pgx.ErrNoRows)
+
+	variant, err := store.CreateItemVariant(9, "hoody", models.ItemVariantRequest{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Price: 350, Stock: intPtr(2),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogVariant{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Price: 350, Stock: intPtr(2), Available: true,
+	}, variant)
+	variant, err = store.CreateItemVariant(9, "hoody", models.ItemVariantRequest{SKU: "hoody-l"})
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogVariant{SKU: "hoody-l", Price: 300, Available: true}, variant)
+
+	_, err = store.CreateItemVariant(9, "hoody", models.ItemVariantRequest{SKU: "hoody-m"})
+	assert.ErrorIs(t, err, ErrVariantExists)
+	_, err = store.CreateItemVariant(9, "yacht", models.ItemVariantRequest{SKU: "yacht-s"})
+	assert.ErrorIs(t, err, ErrItemNotFound)
+	_, err = store.CreateItemVariant(9, "hoody", models.ItemVariantRequest{SKU: "hoody-s", Price: -1})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockItemVariant(t *testing.T) {
+	resetMockDB(t)
+	mock.ExpectQuery("FROM restock_item_variant").
+		WithArgs(9, "hoody-m", 5).
+		WillReturnRows(pgxmock.NewRows([]string{"sku", "attributes", "price", "stock"}).
+			AddRow("hoody-m", map[string]string{"size": "M"}, 300, intPtr(5)))
+	mock.ExpectQuery("FROM restock_item_variant").
+		WithArgs(9, "hoody-l", 5).
+		WillReturnError(&pgconn.PgError{Code: unlimitedStockCode})
+	mock.ExpectQuery("FROM restock_item_variant").
+		WithArgs(9, "yacht-s", 5).
+		WillReturnError(pgx.ErrNoRows)
+
+	variant, err := store.RestockItemVariant(9, "hoody-m", 5)
+	require.NoError(t, err)
+	assert.Equal(t, models.CatalogVariant{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Price: 300, Stock: intPtr(5), Available: true,
+	}, variant)
+	_, err = store.RestockItemVariant(9, "hoody-l", 5)
+	assert.ErrorIs(t, err, ErrUnlimitedStock)
+	_, err = store.RestockItemVariant(9, "yacht-s", 5)
+	assert.ErrorIs(t, err, ErrVariantNotFound)
+	_, err = store.RestockItemVariant(9, "hoody-m", 0)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurchaseErrorVariant(t *testing.T) {
+	err := purchaseError(&pgconn.PgError{Code: outOfStockCode, Detail: "0", Hint: "hoody", ConstraintName: "hoody-m"})
+	assert.Equal(t, &StockError{Item: "hoody", Variant: "hoody-m", Code: models.StockOutOfStock}, err)
+	assert.EqualError(t, err, "hoody/hoody-m: out_of_stock, available 0")
+}
+
+// ------------------------
+// Тесты вариантов в Memory
+// ------------------------
+func TestMemoryBuyItemVariant(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+	_, err := m.CreateItemVariant(admin, "hoody", models.ItemVariantRequest{
+		SKU: "hoody-xl", Attributes: map[string]string{"size": "XL"}, Price: 350, Stock: intPtr(1),
+	})
+	require.NoError(t, err)
+	_, err = m.CreateItemVariant(admin, "cup", models.ItemVariantRequest{SKU: "hoody-xl"})
+	assert.ErrorIs(t, err, ErrVariantExists)
+	_, err = m.CreateItemVariant(admin, "yacht", models.ItemVariantRequest{SKU: "yacht-s"})
+	assert.ErrorIs(t, err, ErrItemNotFound)
+
+	// Цена варианта заменяет цену товара, вариант по умолчанию продается по цене товара
+	require.NoError(t, m.BuyItemsForUser(alice, "hoody", "hoody-xl", 1, models.SpendingLimits{}))
+	assert.Equal(t, 650, memoryCoins(t, m, alice))
+	require.NoError(t, m.BuyItemsForUser(alice, "hoody", "", 1, models.SpendingLimits{}))
+	assert.Equal(t, 350, memoryCoins(t, m, alice))
+
+	err = m.BuyItemsForUser(alice, "hoody", "hoody-xl", 1, models.SpendingLimits{})
+	assert.Equal(t, &StockError{Item: "hoody", Variant: "hoody-xl", Code: models.StockOutOfStock}, err)
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "cup", "hoody-xl", 1, models.SpendingLimits{}), ErrVariantNotFound)
+	assert.ErrorIs(t, m.BuyItemsForUser(alice, "cup", "cup-xl", 1, models.SpendingLimits{}), ErrVariantNotFound)
+
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Item{
+		{Type: "hoody", Quantity: 1},
+		{Type: "hoody", Variant: "hoody-xl", Attributes: map[string]string{"size": "XL"}, Quantity: 1},
+	}, info.Inventory)
+
+	catalog, err := m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CatalogVariant{
+		{SKU: "hoody-xl", Attributes: map[string]string{"size": "XL"}, Price: 350, Stock: intPtr(0)},
+	}, catalog[m.itemsByName["hoody"]].Variants)
+
+	variant, err := m.RestockItemVariant(admin, "hoody-xl", 2)
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(2), variant.Stock)
+	assert.True(t, variant.Available)
+}
+
+func TestMemoryItemVariantStockAndReturns(t *testing.T) {
+	m := NewMemory()
+	alice := registerMemoryUser(t, m, "alice")
+	admin := registerMemoryUser(t, m, "admin")
+	_, err := m.SetItemStock(admin, "cup", intPtr(5), 0)
+	require.NoError(t, err)
+	_, err = m.CreateItemVariant(admin, "cup", models.ItemVariantRequest{SKU: "cup-red", Stock: intPtr(3)})
+	require.NoError(t, err)
+	_, err = m.RestockItemVariant(admin, "cup-green", 1)
+	assert.ErrorIs(t, err, ErrVariantNotFound)
+	_, err = m.CreateItemVariant(admin, "cup", models.ItemVariantRequest{SKU: "cup-blue"})
+	require.NoError(t, err)
+	_, err = m.RestockItemVariant(admin, "cup-blue", 1)
+	assert.ErrorIs(t, err, ErrUnlimitedStock)
+
+	// Заказ списывает остатки и товара, и варианта
+	_, err = m.PlaceOrder(alice, []models.OrderLine{
+		{Item: "cup", Variant: "cup-red", Quantity: 2}, {Item: "cup", Variant: "cup-blue", Quantity: 2},
+	}, models.SpendingLimits{})
+	require.NoError(t, err)
+	err = m.BuyItemsForUser(alice, "cup", "cup-red", 2, models.SpendingLimits{})
+	assert.Equal(t, &StockError{Item: "cup", Code: models.StockOutOfStock, Available: 1}, err)
+	err = m.BuyItemsForUser(alice, "cup", "cup-red", 1, models.SpendingLimits{})
+	require.NoError(t, err)
+	catalog, err := m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(0), catalog[m.itemsByName["cup"]].Stock)
+	assert.Equal(t, intPtr(0), catalog[m.itemsByName["cup"]].Variants[0].Stock)
+
+	// Одобренный возврат возвращает предмет на склад товара и варианта
+	purchases, err := m.GetUserPurchases(alice, models.PurchaseFilter{Limit: 1})
+	require.NoError(t, err)
+	created, err := m.RequestPurchaseReturn(alice, purchases[0].ID, 1, "", time.Hour)
+	require.NoError(t, err)
+	_, err = m.ApprovePurchaseReturn(admin, created.ID)
+	require.NoError(t, err)
+
+	catalog, err = m.GetCatalog(alice)
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(1), catalog[m.itemsByName["cup"]].Stock)
+	assert.Equal(t, models.CatalogVariant{SKU: "cup-red", Price: 20, Stock: intPtr(1), Available: true},
+		catalog[m.itemsByName["cup"]].Variants[0])
+	info, err := m.GetUserBalanceInventoryLogs(alice, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Item{
+		{Type: "cup", Variant: "cup-red", Quantity: 2},
+		{Type: "cup", Variant: "cup-blue", Quantity: 2},
+	}, info.Inventory)
+}
@@ -0,0 +1,223 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNeverFires - расписание синтаксически верно, но ни разу не срабатывает (например, 31 февраля)
+var ErrNeverFires = errors.New("schedule never fires")
+
+// macros - сокращенные записи расписаний
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field - допустимый диапазон значений одного поля расписания
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// searchYears - на сколько лет вперед ищется следующее срабатывание.
+// Восьми лет достаточно, чтобы встретить любую дату, включая 29 февраля.
+const searchYears = 8
+
+// Schedule - расписание в формате cron из пяти полей: минута, час, день месяца, месяц, день недели.
+// Поле допускает *, числа, диапазоны a-b, списки через запятую и шаг /n; день недели 0 и 7 - воскресенье.
+// Поддерживаются сокращения @hourly, @daily, @weekly, @monthly и @yearly.
+// Если ограничены и день месяца, и день недели, достаточно совпадения любого из них, как в cron.
+// Как и в cron, поле, начинающееся с * (например, */2), считается неограничивающим.
+type Schedule struct {
+	expr    string
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	weekday uint64
+	// anyDay и anyWeekday - поле начинается с *, то есть не ограничивает дату
+	anyDay     bool
+	anyWeekday bool
+}
+
+// Parse разбирает расписание expr
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	spec := expr
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("schedule %q: expected %d fields, got %d", expr, len(fields), len(parts))
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	s := &Schedule{
+		expr:       expr,
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekday:    sets[4],
+		anyDay:     strings.HasPrefix(parts[2], "*"),
+		anyWeekday: strings.HasPrefix(parts[4], "*"),
+	}
+	// 7 - тоже воскресенье
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1
+	}
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("schedule %q: %w", expr, ErrNeverFires)
+	}
+	return s, nil
+}
+
+// String возвращает исходную запись расписания
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next возвращает первое срабатывание строго после after с точностью до минуты в часовом поясе after.
+// Если срабатываний нет, возвращает нулевое время.
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(searchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(s.months, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(s.hours, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(s.minutes, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Last возвращает последнее срабатывание в интервале (since, until] и true,
+// или false, если в интервале срабатываний нет. Срабатывание ищется назад от until,
+// поэтому время не зависит от длины интервала.
+func (s *Schedule) Last(since, until time.Time) (time.Time, bool) {
+	last := s.prev(until.Truncate(time.Minute).Add(time.Minute))
+	if last.IsZero() || !last.After(since) {
+		return time.Time{}, false
+	}
+	return last, true
+}
+
+// prev возвращает последнее срабатывание строго до before с точностью до минуты в часовом поясе before.
+// Если срабатываний нет, возвращает нулевое время.
+func (s *Schedule) prev(before time.Time) time.Time {
+	t := before.Truncate(time.Minute)
+	if !t.Before(before) {
+		t = t.Add(-time.Minute)
+	}
+	limit := t.AddDate(-searchYears, 0, 0)
+	for t.After(limit) {
+		switch {
+		case !has(s.months, int(t.Month())):
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !has(s.hours, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !has(s.minutes, t.Minute()):
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay проверяет день месяца и день недели с учетом правила cron для двух ограниченных полей
+func (s *Schedule) matchesDay(t time.Time) bool {
+	day := has(s.days, t.Day())
+	weekday := has(s.weekday, int(t.Weekday()))
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// parseField разбирает одно поле расписания в битовое множество значений
+func parseField(spec string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepSpec)
+			}
+		}
+		low, high := f.min, f.max
+		if rangeSpec != "*" {
+			lowSpec, highSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if low, err = parseValue(lowSpec, f); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseValue(highSpec, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// n/s означает от n до конца диапазона с шагом s
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, rangeSpec)
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+// parseValue разбирает число в пределах поля f
+func parseValue(spec string, f field) (int, error) {
+	value, err := strconv.Atoi(spec)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("%s: value %q out of range %d-%d", f.name, spec, f.min, f.max)
+	}
+	return value, nil
+}
+
+// has проверяет, входит ли value в множество set
+func has(set uint64, value int) bool {
+	return set&(1<<value) != 0
+}
@@ -0,0 +1,119 @@
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// -----------
+// Тесты Parse
+// -----------
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@fortnightly",
+		"0 0 31 2 *",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+	_, err := Parse("0 0 30 2 *")
+	assert.ErrorIs(t, err, ErrNeverFires)
+}
+
+// ----------
+// Тесты Next
+// ----------
+func TestNext(t *testing.T) {
+	after := time.Date(2025, 2, 14, 10, 30, 15, 0, time.UTC) // пятница
+	for expr, expected := range map[string]time.Time{
+		"* * * * *":       time.Date(2025, 2, 14, 10, 31, 0, 0, time.UTC),
+		"@hourly":         time.Date(2025, 2, 14, 11, 0, 0, 0, time.UTC),
+		"@daily":          time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC),
+		"@weekly":         time.Date(2025, 2, 16, 0, 0, 0, 0, time.UTC),
+		"@monthly":        time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		"@yearly":         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		"*/15 9-17 * * *": time.Date(2025, 2, 14, 10, 45, 0, 0, time.UTC),
+		"0 9 * * 1-5":     time.Date(2025, 2, 17, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":       time.Date(2025, 2, 16, 0, 0, 0, 0, time.UTC),
+		"0 12 1,15 * *":   time.Date(2025, 2, 15, 12, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		// день месяца или понедельник
+		"0 0 20 * 1":    time.Date(2025, 2, 17, 0, 0, 0, 0, time.UTC),
+		"30 10/6 * * *": time.Date(2025, 2, 14, 16, 30, 0, 0, time.UTC),
+		// поле, начинающееся с *, не ограничивает дату: нечетный день и понедельник, 13 число и Вс/Ср/Сб
+		"0 0 */2 * 1":  time.Date(2025, 2, 17, 0, 0, 0, 0, time.UTC),
+		"0 0 13 * */3": time.Date(2025, 4, 13, 0, 0, 0, 0, time.UTC),
+	} {
+		s, err := Parse(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected, s.Next(after), expr)
+	}
+}
+
+// ----------
+// Тесты Last
+// ----------
+func TestLast(t *testing.T) {
+	s, err := Parse("@monthly")
+	require.NoError(t, err)
+	since := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	last, ok := s.Last(since, time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), last)
+
+	last, ok = s.Last(since, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), last)
+
+	_, ok = s.Last(since, time.Date(2025, 1, 31, 23, 59, 0, 0, time.UTC))
+	assert.False(t, ok)
+}
+
+func TestLastMatchesNext(t *testing.T) {
+	since := time.Date(2025, 2, 14, 10, 30, 15, 0, time.UTC)
+	for _, expr := range []string{
+		"* * * * *", "@hourly", "@weekly", "*/15 9-17 * * *", "0 9 * * 1-5", "0 0 20 * 1", "0 0 */2 * 1",
+		"0 0 29 2 *", "30 10/6 * * *",
+	} {
+		s, err := Parse(expr)
+		require.NoError(t, err, expr)
+		// Last совпадает с последним срабатыванием, найденным перебором вперед
+		until := since.AddDate(0, 3, 0)
+		expected, ok := time.Time{}, false
+		for next := s.Next(since); !next.IsZero() && !next.After(until); next = s.Next(next) {
+			expected, ok = next, true
+		}
+		last, found := s.Last(since, until)
+		assert.Equal(t, ok, found, expr)
+		assert.Equal(t, expected, last, expr)
+		// until точно в момент срабатывания входит в интервал
+		if found {
+			last, _ = s.Last(since, expected)
+			assert.Equal(t, expected, last, expr)
+		}
+	}
+}
+
+func TestLastLongInterval(t *testing.T) {
+	s, err := Parse("* * * * *")
+	require.NoError(t, err)
+	until := time.Date(2025, 2, 14, 10, 30, 15, 0, time.UTC)
+
+	// Пропущенные за столетие срабатывания не перебираются
+	last, ok := s.Last(until.AddDate(-100, 0, 0), until)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, 2, 14, 10, 30, 0, 0, time.UTC), last)
+}
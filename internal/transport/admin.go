@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxAdjustmentUsers - наибольшее число пользователей в одной операции начисления или списания
+	maxAdjustmentUsers = 1000
+	// maxReasonLength - наибольшая длина причины операции в символах
+	maxReasonLength = 255
+	// maxCampaignNameLength - наибольшая длина названия кампании начислений в символах
+	maxCampaignNameLength = 64
+)
+
+// RequireAdmin это middleware, который пропускает к next только администраторов.
+// Должен выполняться после Authenticate, так как берет идентификатор пользователя из контекста.
+// Если пользователь не администратор, возвращает ошибку 403 (Forbidden).
+func RequireAdmin(next http.HandlerFunc, isAdminFunc func(int) (bool, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAdmin, err := isAdminFunc(r.Context().Value("userID").(int))
+		if err != nil {
+			internalServerErrorResponse(w)
+			return
+		}
+		if !isAdmin {
+			forbiddenResponse(w)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminChecker возвращает функцию проверки прав администратора: администратором считается
+// пользователь с ролью admin в хранилище или указанный в adminUsers
+func adminChecker(store repository.Store, adminUsers []string) func(int) (bool, error) {
+	return func(userID int) (bool, error) {
+		user, err := store.GetUser(userID)
+		if err != nil {
+			return false, err
+		}
+		return user.Role == models.RoleAdmin || slices.Contains(adminUsers, user.Username), nil
+	}
+}
+
+// AdjustBalances обрабатывает начисление (kind = mint) или списание (kind = clawback) монет администратором.
+// Ожидает POST-запрос с JSON-телом {"users": ["alice", "bob"], "amount": 100, "reason": "..."}.
+// Операция выполняется атомарно для всех перечисленных пользователей.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно, список пользователей пуст или слишком велик, сумма не положительна или больше limit,
+// причина пуста или длиннее maxReasonLength символов, а также если операция не удалась,
+// возвращает ошибку 400 (Bad Request). В случае успеха возвращает статус 200 (OK).
+func AdjustBalances(w http.ResponseWriter, r *http.Request, kind string, limit int,
+	adjustFunc func(int, string, []string, int, string) error) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var adjustment models.AdjustmentRequest
+	if err = json.Unmarshal(body, &adjustment); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	adjustment.Reason = strings.TrimSpace(adjustment.Reason)
+	if len(adjustment.Users) == 0 || len(adjustment.Users) > maxAdjustmentUsers ||
+		adjustment.Amount <= 0 || adjustment.Amount > limit ||
+		adjustment.Reason == "" || utf8.RuneCountInString(adjustment.Reason) > maxReasonLength {
+		badRequestResponse(w)
+		return
+	}
+	err = adjustFunc(r.Context().Value("userID").(int), kind, adjustment.Users, adjustment.Amount, adjustment.Reason)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// CreateGrantCampaign обрабатывает создание кампании начислений администратором.
+// Ожидает POST-запрос с JSON-телом {"name": "...", "amount": 200, "startsAt": "...", "endsAt": "..."},
+// даты в формате RFC 3339. Пользователи, уже зарегистрированные в период кампании, получают монеты сразу,
+// зарегистрировавшиеся позже - при регистрации.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно, название пусто или длиннее maxCampaignNameLength символов, сумма не положительна
+// или больше limit, период пуст, а также если кампанию создать не удалось, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает созданную кампанию в формате JSON со статусом 200 (OK).
+func CreateGrantCampaign(w http.ResponseWriter, r *http.Request, limit int,
+	createFunc func(int, models.GrantCampaign) (models.GrantCampaign, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var campaign models.GrantCampaign
+	if err = json.Unmarshal(body, &campaign); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	if campaign.Name == "" || utf8.RuneCountInString(campaign.Name) > maxCampaignNameLength ||
+		campaign.Amount <= 0 || campaign.Amount > limit ||
+		!campaign.StartsAt.Before(campaign.EndsAt) {
+		badRequestResponse(w)
+		return
+	}
+	campaign.ID, campaign.Granted = 0, 0
+	campaign.StartsAt, campaign.EndsAt = campaign.StartsAt.UTC(), campaign.EndsAt.UTC()
+	created, err := createFunc(r.Context().Value("userID").(int), campaign)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, created)
+}
+
+// GetGrantCampaigns обрабатывает GET-запрос списка кампаний начислений от новых к старым.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// В случае успеха возвращает кампании в формате JSON со статусом 200 (OK).
+func GetGrantCampaigns(w http.ResponseWriter, r *http.Request, campaignsFunc func() ([]models.GrantCampaign, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	campaigns, err := campaignsFunc()
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.GrantCampaignsResponse{Campaigns: campaigns})
+}
+
+// forbiddenResponse генерирует ответ об отсутствии прав.
+// Отправляет статус 403 (Forbidden) с общей ошибкой в формате JSON.
+func forbiddenResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Errors: "Недостаточно прав."})
+}
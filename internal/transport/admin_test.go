@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ------------------
+// Тесты RequireAdmin
+// ------------------
+func TestRequireAdmin(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	isAdmin := func(userID int) (bool, error) {
+		if userID == 3 {
+			return false, errors.New("db error")
+		}
+		return userID == 1, nil
+	}
+
+	for userID, expected := range map[int]int{1: http.StatusOK, 2: http.StatusForbidden, 3: http.StatusInternalServerError} {
+		req := httptest.NewRequest("POST", "/api/admin/mint", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", userID))
+		rr := httptest.NewRecorder()
+
+		RequireAdmin(next, isAdmin)(rr, req)
+		assert.Equal(t, expected, rr.Code, "userID %d", userID)
+	}
+}
+
+// --------------------
+// Тесты AdjustBalances
+// --------------------
+func TestAdjustBalancesSuccess(t *testing.T) {
+	var received models.AdjustmentRequest
+	var receivedKind string
+	mockAdjustFunc := func(adminID int, kind string, users []string, amount int, reason string) error {
+		receivedKind = kind
+		received = models.AdjustmentRequest{Users: users, Amount: amount, Reason: reason}
+		return nil
+	}
+
+	reqBody := `{"users": ["alice", "bob"], "amount": 200, "reason": "  onboarding bonus "}`
+	req := httptest.NewRequest("POST", "/api/admin/mint", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	AdjustBalances(rr, req, models.TransactionMint, 1000, mockAdjustFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.TransactionMint, receivedKind)
+	assert.Equal(t, models.AdjustmentRequest{Users: []string{"alice", "bob"}, Amount: 200, Reason: "onboarding bonus"}, received)
+}
+
+func TestAdjustBalancesInvalidBody(t *testing.T) {
+	for _, reqBody := range []string{
+		`not json`,
+		`{"users": [], "amount": 10, "reason": "bonus"}`,
+		`{"users": ["alice"], "amount": 0, "reason": "bonus"}`,
+		`{"users": ["alice"], "amount": 1001, "reason": "bonus"}`,
+		`{"users": ["alice"], "amount": 10, "reason": "  "}`,
+		`{"users": ["alice"], "amount": 10, "reason": "` + strings.Repeat("я", maxReasonLength+1) + `"}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/admin/mint", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		AdjustBalances(rr, req, models.TransactionMint, 1000, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reqBody)
+	}
+}
+
+func TestAdjustBalancesFailed(t *testing.T) {
+	mockAdjustFunc := func(int, string, []string, int, string) error {
+		return errors.New("insufficient funds")
+	}
+
+	reqBody := `{"users": ["alice"], "amount": 500, "reason": "mistake"}`
+	req := httptest.NewRequest("POST", "/api/admin/clawback", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	AdjustBalances(rr, req, models.TransactionClawback, 1000, mockAdjustFunc)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestAdjustBalancesInvalidMethod(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/admin/mint", nil)
+	rr := httptest.NewRecorder()
+
+	AdjustBalances(rr, req, models.TransactionMint, 1000, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// -------------------------
+// Тесты CreateGrantCampaign
+// -------------------------
+func TestCreateGrantCampaignSuccess(t *testing.T) {
+	var received models.GrantCampaign
+	mockCreateFunc := func(adminID int, campaign models.GrantCampaign) (models.GrantCampaign, error) {
+		received = campaign
+		campaign.ID, campaign.Granted = 1, 5
+		return campaign, nil
+	}
+
+	reqBody := `{"name": " onboarding week ", "amount": 200,
+		"startsAt": "2025-02-03T03:00:00+03:00", "endsAt": "2025-02-10T00:00:00Z", "granted": 100}`
+	req := httptest.NewRequest("POST", "/api/admin/campaigns", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	CreateGrantCampaign(rr, req, 1000, mockCreateFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	start := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, models.GrantCampaign{
+		Name: "onboarding week", Amount: 200, StartsAt: start, EndsAt: start.AddDate(0, 0, 7),
+	}, received)
+
+	var created models.GrantCampaign
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, 1, created.ID)
+	assert.Equal(t, 5, created.Granted)
+}
+
+func TestCreateGrantCampaignInvalidBody(t *testing.T) {
+	for _, reqBody := range []string{
+		`not json`,
+		`{"name": " ", "amount": 200, "startsAt": "2025-02-03T00:00:00Z", "endsAt": "2025-02-10T00:00:00Z"}`,
+		`{"name": "week", "amount": 0, "startsAt": "2025-02-03T00:00:00Z", "endsAt": "2025-02-10T00:00:00Z"}`,
+		`{"name": "week", "amount": 1001, "startsAt": "2025-02-03T00:00:00Z", "endsAt": "2025-02-10T00:00:00Z"}`,
+		`{"name": "week", "amount": 200, "startsAt": "2025-02-10T00:00:00Z", "endsAt": "2025-02-03T00:00:00Z"}`,
+		`{"name": "week", "amount": 200}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/admin/campaigns", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		CreateGrantCampaign(rr, req, 1000, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reqBody)
+	}
+}
+
+// -----------------------
+// Тесты GetGrantCampaigns
+// -----------------------
+func TestGetGrantCampaigns(t *testing.T) {
+	mockCampaignsFunc := func() ([]models.GrantCampaign, error) {
+		return []models.GrantCampaign{{ID: 1, Name: "onboarding week", Amount: 200, Granted: 5}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/campaigns", nil)
+	rr := httptest.NewRecorder()
+
+	GetGrantCampaigns(rr, req, mockCampaignsFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response models.GrantCampaignsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Campaigns, 1)
+	assert.Equal(t, "onboarding week", response.Campaigns[0].Name)
+}
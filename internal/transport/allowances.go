@@ -0,0 +1,235 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"avito_internship/internal/schedule"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxRuleNameLength - наибольшая длина названия правила начислений в символах
+	maxRuleNameLength = 64
+	// previewRuns - сколько ближайших запусков показывает пробный запуск правила
+	previewRuns = 5
+	// defaultRunsLimit и maxRunsLimit - размер списка запусков правила по умолчанию и наибольший
+	defaultRunsLimit = 50
+	maxRunsLimit     = 100
+)
+
+var errInvalidRule = errors.New("invalid allowance rule")
+
+// GetAllowanceRules обрабатывает GET-запрос списка правил регулярных начислений от новых к старым.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// В случае успеха возвращает правила в формате JSON со статусом 200 (OK).
+func GetAllowanceRules(w http.ResponseWriter, r *http.Request, rulesFunc func() ([]models.AllowanceRule, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	rules, err := rulesFunc()
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.AllowanceRulesResponse{Rules: rules})
+}
+
+// CreateAllowanceRule обрабатывает создание правила регулярных начислений администратором.
+// Ожидает POST-запрос с JSON-телом {"name": "...", "amount": 100, "schedule": "@monthly", "role": "user"},
+// роль необязательна (по умолчанию все пользователи), "paused": true создает правило на паузе.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно или правило создать не удалось, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает созданное правило в формате JSON со статусом 200 (OK).
+func CreateAllowanceRule(w http.ResponseWriter, r *http.Request, limit int,
+	createFunc func(int, models.AllowanceRule) (models.AllowanceRule, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	rule, err := readAllowanceRule(r, limit)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	created, err := createFunc(r.Context().Value("userID").(int), rule)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, created)
+}
+
+// UpdateAllowanceRule обрабатывает PUT-запрос /api/admin/allowances/{id} с тем же телом, что и при создании.
+// Если метод запроса не PUT, возвращает ошибку 405 (Method Not Allowed).
+// Если правила нет, возвращает ошибку 404 (Not Found).
+// Если идентификатор или тело некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает измененное правило в формате JSON со статусом 200 (OK).
+func UpdateAllowanceRule(w http.ResponseWriter, r *http.Request, limit int,
+	updateFunc func(models.AllowanceRule) (models.AllowanceRule, error)) {
+	if r.Method != http.MethodPut {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	ruleID, err := parseRuleID(r.URL.Path, "")
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	rule, err := readAllowanceRule(r, limit)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	rule.ID = ruleID
+	updated, err := updateFunc(rule)
+	if errors.Is(err, repository.ErrRuleNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+// DeleteAllowanceRule обрабатывает DELETE-запрос /api/admin/allowances/{id}.
+// История запусков удаленного правила сохраняется.
+// Если метод запроса не DELETE, возвращает ошибку 405 (Method Not Allowed).
+// Если правила нет, возвращает ошибку 404 (Not Found), при некорректном идентификаторе - 400 (Bad Request).
+// В случае успеха возвращает статус 200 (OK).
+func DeleteAllowanceRule(w http.ResponseWriter, r *http.Request, deleteFunc func(int) error) {
+	if r.Method != http.MethodDelete {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	ruleID, err := parseRuleID(r.URL.Path, "")
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	err = deleteFunc(ruleID)
+	if errors.Is(err, repository.ErrRuleNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetAllowanceRuns обрабатывает GET-запрос /api/admin/allowances/{id}/runs - запуски правила от новых к старым.
+// Поддерживает параметр limit (по умолчанию 50, не больше 100).
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если идентификатор или limit некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает запуски в формате JSON со статусом 200 (OK).
+func GetAllowanceRuns(w http.ResponseWriter, r *http.Request, runsFunc func(int, int) ([]models.AllowanceRun, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	ruleID, err := parseRuleID(r.URL.Path, "/runs")
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	limit, err := parsePositiveParameter(r.URL.Query(), "limit", defaultRunsLimit)
+	if err != nil || limit > maxRunsLimit {
+		badRequestResponse(w)
+		return
+	}
+	runs, err := runsFunc(ruleID, limit)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.AllowanceRunsResponse{Runs: runs})
+}
+
+// PreviewAllowanceRule обрабатывает пробный запуск правила: ничего не начисляет, а показывает
+// ближайшие previewRuns запусков по расписанию, число пользователей, которые получат монеты сейчас,
+// и общую сумму одного запуска. Ожидает POST-запрос с тем же телом, что и при создании правила.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает результат в формате JSON со статусом 200 (OK).
+func PreviewAllowanceRule(w http.ResponseWriter, r *http.Request, limit int, now func() time.Time,
+	countFunc func(string) (int, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	rule, err := readAllowanceRule(r, limit)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	users, err := countFunc(rule.Role)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	s, _ := schedule.Parse(rule.Schedule)
+	preview := models.AllowancePreview{Users: users, Total: users * rule.Amount}
+	for next := now().UTC(); len(preview.NextRuns) < previewRuns; {
+		next = s.Next(next)
+		preview.NextRuns = append(preview.NextRuns, next)
+	}
+	jsonResponse(w, http.StatusOK, preview)
+}
+
+// readAllowanceRule читает правило из тела запроса и проверяет его: название непустое и не длиннее
+// maxRuleNameLength символов, сумма положительна и не больше limit, расписание разбирается,
+// роль пустая (все пользователи), user или admin
+func readAllowanceRule(r *http.Request, limit int) (models.AllowanceRule, error) {
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return models.AllowanceRule{}, err
+	}
+	var request models.AllowanceRule
+	if err = json.Unmarshal(body, &request); err != nil {
+		return models.AllowanceRule{}, err
+	}
+	rule := models.AllowanceRule{
+		Name:     strings.TrimSpace(request.Name),
+		Amount:   request.Amount,
+		Schedule: strings.TrimSpace(request.Schedule),
+		Role:     request.Role,
+		Paused:   request.Paused,
+	}
+	if rule.Name == "" || utf8.RuneCountInString(rule.Name) > maxRuleNameLength ||
+		rule.Amount <= 0 || rule.Amount > limit ||
+		(rule.Role != "" && rule.Role != models.RoleUser && rule.Role != models.RoleAdmin) {
+		return models.AllowanceRule{}, errInvalidRule
+	}
+	if _, err = schedule.Parse(rule.Schedule); err != nil {
+		return models.AllowanceRule{}, err
+	}
+	return rule, nil
+}
+
+// parseRuleID извлекает идентификатор правила из пути /api/admin/allowances/{id}{suffix}
+func parseRuleID(path, suffix string) (int, error) {
+	value, ok := strings.CutPrefix(path, "/api/admin/allowances/")
+	if !ok {
+		return 0, errInvalidRule
+	}
+	if value, ok = strings.CutSuffix(value, suffix); !ok {
+		return 0, errInvalidRule
+	}
+	ruleID, err := strconv.Atoi(value)
+	if err != nil || ruleID <= 0 {
+		return 0, errInvalidRule
+	}
+	return ruleID, nil
+}
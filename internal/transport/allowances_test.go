@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// -------------------------
+// Тесты CreateAllowanceRule
+// -------------------------
+func TestCreateAllowanceRuleSuccess(t *testing.T) {
+	var received models.AllowanceRule
+	createFunc := func(adminID int, rule models.AllowanceRule) (models.AllowanceRule, error) {
+		assert.Equal(t, 1, adminID)
+		received = rule
+		rule.ID = 3
+		return rule, nil
+	}
+
+	reqBody := `{"name": " monthly ", "amount": 100, "schedule": "0 9 1 * *", "role": "user", "paused": true}`
+	req := httptest.NewRequest("POST", "/api/admin/allowances", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	CreateAllowanceRule(rr, req, 1000, createFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.AllowanceRule{
+		Name: "monthly", Amount: 100, Schedule: "0 9 1 * *", Role: models.RoleUser, Paused: true,
+	}, received)
+	var created models.AllowanceRule
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, 3, created.ID)
+}
+
+func TestCreateAllowanceRuleInvalidBody(t *testing.T) {
+	for _, reqBody := range []string{
+		`not json`,
+		`{"name": " ", "amount": 100, "schedule": "@monthly"}`,
+		`{"name": "` + strings.Repeat("я", maxRuleNameLength+1) + `", "amount": 100, "schedule": "@monthly"}`,
+		`{"name": "monthly", "amount": 0, "schedule": "@monthly"}`,
+		`{"name": "monthly", "amount": 1001, "schedule": "@monthly"}`,
+		`{"name": "monthly", "amount": 100, "schedule": "0 9 31 2 *"}`,
+		`{"name": "monthly", "amount": 100, "schedule": "every month"}`,
+		`{"name": "monthly", "amount": 100, "schedule": "@monthly", "role": "boss"}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/admin/allowances", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		CreateAllowanceRule(rr, req, 1000, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reqBody)
+	}
+}
+
+// -----------------------------------------------
+// Тесты UpdateAllowanceRule и DeleteAllowanceRule
+// -----------------------------------------------
+func TestUpdateAllowanceRule(t *testing.T) {
+	updateFunc := func(rule models.AllowanceRule) (models.AllowanceRule, error) {
+		if rule.ID != 3 {
+			return models.AllowanceRule{}, repository.ErrRuleNotFound
+		}
+		return rule, nil
+	}
+	reqBody := `{"name": "monthly", "amount": 150, "schedule": "@monthly"}`
+
+	for path, expected := range map[string]int{
+		"/api/admin/allowances/3":   http.StatusOK,
+		"/api/admin/allowances/9":   http.StatusNotFound,
+		"/api/admin/allowances/abc": http.StatusBadRequest,
+		"/api/admin/allowances/0":   http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("PUT", path, strings.NewReader(reqBody))
+		rr := httptest.NewRecorder()
+
+		UpdateAllowanceRule(rr, req, 1000, updateFunc)
+		assert.Equal(t, expected, rr.Code, path)
+	}
+}
+
+func TestDeleteAllowanceRule(t *testing.T) {
+	deleteFunc := func(ruleID int) error {
+		if ruleID != 3 {
+			return repository.ErrRuleNotFound
+		}
+		return nil
+	}
+
+	for path, expected := range map[string]int{
+		"/api/admin/allowances/3":   http.StatusOK,
+		"/api/admin/allowances/9":   http.StatusNotFound,
+		"/api/admin/allowances/3/x": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("DELETE", path, nil)
+		rr := httptest.NewRecorder()
+
+		DeleteAllowanceRule(rr, req, deleteFunc)
+		assert.Equal(t, expected, rr.Code, path)
+	}
+}
+
+// ----------------------
+// Тесты GetAllowanceRuns
+// ----------------------
+func TestGetAllowanceRuns(t *testing.T) {
+	var receivedLimit int
+	runsFunc := func(ruleID, limit int) ([]models.AllowanceRun, error) {
+		receivedLimit = limit
+		return []models.AllowanceRun{{ID: 1, RuleID: ruleID, Users: 2, Total: 200}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/allowances/3/runs", nil)
+	rr := httptest.NewRecorder()
+	GetAllowanceRuns(rr, req, runsFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, defaultRunsLimit, receivedLimit)
+	var response models.AllowanceRunsResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, []models.AllowanceRun{{ID: 1, RuleID: 3, Users: 2, Total: 200}}, response.Runs)
+
+	for _, target := range []string{
+		"/api/admin/allowances/3/runs?limit=101",
+		"/api/admin/allowances/3/runs?limit=0",
+		"/api/admin/allowances/x/runs",
+	} {
+		req = httptest.NewRequest("GET", target, nil)
+		rr = httptest.NewRecorder()
+		GetAllowanceRuns(rr, req, runsFunc)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+	}
+}
+
+// --------------------------
+// Тесты PreviewAllowanceRule
+// --------------------------
+func TestPreviewAllowanceRule(t *testing.T) {
+	now := func() time.Time { return time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC) }
+	countFunc := func(role string) (int, error) {
+		assert.Equal(t, models.RoleAdmin, role)
+		return 3, nil
+	}
+
+	reqBody := `{"name": "monthly", "amount": 100, "schedule": "0 9 1 * *", "role": "admin"}`
+	req := httptest.NewRequest("POST", "/api/admin/allowances/preview", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+
+	PreviewAllowanceRule(rr, req, 1000, now, countFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var preview models.AllowancePreview
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&preview))
+	assert.Equal(t, 3, preview.Users)
+	assert.Equal(t, 300, preview.Total)
+	require.Len(t, preview.NextRuns, previewRuns)
+	for i, next := range preview.NextRuns {
+		assert.Equal(t, time.Date(2025, time.Month(2+i), 1, 9, 0, 0, 0, time.UTC), next.UTC())
+	}
+}
+
+func TestPreviewAllowanceRuleInvalidMethod(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/admin/allowances/preview", nil)
+	rr := httptest.NewRecorder()
+
+	PreviewAllowanceRule(rr, req, 1000, time.Now, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"unicode/utf8"
+)
+
+// maxBatchTransfers - наибольшее число строк в одном пакетном переводе
+const maxBatchTransfers = 100
+
+// BatchTransferCoins обрабатывает пакетный перевод нескольким получателям, например выплату команде.
+// Ожидает POST-запрос с JSON-телом {"transfers": [{"toUser": "bob", "amount": 100, "message": "...",
+// "category": "..."}, ...]}. Все переводы выполняются атомарно: либо все, либо ни одного.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно, пакет пуст или содержит больше maxBatchTransfers строк, сумма больше
+// repository.MaxAmount, сообщение длиннее maxMessageLength символов или категория неизвестна,
+// возвращает ошибку 400 (Bad Request).
+// Если какие-то строки некорректны (получатель не найден, перевод себе, неположительная сумма,
+// повтор получателя), возвращает результаты по строкам с причинами отклонения и статусом 400 (Bad Request).
+// Если баланса не хватает на весь пакет, возвращает ошибку 400 (Bad Request).
+// Если пакет превышает лимит трат, возвращает ошибку 422 (Unprocessable Entity) с остатком лимита.
+// В случае успеха возвращает сумму пакета и результаты по строкам со статусом 200 (OK).
+func BatchTransferCoins(w http.ResponseWriter, r *http.Request,
+	batchFunc func(int, []models.BatchTransferLine) ([]models.BatchTransferResult, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var batch models.BatchTransferRequest
+	if err = json.Unmarshal(body, &batch); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if len(batch.Transfers) == 0 || len(batch.Transfers) > maxBatchTransfers {
+		badRequestResponse(w)
+		return
+	}
+	total := 0
+	for i := range batch.Transfers {
+		line := &batch.Transfers[i]
+		line.Message = sanitizeMessage(line.Message)
+		if line.Amount > repository.MaxAmount || utf8.RuneCountInString(line.Message) > maxMessageLength ||
+			!repository.ValidCategory(line.Category) {
+			badRequestResponse(w)
+			return
+		}
+		total += line.Amount
+	}
+
+	results, err := batchFunc(r.Context().Value("userID").(int), batch.Transfers)
+	switch {
+	case errors.Is(err, repository.ErrBatchRejected):
+		jsonResponse(w, http.StatusBadRequest, models.BatchTransferResponse{
+			Total:   total,
+			Results: results,
+			Errors:  "Пакет содержит некорректные переводы.",
+		})
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		jsonResponse(w, http.StatusBadRequest, models.ErrorResponse{Errors: "Недостаточно средств для всего пакета."})
+	case err != nil:
+		spendingErrorResponse(w, err)
+	default:
+		jsonResponse(w, http.StatusOK, models.BatchTransferResponse{Total: total, Results: results})
+	}
+}
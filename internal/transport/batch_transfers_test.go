@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ------------------------
+// Тесты BatchTransferCoins
+// ------------------------
+func TestBatchTransferCoins(t *testing.T) {
+	batchFunc := func(userID int, lines []models.BatchTransferLine) ([]models.BatchTransferResult, error) {
+		assert.Equal(t, 1, userID)
+		assert.Equal(t, []models.BatchTransferLine{
+			{ToUser: "bob", Amount: 100, Message: "премия за квартал", Category: models.CategoryGift},
+			{ToUser: "carol", Amount: 50},
+		}, lines)
+		return []models.BatchTransferResult{
+			{Line: 1, ToUser: "bob", Amount: 100, Status: models.BatchLineTransferred, TransactionID: 7},
+			{Line: 2, ToUser: "carol", Amount: 50, Status: models.BatchLineTransferred, TransactionID: 8},
+		}, nil
+	}
+	reqBody := `{"transfers": [{"toUser": "bob", "amount": 100, "message": " премия\tза  квартал ", "category": "gift"},
+		{"toUser": "carol", "amount": 50}]}`
+	req := httptest.NewRequest("POST", "/api/sendCoin/batch", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	BatchTransferCoins(rr, req, batchFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response models.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, 150, response.Total)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, 8, response.Results[1].TransactionID)
+}
+
+func TestBatchTransferCoinsRejected(t *testing.T) {
+	batchFunc := func(int, []models.BatchTransferLine) ([]models.BatchTransferResult, error) {
+		return []models.BatchTransferResult{
+			{Line: 1, ToUser: "ghost", Amount: 100, Status: models.BatchLineRejected, Error: models.BatchErrorUserNotFound},
+		}, repository.ErrBatchRejected
+	}
+	req := httptest.NewRequest("POST", "/api/sendCoin/batch", strings.NewReader(`{"transfers": [{"toUser": "ghost", "amount": 100}]}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	BatchTransferCoins(rr, req, batchFunc)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	var response models.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, models.BatchErrorUserNotFound, response.Results[0].Error)
+	assert.NotEmpty(t, response.Errors)
+}
+
+func TestBatchTransferCoinsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{repository.ErrInsufficientFunds, http.StatusBadRequest},
+		{&repository.LimitError{Limit: models.LimitDaily, Remaining: 10}, http.StatusUnprocessableEntity},
+	} {
+		batchFunc := func(int, []models.BatchTransferLine) ([]models.BatchTransferResult, error) {
+			return nil, tc.err
+		}
+		req := httptest.NewRequest("POST", "/api/sendCoin/batch", strings.NewReader(`{"transfers": [{"toUser": "bob", "amount": 100}]}`))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		BatchTransferCoins(rr, req, batchFunc)
+		assert.Equal(t, tc.code, rr.Code, tc.err.Error())
+	}
+}
+
+func TestBatchTransferCoinsInvalidRequest(t *testing.T) {
+	tooMany := `{"transfers": [` + strings.Repeat(`{"toUser": "bob", "amount": 1},`, maxBatchTransfers) +
+		`{"toUser": "bob", "amount": 1}]}`
+	for _, body := range []string{
+		`{"transfers": []}`,
+		`{"transfers": [{"toUser": "bob", "amount": 1, "category": "bribe"}]}`,
+		`{"transfers": [{"toUser": "bob", "amount": 1, "message": "` + strings.Repeat("я", maxMessageLength+1) + `"}]}`,
+		`{"transfers": `,
+		`{"transfers": [{"toUser": "bob", "amount": 4294967301}]}`,
+		tooMany,
+	} {
+		req := httptest.NewRequest("POST", "/api/sendCoin/batch", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		BatchTransferCoins(rr, req, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/sendCoin/batch", nil)
+	rr := httptest.NewRecorder()
+	BatchTransferCoins(rr, req, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -3,14 +3,21 @@ package transport
 import (
 	"avito_internship/internal/auth"
 	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Authenticate это middleware который отвечает за проверку предоставленного jwt токена.
@@ -39,10 +46,16 @@ func Authenticate(next http.Handler, verificationFunc func(string) (int, error))
 // BuyItems обрабатывает покупку предметов пользователем.
 // Ожидает GET-запрос по пути "/api/buy/{item}", где {item} — название предмета.
 // Извлекает идентификатор пользователя из контекста, переданного через middleware Authenticate.
-// Вызывает переданную функцию buyFunc с параметрами: userID, название предмета и количество (1).
-// Если метод запроса не GET или URL не соответствует формату, возвращает ошибку 400 (Bad Request).
-// Если во время покупки произошла ошибка, возвращает ошибку 500 (Internal Server Error).
-func BuyItems(w http.ResponseWriter, r *http.Request, buyFunc func(int, string, int) error) {
+// Вызывает переданную функцию buyFunc с параметрами: userID, название предмета, артикул варианта
+// из необязательного параметра variant (по умолчанию вариант по умолчанию) и количество
+// из необязательного параметра quantity (по умолчанию 1).
+// Если метод запроса не GET, URL не соответствует формату или quantity не положительное целое
+// или больше maxItemQuantity, возвращает ошибку 400 (Bad Request).
+// Если покупка превышает лимит трат, возвращает ошибку 422 (Unprocessable Entity) с остатком лимита.
+// Если товар закончился или исчерпан лимит его покупок на пользователя, возвращает ошибку
+// 409 (Conflict) с доступным количеством.
+// Если во время покупки произошла ошибка, возвращает ошибку 400 (Bad Request).
+func BuyItems(w http.ResponseWriter, r *http.Request, buyFunc func(int, string, string, int) error) {
 	if r.Method != "GET" {
 		invalidRequestMethodResponse(w, r)
 		return
@@ -54,20 +67,37 @@ func BuyItems(w http.ResponseWriter, r *http.Request, buyFunc func(int, string,
 		return
 	}
 	item := parts[3]
-	err := buyFunc(r.Context().Value("userID").(int), item, 1)
-	if err != nil {
+	quantity, err := parsePositiveParameter(r.URL.Query(), "quantity", 1)
+	if err != nil || quantity > maxItemQuantity {
 		badRequestResponse(w)
 		return
 	}
+	err = buyFunc(r.Context().Value("userID").(int), item, r.URL.Query().Get("variant"), quantity)
+	if err != nil {
+		purchaseErrorResponse(w, err)
+		return
+	}
 }
 
+// maxMessageLength - наибольшая длина сообщения к переводу в символах
+const maxMessageLength = 200
+
 // TransferCoins осуществляет перевод от одного пользователя к другому.
-// Ожидает POST-запрос с JSON-данными, содержащими сумму перевода и ID получателя.
+// Ожидает POST-запрос с JSON-данными, содержащими сумму перевода, ID получателя и необязательные
+// сообщение, категорию (thanks, reimbursement или gift) и задержку delayMinutes.
 // Если метод запроса не POST, возвращает ошибку 400 (Bad Request).
 // Если тело запроса не удалось прочитать или распарсить, возвращает ошибку 400 (Bad Request).
+// Сообщение очищается от управляющих символов и лишних пробелов. Если после этого оно длиннее
+// maxMessageLength символов или категория неизвестна, возвращает ошибку 400 (Bad Request).
+// Если задержка отрицательна или больше maxDelay, возвращает ошибку 400 (Bad Request).
 // Извлекает ID отправителя из контекста, переданного middleware Authenticate.
-// Если перевод успешен, возвращает статус 200 (OK), иначе 400 (Bad Request).
-func TransferCoins(w http.ResponseWriter, r *http.Request, transferFunc func(int, int, string) error) {
+// Если перевод превышает лимит трат, возвращает ошибку 422 (Unprocessable Entity) с остатком лимита.
+// Перевод без задержки выполняется сразу, в случае успеха возвращает статус 200 (OK), иначе 400 (Bad Request).
+// Перевод с задержкой резервируется у отправителя через holdFunc, в случае успеха возвращает
+// отложенный перевод в формате JSON со статусом 202 (Accepted).
+func TransferCoins(w http.ResponseWriter, r *http.Request, maxDelay time.Duration,
+	transferFunc func(int, int, string, models.TransferNote) error,
+	holdFunc func(int, int, string, models.TransferNote, time.Duration) (models.PendingTransfer, error)) {
 	if r.Method != http.MethodPost {
 		invalidRequestMethodResponse(w, r)
 		return
@@ -84,14 +114,99 @@ func TransferCoins(w http.ResponseWriter, r *http.Request, transferFunc func(int
 		badRequestResponse(w)
 		return
 	}
-	err = transferFunc(r.Context().Value("userID").(int), transferData.Amount, transferData.ToUser)
-	if err != nil {
+	note := models.TransferNote{Message: sanitizeMessage(transferData.Message), Category: transferData.Category}
+	if transferData.Amount > repository.MaxAmount ||
+		utf8.RuneCountInString(note.Message) > maxMessageLength || !repository.ValidCategory(note.Category) ||
+		transferData.DelayMinutes < 0 || time.Duration(transferData.DelayMinutes) > maxDelay/time.Minute {
 		badRequestResponse(w)
 		return
 	}
+	userID := r.Context().Value("userID").(int)
+	if delay := time.Duration(transferData.DelayMinutes) * time.Minute; delay > 0 {
+		pending, err := holdFunc(userID, transferData.Amount, transferData.ToUser, note, delay)
+		if err != nil {
+			spendingErrorResponse(w, err)
+			return
+		}
+		jsonResponse(w, http.StatusAccepted, pending)
+		return
+	}
+	err = transferFunc(userID, transferData.Amount, transferData.ToUser, note)
+	if err != nil {
+		spendingErrorResponse(w, err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// sanitizeMessage убирает из сообщения управляющие и невидимые символы форматирования,
+// заменяет переводы строк и табуляцию пробелами и схлопывает повторяющиеся пробелы
+func sanitizeMessage(message string) string {
+	message = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, message)
+	return strings.Join(strings.Fields(message), " ")
+}
+
+// maxOrderLines - наибольшее число позиций в одном заказе
+const maxOrderLines = 100
+
+// maxItemQuantity - наибольшее количество предметов в одной покупке или позиции заказа
+const maxItemQuantity = 10000
+
+// PlaceOrder обрабатывает покупку нескольких предметов одним заказом.
+// Ожидает POST-запрос с JSON-телом {"items": [{"item": "cup", "quantity": 2}, ...]}, у позиции можно указать
+// артикул варианта товара "variant".
+// Все позиции оплачиваются атомарно: если хотя бы одну купить нельзя, не покупается ни одна.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если тело некорректно, заказ пуст, содержит больше maxOrderLines позиций или позицию
+// с неположительным количеством или количеством больше maxItemQuantity, а также если покупка не удалась,
+// возвращает ошибку 400 (Bad Request).
+// Если стоимость заказа превышает лимит трат, возвращает ошибку 422 (Unprocessable Entity) с остатком лимита.
+// Если товара позиции не хватает на складе или в лимите покупок на пользователя, возвращает ошибку
+// 409 (Conflict) с доступным количеством.
+// В случае успеха возвращает идентификатор заказа и его итоговую стоимость со статусом 200 (OK).
+func PlaceOrder(w http.ResponseWriter, r *http.Request,
+	orderFunc func(int, []models.OrderLine) (models.OrderResponse, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var order models.OrderRequest
+	if err = json.Unmarshal(body, &order); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if len(order.Items) == 0 || len(order.Items) > maxOrderLines {
+		badRequestResponse(w)
+		return
+	}
+	for _, line := range order.Items {
+		if line.Item == "" || line.Quantity <= 0 || line.Quantity > maxItemQuantity {
+			badRequestResponse(w)
+			return
+		}
+	}
+	response, err := orderFunc(r.Context().Value("userID").(int), order.Items)
+	if err != nil {
+		purchaseErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
 // GetJWT обрабатывает запрос на аутентификацию пользователей.
 // Ожидает POST-запрос с JSON-данными, содержащими учетные данные пользователя (имя и пароль).
 // Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
@@ -151,6 +266,199 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request, userInfoFunc func(int)
 	json.NewEncoder(w).Encode(info)
 }
 
+// Размер страницы истории по умолчанию и максимально допустимый
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// GetHistory обрабатывает GET-запрос постраничного получения истории переводов пользователя.
+// Поддерживает параметры запроса: direction (sent или received), user (контрагент),
+// from и to (RFC 3339, from включительно, to исключительно), minAmount, maxAmount,
+// limit (по умолчанию 50, не больше 100) и cursor из nextCursor предыдущей страницы.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если параметры некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает страницу истории в формате JSON со статусом 200 (OK).
+func GetHistory(w http.ResponseWriter, r *http.Request,
+	historyFunc func(int, models.HistoryFilter) ([]models.HistoryEntry, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	limit := filter.Limit
+	// запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	filter.Limit++
+	entries, err := historyFunc(r.Context().Value("userID").(int), filter)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+
+	var response models.HistoryResponse
+	response.Entries, response.NextCursor = nextPage(entries, limit, func(entry models.HistoryEntry) int {
+		return entry.ID
+	})
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// GetPurchases обрабатывает GET-запрос постраничного получения истории покупок пользователя.
+// Поддерживает параметры запроса: item (название предмета), from и to (RFC 3339, from включительно,
+// to исключительно), limit (по умолчанию 50, не больше 100) и cursor из nextCursor предыдущей страницы.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если параметры некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает страницу истории покупок в формате JSON со статусом 200 (OK).
+func GetPurchases(w http.ResponseWriter, r *http.Request,
+	purchasesFunc func(int, models.PurchaseFilter) ([]models.PurchaseEntry, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	query := r.URL.Query()
+	var filter models.PurchaseFilter
+	var err error
+	filter.Item = query.Get("item")
+	if filter.From, err = parseTimeParameter(query, "from"); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if filter.To, err = parseTimeParameter(query, "to"); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if filter.BeforeID, filter.Limit, err = parsePage(query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := purchasesFunc(r.Context().Value("userID").(int), filter)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+
+	var response models.PurchasesResponse
+	response.Entries, response.NextCursor = nextPage(entries, limit, func(entry models.PurchaseEntry) int {
+		return entry.ID
+	})
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// parseHistoryFilter разбирает параметры запроса истории переводов
+func parseHistoryFilter(query url.Values) (models.HistoryFilter, error) {
+	var filter models.HistoryFilter
+	var err error
+
+	filter.Direction = query.Get("direction")
+	if filter.Direction != "" && filter.Direction != models.DirectionSent && filter.Direction != models.DirectionReceived {
+		return filter, errInvalidParameter
+	}
+	filter.Counterparty = query.Get("user")
+	if filter.From, err = parseTimeParameter(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParameter(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, err = parsePositiveParameter(query, "minAmount", 0); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parsePositiveParameter(query, "maxAmount", 0); err != nil {
+		return filter, err
+	}
+	if filter.BeforeID, filter.Limit, err = parsePage(query); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parsePage разбирает параметры постраничного чтения: курсор и размер страницы
+func parsePage(query url.Values) (beforeID int, limit int, err error) {
+	if beforeID, err = decodeCursor(query.Get("cursor")); err != nil {
+		return 0, 0, err
+	}
+	if limit, err = parsePositiveParameter(query, "limit", defaultPageLimit); err != nil {
+		return 0, 0, err
+	}
+	if limit > maxPageLimit {
+		return 0, 0, errInvalidParameter
+	}
+	return beforeID, limit, nil
+}
+
+// nextPage обрезает выборку до limit записей и, если записей было больше,
+// возвращает курсор следующей страницы по идентификатору последней оставленной записи
+func nextPage[T any](entries []T, limit int, id func(T) int) ([]T, string) {
+	if len(entries) <= limit {
+		return entries, ""
+	}
+	entries = entries[:limit]
+	return entries, encodeCursor(id(entries[limit-1]))
+}
+
+// errInvalidParameter - ошибка разбора параметра запроса
+var errInvalidParameter = errors.New("invalid query parameter")
+
+// parseTimeParameter разбирает параметр запроса в формате RFC 3339. Пустой параметр дает нулевое время.
+func parseTimeParameter(query url.Values, key string) (time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errInvalidParameter
+	}
+	return parsed.UTC(), nil
+}
+
+// parsePositiveParameter разбирает целый положительный параметр запроса.
+// Если параметр не задан, возвращает fallback.
+func parsePositiveParameter(query url.Values, key string, fallback int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return 0, errInvalidParameter
+	}
+	return parsed, nil
+}
+
+// encodeCursor упаковывает идентификатор последней записи страницы в непрозрачный курсор
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// decodeCursor распаковывает курсор страницы. Пустой курсор означает первую страницу.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidParameter
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err != nil || id <= 0 {
+		return 0, errInvalidParameter
+	}
+	return id, nil
+}
+
+// jsonResponse отправляет ответ с переданным статусом и телом в формате JSON.
+func jsonResponse(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
 // invalidRequestMethodResponse генерирует сообщение об ошибке неверного типа запроса.
 // Отправляет статус 405 (Method Not Allowed) с описанием ошибки в формате JSON.
 func invalidRequestMethodResponse(w http.ResponseWriter, r *http.Request) {
@@ -190,3 +498,28 @@ func internalServerErrorResponse(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusInternalServerError)
 	json.NewEncoder(w).Encode(models.ErrorResponse{Errors: "Внутренняя ошибка сервера."})
 }
+
+// notFoundResponse генерирует ответ об отсутствии запрошенного объекта.
+// Отправляет статус 404 (Not Found) с общей ошибкой в формате JSON.
+func notFoundResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Errors: "Не найдено."})
+}
+
+// spendingErrorResponse отвечает на ошибку перевода или покупки.
+// Превышение лимита трат - статус 422 (Unprocessable Entity) с кодом limit_exceeded, названием лимита
+// и остатком в формате JSON, остальные ошибки - статус 400 (Bad Request).
+func spendingErrorResponse(w http.ResponseWriter, err error) {
+	var limitErr *repository.LimitError
+	if !errors.As(err, &limitErr) {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusUnprocessableEntity, models.LimitErrorResponse{
+		Errors:    "Превышен лимит трат.",
+		Code:      "limit_exceeded",
+		Limit:     limitErr.Limit,
+		Remaining: limitErr.Remaining,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"avito_internship/internal/auth"
 	"avito_internship/internal/models"
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -67,7 +68,7 @@ func TestAuthenticateInvalidToken(t *testing.T) {
 // Тесты BuyItems
 // --------------
 func TestBuyItemsSuccess(t *testing.T) {
-	mockBuyFunc := func(userID int, item string, quantity int) error {
+	mockBuyFunc := func(userID int, item, variant string, quantity int) error {
 		return nil
 	}
 
@@ -79,6 +80,33 @@ func TestBuyItemsSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
 
+func TestBuyItemsQuantity(t *testing.T) {
+	var receivedQuantity int
+	mockBuyFunc := func(userID int, item, variant string, quantity int) error {
+		receivedQuantity = quantity
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/buy/cup?quantity=3", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	BuyItems(rr, req, mockBuyFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 3, receivedQuantity)
+}
+
+func TestBuyItemsInvalidQuantity(t *testing.T) {
+	for _, query := range []string{"quantity=0", "quantity=-1", "quantity=two", "quantity=10001", "quantity=4294967297"} {
+		req := httptest.NewRequest("GET", "/api/buy/cup?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		BuyItems(rr, req, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
 func TestBuyItemsInvalidMethod(t *testing.T) {
 	req := httptest.NewRequest("POST", "/api/buy/t_shirt", nil)
 	rr := httptest.NewRecorder()
@@ -88,7 +116,7 @@ func TestBuyItemsInvalidMethod(t *testing.T) {
 }
 
 func TestBuyItemsInvalidItem(t *testing.T) {
-	mockBuyFunc := func(userID int, item string, quantity int) error {
+	mockBuyFunc := func(userID int, item, variant string, quantity int) error {
 		return errors.New("purchase failed")
 	}
 
@@ -100,11 +128,75 @@ func TestBuyItemsInvalidItem(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+// ----------------
+// Тесты PlaceOrder
+// ----------------
+func TestPlaceOrderSuccess(t *testing.T) {
+	var receivedLines []models.OrderLine
+	mockOrderFunc := func(userID int, lines []models.OrderLine) (models.OrderResponse, error) {
+		receivedLines = lines
+		return models.OrderResponse{OrderID: 7, Total: 140}, nil
+	}
+
+	reqBody := `{"items": [{"item": "cup", "quantity": 2}, {"item": "pen", "quantity": 10}]}`
+	req := httptest.NewRequest("POST", "/api/orders", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	PlaceOrder(rr, req, mockOrderFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []models.OrderLine{{Item: "cup", Quantity: 2}, {Item: "pen", Quantity: 10}}, receivedLines)
+
+	var response models.OrderResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, models.OrderResponse{OrderID: 7, Total: 140}, response)
+}
+
+func TestPlaceOrderInvalidBody(t *testing.T) {
+	for _, reqBody := range []string{
+		`not json`,
+		`{"items": []}`,
+		`{"items": [{"item": "cup", "quantity": 0}]}`,
+		`{"items": [{"item": "", "quantity": 1}]}`,
+		`{"items": [{"item": "cup", "quantity": 10001}]}`,
+		`{"items": [{"item": "cup", "quantity": 4294967297}]}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/orders", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		PlaceOrder(rr, req, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reqBody)
+	}
+}
+
+func TestPlaceOrderFailed(t *testing.T) {
+	mockOrderFunc := func(userID int, lines []models.OrderLine) (models.OrderResponse, error) {
+		return models.OrderResponse{}, errors.New("insufficient funds")
+	}
+
+	reqBody := `{"items": [{"item": "pink-hoody", "quantity": 3}]}`
+	req := httptest.NewRequest("POST", "/api/orders", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	PlaceOrder(rr, req, mockOrderFunc)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestPlaceOrderInvalidMethod(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+	rr := httptest.NewRecorder()
+
+	PlaceOrder(rr, req, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
 // -------------------
 // Тесты TransferCoins
 // -------------------
 func TestTransferCoinsSuccess(t *testing.T) {
-	mockTransferFunc := func(fromID, amount int, toUser string) error {
+	mockTransferFunc := func(fromID, amount int, toUser string, note models.TransferNote) error {
 		return nil
 	}
 
@@ -114,7 +206,7 @@ func TestTransferCoinsSuccess(t *testing.T) {
 	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
 	rr := httptest.NewRecorder()
 
-	TransferCoins(rr, req, mockTransferFunc)
+	TransferCoins(rr, req, 0, mockTransferFunc, nil)
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
 
@@ -122,12 +214,12 @@ func TestTransferCoinsInvalidMethod(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/sendCoin", nil)
 	rr := httptest.NewRecorder()
 
-	TransferCoins(rr, req, nil)
+	TransferCoins(rr, req, 0, nil, nil)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
 
 func TestTransferCoinsFailedTransfer(t *testing.T) {
-	mockTransferFunc := func(fromID, amount int, toUser string) error {
+	mockTransferFunc := func(fromID, amount int, toUser string, note models.TransferNote) error {
 		return errors.New("transfer failed")
 	}
 
@@ -137,10 +229,47 @@ func TestTransferCoinsFailedTransfer(t *testing.T) {
 	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
 	rr := httptest.NewRecorder()
 
-	TransferCoins(rr, req, mockTransferFunc)
+	TransferCoins(rr, req, 0, mockTransferFunc, nil)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+func TestTransferCoinsMessageSanitized(t *testing.T) {
+	var got models.TransferNote
+	mockTransferFunc := func(fromID, amount int, toUser string, note models.TransferNote) error {
+		got = note
+		return nil
+	}
+
+	reqBody := `{"toUser": "user1", "amount": 50, "message": "  спасибо\n\tза\u200b помощь\u0007 ", "category": "thanks"}`
+	req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	TransferCoins(rr, req, 0, mockTransferFunc, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.TransferNote{Message: "спасибо за помощь", Category: models.CategoryThanks}, got)
+}
+
+func TestTransferCoinsInvalidRequest(t *testing.T) {
+	mockTransferFunc := func(fromID, amount int, toUser string, note models.TransferNote) error {
+		t.Fatal("transfer must not be called")
+		return nil
+	}
+
+	for _, reqBody := range []string{
+		`{"toUser": "user1", "amount": 50, "category": "bribe"}`,
+		`{"toUser": "user1", "amount": 50, "message": "` + strings.Repeat("я", maxMessageLength+1) + `"}`,
+		`{"toUser": "user1", "amount": 4294967296}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		TransferCoins(rr, req, 0, mockTransferFunc, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+}
+
 // ------------
 // Тесты GetJWT
 // ------------
@@ -216,3 +345,119 @@ func TestGetUserInfoInvalidMethod(t *testing.T) {
 	GetUserInfo(rr, req, nil)
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
 }
+
+// ----------------
+// Тесты GetHistory
+// ----------------
+func TestGetHistoryPagination(t *testing.T) {
+	var receivedFilter models.HistoryFilter
+	mockHistoryFunc := func(userID int, filter models.HistoryFilter) ([]models.HistoryEntry, error) {
+		receivedFilter = filter
+		return []models.HistoryEntry{{ID: 30}, {ID: 20}, {ID: 10}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/history?limit=2&direction=sent&user=bob&minAmount=5", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetHistory(rr, req, mockHistoryFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 3, receivedFilter.Limit)
+	assert.Equal(t, models.DirectionSent, receivedFilter.Direction)
+	assert.Equal(t, "bob", receivedFilter.Counterparty)
+	assert.Equal(t, 5, receivedFilter.MinAmount)
+
+	var response models.HistoryResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Entries, 2)
+	assert.Equal(t, encodeCursor(20), response.NextCursor)
+}
+
+func TestGetHistoryCursor(t *testing.T) {
+	var receivedFilter models.HistoryFilter
+	mockHistoryFunc := func(userID int, filter models.HistoryFilter) ([]models.HistoryEntry, error) {
+		receivedFilter = filter
+		return []models.HistoryEntry{{ID: 10}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/history?cursor="+encodeCursor(20), nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetHistory(rr, req, mockHistoryFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 20, receivedFilter.BeforeID)
+	assert.Equal(t, defaultPageLimit+1, receivedFilter.Limit)
+
+	var response models.HistoryResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Empty(t, response.NextCursor)
+}
+
+func TestGetHistoryInvalidParameters(t *testing.T) {
+	for _, query := range []string{
+		"direction=sideways",
+		"from=yesterday",
+		"minAmount=-1",
+		"limit=1000",
+		"cursor=not-a-cursor!",
+	} {
+		req := httptest.NewRequest("GET", "/api/history?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		GetHistory(rr, req, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestGetHistoryInvalidMethod(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/history", nil)
+	rr := httptest.NewRecorder()
+
+	GetHistory(rr, req, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// ------------------
+// Тесты GetPurchases
+// ------------------
+func TestGetPurchasesSuccess(t *testing.T) {
+	var receivedFilter models.PurchaseFilter
+	mockPurchasesFunc := func(userID int, filter models.PurchaseFilter) ([]models.PurchaseEntry, error) {
+		receivedFilter = filter
+		return []models.PurchaseEntry{{ID: 5, Item: "cup", Quantity: 1, UnitPrice: 20}, {ID: 3}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/purchases?item=cup&limit=1&from=2025-01-01T00:00:00Z", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetPurchases(rr, req, mockPurchasesFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "cup", receivedFilter.Item)
+	assert.Equal(t, 2, receivedFilter.Limit)
+	assert.Equal(t, 2025, receivedFilter.From.Year())
+
+	var response models.PurchasesResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, []models.PurchaseEntry{{ID: 5, Item: "cup", Quantity: 1, UnitPrice: 20}}, response.Entries)
+	assert.Equal(t, encodeCursor(5), response.NextCursor)
+}
+
+func TestGetPurchasesInvalidParameters(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/purchases?to=tomorrow", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetPurchases(rr, req, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestGetPurchasesInvalidMethod(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/purchases", nil)
+	rr := httptest.NewRecorder()
+
+	GetPurchases(rr, req, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
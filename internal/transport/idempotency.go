@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	// IdempotencyKeyHeader - заголовок, в котором клиент передает ключ идемпотентности
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader выставляется в ответах, взятых из сохраненных
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// errResponseNotStored - обработчик ответил ошибкой, изменения отменяются и ответ не сохраняется
+var errResponseNotStored = errors.New("unsuccessful response is not stored")
+
+// Idempotent добавляет мутирующему обработчику поддержку заголовка Idempotency-Key.
+// handler должен выполнять изменения через переданное ему хранилище: при наличии ключа
+// оно работает в одной транзакции с сохранением ключа, отпечатка запроса и ответа.
+// Без заголовка запрос обрабатывается как обычно.
+// Повтор с тем же ключом и тем же запросом получает сохраненный ответ без повторного выполнения,
+// повтор с другим методом, путем или телом - ошибку 409 (Conflict).
+// Сохраняются только успешные ответы: после ошибки запрос с тем же ключом можно повторить.
+func Idempotent(store repository.Store, handler func(http.ResponseWriter, *http.Request, repository.Store)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			handler(w, r, store)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			badRequestResponse(w)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			badRequestResponse(w)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		buffer := newResponseBuffer()
+		response, replayed, err := store.Idempotent(r.Context().Value("userID").(int), key, requestFingerprint(r, body),
+			func(txStore repository.Store) (models.IdempotentResponse, error) {
+				handler(buffer, r, txStore)
+				if buffer.status < 200 || buffer.status > 299 {
+					return models.IdempotentResponse{}, errResponseNotStored
+				}
+				return models.IdempotentResponse{Status: buffer.status, Body: buffer.body.Bytes()}, nil
+			})
+		switch {
+		case errors.Is(err, errResponseNotStored):
+			buffer.writeTo(w)
+		case errors.Is(err, repository.ErrIdempotencyKeyReused):
+			conflictResponse(w)
+		case err != nil:
+			internalServerErrorResponse(w)
+		default:
+			if replayed {
+				w.Header().Set(IdempotencyReplayedHeader, "true")
+			}
+			if len(response.Body) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			w.WriteHeader(response.Status)
+			w.Write(response.Body)
+		}
+	}
+}
+
+// requestFingerprint вычисляет отпечаток запроса по методу, пути с параметрами и телу
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseBuffer накапливает ответ обработчика, чтобы сохранить его вместе с ключом идемпотентности
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+// writeTo отправляет накопленный ответ клиенту
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// conflictResponse генерирует ответ о повторном использовании ключа идемпотентности.
+// Отправляет статус 409 (Conflict) с описанием ошибки в формате JSON.
+func conflictResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Errors: "Ключ идемпотентности уже использован с другим запросом."})
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"avito_internship/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ----------------
+// Тесты Idempotent
+// ----------------
+func TestIdempotentReplaysResponse(t *testing.T) {
+	store := repository.NewMemory()
+	userID, _, err := store.GetUserIDPassHashOrRegister("alice", "hash", 1000)
+	require.NoError(t, err)
+	calls := 0
+	handler := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		calls++
+		jsonResponse(w, http.StatusOK, map[string]int{"calls": calls})
+	})
+
+	first := serveIdempotent(handler, userID, "key", `{"amount": 1}`)
+	second := serveIdempotent(handler, userID, "key", `{"amount": 1}`)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(IdempotencyReplayedHeader))
+	assert.Empty(t, first.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	conflict := serveIdempotent(handler, userID, "key", `{"amount": 2}`)
+	assert.Equal(t, http.StatusConflict, conflict.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotentDoesNotStoreErrors(t *testing.T) {
+	store := repository.NewMemory()
+	userID, _, err := store.GetUserIDPassHashOrRegister("alice", "hash", 1000)
+	require.NoError(t, err)
+	calls := 0
+	handler := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		calls++
+		if calls == 1 {
+			badRequestResponse(w)
+		}
+	})
+
+	assert.Equal(t, http.StatusBadRequest, serveIdempotent(handler, userID, "key", "").Code)
+	assert.Equal(t, http.StatusOK, serveIdempotent(handler, userID, "key", "").Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	store := repository.NewMemory()
+	calls := 0
+	handler := Idempotent(store, func(w http.ResponseWriter, r *http.Request, s repository.Store) {
+		calls++
+		assert.Same(t, store, s)
+	})
+
+	serveIdempotent(handler, 1, "", "")
+	serveIdempotent(handler, 1, "", "")
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotentKeyTooLong(t *testing.T) {
+	handler := Idempotent(repository.NewMemory(), nil)
+	rr := serveIdempotent(handler, 1, strings.Repeat("k", maxIdempotencyKeyLength+1), "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// serveIdempotent выполняет POST-запрос к handler от имени userID с ключом идемпотентности key
+func serveIdempotent(handler http.Handler, userID int, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), "userID", userID))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// GetCatalog обрабатывает GET-запрос /api/items - каталог товаров с ценами и остатками.
+// Для товаров с лимитом на пользователя показывает, сколько еще может купить текущий пользователь.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// В случае успеха возвращает каталог в формате JSON со статусом 200 (OK).
+func GetCatalog(w http.ResponseWriter, r *http.Request, catalogFunc func(int) ([]models.CatalogItem, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	catalog, err := catalogFunc(r.Context().Value("userID").(int))
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.CatalogResponse{Items: catalog})
+}
+
+// RestockItem обрабатывает POST-запрос /api/admin/items/{item}/restock - пополнение остатка товара.
+// Ожидает JSON-тело {"quantity": 10}.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны или количество не положительно, возвращает ошибку 400 (Bad Request).
+// Если товара нет, возвращает ошибку 404 (Not Found).
+// Если остаток товара не ограничен, возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает товар с новым остатком в формате JSON со статусом 200 (OK).
+func RestockItem(w http.ResponseWriter, r *http.Request,
+	restockFunc func(int, string, int) (models.CatalogItem, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	item, ok := parseAdminItem(r.URL.Path, "/restock")
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.RestockRequest
+	if err = json.Unmarshal(body, &request); err != nil || request.Quantity <= 0 {
+		badRequestResponse(w)
+		return
+	}
+
+	restocked, err := restockFunc(r.Context().Value("userID").(int), item, request.Quantity)
+	if err != nil {
+		itemStockErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, restocked)
+}
+
+// SetItemStock обрабатывает PUT-запрос /api/admin/items/{item}/stock, задающий остаток товара и лимит
+// покупок на пользователя. Ожидает JSON-тело {"stock": 100, "perUserLimit": 1}: stock null делает остаток
+// неограниченным, нулевой или отсутствующий perUserLimit отключает лимит.
+// Если метод запроса не PUT, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны, остаток или лимит отрицательны, возвращает ошибку 400 (Bad Request).
+// Если товара нет, возвращает ошибку 404 (Not Found).
+// В случае успеха возвращает товар с новым остатком в формате JSON со статусом 200 (OK).
+func SetItemStock(w http.ResponseWriter, r *http.Request,
+	setFunc func(int, string, *int, int) (models.CatalogItem, error)) {
+	if r.Method != http.MethodPut {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	item, ok := parseAdminItem(r.URL.Path, "/stock")
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.ItemStockRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if (request.Stock != nil && *request.Stock < 0) || request.PerUserLimit < 0 {
+		badRequestResponse(w)
+		return
+	}
+
+	updated, err := setFunc(r.Context().Value("userID").(int), item, request.Stock, request.PerUserLimit)
+	if err != nil {
+		itemStockErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+// maxSKULength - наибольшая длина артикула варианта товара
+const maxSKULength = 64
+
+// CreateItemVariant обрабатывает POST-запрос /api/admin/items/{item}/variants - создание варианта товара.
+// Ожидает JSON-тело {"sku": "hoody-m", "attributes": {"size": "M"}, "price": 350, "stock": 20}:
+// цена заменяет цену товара (0 или отсутствие - цена товара), stock null - остаток не ограничен.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны, артикул пуст, длиннее maxSKULength символов или содержит "/",
+// у атрибута пустое название, цена или остаток отрицательны, возвращает ошибку 400 (Bad Request).
+// Если товара нет, возвращает ошибку 404 (Not Found), если артикул занят - 409 (Conflict).
+// В случае успеха возвращает созданный вариант в формате JSON со статусом 200 (OK).
+func CreateItemVariant(w http.ResponseWriter, r *http.Request,
+	createFunc func(int, string, models.ItemVariantRequest) (models.CatalogVariant, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	item, ok := parseAdminItem(r.URL.Path, "/variants")
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.ItemVariantRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	request.SKU = strings.TrimSpace(request.SKU)
+	if !validSKU(request.SKU) || request.Price < 0 || (request.Stock != nil && *request.Stock < 0) {
+		badRequestResponse(w)
+		return
+	}
+	for name := range request.Attributes {
+		if strings.TrimSpace(name) == "" {
+			badRequestResponse(w)
+			return
+		}
+	}
+
+	created, err := createFunc(r.Context().Value("userID").(int), item, request)
+	if err != nil {
+		itemStockErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, created)
+}
+
+// RestockItemVariant обрабатывает POST-запрос /api/admin/variants/{sku}/restock - пополнение остатка
+// варианта товара. Ожидает JSON-тело {"quantity": 10}.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны или количество не положительно, возвращает ошибку 400 (Bad Request).
+// Если варианта нет, возвращает ошибку 404 (Not Found).
+// Если остаток варианта не ограничен, возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает вариант с новым остатком в формате JSON со статусом 200 (OK).
+func RestockItemVariant(w http.ResponseWriter, r *http.Request,
+	restockFunc func(int, string, int) (models.CatalogVariant, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	sku, ok := strings.CutPrefix(r.URL.Path, "/api/admin/variants/")
+	if ok {
+		sku, ok = strings.CutSuffix(sku, "/restock")
+	}
+	if !ok || !validSKU(sku) {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.RestockRequest
+	if err = json.Unmarshal(body, &request); err != nil || request.Quantity <= 0 {
+		badRequestResponse(w)
+		return
+	}
+
+	restocked, err := restockFunc(r.Context().Value("userID").(int), sku, request.Quantity)
+	if err != nil {
+		itemStockErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, restocked)
+}
+
+// validSKU проверяет артикул варианта: непустой, не длиннее maxSKULength символов и без "/"
+func validSKU(sku string) bool {
+	return sku != "" && utf8.RuneCountInString(sku) <= maxSKULength && !strings.Contains(sku, "/")
+}
+
+// parseAdminItem извлекает название товара из пути /api/admin/items/{item}{suffix}
+func parseAdminItem(path, suffix string) (string, bool) {
+	item, ok := strings.CutPrefix(path, "/api/admin/items/")
+	if ok {
+		item, ok = strings.CutSuffix(item, suffix)
+	}
+	return item, ok && item != "" && !strings.Contains(item, "/")
+}
+
+// itemStockErrorResponse отвечает на ошибку изменения остатка или варианта товара.
+// Товара или варианта нет - 404 (Not Found), остаток не ограничен или артикул занят - 409 (Conflict)
+// с описанием, количество некорректно - 400 (Bad Request).
+func itemStockErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrItemNotFound), errors.Is(err, repository.ErrVariantNotFound):
+		notFoundResponse(w)
+	case errors.Is(err, repository.ErrUnlimitedStock):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Остаток товара не ограничен."})
+	case errors.Is(err, repository.ErrVariantExists):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Артикул уже занят."})
+	case errors.Is(err, repository.ErrInvalidAmount):
+		badRequestResponse(w)
+	default:
+		internalServerErrorResponse(w)
+	}
+}
+
+// purchaseErrorResponse отвечает на ошибку покупки. Нехватка остатка товара или варианта или лимита покупок
+// на пользователя - статус 409 (Conflict) с кодом out_of_stock или purchase_limit, названием товара,
+// артикулом варианта и доступным количеством в формате JSON, остальные ошибки - как в spendingErrorResponse.
+func purchaseErrorResponse(w http.ResponseWriter, err error) {
+	var stockErr *repository.StockError
+	if !errors.As(err, &stockErr) {
+		spendingErrorResponse(w, err)
+		return
+	}
+	message := "Товар закончился."
+	if stockErr.Code == models.StockPurchaseLimit {
+		message = "Превышен лимит покупок товара."
+	}
+	jsonResponse(w, http.StatusConflict, models.StockErrorResponse{
+		Errors:    message,
+		Code:      stockErr.Code,
+		Item:      stockErr.Item,
+		Variant:   stockErr.Variant,
+		Available: stockErr.Available,
+	})
+}
@@ -0,0 +1,162 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ----------------
+// Тесты GetCatalog
+// ----------------
+func TestGetCatalog(t *testing.T) {
+	stock := 3
+	catalogFunc := func(userID int) ([]models.CatalogItem, error) {
+		assert.Equal(t, 1, userID)
+		return []models.CatalogItem{{Name: "cup", Price: 20, Available: true}, {Name: "pink-hoody", Price: 500, Stock: &stock}}, nil
+	}
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetCatalog(rr, req, catalogFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"items": [
+		{"name": "cup", "price": 20, "stock": null, "available": true},
+		{"name": "pink-hoody", "price": 500, "stock": 3, "available": false}
+	]}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	GetCatalog(rr, httptest.NewRequest("POST", "/api/items", nil), catalogFunc)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// --------------------------------
+// Тесты RestockItem и SetItemStock
+// --------------------------------
+func TestRestockItem(t *testing.T) {
+	restockFunc := func(adminID int, item string, quantity int) (models.CatalogItem, error) {
+		assert.Equal(t, 9, adminID)
+		switch item {
+		case "pink-hoody":
+			return models.CatalogItem{Name: item, Stock: &quantity, Available: true}, nil
+		case "cup":
+			return models.CatalogItem{}, repository.ErrUnlimitedStock
+		}
+		return models.CatalogItem{}, repository.ErrItemNotFound
+	}
+	for _, tc := range []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/admin/items/pink-hoody/restock", `{"quantity": 5}`, http.StatusOK},
+		{"/api/admin/items/cup/restock", `{"quantity": 5}`, http.StatusConflict},
+		{"/api/admin/items/yacht/restock", `{"quantity": 5}`, http.StatusNotFound},
+		{"/api/admin/items/pink-hoody/restock", `{"quantity": 0}`, http.StatusBadRequest},
+		{"/api/admin/items/pink-hoody/restock", `{"quantity": "5"}`, http.StatusBadRequest},
+		{"/api/admin/items//restock", `{"quantity": 5}`, http.StatusBadRequest},
+		{"/api/admin/items/pink-hoody", `{"quantity": 5}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		RestockItem(rr, req, restockFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+		if tc.code == http.StatusOK {
+			var item models.CatalogItem
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&item))
+			assert.Equal(t, 5, *item.Stock)
+		}
+	}
+}
+
+func TestSetItemStock(t *testing.T) {
+	var receivedStock *int
+	var receivedLimit int
+	setFunc := func(adminID int, item string, stock *int, perUserLimit int) (models.CatalogItem, error) {
+		assert.Equal(t, 9, adminID)
+		if item != "pink-hoody" {
+			return models.CatalogItem{}, repository.ErrItemNotFound
+		}
+		receivedStock, receivedLimit = stock, perUserLimit
+		return models.CatalogItem{Name: item, Stock: stock, PerUserLimit: perUserLimit}, nil
+	}
+	for _, tc := range []struct {
+		path   string
+		body   string
+		code   int
+		stock  *int
+		limit  int
+		method string
+	}{
+		{"/api/admin/items/pink-hoody/stock", `{"stock": 3, "perUserLimit": 1}`, http.StatusOK, intPointer(3), 1, "PUT"},
+		{"/api/admin/items/pink-hoody/stock", `{"stock": null}`, http.StatusOK, nil, 0, "PUT"},
+		{"/api/admin/items/yacht/stock", `{"stock": 3}`, http.StatusNotFound, nil, 0, "PUT"},
+		{"/api/admin/items/pink-hoody/stock", `{"stock": -1}`, http.StatusBadRequest, nil, 0, "PUT"},
+		{"/api/admin/items/pink-hoody/stock", `{"perUserLimit": -1}`, http.StatusBadRequest, nil, 0, "PUT"},
+		{"/api/admin/items/pink-hoody/stock", `{"stock": "3"}`, http.StatusBadRequest, nil, 0, "PUT"},
+		{"/api/admin/items/pink-hoody/stock", `{"stock": 3}`, http.StatusMethodNotAllowed, nil, 0, "POST"},
+	} {
+		receivedStock, receivedLimit = nil, 0
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		SetItemStock(rr, req, setFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+		if tc.code == http.StatusOK {
+			assert.Equal(t, tc.stock, receivedStock)
+			assert.Equal(t, tc.limit, receivedLimit)
+		}
+	}
+}
+
+// ---------------------------------
+// Тесты ошибок остатков при покупке
+// ---------------------------------
+func TestBuyItemsOutOfStock(t *testing.T) {
+	buyFunc := func(userID int, item, variant string, quantity int) error {
+		return &repository.StockError{Item: item, Code: models.StockOutOfStock, Available: 1}
+	}
+	req := httptest.NewRequest("GET", "/api/buy/pink-hoody?quantity=2", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	BuyItems(rr, req, buyFunc)
+	require.Equal(t, http.StatusConflict, rr.Code)
+	var response models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, models.StockOutOfStock, response.Code)
+	assert.Equal(t, "pink-hoody", response.Item)
+	assert.Equal(t, 1, response.Available)
+}
+
+func TestPlaceOrderPurchaseLimit(t *testing.T) {
+	orderFunc := func(userID int, lines []models.OrderLine) (models.OrderResponse, error) {
+		return models.OrderResponse{}, &repository.StockError{Item: "pink-hoody", Code: models.StockPurchaseLimit}
+	}
+	req := httptest.NewRequest("POST", "/api/orders", strings.NewReader(`{"items": [{"item": "pink-hoody", "quantity": 2}]}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	PlaceOrder(rr, req, orderFunc)
+	require.Equal(t, http.StatusConflict, rr.Code)
+	var response models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, models.StockPurchaseLimit, response.Code)
+	assert.Equal(t, 0, response.Available)
+}
+
+// intPointer возвращает указатель на value
+func intPointer(value int) *int {
+	return &value
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GetUserLimits обрабатывает GET-запрос /api/admin/limits/{username} - действующие лимиты трат пользователя:
+// заданные ему администратором или лимиты по умолчанию defaults.
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если пользователя нет, возвращает ошибку 404 (Not Found).
+// В случае успеха возвращает лимиты в формате JSON со статусом 200 (OK).
+func GetUserLimits(w http.ResponseWriter, r *http.Request, defaults models.SpendingLimits,
+	limitsFunc func(string) (models.SpendingLimits, bool, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	username, ok := parseLimitsUser(r.URL.Path)
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	limits, override, err := limitsFunc(username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	if !override {
+		limits = defaults
+	}
+	jsonResponse(w, http.StatusOK, models.UserLimits{User: username, Limits: limits, Override: override})
+}
+
+// SetUserLimits обрабатывает PUT-запрос /api/admin/limits/{username}, задающий пользователю лимиты трат
+// вместо лимитов по умолчанию. Ожидает JSON-тело {"perTransfer": 500, "daily": 1000, "monthly": 5000,
+// "perRecipient": 300}, ноль отключает лимит.
+// Если метод запроса не PUT, возвращает ошибку 405 (Method Not Allowed).
+// Если пользователя нет, возвращает ошибку 404 (Not Found), при некорректном теле - 400 (Bad Request).
+// В случае успеха возвращает заданные лимиты в формате JSON со статусом 200 (OK).
+func SetUserLimits(w http.ResponseWriter, r *http.Request,
+	setFunc func(int, string, models.SpendingLimits) error) {
+	if r.Method != http.MethodPut {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	username, ok := parseLimitsUser(r.URL.Path)
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var limits models.SpendingLimits
+	if err = json.Unmarshal(body, &limits); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	if limits.PerTransfer < 0 || limits.Daily < 0 || limits.Monthly < 0 || limits.PerRecipient < 0 {
+		badRequestResponse(w)
+		return
+	}
+	err = setFunc(r.Context().Value("userID").(int), username, limits)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.UserLimits{User: username, Limits: limits, Override: true})
+}
+
+// DeleteUserLimits обрабатывает DELETE-запрос /api/admin/limits/{username}, возвращающий пользователю
+// лимиты трат по умолчанию.
+// Если метод запроса не DELETE, возвращает ошибку 405 (Method Not Allowed).
+// Если пользователя нет, возвращает ошибку 404 (Not Found).
+// В случае успеха возвращает статус 200 (OK).
+func DeleteUserLimits(w http.ResponseWriter, r *http.Request, deleteFunc func(string) error) {
+	if r.Method != http.MethodDelete {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	username, ok := parseLimitsUser(r.URL.Path)
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+	err := deleteFunc(username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseLimitsUser извлекает имя пользователя из пути /api/admin/limits/{username}
+func parseLimitsUser(path string) (string, bool) {
+	username, ok := strings.CutPrefix(path, "/api/admin/limits/")
+	if !ok || username == "" || strings.Contains(username, "/") {
+		return "", false
+	}
+	return username, true
+}
@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// --------------------------------
+// Тесты ответа о превышении лимита
+// --------------------------------
+func TestTransferCoinsLimitExceeded(t *testing.T) {
+	transferFunc := func(int, int, string, models.TransferNote) error {
+		return &repository.LimitError{Limit: models.LimitDaily, Remaining: 120}
+	}
+	req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(`{"toUser": "bob", "amount": 200}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	TransferCoins(rr, req, 0, transferFunc, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	var response models.LimitErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "limit_exceeded", response.Code)
+	assert.Equal(t, models.LimitDaily, response.Limit)
+	assert.Equal(t, 120, response.Remaining)
+}
+
+func TestBuyItemsLimitExceeded(t *testing.T) {
+	buyFunc := func(int, string, string, int) error {
+		return &repository.LimitError{Limit: models.LimitMonthly, Remaining: 0}
+	}
+	req := httptest.NewRequest("GET", "/api/buy/cup", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	BuyItems(rr, req, buyFunc)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+// -------------------
+// Тесты GetUserLimits
+// -------------------
+func TestGetUserLimits(t *testing.T) {
+	defaults := models.SpendingLimits{Daily: 1000}
+	limitsFunc := func(username string) (models.SpendingLimits, bool, error) {
+		switch username {
+		case "alice":
+			return models.SpendingLimits{PerTransfer: 50}, true, nil
+		case "bob":
+			return models.SpendingLimits{}, false, nil
+		}
+		return models.SpendingLimits{}, false, repository.ErrUserNotFound
+	}
+
+	for username, expected := range map[string]models.UserLimits{
+		"alice": {User: "alice", Limits: models.SpendingLimits{PerTransfer: 50}, Override: true},
+		"bob":   {User: "bob", Limits: defaults},
+	} {
+		req := httptest.NewRequest("GET", "/api/admin/limits/"+username, nil)
+		rr := httptest.NewRecorder()
+		GetUserLimits(rr, req, defaults, limitsFunc)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var response models.UserLimits
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, expected, response)
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/limits/ghost", nil)
+	rr := httptest.NewRecorder()
+	GetUserLimits(rr, req, defaults, limitsFunc)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// --------------------------------------
+// Тесты SetUserLimits и DeleteUserLimits
+// --------------------------------------
+func TestSetUserLimits(t *testing.T) {
+	var received models.SpendingLimits
+	setFunc := func(adminID int, username string, limits models.SpendingLimits) error {
+		if username != "alice" {
+			return repository.ErrUserNotFound
+		}
+		received = limits
+		return nil
+	}
+
+	for target, expected := range map[string]int{
+		"/api/admin/limits/alice":   http.StatusOK,
+		"/api/admin/limits/ghost":   http.StatusNotFound,
+		"/api/admin/limits/":        http.StatusBadRequest,
+		"/api/admin/limits/alice/x": http.StatusBadRequest,
+	} {
+		body := `{"perTransfer": 500, "daily": 1000, "monthly": 0, "perRecipient": 300}`
+		req := httptest.NewRequest("PUT", target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+		SetUserLimits(rr, req, setFunc)
+		assert.Equal(t, expected, rr.Code, target)
+	}
+	assert.Equal(t, models.SpendingLimits{PerTransfer: 500, Daily: 1000, PerRecipient: 300}, received)
+
+	for _, body := range []string{`not json`, `{"daily": -1}`} {
+		req := httptest.NewRequest("PUT", "/api/admin/limits/alice", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+		SetUserLimits(rr, req, setFunc)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestDeleteUserLimits(t *testing.T) {
+	deleteFunc := func(username string) error {
+		switch username {
+		case "alice":
+			return nil
+		case "ghost":
+			return repository.ErrUserNotFound
+		}
+		return errors.New("db error")
+	}
+
+	for username, expected := range map[string]int{
+		"alice": http.StatusOK,
+		"ghost": http.StatusNotFound,
+		"bob":   http.StatusInternalServerError,
+	} {
+		req := httptest.NewRequest("DELETE", "/api/admin/limits/"+username, nil)
+		rr := httptest.NewRecorder()
+		DeleteUserLimits(rr, req, deleteFunc)
+		assert.Equal(t, expected, rr.Code, username)
+	}
+}
@@ -0,0 +1,206 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var errInvalidPaymentRequest = errors.New("invalid payment request")
+
+// CreatePaymentRequest обрабатывает создание запроса монет у другого пользователя.
+// Ожидает POST-запрос с JSON-телом {"payer": "bob", "amount": 100, "note": "...", "expiresAt": "..."},
+// примечание и срок необязательны. Срок по умолчанию и наибольший срок - ttl от текущего момента.
+// Примечание очищается так же, как сообщение перевода, и при одобрении становится сообщением перевода.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если плательщика нет, возвращает ошибку 404 (Not Found).
+// Если тело некорректно, сумма не положительна, примечание длиннее maxMessageLength символов,
+// срок уже прошел или больше ttl, а также если запрос создать не удалось, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает созданный запрос в формате JSON со статусом 200 (OK).
+func CreatePaymentRequest(w http.ResponseWriter, r *http.Request, ttl time.Duration, now func() time.Time,
+	createFunc func(int, models.PaymentRequest) (models.PaymentRequest, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.PaymentRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	current := now().UTC()
+	request.Note = sanitizeMessage(request.Note)
+	if request.ExpiresAt.IsZero() {
+		request.ExpiresAt = current.Add(ttl)
+	}
+	if request.Payer == "" || request.Amount <= 0 || utf8.RuneCountInString(request.Note) > maxMessageLength ||
+		!request.ExpiresAt.After(current) || request.ExpiresAt.After(current.Add(ttl)) {
+		badRequestResponse(w)
+		return
+	}
+	created, err := createFunc(r.Context().Value("userID").(int), request)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		notFoundResponse(w)
+		return
+	}
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, created)
+}
+
+// GetPaymentRequests обрабатывает GET-запрос списка запросов монет пользователя от новых к старым.
+// Поддерживает параметры direction (incoming - запросы к пользователю, по умолчанию, или outgoing -
+// запросы пользователя), status (pending, approved, declined, cancelled или expired)
+// и limit (по умолчанию 50, не больше 100).
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если параметры некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает запросы в формате JSON со статусом 200 (OK).
+func GetPaymentRequests(w http.ResponseWriter, r *http.Request,
+	requestsFunc func(int, string, string, int) ([]models.PaymentRequest, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	query := r.URL.Query()
+	direction := query.Get("direction")
+	if direction == "" {
+		direction = models.DirectionIncoming
+	}
+	status := query.Get("status")
+	limit, err := parsePositiveParameter(query, "limit", defaultPageLimit)
+	if err != nil || limit > maxPageLimit ||
+		(direction != models.DirectionIncoming && direction != models.DirectionOutgoing) ||
+		!validPaymentRequestStatus(status) {
+		badRequestResponse(w)
+		return
+	}
+	requests, err := requestsFunc(r.Context().Value("userID").(int), direction, status, limit)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.PaymentRequestsResponse{Requests: requests})
+}
+
+// ApprovePaymentRequest обрабатывает POST-запрос /api/paymentRequests/{id}/approve - одобрение запроса
+// плательщиком. Перевод и закрытие запроса выполняются атомарно, при ошибке запрос остается открытым.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если запроса нет или пользователь не плательщик, возвращает ошибку 404 (Not Found).
+// Если запрос уже закрыт или просрочен, возвращает ошибку 409 (Conflict).
+// Если перевод превышает лимит трат, возвращает ошибку 422 (Unprocessable Entity) с остатком лимита.
+// Если средств не хватает или идентификатор некорректен, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает закрытый запрос в формате JSON со статусом 200 (OK).
+func ApprovePaymentRequest(w http.ResponseWriter, r *http.Request,
+	approveFunc func(int, int) (models.PaymentRequest, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	requestID, action, err := parsePaymentRequestAction(r.URL.Path)
+	if err != nil || action != "approve" {
+		badRequestResponse(w)
+		return
+	}
+	approved, err := approveFunc(r.Context().Value("userID").(int), requestID)
+	if err != nil {
+		paymentRequestErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, approved)
+}
+
+// ClosePaymentRequest обрабатывает POST-запросы /api/paymentRequests/{id}/decline - отказ плательщика
+// и /api/paymentRequests/{id}/cancel - отмену запросившим. Монеты не переводятся.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если запроса нет или пользователь не та сторона запроса, возвращает ошибку 404 (Not Found).
+// Если запрос уже закрыт или просрочен, возвращает ошибку 409 (Conflict).
+// Если путь некорректен, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает закрытый запрос в формате JSON со статусом 200 (OK).
+func ClosePaymentRequest(w http.ResponseWriter, r *http.Request,
+	closeFunc func(int, int, string) (models.PaymentRequest, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	requestID, action, err := parsePaymentRequestAction(r.URL.Path)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var status string
+	switch action {
+	case "decline":
+		status = models.PaymentRequestDeclined
+	case "cancel":
+		status = models.PaymentRequestCancelled
+	default:
+		badRequestResponse(w)
+		return
+	}
+	closed, err := closeFunc(r.Context().Value("userID").(int), requestID, status)
+	if err != nil {
+		paymentRequestErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, closed)
+}
+
+// parsePaymentRequestAction извлекает идентификатор запроса и действие из пути /api/paymentRequests/{id}/{action}
+func parsePaymentRequestAction(path string) (int, string, error) {
+	value, ok := strings.CutPrefix(path, "/api/paymentRequests/")
+	if !ok {
+		return 0, "", errInvalidPaymentRequest
+	}
+	value, action, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, "", errInvalidPaymentRequest
+	}
+	requestID, err := strconv.Atoi(value)
+	if err != nil || requestID <= 0 {
+		return 0, "", errInvalidPaymentRequest
+	}
+	return requestID, action, nil
+}
+
+// validPaymentRequestStatus проверяет фильтр по статусу запроса монет, пустой фильтр допустим
+func validPaymentRequestStatus(status string) bool {
+	switch status {
+	case "", models.PaymentRequestPending, models.PaymentRequestApproved, models.PaymentRequestDeclined,
+		models.PaymentRequestCancelled, models.PaymentRequestExpired:
+		return true
+	}
+	return false
+}
+
+// paymentRequestErrorResponse отвечает на ошибку закрытия запроса монет.
+// Запроса нет - 404 (Not Found), запрос уже закрыт или просрочен - 409 (Conflict) с описанием,
+// недостаточно средств - 400 (Bad Request) с описанием, ошибки перевода - как в spendingErrorResponse.
+func paymentRequestErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrPaymentRequestNotFound):
+		notFoundResponse(w)
+	case errors.Is(err, repository.ErrPaymentRequestClosed):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Запрос монет уже закрыт."})
+	case errors.Is(err, repository.ErrPaymentRequestExpired):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Срок запроса монет истек."})
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		jsonResponse(w, http.StatusBadRequest, models.ErrorResponse{Errors: "Недостаточно средств."})
+	default:
+		spendingErrorResponse(w, err)
+	}
+}
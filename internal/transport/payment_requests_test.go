@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --------------------------
+// Тесты CreatePaymentRequest
+// --------------------------
+func TestCreatePaymentRequestDefaultExpiry(t *testing.T) {
+	now := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	var received models.PaymentRequest
+	createFunc := func(requesterID int, request models.PaymentRequest) (models.PaymentRequest, error) {
+		assert.Equal(t, 1, requesterID)
+		received = request
+		request.ID = 5
+		request.Status = models.PaymentRequestPending
+		return request, nil
+	}
+
+	reqBody := `{"payer": "bob", "amount": 100, "note": " за\nобед "}`
+	req := httptest.NewRequest("POST", "/api/paymentRequests", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	CreatePaymentRequest(rr, req, 24*time.Hour, func() time.Time { return now }, createFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.PaymentRequest{
+		Payer: "bob", Amount: 100, Note: "за обед", ExpiresAt: now.Add(24 * time.Hour),
+	}, received)
+	var created models.PaymentRequest
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, 5, created.ID)
+}
+
+func TestCreatePaymentRequestInvalidBody(t *testing.T) {
+	now := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	for _, reqBody := range []string{
+		`not json`,
+		`{"amount": 100}`,
+		`{"payer": "bob", "amount": 0}`,
+		`{"payer": "bob", "amount": 100, "note": "` + strings.Repeat("я", maxMessageLength+1) + `"}`,
+		`{"payer": "bob", "amount": 100, "expiresAt": "2025-02-01T11:00:00Z"}`,
+		`{"payer": "bob", "amount": 100, "expiresAt": "2025-02-03T12:00:00Z"}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/paymentRequests", strings.NewReader(reqBody))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		CreatePaymentRequest(rr, req, 24*time.Hour, func() time.Time { return now }, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reqBody)
+	}
+}
+
+func TestCreatePaymentRequestUnknownPayer(t *testing.T) {
+	createFunc := func(int, models.PaymentRequest) (models.PaymentRequest, error) {
+		return models.PaymentRequest{}, repository.ErrUserNotFound
+	}
+	req := httptest.NewRequest("POST", "/api/paymentRequests", strings.NewReader(`{"payer": "nobody", "amount": 10}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	CreatePaymentRequest(rr, req, time.Hour, time.Now, createFunc)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// ------------------------
+// Тесты GetPaymentRequests
+// ------------------------
+func TestGetPaymentRequestsParameters(t *testing.T) {
+	var direction, status string
+	var limit int
+	requestsFunc := func(userID int, d, s string, l int) ([]models.PaymentRequest, error) {
+		direction, status, limit = d, s, l
+		return []models.PaymentRequest{{ID: 1}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/paymentRequests", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+	GetPaymentRequests(rr, req, requestsFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.DirectionIncoming, direction)
+	assert.Empty(t, status)
+	assert.Equal(t, defaultPageLimit, limit)
+
+	req = httptest.NewRequest("GET", "/api/paymentRequests?direction=outgoing&status=expired&limit=5", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr = httptest.NewRecorder()
+	GetPaymentRequests(rr, req, requestsFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.DirectionOutgoing, direction)
+	assert.Equal(t, models.PaymentRequestExpired, status)
+	assert.Equal(t, 5, limit)
+
+	for _, query := range []string{"?direction=sent", "?status=paid", "?limit=101"} {
+		req = httptest.NewRequest("GET", "/api/paymentRequests"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr = httptest.NewRecorder()
+		GetPaymentRequests(rr, req, requestsFunc)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+// -------------------------------------------------
+// Тесты ApprovePaymentRequest и ClosePaymentRequest
+// -------------------------------------------------
+func TestApprovePaymentRequestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{repository.ErrPaymentRequestNotFound, http.StatusNotFound},
+		{repository.ErrPaymentRequestClosed, http.StatusConflict},
+		{repository.ErrPaymentRequestExpired, http.StatusConflict},
+		{repository.ErrInsufficientFunds, http.StatusBadRequest},
+		{&repository.LimitError{Limit: models.LimitDaily, Remaining: 10}, http.StatusUnprocessableEntity},
+	} {
+		approveFunc := func(payerID, requestID int) (models.PaymentRequest, error) {
+			assert.Equal(t, 2, payerID)
+			assert.Equal(t, 7, requestID)
+			return models.PaymentRequest{}, tc.err
+		}
+		req := httptest.NewRequest("POST", "/api/paymentRequests/7/approve", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 2))
+		rr := httptest.NewRecorder()
+
+		ApprovePaymentRequest(rr, req, approveFunc)
+		assert.Equal(t, tc.code, rr.Code, tc.err.Error())
+	}
+}
+
+func TestClosePaymentRequestActions(t *testing.T) {
+	var status string
+	closeFunc := func(userID, requestID int, s string) (models.PaymentRequest, error) {
+		status = s
+		return models.PaymentRequest{ID: requestID, Status: s}, nil
+	}
+	for action, expected := range map[string]string{
+		"decline": models.PaymentRequestDeclined,
+		"cancel":  models.PaymentRequestCancelled,
+	} {
+		req := httptest.NewRequest("POST", "/api/paymentRequests/7/"+action, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		ClosePaymentRequest(rr, req, closeFunc)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, expected, status)
+	}
+
+	for _, path := range []string{"/api/paymentRequests/7/pay", "/api/paymentRequests/x/cancel", "/api/paymentRequests/7"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		ClosePaymentRequest(rr, req, closeFunc)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+}
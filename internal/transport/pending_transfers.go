@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GetPendingTransfers обрабатывает GET-запрос списка отложенных переводов пользователя, которые еще
+// не зачислены получателям, от новых к старым. Поддерживает параметр limit (по умолчанию 50, не больше 100).
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если параметры некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает переводы в формате JSON со статусом 200 (OK).
+func GetPendingTransfers(w http.ResponseWriter, r *http.Request,
+	transfersFunc func(int, int) ([]models.PendingTransfer, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	limit, err := parsePositiveParameter(r.URL.Query(), "limit", defaultPageLimit)
+	if err != nil || limit > maxPageLimit {
+		badRequestResponse(w)
+		return
+	}
+	transfers, err := transfersFunc(r.Context().Value("userID").(int), limit)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.PendingTransfersResponse{Transfers: transfers})
+}
+
+// CancelPendingTransfer обрабатывает POST-запрос /api/pendingTransfers/{id}/cancel - отмену отложенного
+// перевода отправителем. Зарезервированные монеты возвращаются отправителю.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь некорректен, возвращает ошибку 400 (Bad Request).
+// Если перевода нет или пользователь не отправитель, возвращает ошибку 404 (Not Found).
+// Если перевод уже зачислен, отменен или срок его зачисления наступил, возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает отмененный перевод в формате JSON со статусом 200 (OK).
+func CancelPendingTransfer(w http.ResponseWriter, r *http.Request,
+	cancelFunc func(int, int) (models.PendingTransfer, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	value, ok := strings.CutPrefix(r.URL.Path, "/api/pendingTransfers/")
+	if ok {
+		value, ok = strings.CutSuffix(value, "/cancel")
+	}
+	transferID, err := strconv.Atoi(value)
+	if !ok || err != nil || transferID <= 0 {
+		badRequestResponse(w)
+		return
+	}
+	cancelled, err := cancelFunc(r.Context().Value("userID").(int), transferID)
+	switch {
+	case errors.Is(err, repository.ErrPendingTransferNotFound):
+		notFoundResponse(w)
+	case errors.Is(err, repository.ErrPendingTransferClosed):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Отложенный перевод уже нельзя отменить."})
+	case err != nil:
+		internalServerErrorResponse(w)
+	default:
+		jsonResponse(w, http.StatusOK, cancelled)
+	}
+}
@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --------------------------------------
+// Тесты отложенного режима TransferCoins
+// --------------------------------------
+func TestTransferCoinsDelayed(t *testing.T) {
+	transferFunc := func(int, int, string, models.TransferNote) error {
+		t.Fatal("immediate transfer must not be called")
+		return nil
+	}
+	holdFunc := func(fromID, amount int, toUser string, note models.TransferNote,
+		delay time.Duration) (models.PendingTransfer, error) {
+		assert.Equal(t, 1, fromID)
+		assert.Equal(t, 15*time.Minute, delay)
+		return models.PendingTransfer{ID: 7, ToUser: toUser, Amount: amount, Message: note.Message,
+			Status: models.PendingTransferPending}, nil
+	}
+
+	reqBody := `{"toUser": "bob", "amount": 50, "message": "за обед", "delayMinutes": 15}`
+	req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	TransferCoins(rr, req, time.Hour, transferFunc, holdFunc)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	var pending models.PendingTransfer
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&pending))
+	assert.Equal(t, models.PendingTransfer{ID: 7, ToUser: "bob", Amount: 50, Message: "за обед",
+		Status: models.PendingTransferPending}, pending)
+}
+
+func TestTransferCoinsInvalidDelay(t *testing.T) {
+	for _, tc := range []struct {
+		maxDelay time.Duration
+		body     string
+	}{
+		{time.Hour, `{"toUser": "bob", "amount": 50, "delayMinutes": -1}`},
+		{time.Hour, `{"toUser": "bob", "amount": 50, "delayMinutes": 61}`},
+		{time.Hour, `{"toUser": "bob", "amount": 50, "delayMinutes": 9223372036854775807}`},
+		{0, `{"toUser": "bob", "amount": 50, "delayMinutes": 1}`},
+		{time.Hour, `{"toUser": "bob", "amount": 4294967296, "delayMinutes": 1}`},
+	} {
+		req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		TransferCoins(rr, req, tc.maxDelay, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, tc.body)
+	}
+}
+
+func TestTransferCoinsDelayedLimitExceeded(t *testing.T) {
+	holdFunc := func(int, int, string, models.TransferNote, time.Duration) (models.PendingTransfer, error) {
+		return models.PendingTransfer{}, &repository.LimitError{Limit: models.LimitDaily, Remaining: 10}
+	}
+	req := httptest.NewRequest("POST", "/api/sendCoin", strings.NewReader(`{"toUser": "bob", "amount": 50, "delayMinutes": 5}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	TransferCoins(rr, req, time.Hour, nil, holdFunc)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+// -------------------------
+// Тесты GetPendingTransfers
+// -------------------------
+func TestGetPendingTransfers(t *testing.T) {
+	transfersFunc := func(userID, limit int) ([]models.PendingTransfer, error) {
+		assert.Equal(t, 1, userID)
+		assert.Equal(t, 20, limit)
+		return []models.PendingTransfer{{ID: 3, ToUser: "bob", Amount: 10, Status: models.PendingTransferPending}}, nil
+	}
+	req := httptest.NewRequest("GET", "/api/pendingTransfers?limit=20", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+
+	GetPendingTransfers(rr, req, transfersFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response models.PendingTransfersResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Len(t, response.Transfers, 1)
+	assert.Equal(t, 3, response.Transfers[0].ID)
+
+	for _, target := range []string{"/api/pendingTransfers?limit=0", "/api/pendingTransfers?limit=101"} {
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		GetPendingTransfers(rr, req, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+	}
+}
+
+// ---------------------------
+// Тесты CancelPendingTransfer
+// ---------------------------
+func TestCancelPendingTransfer(t *testing.T) {
+	cancelFunc := func(userID, transferID int) (models.PendingTransfer, error) {
+		switch transferID {
+		case 3:
+			return models.PendingTransfer{ID: 3, Status: models.PendingTransferCancelled}, nil
+		case 4:
+			return models.PendingTransfer{}, repository.ErrPendingTransferClosed
+		}
+		return models.PendingTransfer{}, repository.ErrPendingTransferNotFound
+	}
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/api/pendingTransfers/3/cancel", http.StatusOK},
+		{"/api/pendingTransfers/4/cancel", http.StatusConflict},
+		{"/api/pendingTransfers/5/cancel", http.StatusNotFound},
+		{"/api/pendingTransfers/3", http.StatusBadRequest},
+		{"/api/pendingTransfers/x/cancel", http.StatusBadRequest},
+		{"/api/pendingTransfers/0/cancel", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", tc.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		CancelPendingTransfer(rr, req, cancelFunc)
+		assert.Equal(t, tc.code, rr.Code, tc.path)
+	}
+}
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// RequestPurchaseReturn обрабатывает POST-запрос /api/purchases/{id}/return - запрос на возврат части
+// или всей покупки. Ожидает JSON-тело {"quantity": 1, "reason": "..."}, причина необязательна.
+// Возврат выполняется после одобрения администратором.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны, количество не положительно или больше не возвращенного остатка покупки,
+// причина длиннее maxReasonLength символов, возвращает ошибку 400 (Bad Request).
+// Если покупки нет или она чужая, возвращает ошибку 404 (Not Found).
+// Если срок возврата истек, возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает созданный возврат в формате JSON со статусом 200 (OK).
+func RequestPurchaseReturn(w http.ResponseWriter, r *http.Request,
+	requestFunc func(int, int, int, string) (models.PurchaseReturn, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	value, ok := strings.CutPrefix(r.URL.Path, "/api/purchases/")
+	if ok {
+		value, ok = strings.CutSuffix(value, "/return")
+	}
+	purchaseID, err := strconv.Atoi(value)
+	if !ok || err != nil || purchaseID <= 0 {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.ReturnRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Quantity <= 0 || utf8.RuneCountInString(request.Reason) > maxReasonLength {
+		badRequestResponse(w)
+		return
+	}
+
+	created, err := requestFunc(r.Context().Value("userID").(int), purchaseID, request.Quantity, request.Reason)
+	if err != nil {
+		purchaseReturnErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, created)
+}
+
+// GetPurchaseReturns обрабатывает GET-запрос списка возвратов покупок от новых к старым.
+// Поддерживает параметры status (pending, approved или rejected) и limit (по умолчанию 50, не больше 100).
+// Если метод запроса не GET, возвращает ошибку 405 (Method Not Allowed).
+// Если параметры некорректны, возвращает ошибку 400 (Bad Request).
+// В случае успеха возвращает возвраты в формате JSON со статусом 200 (OK).
+func GetPurchaseReturns(w http.ResponseWriter, r *http.Request,
+	returnsFunc func(int, string, int) ([]models.PurchaseReturn, error)) {
+	if r.Method != http.MethodGet {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	query := r.URL.Query()
+	status := query.Get("status")
+	limit, err := parsePositiveParameter(query, "limit", defaultPageLimit)
+	if err != nil || limit > maxPageLimit || !validReturnStatus(status) {
+		badRequestResponse(w)
+		return
+	}
+	returns, err := returnsFunc(r.Context().Value("userID").(int), status, limit)
+	if err != nil {
+		internalServerErrorResponse(w)
+		return
+	}
+	jsonResponse(w, http.StatusOK, models.PurchaseReturnsResponse{Returns: returns})
+}
+
+// ResolvePurchaseReturn обрабатывает POST-запросы /api/admin/returns/{id}/approve - одобрение возврата
+// и /api/admin/returns/{id}/reject - отказ. При одобрении предметы списываются из инвентаря покупателя,
+// а уплаченная за них цена возвращается ему атомарно.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь некорректен, возвращает ошибку 400 (Bad Request).
+// Если возврата нет, возвращает ошибку 404 (Not Found).
+// Если возврат уже рассмотрен или у покупателя не осталось возвращаемых предметов,
+// возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает рассмотренный возврат в формате JSON со статусом 200 (OK).
+func ResolvePurchaseReturn(w http.ResponseWriter, r *http.Request,
+	approveFunc, rejectFunc func(int, int) (models.PurchaseReturn, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	value, ok := strings.CutPrefix(r.URL.Path, "/api/admin/returns/")
+	value, action, found := strings.Cut(value, "/")
+	returnID, err := strconv.Atoi(value)
+	if !ok || !found || err != nil || returnID <= 0 {
+		badRequestResponse(w)
+		return
+	}
+	var resolveFunc func(int, int) (models.PurchaseReturn, error)
+	switch action {
+	case "approve":
+		resolveFunc = approveFunc
+	case "reject":
+		resolveFunc = rejectFunc
+	default:
+		badRequestResponse(w)
+		return
+	}
+
+	resolved, err := resolveFunc(r.Context().Value("userID").(int), returnID)
+	if err != nil {
+		purchaseReturnErrorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, resolved)
+}
+
+// validReturnStatus проверяет фильтр по статусу возврата, пустой фильтр допустим
+func validReturnStatus(status string) bool {
+	switch status {
+	case "", models.ReturnPending, models.ReturnApproved, models.ReturnRejected:
+		return true
+	}
+	return false
+}
+
+// purchaseReturnErrorResponse отвечает на ошибку возврата покупки.
+// Покупки или возврата нет - 404 (Not Found), срок истек, возврат уже рассмотрен или предметов
+// не хватает - 409 (Conflict) с описанием, количество некорректно - 400 (Bad Request) с описанием.
+func purchaseReturnErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrPurchaseNotFound), errors.Is(err, repository.ErrReturnNotFound):
+		notFoundResponse(w)
+	case errors.Is(err, repository.ErrReturnWindowExpired):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Срок возврата покупки истек."})
+	case errors.Is(err, repository.ErrReturnClosed):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Возврат уже рассмотрен."})
+	case errors.Is(err, repository.ErrNotEnoughItems):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "У покупателя нет возвращаемых предметов."})
+	case errors.Is(err, repository.ErrReturnQuantityExceeded):
+		jsonResponse(w, http.StatusBadRequest, models.ErrorResponse{Errors: "Нельзя вернуть больше, чем куплено."})
+	case errors.Is(err, repository.ErrInvalidAmount):
+		badRequestResponse(w)
+	default:
+		internalServerErrorResponse(w)
+	}
+}
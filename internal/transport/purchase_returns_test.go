@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ---------------------------
+// Тесты RequestPurchaseReturn
+// ---------------------------
+func TestRequestPurchaseReturn(t *testing.T) {
+	requestFunc := func(userID, purchaseID, quantity int, reason string) (models.PurchaseReturn, error) {
+		assert.Equal(t, 1, userID)
+		switch purchaseID {
+		case 7:
+			assert.Equal(t, "брак", reason)
+			return models.PurchaseReturn{ID: 3, PurchaseID: 7, Quantity: quantity, Status: models.ReturnPending}, nil
+		case 8:
+			return models.PurchaseReturn{}, repository.ErrReturnWindowExpired
+		case 9:
+			return models.PurchaseReturn{}, repository.ErrReturnQuantityExceeded
+		}
+		return models.PurchaseReturn{}, repository.ErrPurchaseNotFound
+	}
+	for _, tc := range []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/purchases/7/return", `{"quantity": 2, "reason": " брак "}`, http.StatusOK},
+		{"/api/purchases/8/return", `{"quantity": 1}`, http.StatusConflict},
+		{"/api/purchases/9/return", `{"quantity": 5}`, http.StatusBadRequest},
+		{"/api/purchases/10/return", `{"quantity": 1}`, http.StatusNotFound},
+		{"/api/purchases/7/return", `{"quantity": 0}`, http.StatusBadRequest},
+		{"/api/purchases/7/return", `{"quantity": 1, "reason": "` + strings.Repeat("я", maxReasonLength+1) + `"}`, http.StatusBadRequest},
+		{"/api/purchases/7/return", `{"quantity": "1"}`, http.StatusBadRequest},
+		{"/api/purchases/7", `{"quantity": 1}`, http.StatusBadRequest},
+		{"/api/purchases/x/return", `{"quantity": 1}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr := httptest.NewRecorder()
+
+		RequestPurchaseReturn(rr, req, requestFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+		if tc.code == http.StatusOK {
+			var created models.PurchaseReturn
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+			assert.Equal(t, 2, created.Quantity)
+		}
+	}
+}
+
+// ------------------------
+// Тесты GetPurchaseReturns
+// ------------------------
+func TestGetPurchaseReturnsParameters(t *testing.T) {
+	var status string
+	var limit int
+	returnsFunc := func(userID int, s string, l int) ([]models.PurchaseReturn, error) {
+		assert.Equal(t, 1, userID)
+		status, limit = s, l
+		return []models.PurchaseReturn{{ID: 1}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/api/returns?status=approved&limit=5", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+	GetPurchaseReturns(rr, req, returnsFunc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, models.ReturnApproved, status)
+	assert.Equal(t, 5, limit)
+
+	for _, query := range []string{"?status=declined", "?limit=0", "?limit=101"} {
+		req = httptest.NewRequest("GET", "/api/returns"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		rr = httptest.NewRecorder()
+		GetPurchaseReturns(rr, req, returnsFunc)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+// ---------------------------
+// Тесты ResolvePurchaseReturn
+// ---------------------------
+func TestResolvePurchaseReturn(t *testing.T) {
+	approveFunc := func(adminID, returnID int) (models.PurchaseReturn, error) {
+		assert.Equal(t, 9, adminID)
+		switch returnID {
+		case 3:
+			return models.PurchaseReturn{ID: 3, Status: models.ReturnApproved}, nil
+		case 4:
+			return models.PurchaseReturn{}, repository.ErrNotEnoughItems
+		}
+		return models.PurchaseReturn{}, repository.ErrReturnNotFound
+	}
+	rejectFunc := func(adminID, returnID int) (models.PurchaseReturn, error) {
+		if returnID == 3 {
+			return models.PurchaseReturn{ID: 3, Status: models.ReturnRejected}, nil
+		}
+		return models.PurchaseReturn{}, repository.ErrReturnClosed
+	}
+	for _, tc := range []struct {
+		path   string
+		code   int
+		status string
+	}{
+		{"/api/admin/returns/3/approve", http.StatusOK, models.ReturnApproved},
+		{"/api/admin/returns/3/reject", http.StatusOK, models.ReturnRejected},
+		{"/api/admin/returns/4/approve", http.StatusConflict, ""},
+		{"/api/admin/returns/4/reject", http.StatusConflict, ""},
+		{"/api/admin/returns/5/approve", http.StatusNotFound, ""},
+		{"/api/admin/returns/3/refund", http.StatusBadRequest, ""},
+		{"/api/admin/returns/3", http.StatusBadRequest, ""},
+		{"/api/admin/returns/x/approve", http.StatusBadRequest, ""},
+	} {
+		req := httptest.NewRequest("POST", tc.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		ResolvePurchaseReturn(rr, req, approveFunc, rejectFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path)
+		if tc.code == http.StatusOK {
+			var resolved models.PurchaseReturn
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resolved))
+			assert.Equal(t, tc.status, resolved.Status)
+		}
+	}
+}
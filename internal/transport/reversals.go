@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ReverseTransfer обрабатывает POST-запрос /api/admin/transfers/{id}/reverse - отмену ошибочного
+// или мошеннического перевода администратором. Ожидает JSON-тело {"reason": "..."}.
+// Компенсирующая операция возвращает монеты отправителю, а перевод в истории отмечается отмененным.
+// Если метод запроса не POST, возвращает ошибку 405 (Method Not Allowed).
+// Если путь или тело некорректны, причина пуста или длиннее maxReasonLength символов,
+// возвращает ошибку 400 (Bad Request).
+// Если перевода нет, возвращает ошибку 404 (Not Found).
+// Если перевод уже отменен или у получателя нет монет для возврата, возвращает ошибку 409 (Conflict).
+// В случае успеха возвращает отмену в формате JSON со статусом 200 (OK).
+func ReverseTransfer(w http.ResponseWriter, r *http.Request,
+	reverseFunc func(int, int, string) (models.TransferReversal, error)) {
+	if r.Method != http.MethodPost {
+		invalidRequestMethodResponse(w, r)
+		return
+	}
+	value, ok := strings.CutPrefix(r.URL.Path, "/api/admin/transfers/")
+	if ok {
+		value, ok = strings.CutSuffix(value, "/reverse")
+	}
+	transferID, err := strconv.Atoi(value)
+	if !ok || err != nil || transferID <= 0 {
+		badRequestResponse(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	var request models.ReversalRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Reason == "" || utf8.RuneCountInString(request.Reason) > maxReasonLength {
+		badRequestResponse(w)
+		return
+	}
+
+	reversal, err := reverseFunc(r.Context().Value("userID").(int), transferID, request.Reason)
+	switch {
+	case errors.Is(err, repository.ErrTransferNotFound):
+		notFoundResponse(w)
+	case errors.Is(err, repository.ErrTransferAlreadyReversed):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "Перевод уже отменен."})
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		jsonResponse(w, http.StatusConflict, models.ErrorResponse{Errors: "У получателя нет монет для возврата."})
+	case err != nil:
+		internalServerErrorResponse(w)
+	default:
+		jsonResponse(w, http.StatusOK, reversal)
+	}
+}
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ---------------------
+// Тесты ReverseTransfer
+// ---------------------
+func TestReverseTransfer(t *testing.T) {
+	reverseFunc := func(adminID, transferID int, reason string) (models.TransferReversal, error) {
+		assert.Equal(t, 9, adminID)
+		assert.Equal(t, "ошибочный перевод", reason)
+		switch transferID {
+		case 42:
+			return models.TransferReversal{ID: 50, TransferID: 42, Amount: 300, Returned: 200}, nil
+		case 43:
+			return models.TransferReversal{}, repository.ErrTransferAlreadyReversed
+		case 44:
+			return models.TransferReversal{}, repository.ErrInsufficientFunds
+		}
+		return models.TransferReversal{}, repository.ErrTransferNotFound
+	}
+	for _, tc := range []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/admin/transfers/42/reverse", `{"reason": " ошибочный перевод "}`, http.StatusOK},
+		{"/api/admin/transfers/43/reverse", `{"reason": "ошибочный перевод"}`, http.StatusConflict},
+		{"/api/admin/transfers/44/reverse", `{"reason": "ошибочный перевод"}`, http.StatusConflict},
+		{"/api/admin/transfers/45/reverse", `{"reason": "ошибочный перевод"}`, http.StatusNotFound},
+		{"/api/admin/transfers/42/reverse", `{"reason": " "}`, http.StatusBadRequest},
+		{"/api/admin/transfers/42/reverse", `{"reason": "` + strings.Repeat("я", maxReasonLength+1) + `"}`, http.StatusBadRequest},
+		{"/api/admin/transfers/42", `{"reason": "ошибочный перевод"}`, http.StatusBadRequest},
+		{"/api/admin/transfers/x/reverse", `{"reason": "ошибочный перевод"}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		ReverseTransfer(rr, req, reverseFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+		if tc.code == http.StatusOK {
+			var reversal models.TransferReversal
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&reversal))
+			assert.Equal(t, 200, reversal.Returned)
+		}
+	}
+}
@@ -2,23 +2,219 @@ package transport
 
 import (
 	"avito_internship/internal/auth"
+	"avito_internship/internal/config"
+	"avito_internship/internal/models"
 	"avito_internship/internal/repository"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func MapRoutes() {
-	http.HandleFunc("/api/auth", func(w http.ResponseWriter, r *http.Request) {
+// NewRouter собирает обработчики API поверх переданных зависимостей
+// и оборачивает их в middleware проверки JWT. now - часы, от которых обработчики отсчитывают сроки.
+func NewRouter(store repository.Store, tokens *auth.TokenService, cfg *config.Config,
+	now func() time.Time) http.Handler {
+	mux := http.NewServeMux()
+	MapRoutes(mux, store, tokens, cfg, now)
+	return Authenticate(mux, tokens.VerifyJWT)
+}
+
+// MapRoutes регистрирует обработчики API в mux.
+// Мутирующие обработчики оборачиваются в Idempotent и выполняют изменения через переданное им хранилище.
+// Административные обработчики дополнительно оборачиваются в RequireAdmin.
+func MapRoutes(mux *http.ServeMux, store repository.Store, tokens *auth.TokenService, cfg *config.Config,
+	now func() time.Time) {
+	isAdmin := adminChecker(store, cfg.AdminUsers)
+	limits := models.SpendingLimits{
+		PerTransfer:  cfg.LimitPerTransfer,
+		Daily:        cfg.LimitDaily,
+		Monthly:      cfg.LimitMonthly,
+		PerRecipient: cfg.LimitPerRecipient,
+	}
+
+	mux.HandleFunc("/api/auth", func(w http.ResponseWriter, r *http.Request) {
 		GetJWT(w, r, func(username, password string) (string, error) {
-			return auth.Authenticate(username, password, repository.GetUserIDPassHashOrRegister)
+			return tokens.Authenticate(username, password, func(username, passHash string) (int, []byte, error) {
+				return store.GetUserIDPassHashOrRegister(username, passHash, cfg.StartingBalance)
+			})
+		})
+	})
+	mux.HandleFunc("/api/info", func(w http.ResponseWriter, r *http.Request) {
+		GetUserInfo(w, r, func(userID int) (models.InfoResponse, error) {
+			return store.GetUserBalanceInventoryLogs(userID, cfg.CoinExpiryPeriod, cfg.CoinExpiryWarning)
+		})
+	})
+	mux.HandleFunc("/api/sendCoin", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		TransferCoins(w, r, cfg.TransferMaxDelay,
+			func(userFromID, amount int, userTo string, note models.TransferNote) error {
+				return store.SendCoins(userFromID, amount, userTo, note, limits)
+			},
+			func(userFromID, amount int, userTo string, note models.TransferNote, delay time.Duration) (models.PendingTransfer, error) {
+				return store.HoldTransfer(userFromID, amount, userTo, note, delay, limits)
+			})
+	}))
+	mux.HandleFunc("/api/sendCoin/batch", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		BatchTransferCoins(w, r, func(userFromID int, lines []models.BatchTransferLine) ([]models.BatchTransferResult, error) {
+			return store.SendCoinsBatch(userFromID, lines, limits)
 		})
+	}))
+	mux.HandleFunc("/api/pendingTransfers", func(w http.ResponseWriter, r *http.Request) {
+		GetPendingTransfers(w, r, store.GetPendingTransfers)
+	})
+	mux.HandleFunc("/api/pendingTransfers/", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		CancelPendingTransfer(w, r, store.CancelPendingTransfer)
+	}))
+	mux.HandleFunc("/api/buy/", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		BuyItems(w, r, func(userID int, itemName, variant string, amount int) error {
+			return store.BuyItemsForUser(userID, itemName, variant, amount, limits)
+		})
+	}))
+	mux.HandleFunc("/api/orders", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		PlaceOrder(w, r, func(userID int, lines []models.OrderLine) (models.OrderResponse, error) {
+			return store.PlaceOrder(userID, lines, limits)
+		})
+	}))
+	createPaymentRequest := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		CreatePaymentRequest(w, r, cfg.PaymentRequestTTL, now, store.CreatePaymentRequest)
+	})
+	mux.HandleFunc("/api/paymentRequests", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			GetPaymentRequests(w, r, store.GetPaymentRequests)
+			return
+		}
+		createPaymentRequest(w, r)
+	})
+	approvePaymentRequest := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		ApprovePaymentRequest(w, r, func(payerID, requestID int) (models.PaymentRequest, error) {
+			return store.ApprovePaymentRequest(payerID, requestID, limits)
+		})
+	})
+	closePaymentRequest := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		ClosePaymentRequest(w, r, store.ClosePaymentRequest)
+	})
+	mux.HandleFunc("/api/paymentRequests/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/approve") {
+			approvePaymentRequest(w, r)
+			return
+		}
+		closePaymentRequest(w, r)
+	})
+	mux.HandleFunc("/api/items", func(w http.ResponseWriter, r *http.Request) {
+		GetCatalog(w, r, store.GetCatalog)
+	})
+	mux.HandleFunc("/api/history", func(w http.ResponseWriter, r *http.Request) {
+		GetHistory(w, r, store.GetUserHistory)
+	})
+	mux.HandleFunc("/api/purchases", func(w http.ResponseWriter, r *http.Request) {
+		GetPurchases(w, r, store.GetUserPurchases)
+	})
+	mux.HandleFunc("/api/purchases/", Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		RequestPurchaseReturn(w, r, func(userID, purchaseID, quantity int, reason string) (models.PurchaseReturn, error) {
+			return store.RequestPurchaseReturn(userID, purchaseID, quantity, reason, cfg.PurchaseReturnWindow)
+		})
+	}))
+	mux.HandleFunc("/api/returns", func(w http.ResponseWriter, r *http.Request) {
+		GetPurchaseReturns(w, r, store.GetPurchaseReturns)
+	})
+	mux.HandleFunc("/api/admin/mint", RequireAdmin(Idempotent(store,
+		func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+			AdjustBalances(w, r, models.TransactionMint, cfg.AdminOperationLimit, store.AdjustBalances)
+		}), isAdmin))
+	mux.HandleFunc("/api/admin/clawback", RequireAdmin(Idempotent(store,
+		func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+			AdjustBalances(w, r, models.TransactionClawback, cfg.AdminOperationLimit, store.AdjustBalances)
+		}), isAdmin))
+	mux.HandleFunc("/api/admin/transfers/", RequireAdmin(Idempotent(store,
+		func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+			ReverseTransfer(w, r, func(adminID, transferID int, reason string) (models.TransferReversal, error) {
+				return store.ReverseTransfer(adminID, transferID, reason, cfg.ReversalMode == config.ReversalDebt)
+			})
+		}), isAdmin))
+	mux.HandleFunc("/api/admin/returns", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		GetPurchaseReturns(w, r, func(_ int, status string, limit int) ([]models.PurchaseReturn, error) {
+			return store.GetPurchaseReturns(0, status, limit)
+		})
+	}, isAdmin))
+	mux.HandleFunc("/api/admin/returns/", RequireAdmin(Idempotent(store,
+		func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+			ResolvePurchaseReturn(w, r, store.ApprovePurchaseReturn, store.RejectPurchaseReturn)
+		}), isAdmin))
+	restockItem := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		RestockItem(w, r, store.RestockItem)
+	})
+	setItemStock := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		SetItemStock(w, r, store.SetItemStock)
+	})
+	createItemVariant := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		CreateItemVariant(w, r, store.CreateItemVariant)
+	})
+	mux.HandleFunc("/api/admin/items/", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/restock"):
+			restockItem(w, r)
+		case strings.HasSuffix(r.URL.Path, "/variants"):
+			createItemVariant(w, r)
+		default:
+			setItemStock(w, r)
+		}
+	}, isAdmin))
+	mux.HandleFunc("/api/admin/variants/", RequireAdmin(Idempotent(store,
+		func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+			RestockItemVariant(w, r, store.RestockItemVariant)
+		}), isAdmin))
+	createCampaign := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		CreateGrantCampaign(w, r, cfg.AdminOperationLimit, store.CreateGrantCampaign)
+	})
+	mux.HandleFunc("/api/admin/campaigns", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			GetGrantCampaigns(w, r, store.GetGrantCampaigns)
+			return
+		}
+		createCampaign(w, r)
+	}, isAdmin))
+	createRule := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		CreateAllowanceRule(w, r, cfg.AdminOperationLimit, store.CreateAllowanceRule)
+	})
+	mux.HandleFunc("/api/admin/allowances", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			GetAllowanceRules(w, r, store.GetAllowanceRules)
+			return
+		}
+		createRule(w, r)
+	}, isAdmin))
+	mux.HandleFunc("/api/admin/allowances/preview", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		PreviewAllowanceRule(w, r, cfg.AdminOperationLimit, now, store.CountUsersWithRole)
+	}, isAdmin))
+	updateRule := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		UpdateAllowanceRule(w, r, cfg.AdminOperationLimit, store.UpdateAllowanceRule)
 	})
-	http.HandleFunc("/api/info", func(w http.ResponseWriter, r *http.Request) {
-		GetUserInfo(w, r, repository.GetUserBalanceInventoryLogs)
+	deleteRule := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		DeleteAllowanceRule(w, r, store.DeleteAllowanceRule)
 	})
-	http.HandleFunc("/api/sendCoin", func(w http.ResponseWriter, r *http.Request) {
-		TransferCoins(w, r, repository.SendCoins)
+	mux.HandleFunc("/api/admin/allowances/", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/runs"):
+			GetAllowanceRuns(w, r, store.GetAllowanceRuns)
+		case r.Method == http.MethodDelete:
+			deleteRule(w, r)
+		default:
+			updateRule(w, r)
+		}
+	}, isAdmin))
+	setLimits := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		SetUserLimits(w, r, store.SetUserLimits)
 	})
-	http.HandleFunc("/api/buy/", func(w http.ResponseWriter, r *http.Request) {
-		BuyItems(w, r, repository.BuyItemsForUser)
+	deleteLimits := Idempotent(store, func(w http.ResponseWriter, r *http.Request, store repository.Store) {
+		DeleteUserLimits(w, r, store.DeleteUserLimits)
 	})
+	mux.HandleFunc("/api/admin/limits/", RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetUserLimits(w, r, limits, store.GetUserLimits)
+		case http.MethodDelete:
+			deleteLimits(w, r)
+		default:
+			setLimits(w, r)
+		}
+	}, isAdmin))
 }
@@ -1,13 +1,17 @@
 package transport
 
 import (
-	"avito_internship/internal/auth"
 	"log"
 	"net/http"
+	"time"
 )
 
-func Run() {
-	MapRoutes()
-	authMiddleware := Authenticate(http.DefaultServeMux, auth.VerifyJWT)
-	log.Fatal(http.ListenAndServe(":8080", authMiddleware))
+// NewServer создает HTTP-сервер, обслуживающий handler на адресе addr
+func NewServer(addr string, handler http.Handler, logger *log.Logger) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ErrorLog:          logger,
+	}
 }
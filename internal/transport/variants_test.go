@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"avito_internship/internal/models"
+	"avito_internship/internal/repository"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// -----------------------
+// Тесты CreateItemVariant
+// -----------------------
+func TestCreateItemVariant(t *testing.T) {
+	var received models.ItemVariantRequest
+	createFunc := func(adminID int, item string, variant models.ItemVariantRequest) (models.CatalogVariant, error) {
+		assert.Equal(t, 9, adminID)
+		switch {
+		case item != "hoody":
+			return models.CatalogVariant{}, repository.ErrItemNotFound
+		case variant.SKU == "hoody-l":
+			return models.CatalogVariant{}, repository.ErrVariantExists
+		}
+		received = variant
+		return models.CatalogVariant{SKU: variant.SKU, Attributes: variant.Attributes, Price: 300,
+			Stock: variant.Stock, Available: true}, nil
+	}
+	for _, tc := range []struct {
+		path   string
+		body   string
+		code   int
+		method string
+	}{
+		{"/api/admin/items/hoody/variants", `{"sku": " hoody-m ", "attributes": {"size": "M"}, "stock": 2}`, http.StatusOK, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody-l"}`, http.StatusConflict, "POST"},
+		{"/api/admin/items/yacht/variants", `{"sku": "yacht-s"}`, http.StatusNotFound, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": ""}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody/m"}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "` + strings.Repeat("x", 65) + `"}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody-s", "price": -1}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody-s", "stock": -1}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody-s", "attributes": {" ": "S"}}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": 1}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items//variants", `{"sku": "hoody-s"}`, http.StatusBadRequest, "POST"},
+		{"/api/admin/items/hoody/variants", `{"sku": "hoody-s"}`, http.StatusMethodNotAllowed, "PUT"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		CreateItemVariant(rr, req, createFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+	}
+	assert.Equal(t, models.ItemVariantRequest{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Stock: intPointer(2),
+	}, received)
+}
+
+// ------------------------
+// Тесты RestockItemVariant
+// ------------------------
+func TestRestockItemVariant(t *testing.T) {
+	restockFunc := func(adminID int, sku string, quantity int) (models.CatalogVariant, error) {
+		assert.Equal(t, 9, adminID)
+		switch sku {
+		case "hoody-m":
+			return models.CatalogVariant{SKU: sku, Stock: &quantity, Available: true}, nil
+		case "hoody-l":
+			return models.CatalogVariant{}, repository.ErrUnlimitedStock
+		}
+		return models.CatalogVariant{}, repository.ErrVariantNotFound
+	}
+	for _, tc := range []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/admin/variants/hoody-m/restock", `{"quantity": 5}`, http.StatusOK},
+		{"/api/admin/variants/hoody-l/restock", `{"quantity": 5}`, http.StatusConflict},
+		{"/api/admin/variants/yacht-s/restock", `{"quantity": 5}`, http.StatusNotFound},
+		{"/api/admin/variants/hoody-m/restock", `{"quantity": -5}`, http.StatusBadRequest},
+		{"/api/admin/variants//restock", `{"quantity": 5}`, http.StatusBadRequest},
+		{"/api/admin/variants/hoody-m", `{"quantity": 5}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 9))
+		rr := httptest.NewRecorder()
+
+		RestockItemVariant(rr, req, restockFunc)
+		require.Equal(t, tc.code, rr.Code, tc.path+" "+tc.body)
+		if tc.code == http.StatusOK {
+			var variant models.CatalogVariant
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&variant))
+			assert.Equal(t, 5, *variant.Stock)
+		}
+	}
+}
+
+// ----------------------
+// Тесты покупки варианта
+// ----------------------
+func TestBuyItemsVariant(t *testing.T) {
+	buyFunc := func(userID int, item, variant string, quantity int) error {
+		if variant == "hoody-m" {
+			return nil
+		}
+		return &repository.StockError{Item: item, Variant: variant, Code: models.StockOutOfStock}
+	}
+	req := httptest.NewRequest("GET", "/api/buy/hoody?variant=hoody-m", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr := httptest.NewRecorder()
+	BuyItems(rr, req, buyFunc)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest("GET", "/api/buy/hoody?variant=hoody-xl", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+	rr = httptest.NewRecorder()
+	BuyItems(rr, req, buyFunc)
+	require.Equal(t, http.StatusConflict, rr.Code)
+	var response models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "hoody", response.Item)
+	assert.Equal(t, "hoody-xl", response.Variant)
+}
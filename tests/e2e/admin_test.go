@@ -0,0 +1,60 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// TestAdminMintAndClawback это сценарий где администратор начисляет монеты списку пользователей,
+// а затем списывает часть у одного из них, и обе операции видны в истории с причиной
+func TestAdminMintAndClawback(t *testing.T) {
+	baseURL := newTestServer(t)
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	aliceToken := registerUser(t, baseURL+"/api/auth", "adminAlice", "password")
+	registerUser(t, baseURL+"/api/auth", "adminBob", "password")
+	before := getUserInfo(t, baseURL+"/api/info", aliceToken).Coins
+
+	resp := adjustBalances(t, baseURL+"/api/admin/mint", adminToken,
+		models.AdjustmentRequest{Users: []string{"adminAlice", "adminBob"}, Amount: 200, Reason: "onboarding bonus"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = adjustBalances(t, baseURL+"/api/admin/clawback", adminToken,
+		models.AdjustmentRequest{Users: []string{"adminAlice"}, Amount: 50, Reason: "mistaken payout"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	info := getUserInfo(t, baseURL+"/api/info", aliceToken)
+	assert.Equal(t, before+150, info.Coins)
+	assert.Contains(t, info.CoinHistory.Received,
+		models.CoinTransaction{User: "admin", Amount: 200, Type: models.TransactionMint, Reason: "onboarding bonus"})
+	assert.Contains(t, info.CoinHistory.Sent,
+		models.CoinTransaction{User: "admin", Amount: 50, Type: models.TransactionClawback, Reason: "mistaken payout"})
+}
+
+// TestAdminEndpointsForbidden проверяет что обычный пользователь не может начислять монеты
+func TestAdminEndpointsForbidden(t *testing.T) {
+	baseURL := newTestServer(t)
+	token := registerUser(t, baseURL+"/api/auth", "notAnAdmin", "password")
+
+	resp := adjustBalances(t, baseURL+"/api/admin/mint", token,
+		models.AdjustmentRequest{Users: []string{"notAnAdmin"}, Amount: 1000, Reason: "free money"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// adjustBalances отправляет запрос на начисление или списание монет и возвращает ответ
+func adjustBalances(t *testing.T, adminURL, token string, adjustment models.AdjustmentRequest) *http.Response {
+	body, err := json.Marshal(adjustment)
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", adminURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
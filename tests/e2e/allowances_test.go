@@ -0,0 +1,88 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestAllowanceRules это сценарий где администратор проверяет правило пробным запуском, создает его на паузе,
+// меняет и удаляет. Правило остается на паузе, поэтому планировщик ничего не начисляет другим тестам
+func TestAllowanceRules(t *testing.T) {
+	baseURL := newTestServer(t)
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	userToken := registerUser(t, baseURL+"/api/auth", fmt.Sprintf("user%d", time.Now().UnixNano()), "password")
+	rule := models.AllowanceRule{
+		Name:     fmt.Sprintf("monthly %d", time.Now().UnixNano()),
+		Amount:   100,
+		Schedule: "0 9 1 * *",
+		Paused:   true,
+	}
+
+	resp := apiRequest(t, "POST", baseURL+"/api/admin/allowances/preview", adminToken, rule)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var preview models.AllowancePreview
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&preview))
+	assert.Len(t, preview.NextRuns, 5)
+	assert.GreaterOrEqual(t, preview.Users, 2)
+	assert.Equal(t, preview.Users*rule.Amount, preview.Total)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/allowances", userToken, rule)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/allowances", adminToken, rule)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var created models.AllowanceRule
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.NotZero(t, created.ID)
+	assert.True(t, created.Paused)
+
+	ruleURL := fmt.Sprintf("%s/api/admin/allowances/%d", baseURL, created.ID)
+	rule.Amount = 150
+	resp = apiRequest(t, "PUT", ruleURL, adminToken, rule)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = apiRequest(t, "GET", baseURL+"/api/admin/allowances", adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rules models.AllowanceRulesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rules))
+	assert.Contains(t, rules.Rules, models.AllowanceRule{
+		ID: created.ID, Name: rule.Name, Amount: 150, Schedule: rule.Schedule, Paused: true, CreatedAt: created.CreatedAt,
+	})
+
+	resp = apiRequest(t, "GET", ruleURL+"/runs", adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var runs models.AllowanceRunsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&runs))
+	assert.Empty(t, runs.Runs)
+
+	resp = apiRequest(t, "DELETE", ruleURL, adminToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "DELETE", ruleURL, adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// apiRequest выполняет запрос к API от имени пользователя, тело передается в формате JSON, если оно задано
+func apiRequest(t *testing.T, method, url, token string, body any) *http.Response {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
@@ -0,0 +1,63 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestBatchTransfers это сценарий где руководитель выплачивает премии команде одним пакетом:
+// пакет с опечаткой в имени отклоняется целиком с указанием строки, исправленный выполняется
+// атомарно, и каждый получатель видит свой перевод в истории
+func TestBatchTransfers(t *testing.T) {
+	baseURL := newTestServer(t)
+	suffix := time.Now().UnixNano()
+	manager := fmt.Sprintf("manager%d", suffix)
+	first := fmt.Sprintf("first%d", suffix)
+	second := fmt.Sprintf("second%d", suffix)
+	managerToken := registerUser(t, baseURL+"/api/auth", manager, "password")
+	firstToken := registerUser(t, baseURL+"/api/auth", first, "password")
+	secondToken := registerUser(t, baseURL+"/api/auth", second, "password")
+	batchURL := baseURL + "/api/sendCoin/batch"
+
+	resp := apiRequest(t, "POST", batchURL, managerToken, models.BatchTransferRequest{Transfers: []models.BatchTransferLine{
+		{ToUser: first, Amount: 300, Message: "Премия"},
+		{ToUser: second + "x", Amount: 200, Message: "Премия"},
+	}})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var rejected models.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rejected))
+	require.Len(t, rejected.Results, 2)
+	assert.Equal(t, models.BatchLineSkipped, rejected.Results[0].Status)
+	assert.Equal(t, models.BatchErrorUserNotFound, rejected.Results[1].Error)
+	assert.Equal(t, 1000, getUserInfo(t, baseURL+"/api/info", managerToken).Coins)
+
+	resp = apiRequest(t, "POST", batchURL, managerToken, models.BatchTransferRequest{Transfers: []models.BatchTransferLine{
+		{ToUser: first, Amount: 600}, {ToUser: second, Amount: 600},
+	}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = apiRequest(t, "POST", batchURL, managerToken, models.BatchTransferRequest{Transfers: []models.BatchTransferLine{
+		{ToUser: first, Amount: 300, Message: "Премия"},
+		{ToUser: second, Amount: 200, Message: "Премия"},
+	}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var batch models.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+	assert.Equal(t, 500, batch.Total)
+	for _, result := range batch.Results {
+		assert.Equal(t, models.BatchLineTransferred, result.Status)
+		assert.NotZero(t, result.TransactionID)
+	}
+
+	assert.Equal(t, 500, getUserInfo(t, baseURL+"/api/info", managerToken).Coins)
+	firstInfo := getUserInfo(t, baseURL+"/api/info", firstToken)
+	assert.Equal(t, 1300, firstInfo.Coins)
+	assert.Contains(t, firstInfo.CoinHistory.Received, models.CoinTransaction{User: manager, Amount: 300, Message: "Премия"})
+	assert.Equal(t, 1200, getUserInfo(t, baseURL+"/api/info", secondToken).Coins)
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func TestPurchaseAndInventory(t *testing.T) {
-	baseURL := "http://avito-shop-service-test:8080"
+	baseURL := newTestServer(t)
 	authURL := baseURL + "/api/auth"
 	infoURL := baseURL + "/api/info"
 	purchaseURL := baseURL + "/api/buy/t-shirt"
@@ -13,7 +13,7 @@ import (
 )
 
 func TestRegistration(t *testing.T) {
-	apiURL := "http://avito-shop-service-test:8080/api/auth"
+	apiURL := newTestServer(t) + "/api/auth"
 	payload := models.AuthRequest{
 		Username: "testUserID1",
 		Password: "testUserID1",
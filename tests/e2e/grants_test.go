@@ -0,0 +1,67 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// welcomeGrant - приветственное начисление, которое видит в истории каждый новый пользователь
+var welcomeGrant = models.CoinTransaction{Amount: 1000, Type: models.TransactionGrant, Reason: models.WelcomeGrantReason}
+
+// TestGrantCampaign это сценарий где администратор задним числом создает кампанию начислений:
+// монеты получают пользователи, зарегистрированные в период кампании, а зарегистрированные позже - нет
+func TestGrantCampaign(t *testing.T) {
+	baseURL := newTestServer(t)
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	earlyToken := registerUser(t, baseURL+"/api/auth", fmt.Sprintf("early%d", time.Now().UnixNano()), "password")
+
+	// кампания заканчивается в момент создания, поэтому не влияет на регистрации в других тестах
+	now := time.Now().UTC()
+	campaign := models.GrantCampaign{
+		Name:     fmt.Sprintf("onboarding week %d", now.UnixNano()),
+		Amount:   200,
+		StartsAt: now.Add(-time.Hour),
+		EndsAt:   now,
+	}
+	created := createGrantCampaign(t, baseURL+"/api/admin/campaigns", adminToken, campaign)
+	assert.NotZero(t, created.ID)
+	assert.GreaterOrEqual(t, created.Granted, 1)
+
+	lateToken := registerUser(t, baseURL+"/api/auth", fmt.Sprintf("late%d", time.Now().UnixNano()), "password")
+
+	early := getUserInfo(t, baseURL+"/api/info", earlyToken)
+	assert.Equal(t, 1200, early.Coins)
+	assert.Equal(t, []models.CoinTransaction{
+		welcomeGrant,
+		{Amount: 200, Type: models.TransactionGrant, Reason: campaign.Name},
+	}, early.CoinHistory.Received)
+	late := getUserInfo(t, baseURL+"/api/info", lateToken)
+	assert.Equal(t, 1000, late.Coins)
+	assert.Equal(t, []models.CoinTransaction{welcomeGrant}, late.CoinHistory.Received)
+}
+
+// createGrantCampaign создает кампанию начислений от имени администратора и возвращает ее
+func createGrantCampaign(t *testing.T, campaignsURL, token string, campaign models.GrantCampaign) models.GrantCampaign {
+	body, err := json.Marshal(campaign)
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", campaignsURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var created models.GrantCampaign
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	return created
+}
@@ -0,0 +1,116 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestHistoryPagination это сценарий где пользователь делает несколько переводов
+// и постранично читает историю через /api/history, переходя по курсору
+func TestHistoryPagination(t *testing.T) {
+	baseURL := newTestServer(t)
+	authURL := baseURL + "/api/auth"
+	transferURL := baseURL + "/api/sendCoin"
+
+	tokenA := registerUser(t, authURL, "historyUserA", "passwordA")
+	tokenB := registerUser(t, authURL, "historyUserB", "passwordB")
+
+	transferCoins(t, transferURL, tokenA, "historyUserB", 10)
+	transferCoins(t, transferURL, tokenB, "historyUserA", 20)
+	transferCoins(t, transferURL, tokenA, "historyUserB", 30)
+
+	firstPage := getHistory(t, baseURL+"/api/history?limit=2", tokenA)
+	require.Len(t, firstPage.Entries, 2)
+	assert.Equal(t, 30, firstPage.Entries[0].Amount)
+	assert.Equal(t, models.DirectionSent, firstPage.Entries[0].Direction)
+	assert.Equal(t, "historyUserB", firstPage.Entries[0].User)
+	assert.NotZero(t, firstPage.Entries[0].ID)
+	assert.False(t, firstPage.Entries[0].Date.IsZero())
+	assert.Equal(t, 20, firstPage.Entries[1].Amount)
+	assert.Equal(t, models.DirectionReceived, firstPage.Entries[1].Direction)
+	require.NotEmpty(t, firstPage.NextCursor)
+
+	secondPage := getHistory(t, baseURL+"/api/history?limit=2&cursor="+firstPage.NextCursor, tokenA)
+	require.Len(t, secondPage.Entries, 2)
+	assert.Equal(t, 10, secondPage.Entries[0].Amount)
+	assert.Equal(t, models.TransactionGrant, secondPage.Entries[1].Type)
+	assert.Equal(t, models.WelcomeGrantReason, secondPage.Entries[1].Reason)
+	assert.Empty(t, secondPage.NextCursor)
+
+	received := getHistory(t, baseURL+"/api/history?direction=received&user=historyUserB", tokenA)
+	require.Len(t, received.Entries, 1)
+	assert.Equal(t, 20, received.Entries[0].Amount)
+}
+
+// TestHistoryTransferNote это сценарий где пользователь благодарит коллегу переводом с сообщением и категорией,
+// а получатель видит их в /api/info и /api/history
+func TestHistoryTransferNote(t *testing.T) {
+	baseURL := newTestServer(t)
+	sender := fmt.Sprintf("kudosFrom%d", time.Now().UnixNano())
+	receiver := fmt.Sprintf("kudosTo%d", time.Now().UnixNano())
+	senderToken := registerUser(t, baseURL+"/api/auth", sender, "password")
+	receiverToken := registerUser(t, baseURL+"/api/auth", receiver, "password")
+
+	resp := apiRequest(t, "POST", baseURL+"/api/sendCoin", senderToken, models.SendCoinRequest{
+		ToUser: receiver, Amount: 25, Message: " Спасибо\nза ревью! ", Category: models.CategoryThanks,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "POST", baseURL+"/api/sendCoin", senderToken, models.SendCoinRequest{
+		ToUser: receiver, Amount: 25, Category: "bribe",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	info := getUserInfo(t, baseURL+"/api/info", receiverToken)
+	assert.Contains(t, info.CoinHistory.Received, models.CoinTransaction{
+		User: sender, Amount: 25, Message: "Спасибо за ревью!", Category: models.CategoryThanks,
+	})
+
+	history := getHistory(t, baseURL+"/api/history?direction=received&user="+sender, receiverToken)
+	require.Len(t, history.Entries, 1)
+	assert.Equal(t, "Спасибо за ревью!", history.Entries[0].Message)
+	assert.Equal(t, models.CategoryThanks, history.Entries[0].Category)
+}
+
+// registerUser регистрирует пользователя через authURL и возвращает его токен
+func registerUser(t *testing.T, authURL, username, password string) string {
+	jsonPayload, err := json.Marshal(models.AuthRequest{Username: username, Password: password})
+	require.NoError(t, err)
+
+	resp, err := http.Post(authURL, "application/json", bytes.NewBuffer(jsonPayload))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var tokenResp models.AuthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokenResp))
+	require.NotEmpty(t, tokenResp.Token)
+	return tokenResp.Token
+}
+
+// getHistory отправляет GET-запрос на historyURL с указанным токеном и возвращает страницу истории.
+func getHistory(t *testing.T, historyURL, token string) models.HistoryResponse {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", historyURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var historyResp models.HistoryResponse
+	require.NoError(t, json.Unmarshal(body, &historyResp))
+	return historyResp
+}
@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// TestIdempotentTransferRetry это сценарий где клиент повторяет перевод с тем же Idempotency-Key:
+// монеты списываются один раз, а повтор с другим телом отклоняется
+func TestIdempotentTransferRetry(t *testing.T) {
+	baseURL := newTestServer(t)
+	senderToken := registerUser(t, baseURL+"/api/auth", "idempotentSender", "password")
+	registerUser(t, baseURL+"/api/auth", "idempotentReceiver", "password")
+
+	for i := 0; i < 3; i++ {
+		resp := sendCoinWithKey(t, baseURL+"/api/sendCoin", senderToken, "retry-1",
+			models.SendCoinRequest{ToUser: "idempotentReceiver", Amount: 100})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp := sendCoinWithKey(t, baseURL+"/api/sendCoin", senderToken, "retry-1",
+		models.SendCoinRequest{ToUser: "idempotentReceiver", Amount: 200})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	info := getUserInfo(t, baseURL+"/api/info", senderToken)
+	assert.Equal(t, 900, info.Coins)
+	assert.Len(t, info.CoinHistory.Sent, 1)
+}
+
+// sendCoinWithKey отправляет перевод с заголовком Idempotency-Key и возвращает ответ
+func sendCoinWithKey(t *testing.T, transferURL, token, key string, transfer models.SendCoinRequest) *http.Response {
+	body, err := json.Marshal(transfer)
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", transferURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
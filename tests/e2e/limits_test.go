@@ -0,0 +1,53 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestUserLimits это сценарий где администратор задает пользователю лимит на один перевод, перевод сверх лимита
+// отклоняется с указанием лимита и остатка, а после удаления лимита проходит
+func TestUserLimits(t *testing.T) {
+	baseURL := newTestServer(t)
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	username := fmt.Sprintf("user%d", time.Now().UnixNano())
+	receiver := fmt.Sprintf("receiver%d", time.Now().UnixNano())
+	userToken := registerUser(t, baseURL+"/api/auth", username, "password")
+	registerUser(t, baseURL+"/api/auth", receiver, "password")
+	limitsURL := baseURL + "/api/admin/limits/" + username
+	transfer := models.SendCoinRequest{ToUser: receiver, Amount: 150}
+
+	resp := apiRequest(t, "PUT", limitsURL, userToken, models.SpendingLimits{PerTransfer: 100})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = apiRequest(t, "PUT", limitsURL, adminToken, models.SpendingLimits{PerTransfer: 100})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = apiRequest(t, "GET", limitsURL, adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var limits models.UserLimits
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&limits))
+	assert.True(t, limits.Override)
+	assert.Equal(t, 100, limits.Limits.PerTransfer)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/sendCoin", userToken, transfer)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var limitErr models.LimitErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&limitErr))
+	assert.Equal(t, models.LimitPerTransfer, limitErr.Limit)
+	assert.Equal(t, 100, limitErr.Remaining)
+
+	resp = apiRequest(t, "DELETE", limitsURL, adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/sendCoin", userToken, transfer)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	info := getUserInfo(t, baseURL+"/api/info", userToken)
+	assert.Equal(t, 850, info.Coins)
+}
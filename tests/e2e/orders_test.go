@@ -0,0 +1,59 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// TestPlaceOrder это сценарий где пользователь покупает несколько предметов одним заказом,
+// а заказ, на который не хватает монет, не покупает ни одной позиции
+func TestPlaceOrder(t *testing.T) {
+	baseURL := newTestServer(t)
+	token := registerUser(t, baseURL+"/api/auth", "orderUser", "password")
+
+	resp := placeOrder(t, baseURL+"/api/orders", token, models.OrderRequest{Items: []models.OrderLine{
+		{Item: "cup", Quantity: 2},
+		{Item: "pen", Quantity: 3},
+	}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.OrderResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Positive(t, order.OrderID)
+	assert.Equal(t, 70, order.Total)
+
+	resp = placeOrder(t, baseURL+"/api/orders", token, models.OrderRequest{Items: []models.OrderLine{
+		{Item: "book", Quantity: 1},
+		{Item: "pink-hoody", Quantity: 2},
+	}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	buyItem(t, baseURL+"/api/buy/socks?quantity=2", token)
+
+	info := getUserInfo(t, baseURL+"/api/info", token)
+	assert.Equal(t, 910, info.Coins)
+	assert.ElementsMatch(t, []models.Item{
+		{Type: "cup", Quantity: 2},
+		{Type: "pen", Quantity: 3},
+		{Type: "socks", Quantity: 2},
+	}, info.Inventory)
+}
+
+// placeOrder отправляет POST-запрос заказа на ordersURL и возвращает ответ
+func placeOrder(t *testing.T, ordersURL, token string, order models.OrderRequest) *http.Response {
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", ordersURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
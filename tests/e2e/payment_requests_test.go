@@ -0,0 +1,83 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestPaymentRequests это сценарий где пользователь запрашивает монеты у коллеги: запрос сверх баланса
+// не проходит и остается открытым, обычный запрос одобряется с переводом, а лишние запросы отклоняются и отменяются
+func TestPaymentRequests(t *testing.T) {
+	baseURL := newTestServer(t)
+	requester := fmt.Sprintf("requester%d", time.Now().UnixNano())
+	payer := fmt.Sprintf("payer%d", time.Now().UnixNano())
+	requesterToken := registerUser(t, baseURL+"/api/auth", requester, "password")
+	payerToken := registerUser(t, baseURL+"/api/auth", payer, "password")
+	requestsURL := baseURL + "/api/paymentRequests"
+
+	tooLarge := createPaymentRequest(t, requestsURL, requesterToken, models.PaymentRequest{Payer: payer, Amount: 5000})
+	resp := apiRequest(t, "POST", fmt.Sprintf("%s/%d/approve", requestsURL, tooLarge.ID), payerToken, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	lunch := createPaymentRequest(t, requestsURL, requesterToken, models.PaymentRequest{
+		Payer: payer, Amount: 150, Note: "Обед в пятницу",
+	})
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/approve", requestsURL, lunch.ID), requesterToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = apiRequest(t, "GET", requestsURL+"?status=pending", payerToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var incoming models.PaymentRequestsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&incoming))
+	require.Len(t, incoming.Requests, 2)
+	assert.Equal(t, lunch.ID, incoming.Requests[0].ID)
+	assert.Equal(t, requester, incoming.Requests[0].Requester)
+
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/approve", requestsURL, lunch.ID), payerToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var approved models.PaymentRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&approved))
+	assert.Equal(t, models.PaymentRequestApproved, approved.Status)
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/approve", requestsURL, lunch.ID), payerToken, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	info := getUserInfo(t, baseURL+"/api/info", requesterToken)
+	assert.Equal(t, 1150, info.Coins)
+	assert.Contains(t, info.CoinHistory.Received, models.CoinTransaction{User: payer, Amount: 150, Message: "Обед в пятницу"})
+
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/decline", requestsURL, tooLarge.ID), payerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	extra := createPaymentRequest(t, requestsURL, requesterToken, models.PaymentRequest{Payer: payer, Amount: 10})
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/cancel", requestsURL, extra.ID), requesterToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = apiRequest(t, "GET", requestsURL+"?direction=outgoing", requesterToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var outgoing models.PaymentRequestsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&outgoing))
+	var statuses []string
+	for _, request := range outgoing.Requests {
+		statuses = append(statuses, request.Status)
+	}
+	assert.Equal(t, []string{
+		models.PaymentRequestCancelled, models.PaymentRequestApproved, models.PaymentRequestDeclined,
+	}, statuses)
+}
+
+// createPaymentRequest создает запрос монет и возвращает его
+func createPaymentRequest(t *testing.T, requestsURL, token string, request models.PaymentRequest) models.PaymentRequest {
+	resp := apiRequest(t, "POST", requestsURL, token, map[string]any{
+		"payer": request.Payer, "amount": request.Amount, "note": request.Note,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var created models.PaymentRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, models.PaymentRequestPending, created.Status)
+	return created
+}
@@ -0,0 +1,62 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestPendingTransfers это сценарий где сотрудник отправляет перевод с задержкой, замечает опечатку
+// и отменяет его: пока перевод ждет зачисления, монеты зарезервированы и недоступны для других трат,
+// получатель их не видит, а после отмены они возвращаются отправителю
+func TestPendingTransfers(t *testing.T) {
+	baseURL := newTestServer(t)
+	sender := fmt.Sprintf("sender%d", time.Now().UnixNano())
+	receiver := fmt.Sprintf("receiver%d", time.Now().UnixNano())
+	senderToken := registerUser(t, baseURL+"/api/auth", sender, "password")
+	receiverToken := registerUser(t, baseURL+"/api/auth", receiver, "password")
+	pendingURL := baseURL + "/api/pendingTransfers"
+
+	resp := apiRequest(t, "POST", baseURL+"/api/sendCoin", senderToken, models.SendCoinRequest{
+		ToUser: receiver, Amount: 800, Message: "Премия", DelayMinutes: 30,
+	})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var held models.PendingTransfer
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&held))
+	assert.Equal(t, models.PendingTransferPending, held.Status)
+	assert.Equal(t, receiver, held.ToUser)
+
+	// Зарезервированные монеты нельзя потратить повторно
+	resp = apiRequest(t, "POST", baseURL+"/api/sendCoin", senderToken, models.SendCoinRequest{ToUser: receiver, Amount: 300})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 200, getUserInfo(t, baseURL+"/api/info", senderToken).Coins)
+	receiverInfo := getUserInfo(t, baseURL+"/api/info", receiverToken)
+	assert.Equal(t, 1000, receiverInfo.Coins)
+	assert.Len(t, receiverInfo.CoinHistory.Received, 1)
+
+	resp = apiRequest(t, "GET", pendingURL, senderToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var pending models.PendingTransfersResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+	require.Len(t, pending.Transfers, 1)
+	assert.Equal(t, held.ID, pending.Transfers[0].ID)
+
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/cancel", pendingURL, held.ID), receiverToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/cancel", pendingURL, held.ID), senderToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var cancelled models.PendingTransfer
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cancelled))
+	assert.Equal(t, models.PendingTransferCancelled, cancelled.Status)
+	resp = apiRequest(t, "POST", fmt.Sprintf("%s/%d/cancel", pendingURL, held.ID), senderToken, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	senderInfo := getUserInfo(t, baseURL+"/api/info", senderToken)
+	assert.Equal(t, 1000, senderInfo.Coins)
+	assert.Empty(t, senderInfo.CoinHistory.Sent)
+}
@@ -0,0 +1,71 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestPurchaseReturn это сценарий где пользователь возвращает часть покупки: администратор одобряет
+// возврат, предметы списываются из инвентаря, монеты возвращаются по цене покупки, а возврат виден
+// в истории покупок
+func TestPurchaseReturn(t *testing.T) {
+	baseURL := newTestServer(t)
+	buyer := fmt.Sprintf("returnBuyer%d", time.Now().UnixNano())
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	token := registerUser(t, baseURL+"/api/auth", buyer, "password")
+
+	buyItem(t, baseURL+"/api/buy/cup?quantity=3", token)
+	purchases := getPurchases(t, baseURL+"/api/purchases", token)
+	require.Len(t, purchases.Entries, 1)
+	returnURL := fmt.Sprintf("%s/api/purchases/%d/return", baseURL, purchases.Entries[0].ID)
+
+	resp := apiRequest(t, "POST", returnURL, token, models.ReturnRequest{Quantity: 4})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = apiRequest(t, "POST", returnURL, adminToken, models.ReturnRequest{Quantity: 1})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = apiRequest(t, "POST", returnURL, token, models.ReturnRequest{Quantity: 2, Reason: "не подошли"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var created models.PurchaseReturn
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, models.ReturnPending, created.Status)
+	assert.Equal(t, 40, created.Refund)
+
+	resp = apiRequest(t, "GET", baseURL+"/api/admin/returns?status=pending", token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = apiRequest(t, "GET", baseURL+"/api/admin/returns?status=pending", adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var pending models.PurchaseReturnsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+	assert.Contains(t, pending.Returns, created)
+
+	approveURL := fmt.Sprintf("%s/api/admin/returns/%d/approve", baseURL, created.ID)
+	resp = apiRequest(t, "POST", approveURL, token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = apiRequest(t, "POST", approveURL, adminToken, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "POST", approveURL, adminToken, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	info := getUserInfo(t, baseURL+"/api/info", token)
+	assert.Equal(t, 1000-60+40, info.Coins)
+	assert.Equal(t, []models.Item{{Type: "cup", Quantity: 1}}, info.Inventory)
+
+	purchases = getPurchases(t, baseURL+"/api/purchases", token)
+	require.Len(t, purchases.Entries, 1)
+	assert.Equal(t, 2, purchases.Entries[0].ReturnedQuantity)
+	assert.Equal(t, 40, purchases.Entries[0].Refunded)
+
+	resp = apiRequest(t, "GET", baseURL+"/api/returns", token, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var returns models.PurchaseReturnsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&returns))
+	require.Len(t, returns.Returns, 1)
+	assert.Equal(t, models.ReturnApproved, returns.Returns[0].Status)
+}
@@ -0,0 +1,68 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// TestPurchaseHistory это сценарий где пользователь покупает несколько предметов
+// и проверяет их в истории покупок /api/purchases
+func TestPurchaseHistory(t *testing.T) {
+	baseURL := newTestServer(t)
+	token := registerUser(t, baseURL+"/api/auth", "purchaseHistoryUser", "password")
+
+	buyItem(t, baseURL+"/api/buy/cup", token)
+	buyItem(t, baseURL+"/api/buy/pen", token)
+	buyItem(t, baseURL+"/api/buy/cup", token)
+
+	all := getPurchases(t, baseURL+"/api/purchases", token)
+	require.Len(t, all.Entries, 3)
+	assert.Equal(t, "cup", all.Entries[0].Item)
+	assert.Equal(t, 1, all.Entries[0].Quantity)
+	assert.Equal(t, 20, all.Entries[0].UnitPrice)
+	assert.Equal(t, 20, all.Entries[0].TotalCost)
+	assert.False(t, all.Entries[0].PriceEstimated)
+	assert.False(t, all.Entries[0].Date.IsZero())
+	assert.Empty(t, all.NextCursor)
+
+	cups := getPurchases(t, baseURL+"/api/purchases?item=cup&limit=1", token)
+	require.Len(t, cups.Entries, 1)
+	require.NotEmpty(t, cups.NextCursor)
+	nextCups := getPurchases(t, baseURL+"/api/purchases?item=cup&limit=1&cursor="+cups.NextCursor, token)
+	require.Len(t, nextCups.Entries, 1)
+	assert.Less(t, nextCups.Entries[0].ID, cups.Entries[0].ID)
+}
+
+// buyItem отправляет GET-запрос покупки на purchaseURL и проверяет успешный ответ
+func buyItem(t *testing.T, purchaseURL, token string) {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", purchaseURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+}
+
+// getPurchases отправляет GET-запрос на purchasesURL с указанным токеном и возвращает страницу покупок.
+func getPurchases(t *testing.T, purchasesURL, token string) models.PurchasesResponse {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", purchasesURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var purchasesResp models.PurchasesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&purchasesResp))
+	return purchasesResp
+}
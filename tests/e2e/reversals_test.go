@@ -0,0 +1,54 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestTransferReversal это сценарий где администратор отменяет мошеннический перевод, после которого
+// получатель успел потратить часть монет: отправителю возвращается остаток, а обе стороны видят
+// в истории, что перевод отменен
+func TestTransferReversal(t *testing.T) {
+	baseURL := newTestServer(t)
+	suffix := time.Now().UnixNano()
+	victim := fmt.Sprintf("victim%d", suffix)
+	fraudster := fmt.Sprintf("fraudster%d", suffix)
+	accomplice := fmt.Sprintf("accomplice%d", suffix)
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	victimToken := registerUser(t, baseURL+"/api/auth", victim, "password")
+	fraudsterToken := registerUser(t, baseURL+"/api/auth", fraudster, "password")
+	registerUser(t, baseURL+"/api/auth", accomplice, "password")
+
+	transferCoins(t, baseURL+"/api/sendCoin", victimToken, fraudster, 600)
+	transferCoins(t, baseURL+"/api/sendCoin", fraudsterToken, accomplice, 1200)
+	history := getHistory(t, baseURL+"/api/history?limit=1&direction=sent", victimToken)
+	require.Len(t, history.Entries, 1)
+	reverseURL := fmt.Sprintf("%s/api/admin/transfers/%d/reverse", baseURL, history.Entries[0].ID)
+
+	resp := apiRequest(t, "POST", reverseURL, fraudsterToken, models.ReversalRequest{Reason: "мошенничество"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = apiRequest(t, "POST", reverseURL, adminToken, models.ReversalRequest{Reason: "мошенничество"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reversal models.TransferReversal
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reversal))
+	assert.Equal(t, 600, reversal.Amount)
+	assert.Equal(t, 400, reversal.Returned)
+	assert.Equal(t, 800, getUserInfo(t, baseURL+"/api/info", victimToken).Coins)
+	assert.Zero(t, getUserInfo(t, baseURL+"/api/info", fraudsterToken).Coins)
+
+	resp = apiRequest(t, "POST", reverseURL, adminToken, models.ReversalRequest{Reason: "мошенничество"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	history = getHistory(t, baseURL+"/api/history?limit=2", victimToken)
+	require.Len(t, history.Entries, 2)
+	assert.Equal(t, models.TransactionReversal, history.Entries[0].Type)
+	assert.Equal(t, history.Entries[1].ID, history.Entries[0].ReversalOf)
+	assert.Equal(t, reversal.ID, history.Entries[1].ReversedBy)
+}
@@ -0,0 +1,35 @@
+package e2e
+
+import (
+	"avito_internship/internal/app"
+	"avito_internship/internal/config"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestServer возвращает адрес сервиса для e2e тестов.
+// Если задана переменная окружения API_URL, тесты идут во внешний сервис (docker-compose.test.yml),
+// иначе в процессе поднимается отдельный экземпляр приложения с хранилищем в памяти.
+func newTestServer(t *testing.T) string {
+	if apiURL, ok := os.LookupEnv("API_URL"); ok {
+		return apiURL
+	}
+	cfg := &config.Config{
+		Storage:              config.StorageMemory,
+		JWTSecret:            []byte("secret"),
+		AdminUsers:           []string{"admin"},
+		AdminOperationLimit:  10000,
+		StartingBalance:      1000,
+		PaymentRequestTTL:    time.Hour,
+		TransferMaxDelay:     time.Hour,
+		PurchaseReturnWindow: time.Hour,
+	}
+	a, err := app.New(cfg, app.Dependencies{})
+	require.NoError(t, err)
+	server := httptest.NewServer(a.Handler())
+	t.Cleanup(server.Close)
+	return server.URL
+}
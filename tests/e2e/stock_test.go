@@ -0,0 +1,78 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// getCatalogItem возвращает товар name из каталога /api/items
+func getCatalogItem(t *testing.T, baseURL, token, name string) models.CatalogItem {
+	resp := apiRequest(t, "GET", baseURL+"/api/items", token, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var catalog models.CatalogResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&catalog))
+	for _, item := range catalog.Items {
+		if item.Name == name {
+			return item
+		}
+	}
+	t.Fatalf("item %s not found in catalog", name)
+	return models.CatalogItem{}
+}
+
+// TestLimitedEditionItem это сценарий где администратор выпускает ограниченную партию товара с лимитом
+// на пользователя: покупатели упираются сначала в лимит, затем в остаток, а после пополнения снова могут купить
+func TestLimitedEditionItem(t *testing.T) {
+	baseURL := newTestServer(t)
+	first := fmt.Sprintf("stockFirst%d", time.Now().UnixNano())
+	second := fmt.Sprintf("stockSecond%d", time.Now().UnixNano())
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	firstToken := registerUser(t, baseURL+"/api/auth", first, "password")
+	secondToken := registerUser(t, baseURL+"/api/auth", second, "password")
+
+	stockURL := baseURL + "/api/admin/items/cup/stock"
+	resp := apiRequest(t, "PUT", stockURL, firstToken, models.ItemStockRequest{Stock: new(int)})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	stock := 3
+	resp = apiRequest(t, "PUT", stockURL, adminToken, models.ItemStockRequest{Stock: &stock, PerUserLimit: 2})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	item := getCatalogItem(t, baseURL, firstToken, "cup")
+	require.NotNil(t, item.Stock)
+	assert.Equal(t, 3, *item.Stock)
+	require.NotNil(t, item.UserRemaining)
+	assert.Equal(t, 2, *item.UserRemaining)
+	assert.Nil(t, getCatalogItem(t, baseURL, firstToken, "pen").Stock)
+
+	buyItem(t, baseURL+"/api/buy/cup?quantity=2", firstToken)
+	resp = apiRequest(t, "GET", baseURL+"/api/buy/cup", firstToken, nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	var stockErr models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stockErr))
+	assert.Equal(t, models.StockPurchaseLimit, stockErr.Code)
+
+	resp = apiRequest(t, "GET", baseURL+"/api/buy/cup?quantity=2", secondToken, nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stockErr))
+	assert.Equal(t, models.StockErrorResponse{
+		Errors: stockErr.Errors, Code: models.StockOutOfStock, Item: "cup", Available: 1,
+	}, stockErr)
+	assert.Equal(t, 1000, getUserInfo(t, baseURL+"/api/info", secondToken).Coins)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/items/cup/restock", adminToken, models.RestockRequest{Quantity: 4})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/items/pen/restock", adminToken, models.RestockRequest{Quantity: 4})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	buyItem(t, baseURL+"/api/buy/cup?quantity=2", secondToken)
+	item = getCatalogItem(t, baseURL, secondToken, "cup")
+	assert.Equal(t, 3, *item.Stock)
+	assert.Equal(t, 0, *item.UserRemaining)
+	assert.False(t, item.Available)
+}
@@ -14,7 +14,7 @@ import (
 // TestTransferCoins это сценарий где 3 пользователя регистрируются и начинают обмениваться монетами между собой.
 // После каждой транзакции проверка информации /api/info и сравнение с ожидаемыми данными
 func TestTransferCoinsAndInfo(t *testing.T) {
-	baseURL := "http://avito-shop-service-test:8080"
+	baseURL := newTestServer(t)
 	authURL := baseURL + "/api/auth"
 	infoURL := baseURL + "/api/info"
 	transferURL := baseURL + "/api/sendCoin"
@@ -49,7 +49,7 @@ func TestTransferCoinsAndInfo(t *testing.T) {
 	for _, u := range users {
 		info := getUserInfo(t, infoURL, tokens[u.Username])
 		assert.Equal(t, 1000, info.Coins)
-		assert.Empty(t, info.CoinHistory.Received)
+		assert.Equal(t, []models.CoinTransaction{welcomeGrant}, info.CoinHistory.Received)
 		assert.Empty(t, info.CoinHistory.Sent)
 	}
 
@@ -72,9 +72,9 @@ func TestTransferCoinsAndInfo(t *testing.T) {
 	assert.Equal(t, "userB", infoA.CoinHistory.Sent[0].User, "Отправленная транзакция у UserA должна быть на userB")
 	assert.Equal(t, 200, infoA.CoinHistory.Sent[0].Amount, "Сумма отправленной транзакции у UserA должна быть 200")
 
-	require.Len(t, infoB.CoinHistory.Received, 1, "UserB должен иметь 1 полученную транзакцию")
-	assert.Equal(t, "userA", infoB.CoinHistory.Received[0].User, "Полученная транзакция у UserB должна быть от userA")
-	assert.Equal(t, 200, infoB.CoinHistory.Received[0].Amount, "Сумма полученной транзакции у UserB должна быть 200")
+	require.Len(t, infoB.CoinHistory.Received, 2, "UserB должен иметь приветственное начисление и 1 полученную транзакцию")
+	assert.Equal(t, "userA", infoB.CoinHistory.Received[1].User, "Полученная транзакция у UserB должна быть от userA")
+	assert.Equal(t, 200, infoB.CoinHistory.Received[1].Amount, "Сумма полученной транзакции у UserB должна быть 200")
 
 	// Пользователь B отправляет 300 монет пользователю C
 	transferCoins(t, transferURL, tokens["userB"], "userC", 300)
@@ -95,9 +95,9 @@ func TestTransferCoinsAndInfo(t *testing.T) {
 	assert.Equal(t, "userC", infoB.CoinHistory.Sent[0].User, "Отправленная транзакция у UserB должна быть на userC")
 	assert.Equal(t, 300, infoB.CoinHistory.Sent[0].Amount, "Сумма отправленной транзакции у UserB должна быть 300")
 
-	require.Len(t, infoC.CoinHistory.Received, 1, "UserC должен иметь 1 полученную транзакцию")
-	assert.Equal(t, "userB", infoC.CoinHistory.Received[0].User, "Полученная транзакция у UserC должна быть от userB")
-	assert.Equal(t, 300, infoC.CoinHistory.Received[0].Amount, "Сумма полученной транзакции у UserC должна быть 300")
+	require.Len(t, infoC.CoinHistory.Received, 2, "UserC должен иметь приветственное начисление и 1 полученную транзакцию")
+	assert.Equal(t, "userB", infoC.CoinHistory.Received[1].User, "Полученная транзакция у UserC должна быть от userB")
+	assert.Equal(t, 300, infoC.CoinHistory.Received[1].Amount, "Сумма полученной транзакции у UserC должна быть 300")
 }
 
 // getUserInfo отправляет GET-запрос на infoURL с указанным токеном и возвращает полную информацию пользователя.
@@ -0,0 +1,65 @@
+package e2e
+
+import (
+	"avito_internship/internal/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestItemVariants это сценарий где администратор заводит размеры толстовки с отдельной ценой и остатком:
+// покупатель выбирает размер, видит его в инвентаре, упирается в остаток размера, а покупка
+// без варианта по-прежнему работает
+func TestItemVariants(t *testing.T) {
+	baseURL := newTestServer(t)
+	buyer := fmt.Sprintf("variantBuyer%d", time.Now().UnixNano())
+	adminToken := registerUser(t, baseURL+"/api/auth", "admin", "password")
+	buyerToken := registerUser(t, baseURL+"/api/auth", buyer, "password")
+
+	variantsURL := baseURL + "/api/admin/items/hoody/variants"
+	variant := models.ItemVariantRequest{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Price: 320, Stock: new(int),
+	}
+	*variant.Stock = 1
+	resp := apiRequest(t, "POST", variantsURL, buyerToken, variant)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = apiRequest(t, "POST", variantsURL, adminToken, variant)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "POST", variantsURL, adminToken, variant)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	item := getCatalogItem(t, baseURL, buyerToken, "hoody")
+	assert.Equal(t, []models.CatalogVariant{{
+		SKU: "hoody-m", Attributes: map[string]string{"size": "M"}, Price: 320, Stock: variant.Stock, Available: true,
+	}}, item.Variants)
+
+	buyItem(t, baseURL+"/api/buy/hoody?variant=hoody-m", buyerToken)
+	buyItem(t, baseURL+"/api/buy/hoody", buyerToken)
+	info := getUserInfo(t, baseURL+"/api/info", buyerToken)
+	assert.Equal(t, 1000-320-300, info.Coins)
+	assert.Equal(t, []models.Item{
+		{Type: "hoody", Quantity: 1},
+		{Type: "hoody", Variant: "hoody-m", Attributes: map[string]string{"size": "M"}, Quantity: 1},
+	}, info.Inventory)
+
+	resp = apiRequest(t, "GET", baseURL+"/api/buy/hoody?variant=hoody-m", buyerToken, nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	var stockErr models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stockErr))
+	assert.Equal(t, models.StockErrorResponse{
+		Errors: stockErr.Errors, Code: models.StockOutOfStock, Item: "hoody", Variant: "hoody-m",
+	}, stockErr)
+
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/variants/hoody-m/restock", adminToken,
+		models.RestockRequest{Quantity: 2})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = apiRequest(t, "POST", baseURL+"/api/admin/variants/yacht-s/restock", adminToken,
+		models.RestockRequest{Quantity: 2})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	buyItem(t, baseURL+"/api/buy/hoody?variant=hoody-m", buyerToken)
+	assert.Equal(t, 1, *getCatalogItem(t, baseURL, buyerToken, "hoody").Variants[0].Stock)
+}